@@ -12,6 +12,7 @@ import (
 	"path/filepath"
 	"runtime/debug"
 	"syscall"
+	"time"
 
 	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
 	"github.com/Azure/azure-sdk-for-go/sdk/azcore/cloud"
@@ -20,6 +21,7 @@ import (
 	ocmsdk "github.com/openshift-online/ocm-sdk-go"
 	"github.com/spf13/cobra"
 
+	"github.com/Azure/ARO-HCP/internal/api/arm"
 	"github.com/Azure/ARO-HCP/internal/database"
 )
 
@@ -29,6 +31,11 @@ var (
 	argCosmosURL          string
 	argClustersServiceURL string
 	argInsecure           bool
+	argMaintenance        bool
+
+	argSucceededOperationRetention time.Duration
+	argFailedOperationRetention    time.Duration
+	argWebhookSigningKey           string
 
 	processName = filepath.Base(os.Args[0])
 
@@ -59,6 +66,12 @@ func init() {
 	rootCmd.Flags().StringVar(&argCosmosURL, "cosmos-url", os.Getenv("DB_URL"), "Cosmos database URL")
 	rootCmd.Flags().StringVar(&argClustersServiceURL, "clusters-service-url", "https://api.openshift.com", "URL of the OCM API gateway")
 	rootCmd.Flags().BoolVar(&argInsecure, "insecure", false, "Skip validating TLS for clusters-service")
+	rootCmd.Flags().BoolVar(&argMaintenance, "maintenance", false, "Start in maintenance mode, in which no new operations are picked up. SIGUSR1 turns maintenance mode on and SIGUSR2 turns it off.")
+
+	rootCmd.Flags().DurationVar(&argSucceededOperationRetention, "succeeded-operation-retention", database.OperationRetention, "How long succeeded operations remain available")
+	rootCmd.Flags().DurationVar(&argFailedOperationRetention, "failed-operation-retention", database.OperationRetention, "How long failed operations remain available")
+
+	rootCmd.Flags().StringVar(&argWebhookSigningKey, "completion-webhook-signing-key", os.Getenv("COMPLETION_WEBHOOK_SIGNING_KEY"), "Key from which completion webhook secrets are derived, which must match the frontend's")
 
 	rootCmd.MarkFlagsRequiredTogether("cosmos-name", "cosmos-url")
 
@@ -106,6 +119,14 @@ func Run(cmd *cobra.Command, args []string) error {
 	handler := slog.NewJSONHandler(os.Stdout, nil)
 	logger := slog.New(handler)
 
+	operationRetention := database.OperationRetentionPolicy{
+		arm.ProvisioningStateSucceeded: argSucceededOperationRetention,
+		arm.ProvisioningStateFailed:    argFailedOperationRetention,
+	}
+	if err := operationRetention.Validate(); err != nil {
+		return err
+	}
+
 	// Create database client
 	dbClient, err := newCosmosDBClient()
 	if err != nil {
@@ -124,14 +145,34 @@ func Run(cmd *cobra.Command, args []string) error {
 	logger.Info(fmt.Sprintf("%s (%s) started", cmd.Short, cmd.Version))
 
 	operationsScanner := NewOperationsScanner(dbClient, ocmConnection)
+	operationsScanner.SetMaintenance(argMaintenance)
+	operationsScanner.SetOperationRetention(operationRetention)
+	operationsScanner.SetCompletionWebhookSigningKey([]byte(argWebhookSigningKey))
+	if argMaintenance {
+		logger.Info("Maintenance mode is on")
+	}
 
 	stop := make(chan struct{})
 	signalChannel := make(chan os.Signal, 1)
 	signal.Notify(signalChannel, syscall.SIGINT, syscall.SIGTERM)
 
+	// Maintenance mode can be toggled without restarting, so that
+	// in-flight operations keep being tracked while draining.
+	maintenanceChannel := make(chan os.Signal, 1)
+	signal.Notify(maintenanceChannel, syscall.SIGUSR1, syscall.SIGUSR2)
+
 	go operationsScanner.Run(logger, stop)
 
-	sig := <-signalChannel
+	var sig os.Signal
+	for sig == nil {
+		select {
+		case maintenanceSig := <-maintenanceChannel:
+			maintenance := maintenanceSig == syscall.SIGUSR1
+			operationsScanner.SetMaintenance(maintenance)
+			logger.Info(fmt.Sprintf("caught %s signal, maintenance mode is %t", maintenanceSig, maintenance))
+		case sig = <-signalChannel:
+		}
+	}
 	logger.Info(fmt.Sprintf("caught %s signal", sig))
 	close(stop)
 
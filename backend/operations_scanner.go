@@ -4,13 +4,20 @@ package main
 // Licensed under the Apache License 2.0.
 
 import (
+	"bytes"
 	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"log/slog"
 	"net/http"
 	"os"
+	"strconv"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	ocmsdk "github.com/openshift-online/ocm-sdk-go"
@@ -25,25 +32,94 @@ import (
 const (
 	defaultCosmosOperationsPollInterval = 30 * time.Second
 	defaultClusterServicePollInterval   = 10 * time.Second
+
+	// maxOperationAttempts is the number of transient failures after
+	// which an operation is given up on and marked as failed.
+	maxOperationAttempts = 5
+
+	// completionWebhookAttempts is the number of times a completion
+	// webhook is called before its failure is logged and given up on.
+	completionWebhookAttempts = 3
+
+	// completionWebhookTimeout bounds how long all attempts to call a
+	// single completion webhook may take.
+	completionWebhookTimeout = time.Minute
+
+	// HeaderNameWebhookTimestamp is the completion webhook request header
+	// holding the Unix time at which the request was signed.
+	HeaderNameWebhookTimestamp = "X-Aro-Webhook-Timestamp"
+
+	// HeaderNameWebhookSignature is the completion webhook request header
+	// holding "sha256=" followed by the hex-encoded HMAC-SHA256, keyed by
+	// the webhook secret, of the timestamp, a period and the request body.
+	HeaderNameWebhookSignature = "X-Aro-Webhook-Signature"
 )
 
+// completionWebhookBackoff is how long to wait before calling a completion
+// webhook again after its first failed call. The wait doubles with each
+// failure. This is a variable so tests can shorten it.
+var completionWebhookBackoff = 2 * time.Second
+
+// operationRetryBackoff is how long to wait before retrying an operation
+// after its first transient failure. The wait doubles with each failure.
+var operationRetryBackoff = 10 * time.Second
+
+// clusterServiceClient is the subset of the Cluster Service
+// client that the operations scanner uses.
+type clusterServiceClient interface {
+	GetCSClusterStatus(ctx context.Context, internalID ocm.InternalID) (*cmv1.ClusterStatus, error)
+}
+
 type OperationsScanner struct {
 	dbClient           database.DBClient
 	lockClient         *database.LockClient
-	clusterService     ocm.ClusterServiceClient
+	clusterService     clusterServiceClient
 	activeOperations   []*database.OperationDocument
 	notificationClient *http.Client
 	done               chan struct{}
+
+	// retryAfter holds, by operation ID, the time before which an
+	// operation that failed transiently is not polled again.
+	retryAfter map[string]time.Time
+
+	// maintenance, when set, stops the scanner from picking up new
+	// operations. Operations already being tracked are still polled
+	// so they can finish.
+	maintenance atomic.Bool
+
+	// webhookCalls tracks completion webhook calls in progress, which
+	// run in the background so that retries do not hold up polling.
+	webhookCalls sync.WaitGroup
+
+	// retention determines how long operations are kept once they
+	// reach a terminal state.
+	retention database.OperationRetentionPolicy
+
+	// webhookSigningKey is the key from which the secrets that sign
+	// completion webhook requests are derived.
+	webhookSigningKey []byte
 }
 
 func NewOperationsScanner(dbClient database.DBClient, ocmConnection *ocmsdk.Connection) *OperationsScanner {
 	return &OperationsScanner{
 		dbClient:           dbClient,
 		lockClient:         dbClient.GetLockClient(),
-		clusterService:     ocm.ClusterServiceClient{Conn: ocmConnection},
+		clusterService:     &ocm.ClusterServiceClient{Conn: ocmConnection},
 		activeOperations:   make([]*database.OperationDocument, 0),
-		notificationClient: http.DefaultClient,
+		notificationClient: newNotificationClient(),
 		done:               make(chan struct{}),
+		retryAfter:         make(map[string]time.Time),
+	}
+}
+
+// newNotificationClient returns a client for calling the endpoints that
+// customers register. Redirects are not followed, so that an endpoint
+// cannot send requests on to an address of its choosing.
+func newNotificationClient() *http.Client {
+	return &http.Client{
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
 	}
 }
 
@@ -91,10 +167,44 @@ func (s *OperationsScanner) Run(logger *slog.Logger, stop <-chan struct{}) {
 
 func (s *OperationsScanner) Join() {
 	<-s.done
+	s.webhookCalls.Wait()
+}
+
+// SetMaintenance turns maintenance mode on or off. While maintenance mode
+// is on, the scanner drains the operations it is already tracking without
+// picking up new ones.
+func (s *OperationsScanner) SetMaintenance(maintenance bool) {
+	s.maintenance.Store(maintenance)
+}
+
+// SetOperationRetention sets how long operations are kept after reaching
+// each terminal state. It must be called before Run.
+func (s *OperationsScanner) SetOperationRetention(policy database.OperationRetentionPolicy) {
+	s.retention = policy
+}
+
+// SetCompletionWebhookSigningKey sets the key from which the secrets that
+// sign completion webhook requests are derived. It must match the key the
+// frontend derives secrets from. It must be called before Run.
+func (s *OperationsScanner) SetCompletionWebhookSigningKey(key []byte) {
+	s.webhookSigningKey = key
+}
+
+// InMaintenance returns true if maintenance mode is on.
+func (s *OperationsScanner) InMaintenance() bool {
+	return s.maintenance.Load()
 }
 
 func (s *OperationsScanner) pollDBOperations(ctx context.Context, logger *slog.Logger) {
 	var activeOperations []*database.OperationDocument
+	var skippedOperations int
+
+	// In maintenance mode, only operations already being tracked are kept.
+	maintenance := s.InMaintenance()
+	trackedOperations := make(map[string]bool, len(s.activeOperations))
+	for _, doc := range s.activeOperations {
+		trackedOperations[doc.ID] = true
+	}
 
 	iterator := s.dbClient.ListAllOperationDocs(ctx)
 
@@ -107,9 +217,14 @@ func (s *OperationsScanner) pollDBOperations(ctx context.Context, logger *slog.L
 			continue
 		}
 
-		if !doc.Status.IsTerminal() {
-			activeOperations = append(activeOperations, doc)
+		if doc.Status.IsTerminal() {
+			continue
 		}
+		if maintenance && !trackedOperations[doc.ID] {
+			skippedOperations++
+			continue
+		}
+		activeOperations = append(activeOperations, doc)
 	}
 
 	err := iterator.GetError()
@@ -118,6 +233,9 @@ func (s *OperationsScanner) pollDBOperations(ctx context.Context, logger *slog.L
 		if len(s.activeOperations) > 0 {
 			logger.Info(fmt.Sprintf("Tracking %d active operations", len(s.activeOperations)))
 		}
+		if skippedOperations > 0 {
+			logger.Info(fmt.Sprintf("Maintenance mode: not picking up %d new operations", skippedOperations))
+		}
 	} else {
 		logger.Error(fmt.Sprintf("Error while paging through Cosmos query results: %s", err.Error()))
 	}
@@ -140,17 +258,26 @@ func (s *OperationsScanner) pollCSOperations(ctx context.Context, logger *slog.L
 				"resource_id", doc.ExternalID.String(),
 				"internal_id", doc.InternalID.String())
 
+			// Leave an operation alone while backing off from a failure.
+			if time.Now().Before(s.retryAfter[doc.ID]) {
+				activeOperations = append(activeOperations, doc)
+				continue
+			}
+
 			switch doc.InternalID.Kind() {
 			case cmv1.ClusterKind:
 				requeue, err = s.pollClusterOperation(ctx, opLogger, doc)
 			case cmv1.NodePoolKind:
 				requeue, err = s.pollNodePoolOperation(ctx, opLogger, doc)
 			}
-			if requeue {
-				activeOperations = append(activeOperations, doc)
-			}
 			if err != nil {
 				opLogger.Error(fmt.Sprintf("Error while polling operation '%s': %s", doc.ID, err.Error()))
+				requeue = s.retryOperation(ctx, opLogger, doc, err)
+			} else {
+				delete(s.retryAfter, doc.ID)
+			}
+			if requeue {
+				activeOperations = append(activeOperations, doc)
 			}
 		}
 	}
@@ -158,6 +285,71 @@ func (s *OperationsScanner) pollCSOperations(ctx context.Context, logger *slog.L
 	s.activeOperations = activeOperations
 }
 
+// isRetryableError returns true if an error encountered while tracking an
+// operation may be transient. Cluster Service errors other than throttling
+// and server errors are not expected to go away by themselves.
+func isRetryableError(err error) bool {
+	var ocmError *ocmerrors.Error
+	if errors.As(err, &ocmError) {
+		return ocmError.Status() == http.StatusTooManyRequests || ocmError.Status() >= http.StatusInternalServerError
+	}
+	// Errors without a response, such as network failures, are transient.
+	return true
+}
+
+// retryOperation records a failed attempt to track an operation and returns
+// true if the operation should be retried after a backoff. An operation that
+// fails with a non-retryable error, or that exhausts maxOperationAttempts, is
+// marked as failed instead.
+func (s *OperationsScanner) retryOperation(ctx context.Context, logger *slog.Logger, doc *database.OperationDocument, pollErr error) bool {
+	retryable := isRetryableError(pollErr)
+
+	// Count the attempt even if recording it fails, so
+	// the backoff below always follows a failed attempt.
+	failedAttempts := doc.FailedAttempts + 1
+	_, err := s.dbClient.UpdateOperationDoc(ctx, doc.ID, func(updateDoc *database.OperationDocument) bool {
+		updateDoc.FailedAttempts++
+		failedAttempts = updateDoc.FailedAttempts
+		return true
+	})
+	if err != nil {
+		logger.Error(fmt.Sprintf("Failed to record failed attempt for operation '%s': %s", doc.ID, err.Error()))
+	}
+	doc.FailedAttempts = failedAttempts
+
+	if retryable && doc.FailedAttempts < maxOperationAttempts {
+		backoff := operationRetryBackoff << (doc.FailedAttempts - 1)
+		if s.retryAfter == nil {
+			s.retryAfter = make(map[string]time.Time)
+		}
+		s.retryAfter[doc.ID] = time.Now().Add(backoff)
+		logger.Info(fmt.Sprintf("Retrying operation '%s' in %s after %d failed attempts", doc.ID, backoff, doc.FailedAttempts))
+		return true
+	}
+
+	if retryable {
+		logger.Error(fmt.Sprintf("Giving up on operation '%s' after %d failed attempts", doc.ID, doc.FailedAttempts))
+	} else {
+		logger.Error(fmt.Sprintf("Giving up on operation '%s' after a non-retryable error", doc.ID))
+	}
+
+	opError := &arm.CloudErrorBody{
+		Code:    arm.CloudErrorCodeInternalServerError,
+		Message: "The operation could not be completed due to an internal error.",
+	}
+	err = s.withSubscriptionLock(ctx, logger, doc.ExternalID.SubscriptionID, func(ctx context.Context) error {
+		return s.updateOperationStatus(ctx, logger, doc, arm.ProvisioningStateFailed, opError)
+	})
+	if err != nil {
+		// Try again on a later poll rather than leave the operation stuck.
+		logger.Error(fmt.Sprintf("Failed to mark operation '%s' as failed: %s", doc.ID, err.Error()))
+		return true
+	}
+
+	delete(s.retryAfter, doc.ID)
+	return false
+}
+
 func (s *OperationsScanner) pollClusterOperation(ctx context.Context, logger *slog.Logger, doc *database.OperationDocument) (bool, error) {
 	var requeue bool = true
 
@@ -195,6 +387,11 @@ func (s *OperationsScanner) pollNodePoolOperation(ctx context.Context, logger *s
 }
 
 func (s *OperationsScanner) withSubscriptionLock(ctx context.Context, logger *slog.Logger, subscriptionID string, fn func(ctx context.Context) error) error {
+	// A DBClient without lock support has no concurrent writers to exclude.
+	if s.lockClient == nil {
+		return fn(ctx)
+	}
+
 	timeout := s.lockClient.GetDefaultTimeToLive()
 	lock, err := s.lockClient.AcquireLock(ctx, subscriptionID, &timeout)
 	if err != nil {
@@ -218,7 +415,23 @@ func (s *OperationsScanner) withSubscriptionLock(ctx context.Context, logger *sl
 }
 
 func (s *OperationsScanner) deleteOperationCompleted(ctx context.Context, logger *slog.Logger, doc *database.OperationDocument) error {
-	err := s.dbClient.DeleteResourceDoc(ctx, doc.ExternalID)
+	// The completion webhook is registered on the resource
+	// document, so retrieve it before the document is gone.
+	var webhook *database.CompletionWebhook
+	resourceDoc, err := s.dbClient.GetResourceDoc(ctx, doc.ExternalID)
+	if err == nil {
+		webhook = resourceDoc.CompletionWebhook
+	} else if !errors.Is(err, database.ErrNotFound) {
+		return err
+	}
+
+	err = s.dbClient.DeleteResourceDoc(ctx, doc.ExternalID)
+	if err != nil {
+		return err
+	}
+
+	// Diagnostic settings do not outlive the resource they belong to.
+	err = s.dbClient.DeleteDiagnosticSettingsDoc(ctx, doc.ExternalID)
 	if err != nil {
 		return err
 	}
@@ -226,7 +439,11 @@ func (s *OperationsScanner) deleteOperationCompleted(ctx context.Context, logger
 	// Save a final "succeeded" operation status until TTL expires.
 	const opStatus arm.ProvisioningState = arm.ProvisioningStateSucceeded
 	updated, err := s.dbClient.UpdateOperationDoc(ctx, doc.ID, func(updateDoc *database.OperationDocument) bool {
-		return updateDoc.UpdateStatus(opStatus, nil)
+		if !updateDoc.UpdateStatus(opStatus, nil) {
+			return false
+		}
+		updateDoc.SetRetention(s.retention)
+		return true
 	})
 	if err != nil {
 		return err
@@ -234,6 +451,7 @@ func (s *OperationsScanner) deleteOperationCompleted(ctx context.Context, logger
 	if updated {
 		logger.Info(fmt.Sprintf("Updated Operations container item for '%s' with status '%s'", doc.ID, opStatus))
 		s.maybePostAsyncNotification(ctx, logger, doc)
+		s.maybeCallCompletionWebhook(logger, webhook, doc, opStatus, nil)
 	}
 
 	return nil
@@ -241,19 +459,27 @@ func (s *OperationsScanner) deleteOperationCompleted(ctx context.Context, logger
 
 func (s *OperationsScanner) updateOperationStatus(ctx context.Context, logger *slog.Logger, doc *database.OperationDocument, opStatus arm.ProvisioningState, opError *arm.CloudErrorBody) error {
 	updated, err := s.dbClient.UpdateOperationDoc(ctx, doc.ID, func(updateDoc *database.OperationDocument) bool {
-		return updateDoc.UpdateStatus(opStatus, opError)
+		if !updateDoc.UpdateStatus(opStatus, opError) {
+			return false
+		}
+		updateDoc.SetRetention(s.retention)
+		return true
 	})
 	if err != nil {
 		return err
 	}
-	if updated {
+	operationUpdated := updated
+	if operationUpdated {
 		logger.Info(fmt.Sprintf("Updated Operations container item for '%s' with status '%s'", doc.ID, opStatus))
 		s.maybePostAsyncNotification(ctx, logger, doc)
 	}
 
+	var webhook *database.CompletionWebhook
 	updated, err = s.dbClient.UpdateResourceDoc(ctx, doc.ExternalID, func(updateDoc *database.ResourceDocument) bool {
 		var updated bool
 
+		webhook = updateDoc.CompletionWebhook
+
 		if doc.ID == updateDoc.ActiveOperationID {
 			if opStatus != updateDoc.ProvisioningState {
 				updateDoc.ProvisioningState = opStatus
@@ -274,6 +500,10 @@ func (s *OperationsScanner) updateOperationStatus(ctx context.Context, logger *s
 		logger.Info(fmt.Sprintf("Updated Resources container item for '%s' with provisioning state '%s'", doc.ExternalID, opStatus))
 	}
 
+	if operationUpdated && opStatus.IsTerminal() {
+		s.maybeCallCompletionWebhook(logger, webhook, doc, opStatus, opError)
+	}
+
 	return nil
 }
 
@@ -300,13 +530,123 @@ func (s *OperationsScanner) postAsyncNotification(ctx context.Context, url strin
 	}
 
 	defer response.Body.Close()
-	if response.StatusCode >= 400 {
+	if response.StatusCode >= 300 {
 		return errors.New(response.Status)
 	}
 
 	return nil
 }
 
+// CompletionWebhookEvent is the body of a completion webhook request.
+type CompletionWebhookEvent struct {
+	ResourceID  string                    `json:"resourceId"`
+	OperationID string                    `json:"operationId"`
+	Request     database.OperationRequest `json:"request"`
+	Status      arm.ProvisioningState     `json:"status"`
+	Error       *arm.CloudErrorBody       `json:"error,omitempty"`
+	Time        time.Time                 `json:"time"`
+}
+
+// maybeCallCompletionWebhook calls the completion webhook, if any, with the
+// terminal state of an operation. The call is made in the background and is
+// retried on failure. Failures are logged but do not affect the operation.
+func (s *OperationsScanner) maybeCallCompletionWebhook(logger *slog.Logger, webhook *database.CompletionWebhook, doc *database.OperationDocument, opStatus arm.ProvisioningState, opError *arm.CloudErrorBody) {
+	if webhook == nil || webhook.URL == "" {
+		return
+	}
+
+	body, err := json.Marshal(CompletionWebhookEvent{
+		ResourceID:  doc.ExternalID.String(),
+		OperationID: doc.ID,
+		Request:     doc.Request,
+		Status:      opStatus,
+		Error:       opError,
+		Time:        time.Now().UTC(),
+	})
+	if err != nil {
+		logger.Error(fmt.Sprintf("Failed to marshal completion webhook event for operation '%s': %s", doc.ID, err.Error()))
+		return
+	}
+
+	s.webhookCalls.Add(1)
+	go func() {
+		defer s.webhookCalls.Done()
+
+		// The webhook call outlives the poll that triggered it.
+		ctx, cancel := context.WithTimeout(context.Background(), completionWebhookTimeout)
+		defer cancel()
+
+		backoff := completionWebhookBackoff
+		for attempt := 1; ; attempt++ {
+			retry, err := s.callCompletionWebhook(ctx, webhook, body)
+			if err == nil {
+				logger.Info(fmt.Sprintf("Called completion webhook for operation '%s'", doc.ID))
+				return
+			}
+			if !retry || attempt == completionWebhookAttempts {
+				logger.Error(fmt.Sprintf("Failed to call completion webhook for operation '%s' after %d attempts: %s", doc.ID, attempt, err.Error()))
+				return
+			}
+			logger.Warn(fmt.Sprintf("Failed to call completion webhook for operation '%s', retrying in %s: %s", doc.ID, backoff, err.Error()))
+
+			select {
+			case <-ctx.Done():
+				logger.Error(fmt.Sprintf("Gave up calling completion webhook for operation '%s': %s", doc.ID, ctx.Err()))
+				return
+			case <-time.After(backoff):
+			}
+			backoff *= 2
+		}
+	}()
+}
+
+// callCompletionWebhook makes a single call to a completion webhook. On
+// failure it also reports whether the failure is worth retrying.
+func (s *OperationsScanner) callCompletionWebhook(ctx context.Context, webhook *database.CompletionWebhook, body []byte) (bool, error) {
+	// A webhook registered for signing must not be called unsigned.
+	if webhook.KeyID != "" && len(s.webhookSigningKey) == 0 {
+		return false, errors.New("no signing key for completion webhook")
+	}
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, webhook.URL, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set(HeaderNameWebhookTimestamp, timestamp)
+	if webhook.KeyID != "" {
+		secret := database.CompletionWebhookSecret(s.webhookSigningKey, webhook.KeyID)
+		request.Header.Set(HeaderNameWebhookSignature, signCompletionWebhook(secret, timestamp, body))
+	}
+
+	response, err := s.notificationClient.Do(request)
+	if err != nil {
+		return true, err
+	}
+
+	defer response.Body.Close()
+	// Redirects are not followed, so they count as failures.
+	if response.StatusCode >= 300 {
+		retry := response.StatusCode >= 500 || response.StatusCode == http.StatusTooManyRequests
+		return retry, errors.New(response.Status)
+	}
+
+	return false, nil
+}
+
+// signCompletionWebhook returns the signature header value for a completion
+// webhook request. Signing the timestamp along with the body lets receivers
+// reject replayed requests.
+func signCompletionWebhook(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
 func convertClusterStatus(clusterStatus *cmv1.ClusterStatus, current arm.ProvisioningState) (arm.ProvisioningState, *arm.CloudErrorBody, error) {
 	var opStatus arm.ProvisioningState = current
 	var opError *arm.CloudErrorBody
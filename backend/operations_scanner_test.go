@@ -5,13 +5,20 @@ package main
 
 import (
 	"context"
+	"crypto/hmac"
+	"encoding/json"
 	"errors"
+	"io"
 	"log/slog"
 	"net/http"
 	"net/http/httptest"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	cmv1 "github.com/openshift-online/ocm-sdk-go/clustersmgmt/v1"
+	ocmerrors "github.com/openshift-online/ocm-sdk-go/errors"
 
 	"github.com/Azure/ARO-HCP/internal/api/arm"
 	"github.com/Azure/ARO-HCP/internal/database"
@@ -288,6 +295,528 @@ func TestUpdateOperationStatus(t *testing.T) {
 	}
 }
 
+func TestUpdateOperationStatusRetention(t *testing.T) {
+	ctx := context.Background()
+
+	resourceID, err := arm.ParseResourceID("/subscriptions/00000000-0000-0000-0000-000000000000/resourceGroups/testGroup/providers/Microsoft.RedHatOpenShift/hcpOpenShiftClusters/testCluster")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Placeholder InternalID for NewOperationDocument
+	internalID, err := ocm.NewInternalID("/api/clusters_mgmt/v1/clusters/placeholder")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	scanner := &OperationsScanner{
+		dbClient:           database.NewCache(),
+		notificationClient: http.DefaultClient,
+	}
+	scanner.SetOperationRetention(database.OperationRetentionPolicy{
+		arm.ProvisioningStateSucceeded: 24 * time.Hour,
+		arm.ProvisioningStateFailed:    30 * 24 * time.Hour,
+	})
+
+	err = scanner.dbClient.CreateResourceDoc(ctx, database.NewResourceDocument(resourceID))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// updateTTL moves a new operation to the given status and returns its TTL.
+	updateTTL := func(status arm.ProvisioningState) int32 {
+		operationDoc := database.NewOperationDocument(database.OperationRequestCreate, resourceID, internalID)
+		err := scanner.dbClient.CreateOperationDoc(ctx, operationDoc)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = scanner.updateOperationStatus(ctx, slog.Default(), operationDoc, status, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		operationDoc, err = scanner.dbClient.GetOperationDoc(ctx, operationDoc.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return operationDoc.TTL
+	}
+
+	provisioningTTL := updateTTL(arm.ProvisioningStateProvisioning)
+	succeededTTL := updateTTL(arm.ProvisioningStateSucceeded)
+	failedTTL := updateTTL(arm.ProvisioningStateFailed)
+
+	if provisioningTTL != 0 {
+		t.Errorf("expected no TTL for an operation in progress, got %d", provisioningTTL)
+	}
+	if expected := int32((24*time.Hour + database.OperationTombstoneRetention) / time.Second); succeededTTL != expected {
+		t.Errorf("expected TTL %d for a succeeded operation, got %d", expected, succeededTTL)
+	}
+	if failedTTL <= succeededTTL {
+		t.Errorf("expected a failed operation's TTL (%d) to exceed a succeeded one's (%d)", failedTTL, succeededTTL)
+	}
+}
+
+func TestCompletionWebhook(t *testing.T) {
+	const signingKey = "webhook-signing-key"
+	const keyID = "webhook-key-id"
+	secret := database.CompletionWebhookSecret([]byte(signingKey), keyID)
+
+	tests := []struct {
+		name             string
+		request          database.OperationRequest
+		currentStatus    arm.ProvisioningState
+		updatedStatus    arm.ProvisioningState
+		responseCodes    []int
+		expectedCalls    int
+		expectedStatus   arm.ProvisioningState
+		withoutWebhook   bool
+		completeDeletion bool
+	}{
+		{
+			name:           "Provisioning succeeded",
+			request:        database.OperationRequestCreate,
+			currentStatus:  arm.ProvisioningStateProvisioning,
+			updatedStatus:  arm.ProvisioningStateSucceeded,
+			expectedCalls:  1,
+			expectedStatus: arm.ProvisioningStateSucceeded,
+		},
+		{
+			name:           "Provisioning failed",
+			request:        database.OperationRequestCreate,
+			currentStatus:  arm.ProvisioningStateProvisioning,
+			updatedStatus:  arm.ProvisioningStateFailed,
+			expectedCalls:  1,
+			expectedStatus: arm.ProvisioningStateFailed,
+		},
+		{
+			name:          "Provisioning still in progress",
+			request:       database.OperationRequestCreate,
+			currentStatus: arm.ProvisioningStateAccepted,
+			updatedStatus: arm.ProvisioningStateProvisioning,
+			expectedCalls: 0,
+		},
+		{
+			name:          "Operation already terminal",
+			request:       database.OperationRequestCreate,
+			currentStatus: arm.ProvisioningStateSucceeded,
+			updatedStatus: arm.ProvisioningStateSucceeded,
+			expectedCalls: 0,
+		},
+		{
+			name:           "No webhook registered",
+			request:        database.OperationRequestCreate,
+			currentStatus:  arm.ProvisioningStateProvisioning,
+			updatedStatus:  arm.ProvisioningStateSucceeded,
+			withoutWebhook: true,
+			expectedCalls:  0,
+		},
+		{
+			name:           "Receiver recovers",
+			request:        database.OperationRequestCreate,
+			currentStatus:  arm.ProvisioningStateProvisioning,
+			updatedStatus:  arm.ProvisioningStateSucceeded,
+			responseCodes:  []int{http.StatusServiceUnavailable, http.StatusInternalServerError},
+			expectedCalls:  3,
+			expectedStatus: arm.ProvisioningStateSucceeded,
+		},
+		{
+			name:           "Receiver keeps failing",
+			request:        database.OperationRequestCreate,
+			currentStatus:  arm.ProvisioningStateProvisioning,
+			updatedStatus:  arm.ProvisioningStateSucceeded,
+			responseCodes:  []int{http.StatusBadGateway, http.StatusBadGateway, http.StatusBadGateway, http.StatusBadGateway},
+			expectedCalls:  completionWebhookAttempts,
+			expectedStatus: arm.ProvisioningStateSucceeded,
+		},
+		{
+			name:           "Receiver rejects the call",
+			request:        database.OperationRequestCreate,
+			currentStatus:  arm.ProvisioningStateProvisioning,
+			updatedStatus:  arm.ProvisioningStateSucceeded,
+			responseCodes:  []int{http.StatusBadRequest},
+			expectedCalls:  1,
+			expectedStatus: arm.ProvisioningStateSucceeded,
+		},
+		{
+			name:             "Deletion completed",
+			request:          database.OperationRequestDelete,
+			currentStatus:    arm.ProvisioningStateDeleting,
+			completeDeletion: true,
+			expectedCalls:    1,
+			expectedStatus:   arm.ProvisioningStateSucceeded,
+		},
+	}
+
+	defaultBackoff := completionWebhookBackoff
+	completionWebhookBackoff = time.Millisecond
+	t.Cleanup(func() { completionWebhookBackoff = defaultBackoff })
+
+	// Placeholder InternalID for NewOperationDocument
+	internalID, err := ocm.NewInternalID("/api/clusters_mgmt/v1/clusters/placeholder")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var mu sync.Mutex
+			var events []CompletionWebhookEvent
+
+			ctx := context.Background()
+
+			resourceID, err := arm.ParseResourceID("/subscriptions/00000000-0000-0000-0000-000000000000/resourceGroups/testGroup/providers/Microsoft.RedHatOpenShift/hcpOpenShiftClusters/testCluster")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// The stub receiver verifies each call's signature and
+			// responds with the given status codes in turn.
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				body, err := io.ReadAll(r.Body)
+				if err != nil {
+					t.Error(err)
+				}
+
+				expectedSignature := signCompletionWebhook(secret, r.Header.Get(HeaderNameWebhookTimestamp), body)
+				if !hmac.Equal([]byte(r.Header.Get(HeaderNameWebhookSignature)), []byte(expectedSignature)) {
+					t.Errorf("invalid webhook signature %q", r.Header.Get(HeaderNameWebhookSignature))
+				}
+
+				var event CompletionWebhookEvent
+				err = json.Unmarshal(body, &event)
+				if err != nil {
+					t.Error(err)
+				}
+
+				mu.Lock()
+				defer mu.Unlock()
+				events = append(events, event)
+				if len(events) <= len(tt.responseCodes) {
+					w.WriteHeader(tt.responseCodes[len(events)-1])
+				}
+			}))
+			defer server.Close()
+
+			scanner := &OperationsScanner{
+				dbClient:           database.NewCache(),
+				notificationClient: server.Client(),
+				webhookSigningKey:  []byte(signingKey),
+			}
+
+			operationDoc := database.NewOperationDocument(tt.request, resourceID, internalID)
+			operationDoc.Status = tt.currentStatus
+			err = scanner.dbClient.CreateOperationDoc(ctx, operationDoc)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			resourceDoc := database.NewResourceDocument(resourceID)
+			resourceDoc.ActiveOperationID = operationDoc.ID
+			if !tt.withoutWebhook {
+				resourceDoc.CompletionWebhook = &database.CompletionWebhook{URL: server.URL, KeyID: keyID}
+			}
+			err = scanner.dbClient.CreateResourceDoc(ctx, resourceDoc)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if tt.completeDeletion {
+				err = scanner.deleteOperationCompleted(ctx, slog.Default(), operationDoc)
+			} else {
+				err = scanner.updateOperationStatus(ctx, slog.Default(), operationDoc, tt.updatedStatus, nil)
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			scanner.webhookCalls.Wait()
+
+			mu.Lock()
+			defer mu.Unlock()
+
+			if len(events) != tt.expectedCalls {
+				t.Fatalf("expected %d webhook calls, got %d", tt.expectedCalls, len(events))
+			}
+			for _, event := range events {
+				if event.Status != tt.expectedStatus {
+					t.Errorf("expected status %s, got %s", tt.expectedStatus, event.Status)
+				}
+				if event.OperationID != operationDoc.ID {
+					t.Errorf("expected operation ID %s, got %s", operationDoc.ID, event.OperationID)
+				}
+				if !strings.EqualFold(event.ResourceID, resourceID.String()) {
+					t.Errorf("expected resource ID %s, got %s", resourceID, event.ResourceID)
+				}
+			}
+		})
+	}
+}
+
+func TestCallCompletionWebhookRefusesRedirect(t *testing.T) {
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("redirect was followed")
+	}))
+	defer target.Close()
+
+	server := httptest.NewServer(http.RedirectHandler(target.URL, http.StatusTemporaryRedirect))
+	defer server.Close()
+
+	scanner := &OperationsScanner{
+		notificationClient: newNotificationClient(),
+	}
+
+	retry, err := scanner.callCompletionWebhook(context.Background(), &database.CompletionWebhook{URL: server.URL}, []byte("{}"))
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	if retry {
+		t.Error("expected no retry")
+	}
+}
+
+func TestCallCompletionWebhookWithoutSigningKey(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("webhook was called unsigned")
+	}))
+	defer server.Close()
+
+	scanner := &OperationsScanner{
+		notificationClient: server.Client(),
+	}
+
+	_, err := scanner.callCompletionWebhook(context.Background(), &database.CompletionWebhook{URL: server.URL, KeyID: "webhook-key-id"}, []byte("{}"))
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+}
+
+func TestPollDBOperationsMaintenance(t *testing.T) {
+	ctx := context.Background()
+
+	resourceID, err := arm.ParseResourceID("/subscriptions/00000000-0000-0000-0000-000000000000/resourceGroups/testGroup/providers/Microsoft.RedHatOpenShift/hcpOpenShiftClusters/testCluster")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	internalID, err := ocm.NewInternalID("/api/clusters_mgmt/v1/clusters/placeholder")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	scanner := &OperationsScanner{
+		dbClient: database.NewCache(),
+	}
+
+	createOperation := func() *database.OperationDocument {
+		t.Helper()
+
+		doc := database.NewOperationDocument(database.OperationRequestCreate, resourceID, internalID)
+		err := scanner.dbClient.CreateOperationDoc(ctx, doc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return doc
+	}
+
+	trackedOperationIDs := func() map[string]bool {
+		ids := make(map[string]bool, len(scanner.activeOperations))
+		for _, doc := range scanner.activeOperations {
+			ids[doc.ID] = true
+		}
+		return ids
+	}
+
+	inFlight := createOperation()
+	scanner.pollDBOperations(ctx, slog.Default())
+	if tracked := trackedOperationIDs(); len(tracked) != 1 || !tracked[inFlight.ID] {
+		t.Fatalf("expected to track the in-flight operation, got %v", tracked)
+	}
+
+	// New operations are not picked up in maintenance mode,
+	// but the in-flight operation continues to be tracked.
+	scanner.SetMaintenance(true)
+	deferred := createOperation()
+	scanner.pollDBOperations(ctx, slog.Default())
+	if tracked := trackedOperationIDs(); len(tracked) != 1 || !tracked[inFlight.ID] {
+		t.Errorf("expected to track only the in-flight operation in maintenance mode, got %v", tracked)
+	}
+
+	// The in-flight operation drains once it finishes.
+	_, err = scanner.dbClient.UpdateOperationDoc(ctx, inFlight.ID, func(doc *database.OperationDocument) bool {
+		return doc.UpdateStatus(arm.ProvisioningStateSucceeded, nil)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	scanner.pollDBOperations(ctx, slog.Default())
+	if tracked := trackedOperationIDs(); len(tracked) != 0 {
+		t.Errorf("expected no tracked operations after draining, got %v", tracked)
+	}
+
+	// Deferred operations are picked up once maintenance mode is off.
+	scanner.SetMaintenance(false)
+	scanner.pollDBOperations(ctx, slog.Default())
+	if tracked := trackedOperationIDs(); len(tracked) != 1 || !tracked[deferred.ID] {
+		t.Errorf("expected to track the deferred operation after maintenance, got %v", tracked)
+	}
+}
+
+// fakeClusterService returns the given errors from successive
+// calls before reporting the cluster as ready.
+type fakeClusterService struct {
+	errs  []error
+	calls int
+}
+
+func (f *fakeClusterService) GetCSClusterStatus(ctx context.Context, internalID ocm.InternalID) (*cmv1.ClusterStatus, error) {
+	f.calls++
+	if len(f.errs) > 0 {
+		err := f.errs[0]
+		f.errs = f.errs[1:]
+		return nil, err
+	}
+	return cmv1.NewClusterStatus().State(cmv1.ClusterStateReady).Build()
+}
+
+func TestPollCSOperationsRetry(t *testing.T) {
+	badRequest, err := ocmerrors.NewError().Status(http.StatusBadRequest).Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	unavailable, err := ocmerrors.NewError().Status(http.StatusServiceUnavailable).Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name                 string
+		errs                 []error
+		expectPolls          int
+		expectFailedAttempts int
+		expectStatus         arm.ProvisioningState
+	}{
+		{
+			name:                 "Transient failures then success",
+			errs:                 []error{unavailable, errors.New("connection reset")},
+			expectPolls:          3,
+			expectFailedAttempts: 2,
+			expectStatus:         arm.ProvisioningStateSucceeded,
+		},
+		{
+			name:                 "Non-retryable failure",
+			errs:                 []error{badRequest},
+			expectPolls:          1,
+			expectFailedAttempts: 1,
+			expectStatus:         arm.ProvisioningStateFailed,
+		},
+		{
+			name:                 "Transient failures exhaust attempts",
+			errs:                 []error{unavailable, unavailable, unavailable, unavailable, unavailable, unavailable},
+			expectPolls:          maxOperationAttempts,
+			expectFailedAttempts: maxOperationAttempts,
+			expectStatus:         arm.ProvisioningStateFailed,
+		},
+	}
+
+	defer func(backoff time.Duration) { operationRetryBackoff = backoff }(operationRetryBackoff)
+	operationRetryBackoff = 0
+
+	internalID, err := ocm.NewInternalID("/api/clusters_mgmt/v1/clusters/placeholder")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+
+			resourceID, err := arm.ParseResourceID("/subscriptions/00000000-0000-0000-0000-000000000000/resourceGroups/testGroup/providers/Microsoft.RedHatOpenShift/hcpOpenShiftClusters/testCluster")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			clusterService := &fakeClusterService{errs: tt.errs}
+			scanner := &OperationsScanner{
+				dbClient:       database.NewCache(),
+				clusterService: clusterService,
+			}
+
+			operationDoc := database.NewOperationDocument(database.OperationRequestCreate, resourceID, internalID)
+			_ = scanner.dbClient.CreateOperationDoc(ctx, operationDoc)
+
+			resourceDoc := database.NewResourceDocument(resourceID)
+			resourceDoc.ActiveOperationID = operationDoc.ID
+			_ = scanner.dbClient.CreateResourceDoc(ctx, resourceDoc)
+
+			for range 10 {
+				scanner.pollDBOperations(ctx, slog.Default())
+				scanner.pollCSOperations(ctx, slog.Default(), nil)
+			}
+
+			if clusterService.calls != tt.expectPolls {
+				t.Errorf("Expected %d polls but got %d", tt.expectPolls, clusterService.calls)
+			}
+
+			operationDoc, err = scanner.dbClient.GetOperationDoc(ctx, operationDoc.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if operationDoc.FailedAttempts != tt.expectFailedAttempts {
+				t.Errorf("Expected %d failed attempts but got %d", tt.expectFailedAttempts, operationDoc.FailedAttempts)
+			}
+			if operationDoc.Status != tt.expectStatus {
+				t.Errorf("Expected operation status to be %s but got %s", tt.expectStatus, operationDoc.Status)
+			}
+		})
+	}
+}
+
+// failingOperationUpdateDBClient fails every operation document update.
+type failingOperationUpdateDBClient struct {
+	database.DBClient
+}
+
+func (c *failingOperationUpdateDBClient) UpdateOperationDoc(ctx context.Context, operationID string, callback func(*database.OperationDocument) bool) (bool, error) {
+	return false, errors.New("database unavailable")
+}
+
+func TestRetryOperationRecordFailure(t *testing.T) {
+	defer func(backoff time.Duration) { operationRetryBackoff = backoff }(operationRetryBackoff)
+	operationRetryBackoff = time.Hour
+
+	resourceID, err := arm.ParseResourceID("/subscriptions/00000000-0000-0000-0000-000000000000/resourceGroups/testGroup/providers/Microsoft.RedHatOpenShift/hcpOpenShiftClusters/testCluster")
+	if err != nil {
+		t.Fatal(err)
+	}
+	internalID, err := ocm.NewInternalID("/api/clusters_mgmt/v1/clusters/placeholder")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	scanner := &OperationsScanner{
+		dbClient: &failingOperationUpdateDBClient{DBClient: database.NewCache()},
+	}
+
+	operationDoc := database.NewOperationDocument(database.OperationRequestCreate, resourceID, internalID)
+
+	for attempt := 1; attempt <= 2; attempt++ {
+		start := time.Now()
+		if !scanner.retryOperation(context.Background(), slog.Default(), operationDoc, errors.New("connection reset")) {
+			t.Fatalf("Expected attempt %d to be retried", attempt)
+		}
+
+		if operationDoc.FailedAttempts != attempt {
+			t.Errorf("Expected %d failed attempts but got %d", attempt, operationDoc.FailedAttempts)
+		}
+		expectBackoff := operationRetryBackoff << (attempt - 1)
+		if backoff := scanner.retryAfter[operationDoc.ID].Sub(start); backoff < expectBackoff || backoff > expectBackoff+time.Minute {
+			t.Errorf("Expected a backoff of %s but got %s", expectBackoff, backoff)
+		}
+	}
+}
+
 func TestConvertClusterStatus(t *testing.T) {
 	// FIXME These tests are all tentative until the new "/api/aro_hcp/v1" OCM
 	//       API is available. What's here now is a best guess at converting
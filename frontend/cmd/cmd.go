@@ -2,13 +2,14 @@ package cmd
 
 import (
 	"context"
-	"errors"
 	"fmt"
 	"net"
 	"os"
 	"os/signal"
 	"runtime/debug"
+	"strings"
 	"syscall"
+	"time"
 
 	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
 	"github.com/Azure/azure-sdk-for-go/sdk/azcore/cloud"
@@ -36,6 +37,38 @@ type FrontendOpts struct {
 	metricsPort int
 	port        int
 
+	defaultPageSize int32
+	maxPageSize     int32
+	maxNodePools    int
+	maxClusters     int
+
+	minNodePoolReplicas int32
+
+	maxOperationWait      time.Duration
+	maxOperationWaiters   int
+	maxHeaderBytes        int
+	maxURLLength          int
+	maxBodyBytes          int64
+	contentEncodings      []string
+	shutdownGracePeriod   time.Duration
+	synchronousOperations bool
+
+	subscriptionWriteRetries    int
+	subscriptionWriteBackoff    time.Duration
+	healthCheckTimeout          time.Duration
+	subscriptionMetricsInterval time.Duration
+	subscriptionRetention       time.Duration
+	subscriptionReapInterval    time.Duration
+	dbCircuitBreakerThreshold   int
+	dbCircuitBreakerCooldown    time.Duration
+	subscriptionRateLimit       float64
+	subscriptionRateBurst       int
+	identityURLHostSuffixes     []string
+	globalPreviewFeatures       []string
+	adminTokens                 []string
+	completionWebhookSigningKey string
+	supportedLocations          []string
+
 	useCache   bool
 	cosmosName string
 	cosmosURL  string
@@ -67,6 +100,34 @@ func NewRootCmd() *cobra.Command {
 	rootCmd.Flags().StringVar(&opts.location, "location", os.Getenv("LOCATION"), "Azure location")
 	rootCmd.Flags().IntVar(&opts.port, "port", 8443, "port to listen on")
 	rootCmd.Flags().IntVar(&opts.metricsPort, "metrics-port", 8081, "port to serve metrics on")
+	rootCmd.Flags().Int32Var(&opts.defaultPageSize, "default-page-size", frontend.DefaultPageSize, "number of items in a page of a resource list when $top is absent")
+	rootCmd.Flags().Int32Var(&opts.maxPageSize, "max-page-size", frontend.MaxPageSize, "maximum number of items in a page of a resource list")
+	rootCmd.Flags().IntVar(&opts.maxNodePools, "max-node-pools", frontend.DefaultMaxNodePools, "maximum number of node pools per cluster")
+	rootCmd.Flags().IntVar(&opts.maxClusters, "max-clusters", frontend.DefaultMaxClusters, "maximum number of clusters per subscription, or 0 for no limit")
+	rootCmd.Flags().Int32Var(&opts.minNodePoolReplicas, "min-node-pool-replicas", frontend.DefaultMinNodePoolReplicas, "number of replicas below which node pool updates may not shrink a node pool without an override, or 0 to allow any shrink")
+	rootCmd.Flags().DurationVar(&opts.maxOperationWait, "max-operation-wait", frontend.MaxOperationWait, "maximum time an operation result request may wait for the operation to finish")
+	rootCmd.Flags().IntVar(&opts.maxOperationWaiters, "max-operation-waiters", frontend.DefaultMaxOperationWaiters, "maximum number of operation result requests that may wait concurrently")
+	rootCmd.Flags().IntVar(&opts.maxHeaderBytes, "max-header-bytes", frontend.DefaultMaxHeaderBytes, "maximum total size in bytes of request headers")
+	rootCmd.Flags().IntVar(&opts.maxURLLength, "max-url-length", frontend.DefaultMaxURLLength, "maximum length in bytes of request URLs")
+	rootCmd.Flags().Int64Var(&opts.maxBodyBytes, "max-body-bytes", frontend.DefaultMaxBodyBytes, "maximum size in bytes of request bodies")
+	rootCmd.Flags().StringSliceVar(&opts.contentEncodings, "content-encodings", frontend.DefaultContentEncodings(), "content encodings besides identity that request bodies may be sent in")
+	rootCmd.Flags().DurationVar(&opts.shutdownGracePeriod, "shutdown-grace-period", frontend.DefaultShutdownGracePeriod, "maximum time to wait for in-flight requests to finish when shutting down")
+	rootCmd.Flags().IntVar(&opts.subscriptionWriteRetries, "subscription-write-retries", frontend.DefaultSubscriptionWriteRetries, "number of times to retry a subscription write that conflicts with a concurrent write")
+	rootCmd.Flags().DurationVar(&opts.subscriptionWriteBackoff, "subscription-write-backoff", frontend.DefaultSubscriptionWriteBackoff, "base delay before retrying a conflicting subscription write")
+	rootCmd.Flags().Float64Var(&opts.subscriptionRateLimit, "subscription-rate-limit", frontend.DefaultSubscriptionRateLimit, "average number of requests per second allowed from each subscription")
+	rootCmd.Flags().IntVar(&opts.subscriptionRateBurst, "subscription-rate-burst", frontend.DefaultSubscriptionRateBurst, "number of requests a subscription may send at once above its average rate")
+	rootCmd.Flags().DurationVar(&opts.healthCheckTimeout, "health-check-timeout", frontend.DefaultHealthCheckTimeout, "maximum time a health check waits for the database to respond")
+	rootCmd.Flags().DurationVar(&opts.subscriptionMetricsInterval, "subscription-metrics-interval", frontend.DefaultSubscriptionMetricsInterval, "how often subscriptions are counted by state for metrics")
+	rootCmd.Flags().DurationVar(&opts.subscriptionRetention, "subscription-retention", frontend.DefaultSubscriptionRetention, "how long the document of a deleted subscription is kept for auditing")
+	rootCmd.Flags().DurationVar(&opts.subscriptionReapInterval, "subscription-reap-interval", frontend.DefaultSubscriptionReapInterval, "how often the documents of deleted subscriptions past their retention are removed")
+	rootCmd.Flags().IntVar(&opts.dbCircuitBreakerThreshold, "db-circuit-breaker-threshold", frontend.DefaultDBCircuitBreakerThreshold, "consecutive database failures after which requests are rejected until the cooldown elapses")
+	rootCmd.Flags().DurationVar(&opts.dbCircuitBreakerCooldown, "db-circuit-breaker-cooldown", frontend.DefaultDBCircuitBreakerCooldown, "time requests are rejected after consecutive database failures")
+	rootCmd.Flags().StringSliceVar(&opts.identityURLHostSuffixes, "identity-url-host-suffixes", frontend.DefaultIdentityURLHostSuffixes(), "allowed host suffixes of the managed identity URL on cluster creates and updates, or empty to not require the URL")
+	rootCmd.Flags().StringSliceVar(&opts.globalPreviewFeatures, "global-preview-features", nil, "preview features to enable for every subscription, whether or not it registered them")
+	rootCmd.Flags().StringSliceVar(&opts.adminTokens, "admin-tokens", strings.FieldsFunc(os.Getenv("ADMIN_TOKENS"), func(r rune) bool { return r == ',' }), "bearer tokens authorizing requests to the admin routes, or empty to disable the admin routes")
+	rootCmd.Flags().StringVar(&opts.completionWebhookSigningKey, "completion-webhook-signing-key", os.Getenv("COMPLETION_WEBHOOK_SIGNING_KEY"), "key from which completion webhook secrets are derived, or empty to register completion webhooks unsigned")
+	rootCmd.Flags().StringSliceVar(&opts.supportedLocations, "supported-locations", nil, "Azure locations that requests may target, or empty for only the frontend's own location")
+	rootCmd.Flags().BoolVar(&opts.synchronousOperations, "synchronous-operations", false, "Complete create and delete operations inline, for testing purposes")
 
 	rootCmd.Flags().StringVar(&opts.clustersServiceURL, "clusters-service-url", "https://api.openshift.com", "URL of the OCM API gateway.")
 	rootCmd.Flags().BoolVar(&opts.insecure, "insecure", false, "Skip validating TLS for clusters-service.")
@@ -154,12 +215,44 @@ func (opts *FrontendOpts) Run() error {
 		csClient.ProvisionShardID = api.Ptr(opts.clusterServiceProvisionShard)
 	}
 
-	if len(opts.location) == 0 {
-		return errors.New("location is required")
+	frontendConfig := frontend.Config{
+		Location:              opts.location,
+		DefaultPageSize:       opts.defaultPageSize,
+		MaxPageSize:           opts.maxPageSize,
+		MaxNodePools:          opts.maxNodePools,
+		MaxClusters:           opts.maxClusters,
+		MinNodePoolReplicas:   opts.minNodePoolReplicas,
+		MaxOperationWait:      opts.maxOperationWait,
+		MaxOperationWaiters:   opts.maxOperationWaiters,
+		MaxHeaderBytes:        opts.maxHeaderBytes,
+		MaxURLLength:          opts.maxURLLength,
+		MaxBodyBytes:          opts.maxBodyBytes,
+		ContentEncodings:      opts.contentEncodings,
+		ShutdownGracePeriod:   opts.shutdownGracePeriod,
+		SynchronousOperations: opts.synchronousOperations,
+
+		SubscriptionWriteRetries:    opts.subscriptionWriteRetries,
+		SubscriptionWriteBackoff:    opts.subscriptionWriteBackoff,
+		HealthCheckTimeout:          opts.healthCheckTimeout,
+		SubscriptionMetricsInterval: opts.subscriptionMetricsInterval,
+		SubscriptionRetention:       opts.subscriptionRetention,
+		SubscriptionReapInterval:    opts.subscriptionReapInterval,
+		DBCircuitBreakerThreshold:   opts.dbCircuitBreakerThreshold,
+		DBCircuitBreakerCooldown:    opts.dbCircuitBreakerCooldown,
+		SubscriptionRateLimit:       opts.subscriptionRateLimit,
+		SubscriptionRateBurst:       opts.subscriptionRateBurst,
+		IdentityURLHostSuffixes:     opts.identityURLHostSuffixes,
+		GlobalPreviewFeatures:       opts.globalPreviewFeatures,
+		AdminTokens:                 opts.adminTokens,
+		CompletionWebhookSigningKey: opts.completionWebhookSigningKey,
+		SupportedLocations:          opts.supportedLocations,
 	}
-	logger.Info(fmt.Sprintf("Application running in %s", opts.location))
 
-	f := frontend.NewFrontend(logger, listener, metricsListener, prometheusEmitter, dbClient, opts.location, &csClient)
+	f, err := frontend.NewFrontend(frontendConfig, logger, listener, metricsListener, prometheusEmitter, dbClient, &csClient)
+	if err != nil {
+		return err
+	}
+	logger.Info(fmt.Sprintf("Application running in %s", opts.location))
 
 	stop := make(chan struct{})
 	signalChannel := make(chan os.Signal, 1)
@@ -0,0 +1,818 @@
+package frontend
+
+// Copyright (c) Microsoft Corporation.
+// Licensed under the Apache License 2.0.
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+	cmv1 "github.com/openshift-online/ocm-sdk-go/clustersmgmt/v1"
+
+	"github.com/Azure/ARO-HCP/internal/api"
+	"github.com/Azure/ARO-HCP/internal/api/arm"
+	"github.com/Azure/ARO-HCP/internal/database"
+	"github.com/Azure/ARO-HCP/internal/ocm"
+)
+
+// SubscriptionStateBatchRequest is the request body for bulk transitioning
+// subscriptions to a new state, such as during a migration.
+type SubscriptionStateBatchRequest struct {
+	SubscriptionIDs []string              `json:"subscriptionIds"`
+	State           arm.SubscriptionState `json:"state"`
+
+	// Force suppresses the warnings about clusters still owned by
+	// subscriptions transitioning to Deleted. Their clusters are
+	// deleted either way.
+	Force bool `json:"force,omitempty"`
+}
+
+// SubscriptionStateBatchResult is the outcome of transitioning a single
+// subscription. Error is set if the transition was not applied.
+type SubscriptionStateBatchResult struct {
+	SubscriptionID string                `json:"subscriptionId"`
+	PreviousState  arm.SubscriptionState `json:"previousState,omitempty"`
+	State          arm.SubscriptionState `json:"state,omitempty"`
+	Error          *arm.CloudErrorBody   `json:"error,omitempty"`
+
+	// RemainingClusters describes the clusters which a deleted
+	// subscription still owned, unless the request was forced.
+	RemainingClusters *ClusterDeletionProgress `json:"remainingClusters,omitempty"`
+	Warning           string                   `json:"warning,omitempty"`
+}
+
+// SubscriptionStateBatchResponse is the response body for bulk transitioning
+// subscriptions, with one result per requested subscription in request order.
+type SubscriptionStateBatchResponse struct {
+	Value []SubscriptionStateBatchResult `json:"value"`
+}
+
+// AdminSubscriptionStateBatch applies a subscription state transition to each
+// subscription in the request. A failure for one subscription does not stop
+// the remaining subscriptions from being transitioned.
+func (f *Frontend) AdminSubscriptionStateBatch(writer http.ResponseWriter, request *http.Request) {
+	ctx := request.Context()
+	logger := LoggerFromContext(ctx)
+
+	body, err := BodyFromContext(ctx)
+	if err != nil {
+		logger.Error(err.Error())
+		arm.WriteInternalServerError(writer)
+		return
+	}
+
+	var batchRequest SubscriptionStateBatchRequest
+	err = json.Unmarshal(body, &batchRequest)
+	if err != nil {
+		logger.Error(err.Error())
+		arm.WriteInvalidRequestContentError(writer, err)
+		return
+	}
+
+	if len(batchRequest.SubscriptionIDs) == 0 {
+		arm.WriteError(writer, http.StatusBadRequest,
+			arm.CloudErrorCodeInvalidRequestContent, "subscriptionIds",
+			"Missing required field 'subscriptionIds'")
+		return
+	}
+
+	err = validate.Var(batchRequest.State, "required,enum_subscriptionstate")
+	if err != nil {
+		arm.WriteError(writer, http.StatusBadRequest,
+			arm.CloudErrorCodeInvalidRequestContent, "state",
+			"Invalid value '%s' for field 'state'", batchRequest.State)
+		return
+	}
+
+	response := SubscriptionStateBatchResponse{
+		Value: make([]SubscriptionStateBatchResult, 0, len(batchRequest.SubscriptionIDs)),
+	}
+
+	for _, subscriptionID := range batchRequest.SubscriptionIDs {
+		result := SubscriptionStateBatchResult{SubscriptionID: subscriptionID}
+
+		cloudError := f.transitionSubscriptionState(ctx, subscriptionID, batchRequest.State, batchRequest.Force, &result)
+		if cloudError != nil {
+			logger.Warn(fmt.Sprintf("failed to transition subscription %s: %s", subscriptionID, cloudError.Error()))
+			result.Error = cloudError.CloudErrorBody
+		}
+
+		response.Value = append(response.Value, result)
+	}
+
+	_, err = arm.WriteJSONResponse(writer, http.StatusOK, response)
+	if err != nil {
+		logger.Error(err.Error())
+	}
+}
+
+// transitionSubscriptionState moves a single subscription to the target
+// state, recording the previous and new states in result.
+func (f *Frontend) transitionSubscriptionState(ctx context.Context, subscriptionID string, state arm.SubscriptionState, force bool, result *SubscriptionStateBatchResult) *arm.CloudError {
+	logger := LoggerFromContext(ctx)
+
+	if uuid.Validate(subscriptionID) != nil {
+		return arm.NewCloudError(http.StatusBadRequest,
+			arm.CloudErrorCodeInvalidSubscriptionID,
+			"/subscriptions/"+subscriptionID,
+			"The provided subscription identifier '%s' is malformed or invalid.",
+			subscriptionID)
+	}
+
+	var transitionError *arm.CloudError
+
+	_, err := f.dbClient.UpdateSubscriptionDoc(ctx, subscriptionID, func(doc *database.SubscriptionDocument) bool {
+		// The callback may be retried, so reset any earlier outcome.
+		transitionError = nil
+		result.PreviousState = doc.Subscription.State
+		if !doc.Subscription.State.CanTransitionTo(state) {
+			transitionError = arm.NewCloudError(http.StatusConflict,
+				arm.CloudErrorCodeInvalidSubscriptionState,
+				"/subscriptions/"+subscriptionID,
+				"Subscription '%s' cannot transition from state '%s' to '%s'.",
+				subscriptionID, doc.Subscription.State, state)
+			return false
+		}
+		if doc.Subscription.State == state {
+			return false
+		}
+		doc.Subscription.State = state
+		return true
+	})
+	if errors.Is(err, database.ErrNotFound) {
+		resourceID, err := arm.ParseResourceID("/subscriptions/" + subscriptionID)
+		if err != nil {
+			logger.Error(err.Error())
+			return arm.NewInternalServerError()
+		}
+		return arm.NewResourceNotFoundError(resourceID)
+	} else if err != nil {
+		logger.Error(err.Error())
+		return arm.NewInternalServerError()
+	} else if transitionError != nil {
+		return transitionError
+	}
+
+	result.State = state
+	logger.Info(fmt.Sprintf("transitioned subscription %s from %s to %s", subscriptionID, result.PreviousState, state))
+
+	if result.PreviousState != state {
+		f.audit(ctx, AuditActionSubscriptionStateChange,
+			slog.String("subscription_id", subscriptionID),
+			slog.String("previous_state", string(result.PreviousState)),
+			slog.String("state", string(state)))
+	}
+
+	f.metrics.EmitGauge("subscription_lifecycle", 1, map[string]string{
+		"location":       f.config.Location,
+		"subscriptionid": subscriptionID,
+		"state":          string(state),
+	})
+
+	// Retain the subscription document for auditing but clean up
+	// resources when the subscription becomes deleted. Repeating
+	// the transition for a deleted subscription does nothing more.
+	if state == arm.SubscriptionStateDeleted && result.PreviousState != state {
+		err = f.dbClient.SoftDeleteSubscriptionDoc(ctx, subscriptionID)
+		if err != nil {
+			logger.Error(err.Error())
+			return arm.NewInternalServerError()
+		}
+		progress, cloudError := f.DeleteAllResources(ctx, subscriptionID)
+		if cloudError != nil {
+			return cloudError
+		}
+
+		if warning := remainingClustersWarning(subscriptionID, progress); warning != "" && !force {
+			result.RemainingClusters = progress
+			result.Warning = warning
+		}
+	}
+
+	return nil
+}
+
+// AdminSubscriptionList streams every subscription document as newline-delimited
+// JSON for operator tools reconciling subscription state. Documents are read and
+// flushed to the client a page at a time so the full set is never buffered, and
+// enumeration stops as soon as the client goes away.
+func (f *Frontend) AdminSubscriptionList(writer http.ResponseWriter, request *http.Request) {
+	ctx := request.Context()
+	logger := LoggerFromContext(ctx)
+
+	pageSize, _ := f.pageSizes()
+
+	controller := http.NewResponseController(writer)
+	encoder := json.NewEncoder(writer)
+
+	var continuationToken string
+	var started bool
+
+	for {
+		docs, nextToken, err := f.dbClient.ListSubscriptionDocs(ctx, continuationToken, int(pageSize))
+		if err != nil {
+			// A cancelled request is not an error.
+			if ctx.Err() != nil {
+				return
+			}
+			if !started {
+				arm.WriteCloudError(writer, toCloudError(ctx, err, nil))
+				return
+			}
+			// Too late for an error response, so abort the connection
+			// rather than let a truncated stream pass for a complete one.
+			logger.Error(err.Error())
+			panic(http.ErrAbortHandler)
+		}
+
+		if !started {
+			writer.Header().Set("Content-Type", "application/x-ndjson")
+			writer.WriteHeader(http.StatusOK)
+			started = true
+		}
+
+		for _, doc := range docs {
+			err = encoder.Encode(doc)
+			if err != nil {
+				logger.Error(err.Error())
+				return
+			}
+		}
+
+		err = controller.Flush()
+		if err != nil {
+			logger.Error(err.Error())
+			return
+		}
+
+		if nextToken == "" || ctx.Err() != nil {
+			return
+		}
+		continuationToken = nextToken
+	}
+}
+
+// AdminOperationStatus is the admin view of an operation, which includes
+// the full progression of the operation's status.
+type AdminOperationStatus struct {
+	ID                 string                    `json:"id"`
+	Request            database.OperationRequest `json:"request"`
+	ExternalID         *arm.ResourceID           `json:"externalId,omitempty"`
+	StartTime          time.Time                 `json:"startTime"`
+	LastTransitionTime time.Time                 `json:"lastTransitionTime"`
+	Status             arm.ProvisioningState     `json:"status"`
+	Error              *arm.CloudErrorBody       `json:"error,omitempty"`
+	History            []database.OperationEvent `json:"history"`
+}
+
+// AdminOperationGet returns the admin view of an operation.
+func (f *Frontend) AdminOperationGet(writer http.ResponseWriter, request *http.Request) {
+	ctx := request.Context()
+	logger := LoggerFromContext(ctx)
+
+	operationID := request.PathValue(PathSegmentOperationID)
+
+	doc, err := f.dbClient.GetOperationDoc(ctx, operationID)
+	if errors.Is(err, database.ErrNotFound) {
+		arm.WriteError(writer, http.StatusNotFound,
+			arm.CloudErrorCodeNotFound, "",
+			"Operation '%s' not found.", operationID)
+		return
+	} else if err != nil {
+		logger.Error(err.Error())
+		arm.WriteInternalServerError(writer)
+		return
+	}
+
+	_, err = arm.WriteJSONResponse(writer, http.StatusOK, newAdminOperationStatus(doc))
+	if err != nil {
+		logger.Error(err.Error())
+	}
+}
+
+// newAdminOperationStatus returns the admin view of an operation document.
+func newAdminOperationStatus(doc *database.OperationDocument) AdminOperationStatus {
+	status := AdminOperationStatus{
+		ID:                 doc.ID,
+		Request:            doc.Request,
+		ExternalID:         doc.ExternalID,
+		StartTime:          doc.StartTime,
+		LastTransitionTime: doc.LastTransitionTime,
+		Status:             doc.Status,
+		Error:              doc.Error,
+		History:            doc.History,
+	}
+
+	// Operations created before history was recorded have none.
+	if status.History == nil {
+		status.History = []database.OperationEvent{}
+	}
+
+	return status
+}
+
+// parseOperationFilter builds an operation filter from the admin operation
+// list request parameters, or returns a CloudError if a parameter is invalid.
+func parseOperationFilter(urlQuery url.Values) (database.OperationFilter, *arm.CloudError) {
+	filter := database.OperationFilter{
+		Status:  arm.ProvisioningState(urlQuery.Get(StatusKey)),
+		Request: database.OperationRequest(urlQuery.Get(RequestKey)),
+	}
+
+	for key, bound := range map[string]*time.Time{
+		StartedAfterKey:  &filter.StartedAfter,
+		StartedBeforeKey: &filter.StartedBefore,
+	} {
+		if !urlQuery.Has(key) {
+			continue
+		}
+		timestamp, err := time.Parse(time.RFC3339, urlQuery.Get(key))
+		if err != nil {
+			return filter, arm.NewCloudError(
+				http.StatusBadRequest,
+				arm.CloudErrorCodeInvalidParameter, key,
+				"The value '%s' for parameter '%s' is not a valid RFC 3339 timestamp.",
+				urlQuery.Get(key), key)
+		}
+		*bound = timestamp
+	}
+
+	return filter, nil
+}
+
+// AdminOperationList returns a page of operations across all subscriptions,
+// most recently started first, optionally filtered by status, operation type
+// and start time. This backs the central operations dashboard.
+func (f *Frontend) AdminOperationList(writer http.ResponseWriter, request *http.Request) {
+	ctx := request.Context()
+	logger := LoggerFromContext(ctx)
+
+	urlQuery := request.URL.Query()
+
+	filter, cloudError := parseOperationFilter(urlQuery)
+	if cloudError != nil {
+		arm.WriteCloudError(writer, cloudError)
+		return
+	}
+
+	pageSizeHint, maxPageSize := f.pageSizes()
+	top, err := strconv.ParseInt(urlQuery.Get("$top"), 10, 32)
+	if err == nil && top > 0 {
+		pageSizeHint = min(int32(top), maxPageSize)
+	}
+
+	var continuationToken *string
+	if urlQuery.Has("$skipToken") {
+		skipToken := urlQuery.Get("$skipToken")
+		if _, err := database.DecodeContinuationToken(skipToken); err != nil {
+			arm.WriteError(writer, http.StatusBadRequest,
+				arm.CloudErrorCodeInvalidContinuationToken, "$skipToken",
+				"The continuation token is malformed.")
+			return
+		}
+		continuationToken = api.Ptr(skipToken)
+	}
+
+	var pagedResponse arm.PagedResponse
+
+	iterator := f.dbClient.ListOperationDocs(ctx, filter, pageSizeHint, continuationToken)
+	for item := range iterator.Items(ctx) {
+		var doc *database.OperationDocument
+		err = json.Unmarshal(item, &doc)
+		if err != nil {
+			break
+		}
+
+		var value []byte
+		value, err = json.Marshal(newAdminOperationStatus(doc))
+		if err != nil {
+			break
+		}
+		pagedResponse.AddValue(value)
+	}
+	if err == nil {
+		err = iterator.GetError()
+	}
+	if err != nil {
+		arm.WriteCloudError(writer, toCloudError(ctx, err, nil))
+		return
+	}
+
+	err = pagedResponse.SetNextLink(originalRequestURL(request), iterator.GetContinuationToken())
+	if err != nil {
+		logger.Error(err.Error())
+		arm.WriteInternalServerError(writer)
+		return
+	}
+
+	_, err = arm.WriteJSONResponse(writer, http.StatusOK, pagedResponse)
+	if err != nil {
+		logger.Error(err.Error())
+	}
+}
+
+// adminResourceID returns the resource ID of an admin request for a
+// resource path, stripping the "admin" prefix and the final segment,
+// which names the admin action.
+func adminResourceID(request *http.Request) (*arm.ResourceID, error) {
+	originalPath, _ := OriginalPathFromContext(request.Context())
+	if originalPath == "" {
+		originalPath = request.URL.Path
+	}
+	return arm.ParseResourceID(strings.TrimPrefix(path.Dir(originalPath), "/admin"))
+}
+
+// ClusterImportRequest is the request body for importing a cluster that
+// already exists in Cluster Service into resource provider management.
+type ClusterImportRequest struct {
+	// InternalID is the Cluster Service path of the cluster to import.
+	InternalID string `json:"internalId"`
+}
+
+// ClusterImportResponse is the response body for importing a cluster.
+type ClusterImportResponse struct {
+	ID                string                `json:"id"`
+	InternalID        string                `json:"internalId"`
+	ProvisioningState arm.ProvisioningState `json:"provisioningState"`
+}
+
+// AdminClusterImport adopts a cluster created outside the resource provider,
+// such as during a migration, by creating its resource document without
+// provisioning anything. The cluster must exist in Cluster Service and the
+// resource ID must not already be in use.
+func (f *Frontend) AdminClusterImport(writer http.ResponseWriter, request *http.Request) {
+	ctx := request.Context()
+	logger := LoggerFromContext(ctx)
+
+	resourceID, err := adminResourceID(request)
+	if err != nil {
+		logger.Error(err.Error())
+		arm.WriteInternalServerError(writer)
+		return
+	}
+
+	body, err := BodyFromContext(ctx)
+	if err != nil {
+		logger.Error(err.Error())
+		arm.WriteInternalServerError(writer)
+		return
+	}
+
+	var importRequest ClusterImportRequest
+	err = json.Unmarshal(body, &importRequest)
+	if err != nil {
+		logger.Error(err.Error())
+		arm.WriteInvalidRequestContentError(writer, err)
+		return
+	}
+
+	internalID, err := ocm.NewInternalID(importRequest.InternalID)
+	if err != nil || internalID.Kind() != cmv1.ClusterKind {
+		arm.WriteError(writer, http.StatusBadRequest,
+			arm.CloudErrorCodeInvalidRequestContent, "internalId",
+			"Invalid value '%s' for field 'internalId'", importRequest.InternalID)
+		return
+	}
+
+	_, err = f.dbClient.GetSubscriptionDoc(ctx, resourceID.SubscriptionID)
+	if err != nil {
+		subscriptionID, _ := arm.ParseResourceID("/subscriptions/" + resourceID.SubscriptionID)
+		arm.WriteCloudError(writer, toCloudError(ctx, err, subscriptionID))
+		return
+	}
+
+	_, err = f.dbClient.GetResourceDoc(ctx, resourceID)
+	if err == nil {
+		arm.WriteError(writer, http.StatusConflict,
+			arm.CloudErrorCodeConflict, resourceID.String(),
+			"Resource '%s' is already managed by the resource provider.", resourceID)
+		return
+	} else if !errors.Is(err, database.ErrNotFound) {
+		arm.WriteCloudError(writer, toCloudError(ctx, err, resourceID))
+		return
+	}
+
+	// The cluster must exist downstream, since nothing will be provisioned.
+	csCluster, err := f.clusterServiceClient.GetCSCluster(ctx, internalID)
+	if err != nil {
+		logger.Warn(fmt.Sprintf("cannot import %s: %v", internalID, err))
+		arm.WriteCloudError(writer, toCloudError(ctx, err, resourceID))
+		return
+	}
+
+	// The cluster must have been created for this resource, so
+	// a mistyped internal ID cannot attach some other cluster.
+	azure := csCluster.Azure()
+	if !strings.EqualFold(azure.SubscriptionID(), resourceID.SubscriptionID) ||
+		!strings.EqualFold(azure.ResourceGroupName(), resourceID.ResourceGroupName) ||
+		!strings.EqualFold(azure.ResourceName(), resourceID.Name) {
+		logger.Warn(fmt.Sprintf("cannot import %s: cluster belongs to resource group '%s' and resource '%s' in subscription '%s'",
+			internalID, azure.ResourceGroupName(), azure.ResourceName(), azure.SubscriptionID()))
+		arm.WriteError(writer, http.StatusBadRequest,
+			arm.CloudErrorCodeInvalidRequestContent, "internalId",
+			"Cluster '%s' does not belong to resource '%s'.", internalID, resourceID)
+		return
+	}
+
+	trackingDoc, err := f.findResourceDocByInternalID(ctx, resourceID.SubscriptionID, internalID)
+	if err != nil {
+		logger.Error(err.Error())
+		arm.WriteInternalServerError(writer)
+		return
+	}
+	if trackingDoc != nil {
+		arm.WriteError(writer, http.StatusConflict,
+			arm.CloudErrorCodeConflict, "internalId",
+			"Cluster '%s' is already managed as resource '%s'.", internalID, trackingDoc.ResourceId)
+		return
+	}
+
+	doc := database.NewResourceDocument(resourceID)
+	doc.InternalID = internalID
+	doc.ProvisioningState = arm.ProvisioningStateSucceeded
+
+	err = f.dbClient.CreateResourceDoc(ctx, doc)
+	if err != nil {
+		arm.WriteCloudError(writer, toCloudError(ctx, err, resourceID))
+		return
+	}
+	logger.Info(fmt.Sprintf("imported %s as resource %s", internalID, resourceID))
+
+	response := ClusterImportResponse{
+		ID:                resourceID.String(),
+		InternalID:        internalID.String(),
+		ProvisioningState: doc.ProvisioningState,
+	}
+
+	_, err = arm.WriteJSONResponse(writer, http.StatusCreated, response)
+	if err != nil {
+		logger.Error(err.Error())
+	}
+}
+
+// findResourceDocByInternalID returns the resource document in the given
+// subscription that tracks internalID, or nil if there is none.
+func (f *Frontend) findResourceDocByInternalID(ctx context.Context, subscriptionID string, internalID ocm.InternalID) (*database.ResourceDocument, error) {
+	prefix, err := arm.ParseResourceID("/subscriptions/" + subscriptionID)
+	if err != nil {
+		return nil, err
+	}
+
+	iterator := f.dbClient.ListResourceDocs(ctx, prefix, -1, nil)
+
+	for item := range iterator.Items(ctx) {
+		var doc database.ResourceDocument
+		err := json.Unmarshal(item, &doc)
+		if err != nil {
+			return nil, err
+		}
+		if doc.InternalID.String() == internalID.String() {
+			return &doc, nil
+		}
+	}
+
+	return nil, iterator.GetError()
+}
+
+// Limits on the annotations of a resource.
+const (
+	MaxAnnotations           = 50
+	MaxAnnotationKeyLength   = 128
+	MaxAnnotationValueLength = 1024
+)
+
+// ResourceAnnotations is the request and response body for the internal
+// annotations of a resource.
+type ResourceAnnotations struct {
+	Annotations map[string]string `json:"annotations"`
+}
+
+// validateAnnotations returns a CloudError if the annotations
+// exceed the limits on their number or size.
+func validateAnnotations(annotations map[string]string) *arm.CloudError {
+	if len(annotations) > MaxAnnotations {
+		return arm.NewCloudError(http.StatusBadRequest,
+			arm.CloudErrorCodeInvalidRequestContent, "annotations",
+			"A resource may have at most %d annotations, got %d.",
+			MaxAnnotations, len(annotations))
+	}
+
+	for key, value := range annotations {
+		if key == "" || utf8.RuneCountInString(key) > MaxAnnotationKeyLength {
+			return arm.NewCloudError(http.StatusBadRequest,
+				arm.CloudErrorCodeInvalidRequestContent, "annotations",
+				"Annotation key '%s' must be between 1 and %d characters.",
+				key, MaxAnnotationKeyLength)
+		}
+		if utf8.RuneCountInString(value) > MaxAnnotationValueLength {
+			return arm.NewCloudError(http.StatusBadRequest,
+				arm.CloudErrorCodeInvalidRequestContent, "annotations",
+				"Value of annotation '%s' must be at most %d characters.",
+				key, MaxAnnotationValueLength)
+		}
+	}
+
+	return nil
+}
+
+// AdminResourceAnnotationsGet returns the internal annotations of a resource.
+func (f *Frontend) AdminResourceAnnotationsGet(writer http.ResponseWriter, request *http.Request) {
+	ctx := request.Context()
+	logger := LoggerFromContext(ctx)
+
+	resourceID, err := adminResourceID(request)
+	if err != nil {
+		logger.Error(err.Error())
+		arm.WriteInternalServerError(writer)
+		return
+	}
+
+	doc, err := f.dbClient.GetResourceDoc(ctx, resourceID)
+	if err != nil {
+		arm.WriteCloudError(writer, toCloudError(ctx, err, resourceID))
+		return
+	}
+
+	response := ResourceAnnotations{Annotations: doc.Annotations}
+	if response.Annotations == nil {
+		response.Annotations = map[string]string{}
+	}
+
+	_, err = arm.WriteJSONResponse(writer, http.StatusOK, response)
+	if err != nil {
+		logger.Error(err.Error())
+	}
+}
+
+// AdminResourceAnnotationsPut replaces the internal annotations of a
+// resource. The resource itself is left as is.
+func (f *Frontend) AdminResourceAnnotationsPut(writer http.ResponseWriter, request *http.Request) {
+	ctx := request.Context()
+	logger := LoggerFromContext(ctx)
+
+	resourceID, err := adminResourceID(request)
+	if err != nil {
+		logger.Error(err.Error())
+		arm.WriteInternalServerError(writer)
+		return
+	}
+
+	body, err := BodyFromContext(ctx)
+	if err != nil {
+		logger.Error(err.Error())
+		arm.WriteInternalServerError(writer)
+		return
+	}
+
+	var annotations ResourceAnnotations
+	err = json.Unmarshal(body, &annotations)
+	if err != nil {
+		logger.Error(err.Error())
+		arm.WriteInvalidRequestContentError(writer, err)
+		return
+	}
+
+	cloudError := validateAnnotations(annotations.Annotations)
+	if cloudError != nil {
+		arm.WriteCloudError(writer, cloudError)
+		return
+	}
+
+	_, err = f.dbClient.UpdateResourceDoc(ctx, resourceID, func(doc *database.ResourceDocument) bool {
+		doc.Annotations = annotations.Annotations
+		return true
+	})
+	if err != nil {
+		arm.WriteCloudError(writer, toCloudError(ctx, err, resourceID))
+		return
+	}
+	logger.Info(fmt.Sprintf("set %d annotations on resource %s", len(annotations.Annotations), resourceID))
+
+	if annotations.Annotations == nil {
+		annotations.Annotations = map[string]string{}
+	}
+
+	_, err = arm.WriteJSONResponse(writer, http.StatusOK, annotations)
+	if err != nil {
+		logger.Error(err.Error())
+	}
+}
+
+// CompletionWebhookRequest is the body of a request to register a
+// completion webhook.
+type CompletionWebhookRequest struct {
+	URL string `json:"url"`
+}
+
+// CompletionWebhookResponse describes a registered completion webhook.
+// Secret, which signs the requests to the webhook, is only returned when
+// the webhook is registered and cannot be retrieved later.
+type CompletionWebhookResponse struct {
+	URL    string `json:"url"`
+	Secret string `json:"secret,omitempty"`
+}
+
+// AdminClusterCompletionWebhookPut registers a webhook for the backend to
+// call whenever an operation on a cluster reaches a terminal state. This
+// replaces any webhook registered earlier. If the frontend has a signing
+// key, the webhook gets a new secret, which only the response includes.
+func (f *Frontend) AdminClusterCompletionWebhookPut(writer http.ResponseWriter, request *http.Request) {
+	ctx := request.Context()
+	logger := LoggerFromContext(ctx)
+
+	resourceID, err := adminResourceID(request)
+	if err != nil {
+		logger.Error(err.Error())
+		arm.WriteInternalServerError(writer)
+		return
+	}
+
+	body, err := BodyFromContext(ctx)
+	if err != nil {
+		logger.Error(err.Error())
+		arm.WriteInternalServerError(writer)
+		return
+	}
+
+	var webhookRequest CompletionWebhookRequest
+	err = DecodeStrictJSON(body, &webhookRequest)
+	if err != nil {
+		logger.Error(err.Error())
+		arm.WriteInvalidRequestContentError(writer, err)
+		return
+	}
+
+	webhook := database.CompletionWebhook{URL: webhookRequest.URL}
+	response := CompletionWebhookResponse{URL: webhook.URL}
+
+	// Store only the key ID, so that the secret cannot
+	// be recovered from the database or its exports.
+	if signingKey := f.config.CompletionWebhookSigningKey; signingKey != "" {
+		webhook.KeyID = uuid.NewString()
+		response.Secret = database.CompletionWebhookSecret([]byte(signingKey), webhook.KeyID)
+	}
+
+	webhookURL, err := url.Parse(webhook.URL)
+	if err != nil || webhookURL.Scheme != "https" || webhookURL.Host == "" {
+		arm.WriteError(writer, http.StatusBadRequest,
+			arm.CloudErrorCodeInvalidRequestContent, "url",
+			"Invalid value '%s' for field 'url'. The webhook URL must be an absolute HTTPS URL.",
+			webhook.URL)
+		return
+	}
+
+	_, err = f.dbClient.UpdateResourceDoc(ctx, resourceID, func(doc *database.ResourceDocument) bool {
+		doc.CompletionWebhook = &webhook
+		return true
+	})
+	if err != nil {
+		arm.WriteCloudError(writer, toCloudError(ctx, err, resourceID))
+		return
+	}
+	logger.Info(fmt.Sprintf("set completion webhook on resource %s", resourceID))
+
+	_, err = arm.WriteJSONResponse(writer, http.StatusOK, response)
+	if err != nil {
+		logger.Error(err.Error())
+	}
+}
+
+// AdminClusterCompletionWebhookDelete removes the completion webhook of a
+// cluster, if any.
+func (f *Frontend) AdminClusterCompletionWebhookDelete(writer http.ResponseWriter, request *http.Request) {
+	ctx := request.Context()
+	logger := LoggerFromContext(ctx)
+
+	resourceID, err := adminResourceID(request)
+	if err != nil {
+		logger.Error(err.Error())
+		arm.WriteInternalServerError(writer)
+		return
+	}
+
+	_, err = f.dbClient.UpdateResourceDoc(ctx, resourceID, func(doc *database.ResourceDocument) bool {
+		if doc.CompletionWebhook == nil {
+			return false
+		}
+		doc.CompletionWebhook = nil
+		return true
+	})
+	if err != nil {
+		arm.WriteCloudError(writer, toCloudError(ctx, err, resourceID))
+		return
+	}
+	logger.Info(fmt.Sprintf("removed completion webhook from resource %s", resourceID))
+
+	writer.WriteHeader(http.StatusNoContent)
+}
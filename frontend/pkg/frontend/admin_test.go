@@ -0,0 +1,1001 @@
+package frontend
+
+// Copyright (c) Microsoft Corporation.
+// Licensed under the Apache License 2.0.
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Azure/ARO-HCP/internal/api"
+	"github.com/Azure/ARO-HCP/internal/api/arm"
+	"github.com/Azure/ARO-HCP/internal/database"
+	"github.com/Azure/ARO-HCP/internal/ocm"
+)
+
+func TestAdminSubscriptionStateBatch(t *testing.T) {
+	const (
+		deletedSubscriptionID      = "11111111-1111-1111-1111-111111111111"
+		unregisteredSubscriptionID = "22222222-2222-2222-2222-222222222222"
+		missingSubscriptionID      = "33333333-3333-3333-3333-333333333333"
+		malformedSubscriptionID    = "not-a-uuid"
+	)
+
+	f, ts := newTestListServer(t)
+
+	for subscriptionID, state := range map[string]arm.SubscriptionState{
+		deletedSubscriptionID:      arm.SubscriptionStateDeleted,
+		unregisteredSubscriptionID: arm.SubscriptionStateUnregistered,
+	} {
+		err := f.dbClient.CreateSubscriptionDoc(context.Background(), database.NewSubscriptionDocument(
+			subscriptionID, &arm.Subscription{
+				State:            state,
+				RegistrationDate: api.Ptr(time.Now().String()),
+			}))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	body, err := json.Marshal(SubscriptionStateBatchRequest{
+		SubscriptionIDs: []string{
+			dummySubscrtiptionId,
+			deletedSubscriptionID,
+			unregisteredSubscriptionID,
+			missingSubscriptionID,
+			malformedSubscriptionID,
+		},
+		State: arm.SubscriptionStateSuspended,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rs, err := ts.Client().Post(ts.URL+"/admin/subscriptionStates", "application/json", bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rs.Body.Close()
+
+	if rs.StatusCode != http.StatusOK {
+		t.Fatalf("expected status code %d, got %d", http.StatusOK, rs.StatusCode)
+	}
+
+	var response SubscriptionStateBatchResponse
+	err = json.NewDecoder(rs.Body).Decode(&response)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []struct {
+		subscriptionID string
+		errorCode      string
+		finalState     arm.SubscriptionState
+	}{
+		{
+			subscriptionID: dummySubscrtiptionId,
+			finalState:     arm.SubscriptionStateSuspended,
+		},
+		{
+			subscriptionID: deletedSubscriptionID,
+			errorCode:      arm.CloudErrorCodeInvalidSubscriptionState,
+			finalState:     arm.SubscriptionStateDeleted,
+		},
+		{
+			subscriptionID: unregisteredSubscriptionID,
+			errorCode:      arm.CloudErrorCodeInvalidSubscriptionState,
+			finalState:     arm.SubscriptionStateUnregistered,
+		},
+		{
+			subscriptionID: missingSubscriptionID,
+			errorCode:      arm.CloudErrorCodeSubscriptionNotFound,
+		},
+		{
+			subscriptionID: malformedSubscriptionID,
+			errorCode:      arm.CloudErrorCodeInvalidSubscriptionID,
+		},
+	}
+
+	if len(response.Value) != len(expected) {
+		t.Fatalf("expected %d results, got %d", len(expected), len(response.Value))
+	}
+
+	for i, result := range response.Value {
+		if result.SubscriptionID != expected[i].subscriptionID {
+			t.Errorf("result %d: expected subscription %s, got %s", i, expected[i].subscriptionID, result.SubscriptionID)
+		}
+
+		var errorCode string
+		if result.Error != nil {
+			errorCode = result.Error.Code
+		}
+		if errorCode != expected[i].errorCode {
+			t.Errorf("result %d: expected error code %q, got %q", i, expected[i].errorCode, errorCode)
+		}
+
+		if expected[i].finalState == "" {
+			continue
+		}
+		doc, err := f.dbClient.GetSubscriptionDoc(context.Background(), result.SubscriptionID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if doc.Subscription.State != expected[i].finalState {
+			t.Errorf("result %d: expected state %s, got %s", i, expected[i].finalState, doc.Subscription.State)
+		}
+	}
+}
+
+func TestAdminSubscriptionStateBatchDeleteWithClusters(t *testing.T) {
+	tests := []struct {
+		name            string
+		force           bool
+		expectedWarning bool
+	}{
+		{
+			name:            "Unforced deletion reports remaining clusters",
+			expectedWarning: true,
+		},
+		{
+			name:  "Forced deletion",
+			force: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctx := context.Background()
+
+			f, ts := newTestListServer(t)
+			cluster := addTestCluster(t, f, dummyClusterName, nil)
+
+			body, err := json.Marshal(SubscriptionStateBatchRequest{
+				SubscriptionIDs: []string{dummySubscrtiptionId},
+				State:           arm.SubscriptionStateDeleted,
+				Force:           test.force,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			rs, err := ts.Client().Post(ts.URL+"/admin/subscriptionStates", "application/json", bytes.NewReader(body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer rs.Body.Close()
+
+			var response SubscriptionStateBatchResponse
+			err = json.NewDecoder(rs.Body).Decode(&response)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(response.Value) != 1 || response.Value[0].Error != nil {
+				t.Fatalf("expected one successful result, got %+v", response.Value)
+			}
+
+			result := response.Value[0]
+			if (result.Warning != "") != test.expectedWarning {
+				t.Errorf("expected warning: %t, got %q", test.expectedWarning, result.Warning)
+			}
+			if test.expectedWarning {
+				if result.RemainingClusters == nil || result.RemainingClusters.Total != 1 || result.RemainingClusters.Started != 1 {
+					t.Errorf("expected 1 remaining cluster being deleted, got %+v", result.RemainingClusters)
+				}
+			} else if result.RemainingClusters != nil {
+				t.Errorf("expected no remaining clusters report, got %+v", result.RemainingClusters)
+			}
+
+			// The cascade proceeds either way.
+			doc, err := f.dbClient.GetResourceDoc(ctx, cluster.ResourceId)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if doc.ProvisioningState != arm.ProvisioningStateDeleting {
+				t.Errorf("expected cluster provisioning state %s, got %s", arm.ProvisioningStateDeleting, doc.ProvisioningState)
+			}
+		})
+	}
+}
+
+func TestAdminSubscriptionStateBatchRepeatedDelete(t *testing.T) {
+	ctx := context.Background()
+
+	f, ts := newTestListServer(t)
+	cluster := addTestCluster(t, f, dummyClusterName, nil)
+
+	_, err := f.dbClient.UpdateSubscriptionDoc(ctx, dummySubscrtiptionId, func(doc *database.SubscriptionDocument) bool {
+		doc.Subscription.State = arm.SubscriptionStateDeleted
+		return true
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	body, err := json.Marshal(SubscriptionStateBatchRequest{
+		SubscriptionIDs: []string{dummySubscrtiptionId},
+		State:           arm.SubscriptionStateDeleted,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rs, err := ts.Client().Post(ts.URL+"/admin/subscriptionStates", "application/json", bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rs.Body.Close()
+
+	var response SubscriptionStateBatchResponse
+	err = json.NewDecoder(rs.Body).Decode(&response)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(response.Value) != 1 || response.Value[0].Error != nil || response.Value[0].Warning != "" {
+		t.Fatalf("expected one successful result without a warning, got %+v", response.Value)
+	}
+
+	// The subscription was already deleted, so its resources are left alone.
+	doc, err := f.dbClient.GetResourceDoc(ctx, cluster.ResourceId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if doc.ProvisioningState == arm.ProvisioningStateDeleting {
+		t.Errorf("expected the cluster not to be deleted again")
+	}
+}
+
+func TestAdminSubscriptionStateBatchInvalidRequest(t *testing.T) {
+	tests := []struct {
+		name    string
+		request SubscriptionStateBatchRequest
+	}{
+		{
+			name: "Missing subscription IDs",
+			request: SubscriptionStateBatchRequest{
+				State: arm.SubscriptionStateWarned,
+			},
+		},
+		{
+			name: "Invalid state",
+			request: SubscriptionStateBatchRequest{
+				SubscriptionIDs: []string{dummySubscrtiptionId},
+				State:           "Bogus",
+			},
+		},
+	}
+
+	_, ts := newTestListServer(t)
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			body, err := json.Marshal(test.request)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			rs, err := ts.Client().Post(ts.URL+"/admin/subscriptionStates", "application/json", bytes.NewReader(body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer rs.Body.Close()
+
+			if rs.StatusCode != http.StatusBadRequest {
+				t.Errorf("expected status code %d, got %d", http.StatusBadRequest, rs.StatusCode)
+			}
+		})
+	}
+}
+
+func TestAdminSubscriptionList(t *testing.T) {
+	f, ts := newTestListServer(t)
+
+	// Force several pages.
+	f.config.DefaultPageSize = 2
+	f.config.MaxPageSize = 2
+
+	expected := map[string]bool{dummySubscrtiptionId: true}
+	for i := range 4 {
+		subscriptionID := fmt.Sprintf("00000000-0000-0000-0000-%012d", i+1)
+		err := f.dbClient.CreateSubscriptionDoc(context.Background(), database.NewSubscriptionDocument(
+			subscriptionID, &arm.Subscription{State: arm.SubscriptionStateRegistered}))
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected[subscriptionID] = true
+	}
+
+	rs, err := ts.Client().Get(ts.URL + "/admin/subscriptions")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rs.Body.Close()
+
+	if rs.StatusCode != http.StatusOK {
+		t.Fatalf("expected status code %d, got %d", http.StatusOK, rs.StatusCode)
+	}
+	if contentType := rs.Header.Get("Content-Type"); contentType != "application/x-ndjson" {
+		t.Errorf("expected content type application/x-ndjson, got %q", contentType)
+	}
+
+	seen := make(map[string]int)
+	scanner := bufio.NewScanner(rs.Body)
+	for scanner.Scan() {
+		var doc database.SubscriptionDocument
+		err = json.Unmarshal(scanner.Bytes(), &doc)
+		if err != nil {
+			t.Fatalf("invalid line %q: %v", scanner.Text(), err)
+		}
+		seen[doc.ID]++
+	}
+	if err = scanner.Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	for subscriptionID := range expected {
+		if seen[subscriptionID] != 1 {
+			t.Errorf("expected subscription %s once, got it %d times", subscriptionID, seen[subscriptionID])
+		}
+	}
+	for subscriptionID := range seen {
+		if !expected[subscriptionID] {
+			t.Errorf("unexpected subscription %s", subscriptionID)
+		}
+	}
+}
+
+// cancellingDBClient cancels a context once its first page of
+// subscription documents has been listed, as if the client had
+// disconnected mid-stream.
+type cancellingDBClient struct {
+	database.DBClient
+	cancel context.CancelFunc
+	pages  int
+}
+
+func (c *cancellingDBClient) ListSubscriptionDocs(ctx context.Context, continuationToken string, pageSize int) ([]*database.SubscriptionDocument, string, error) {
+	c.pages++
+	c.cancel()
+	return c.DBClient.ListSubscriptionDocs(ctx, continuationToken, pageSize)
+}
+
+func TestAdminSubscriptionListCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(ContextWithLogger(context.Background(), testLogger))
+	defer cancel()
+
+	dbClient := &cancellingDBClient{DBClient: database.NewCache(), cancel: cancel}
+	for i := range 4 {
+		err := dbClient.CreateSubscriptionDoc(ctx, database.NewSubscriptionDocument(
+			fmt.Sprintf("00000000-0000-0000-0000-%012d", i),
+			&arm.Subscription{State: arm.SubscriptionStateRegistered}))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	f := &Frontend{
+		dbClient: dbClient,
+		config:   Config{DefaultPageSize: 1, MaxPageSize: 1},
+	}
+
+	writer := httptest.NewRecorder()
+	request := httptest.NewRequestWithContext(ctx, http.MethodGet, "/admin/subscriptions", nil)
+	f.AdminSubscriptionList(writer, request)
+
+	if dbClient.pages != 1 {
+		t.Errorf("expected enumeration to stop after 1 page, got %d pages", dbClient.pages)
+	}
+}
+
+func TestAdminOperationGet(t *testing.T) {
+	ctx := context.Background()
+
+	f, ts := newTestListServer(t)
+	cluster := addTestCluster(t, f, dummyClusterName, nil)
+
+	doc := database.NewOperationDocument(database.OperationRequestCreate, cluster.ResourceId, cluster.InternalID)
+	err := f.dbClient.CreateOperationDoc(ctx, doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, status := range []arm.ProvisioningState{arm.ProvisioningStateProvisioning, arm.ProvisioningStateSucceeded} {
+		_, err = f.dbClient.UpdateOperationDoc(ctx, doc.ID, func(updateDoc *database.OperationDocument) bool {
+			return updateDoc.UpdateStatus(status, nil)
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name               string
+		operationID        string
+		expectedStatusCode int
+		expectedHistory    []arm.ProvisioningState
+	}{
+		{
+			name:               "Existing operation",
+			operationID:        doc.ID,
+			expectedStatusCode: http.StatusOK,
+			expectedHistory: []arm.ProvisioningState{
+				arm.ProvisioningStateAccepted,
+				arm.ProvisioningStateProvisioning,
+				arm.ProvisioningStateSucceeded,
+			},
+		},
+		{
+			name:               "Missing operation",
+			operationID:        "missing",
+			expectedStatusCode: http.StatusNotFound,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rs, err := ts.Client().Get(ts.URL + "/admin/operations/" + test.operationID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer rs.Body.Close()
+
+			if rs.StatusCode != test.expectedStatusCode {
+				t.Fatalf("expected status code %d, got %d", test.expectedStatusCode, rs.StatusCode)
+			}
+
+			if test.expectedHistory == nil {
+				return
+			}
+
+			var status AdminOperationStatus
+			err = json.NewDecoder(rs.Body).Decode(&status)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var history []arm.ProvisioningState
+			for _, event := range status.History {
+				history = append(history, event.Status)
+			}
+			if !slices.Equal(history, test.expectedHistory) {
+				t.Errorf("expected history %v, got %v", test.expectedHistory, history)
+			}
+			if status.Status != arm.ProvisioningStateSucceeded {
+				t.Errorf("expected status %s, got %s", arm.ProvisioningStateSucceeded, status.Status)
+			}
+		})
+	}
+}
+
+func TestAdminClusterImport(t *testing.T) {
+	ctx := context.Background()
+
+	f, ts := newTestListServer(t)
+	managed := addTestCluster(t, f, dummyClusterName, nil)
+
+	// Create a cluster in Cluster Service with no resource document,
+	// as though it were created outside the resource provider.
+	importedID, err := arm.ParseResourceID(
+		"/subscriptions/" + dummySubscrtiptionId + "/resourceGroups/" + dummyResourceGroupId +
+			"/providers/" + api.ProviderNamespace + "/" + api.ClusterResourceTypeName + "/imported")
+	if err != nil {
+		t.Fatal(err)
+	}
+	requestHeader := make(http.Header)
+	requestHeader.Add(arm.HeaderNameHomeTenantID, dummyTenantId)
+	hcpCluster := api.NewDefaultHCPOpenShiftCluster()
+	hcpCluster.Name = importedID.Name
+	csCluster, err := f.BuildCSCluster(importedID, requestHeader, hcpCluster, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	csCluster, err = f.clusterServiceClient.PostCSCluster(ctx, csCluster)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Track another cluster under the wrong resource name,
+	// as though it had been imported by mistake.
+	tracked := addTestCluster(t, f, "tracked", nil)
+	alias, err := arm.ParseResourceID(
+		"/subscriptions/" + dummySubscrtiptionId + "/resourceGroups/" + dummyResourceGroupId +
+			"/providers/" + api.ProviderNamespace + "/" + api.ClusterResourceTypeName + "/alias")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = f.dbClient.DeleteResourceDoc(ctx, tracked.ResourceId); err != nil {
+		t.Fatal(err)
+	}
+	aliasDoc := database.NewResourceDocument(alias)
+	aliasDoc.InternalID = tracked.InternalID
+	if err = f.dbClient.CreateResourceDoc(ctx, aliasDoc); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name               string
+		clusterName        string
+		internalID         string
+		expectedStatusCode int
+	}{
+		{
+			name:               "Cluster belongs to another resource",
+			clusterName:        "other",
+			internalID:         csCluster.HREF(),
+			expectedStatusCode: http.StatusBadRequest,
+		},
+		{
+			name:               "Cluster exists downstream",
+			clusterName:        importedID.Name,
+			internalID:         csCluster.HREF(),
+			expectedStatusCode: http.StatusCreated,
+		},
+		{
+			name:               "Cluster managed as another resource",
+			clusterName:        tracked.ResourceId.Name,
+			internalID:         tracked.InternalID.String(),
+			expectedStatusCode: http.StatusConflict,
+		},
+		{
+			name:               "Cluster missing downstream",
+			clusterName:        "missing",
+			internalID:         "/api/clusters_mgmt/v1/clusters/missing",
+			expectedStatusCode: http.StatusNotFound,
+		},
+		{
+			name:               "Cluster already managed",
+			clusterName:        managed.ResourceId.Name,
+			internalID:         managed.InternalID.String(),
+			expectedStatusCode: http.StatusConflict,
+		},
+		{
+			name:               "Invalid internal ID",
+			clusterName:        "invalid",
+			internalID:         "/api/clusters_mgmt/v1/bogus",
+			expectedStatusCode: http.StatusBadRequest,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			body, err := json.Marshal(ClusterImportRequest{InternalID: test.internalID})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			url := ts.URL + "/admin/subscriptions/" + dummySubscrtiptionId +
+				"/resourceGroups/" + dummyResourceGroupId +
+				"/providers/" + api.ProviderNamespace + "/" + api.ClusterResourceTypeName +
+				"/" + test.clusterName + "/import"
+			rs, err := ts.Client().Post(url, "application/json", bytes.NewReader(body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer rs.Body.Close()
+
+			if rs.StatusCode != test.expectedStatusCode {
+				t.Fatalf("expected status code %d, got %d", test.expectedStatusCode, rs.StatusCode)
+			}
+
+			if test.expectedStatusCode != http.StatusCreated {
+				return
+			}
+
+			doc, err := f.dbClient.GetResourceDoc(ctx, importedID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if doc.ProvisioningState != arm.ProvisioningStateSucceeded {
+				t.Errorf("expected provisioning state %s, got %s", arm.ProvisioningStateSucceeded, doc.ProvisioningState)
+			}
+			if doc.InternalID.String() != test.internalID {
+				t.Errorf("expected internal ID %s, got %s", test.internalID, doc.InternalID)
+			}
+		})
+	}
+}
+
+func TestAdminOperationList(t *testing.T) {
+	ctx := context.Background()
+
+	f, ts := newTestListServer(t)
+
+	// Seed operations across subscriptions, one hour apart
+	// with "op-0" being the most recently started.
+	start := time.Date(2024, time.June, 10, 12, 0, 0, 0, time.UTC)
+	seeds := []struct {
+		subscriptionID string
+		request        database.OperationRequest
+		status         arm.ProvisioningState
+	}{
+		{"00000000-0000-0000-0000-000000000001", database.OperationRequestCreate, arm.ProvisioningStateProvisioning},
+		{"00000000-0000-0000-0000-000000000002", database.OperationRequestDelete, arm.ProvisioningStateFailed},
+		{"00000000-0000-0000-0000-000000000001", database.OperationRequestUpdate, arm.ProvisioningStateSucceeded},
+		{"00000000-0000-0000-0000-000000000003", database.OperationRequestCreate, arm.ProvisioningStateSucceeded},
+		{"00000000-0000-0000-0000-000000000002", database.OperationRequestCreate, arm.ProvisioningStateFailed},
+	}
+	for i, seed := range seeds {
+		resourceID, err := arm.ParseResourceID(
+			"/subscriptions/" + seed.subscriptionID + "/resourceGroups/" + dummyResourceGroupId +
+				"/providers/" + api.ProviderNamespace + "/" + api.ClusterResourceTypeName + "/" + dummyClusterName)
+		if err != nil {
+			t.Fatal(err)
+		}
+		internalID, err := ocm.NewInternalID(fmt.Sprintf("/api/clusters_mgmt/v1/clusters/cluster-%d", i))
+		if err != nil {
+			t.Fatal(err)
+		}
+		doc := database.NewOperationDocument(seed.request, resourceID, internalID)
+		doc.ID = fmt.Sprintf("op-%d", i)
+		doc.Status = seed.status
+		doc.StartTime = start.Add(-time.Duration(i) * time.Hour)
+		err = f.dbClient.CreateOperationDoc(ctx, doc)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name               string
+		query              string
+		expectedStatusCode int
+		expectedIDs        []string
+	}{
+		{
+			name:               "All operations",
+			expectedStatusCode: http.StatusOK,
+			expectedIDs:        []string{"op-0", "op-1", "op-2", "op-3", "op-4"},
+		},
+		{
+			name:               "Filter by status",
+			query:              StatusKey + "=failed",
+			expectedStatusCode: http.StatusOK,
+			expectedIDs:        []string{"op-1", "op-4"},
+		},
+		{
+			name:               "Filter by operation type",
+			query:              RequestKey + "=Create",
+			expectedStatusCode: http.StatusOK,
+			expectedIDs:        []string{"op-0", "op-3", "op-4"},
+		},
+		{
+			name: "Filter by time range",
+			query: StartedAfterKey + "=" + start.Add(-3*time.Hour).Format(time.RFC3339) +
+				"&" + StartedBeforeKey + "=" + start.Format(time.RFC3339),
+			expectedStatusCode: http.StatusOK,
+			expectedIDs:        []string{"op-1", "op-2", "op-3"},
+		},
+		{
+			name:               "Combined filters",
+			query:              StatusKey + "=Succeeded&" + RequestKey + "=Create",
+			expectedStatusCode: http.StatusOK,
+			expectedIDs:        []string{"op-3"},
+		},
+		{
+			name:               "Paginated",
+			query:              "$top=2",
+			expectedStatusCode: http.StatusOK,
+			expectedIDs:        []string{"op-0", "op-1", "op-2", "op-3", "op-4"},
+		},
+		{
+			name:               "Invalid time range",
+			query:              StartedAfterKey + "=yesterday",
+			expectedStatusCode: http.StatusBadRequest,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var ids []string
+			var pages int
+
+			nextLink := ts.URL + "/admin/operations?" + test.query
+			for nextLink != "" {
+				rs, err := ts.Client().Get(nextLink)
+				if err != nil {
+					t.Fatal(err)
+				}
+				defer rs.Body.Close()
+
+				if rs.StatusCode != test.expectedStatusCode {
+					t.Fatalf("expected status code %d, got %d", test.expectedStatusCode, rs.StatusCode)
+				}
+				if rs.StatusCode != http.StatusOK {
+					return
+				}
+
+				var page struct {
+					Value    []AdminOperationStatus `json:"value"`
+					NextLink string                 `json:"nextLink"`
+				}
+				err = json.NewDecoder(rs.Body).Decode(&page)
+				if err != nil {
+					t.Fatal(err)
+				}
+				for _, status := range page.Value {
+					ids = append(ids, status.ID)
+				}
+
+				if page.NextLink != "" && !strings.HasPrefix(page.NextLink, ts.URL+"/admin/operations?") {
+					t.Fatalf("expected an absolute next link, got %q", page.NextLink)
+				}
+				nextLink = page.NextLink
+				pages++
+			}
+
+			if !slices.Equal(ids, test.expectedIDs) {
+				t.Errorf("expected operations %v, got %v", test.expectedIDs, ids)
+			}
+			if test.query == "$top=2" && pages != 3 {
+				t.Errorf("expected 3 pages, got %d", pages)
+			}
+		})
+	}
+}
+
+func TestAdminResourceAnnotations(t *testing.T) {
+	f, ts := newTestListServer(t)
+	cluster := addTestCluster(t, f, dummyClusterName, nil)
+
+	annotationsURL := func(clusterName string) string {
+		return ts.URL + "/admin/subscriptions/" + dummySubscrtiptionId +
+			"/resourceGroups/" + dummyResourceGroupId +
+			"/providers/" + api.ProviderNamespace + "/" + api.ClusterResourceTypeName +
+			"/" + clusterName + "/annotations"
+	}
+
+	tooMany := make(map[string]string)
+	for i := range MaxAnnotations + 1 {
+		tooMany[fmt.Sprintf("key-%d", i)] = "value"
+	}
+
+	tests := []struct {
+		name               string
+		clusterName        string
+		annotations        map[string]string
+		expectedStatusCode int
+	}{
+		{
+			name:               "Too many annotations",
+			clusterName:        dummyClusterName,
+			annotations:        tooMany,
+			expectedStatusCode: http.StatusBadRequest,
+		},
+		{
+			name:               "Key too long",
+			clusterName:        dummyClusterName,
+			annotations:        map[string]string{strings.Repeat("k", MaxAnnotationKeyLength+1): "value"},
+			expectedStatusCode: http.StatusBadRequest,
+		},
+		{
+			name:               "Value too long",
+			clusterName:        dummyClusterName,
+			annotations:        map[string]string{"key": strings.Repeat("v", MaxAnnotationValueLength+1)},
+			expectedStatusCode: http.StatusBadRequest,
+		},
+		{
+			name:               "Multibyte value at the limit",
+			clusterName:        dummyClusterName,
+			annotations:        map[string]string{"key": strings.Repeat("é", MaxAnnotationValueLength)},
+			expectedStatusCode: http.StatusOK,
+		},
+		{
+			name:               "Cluster not found",
+			clusterName:        "missing",
+			annotations:        map[string]string{"key": "value"},
+			expectedStatusCode: http.StatusNotFound,
+		},
+		{
+			name:               "Annotations set",
+			clusterName:        dummyClusterName,
+			annotations:        map[string]string{"owner": "sre-team", "ticket": "internal-ticket-1234"},
+			expectedStatusCode: http.StatusOK,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			body, err := json.Marshal(ResourceAnnotations{Annotations: test.annotations})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			req, err := http.NewRequest(http.MethodPut, annotationsURL(test.clusterName), bytes.NewReader(body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.Header.Set("Content-Type", "application/json")
+
+			rs, err := ts.Client().Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			rs.Body.Close()
+
+			if rs.StatusCode != test.expectedStatusCode {
+				t.Fatalf("expected status code %d, got %d", test.expectedStatusCode, rs.StatusCode)
+			}
+		})
+	}
+
+	// The admin view includes the annotations.
+	rs, err := ts.Client().Get(annotationsURL(dummyClusterName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rs.Body.Close()
+
+	if rs.StatusCode != http.StatusOK {
+		t.Fatalf("expected status code %d, got %d", http.StatusOK, rs.StatusCode)
+	}
+	var annotations ResourceAnnotations
+	if err := json.NewDecoder(rs.Body).Decode(&annotations); err != nil {
+		t.Fatal(err)
+	}
+	if annotations.Annotations["ticket"] != "internal-ticket-1234" || len(annotations.Annotations) != 2 {
+		t.Errorf("expected the annotations that were set, got %v", annotations.Annotations)
+	}
+
+	// ARM responses do not.
+	for _, armURL := range []string{
+		ts.URL + cluster.ResourceId.String() + "?api-version=2024-06-10-preview",
+		ts.URL + "/subscriptions/" + dummySubscrtiptionId + "/providers/" + api.ProviderNamespace + "/" + api.ClusterResourceTypeName + "?api-version=2024-06-10-preview",
+	} {
+		rs, err := ts.Client().Get(armURL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, err := io.ReadAll(rs.Body)
+		rs.Body.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if rs.StatusCode != http.StatusOK {
+			t.Fatalf("expected status code %d from %s, got %d", http.StatusOK, armURL, rs.StatusCode)
+		}
+		if bytes.Contains(body, []byte("annotations")) || bytes.Contains(body, []byte("internal-ticket-1234")) {
+			t.Errorf("expected no annotations in the ARM response from %s, got %s", armURL, body)
+		}
+	}
+}
+
+func TestAdminClusterCompletionWebhook(t *testing.T) {
+	f, ts := newTestListServer(t)
+	f.config.CompletionWebhookSigningKey = "signing-key"
+	cluster := addTestCluster(t, f, dummyClusterName, nil)
+
+	webhookURL := func(clusterName string) string {
+		return ts.URL + "/admin/subscriptions/" + dummySubscrtiptionId +
+			"/resourceGroups/" + dummyResourceGroupId +
+			"/providers/" + api.ProviderNamespace + "/" + api.ClusterResourceTypeName +
+			"/" + clusterName + "/completionWebhook"
+	}
+
+	tests := []struct {
+		name               string
+		clusterName        string
+		url                string
+		secret             string
+		expectedStatusCode int
+	}{
+		{
+			name:               "Missing URL",
+			clusterName:        dummyClusterName,
+			expectedStatusCode: http.StatusBadRequest,
+		},
+		{
+			name:               "Plain HTTP URL",
+			clusterName:        dummyClusterName,
+			url:                "http://hooks.example.com/aro",
+			expectedStatusCode: http.StatusBadRequest,
+		},
+		{
+			name:               "Relative URL",
+			clusterName:        dummyClusterName,
+			url:                "/aro",
+			expectedStatusCode: http.StatusBadRequest,
+		},
+		{
+			name:               "Secret given",
+			clusterName:        dummyClusterName,
+			url:                "https://hooks.example.com/aro",
+			secret:             "s3cr3t",
+			expectedStatusCode: http.StatusBadRequest,
+		},
+		{
+			name:               "Cluster not found",
+			clusterName:        "missing",
+			url:                "https://hooks.example.com/aro",
+			expectedStatusCode: http.StatusNotFound,
+		},
+		{
+			name:               "Webhook set",
+			clusterName:        dummyClusterName,
+			url:                "https://hooks.example.com/aro",
+			expectedStatusCode: http.StatusOK,
+		},
+	}
+
+	var response CompletionWebhookResponse
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			body, err := json.Marshal(CompletionWebhookResponse{URL: test.url, Secret: test.secret})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			req, err := http.NewRequest(http.MethodPut, webhookURL(test.clusterName), bytes.NewReader(body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.Header.Set("Content-Type", "application/json")
+
+			rs, err := ts.Client().Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			body, err = io.ReadAll(rs.Body)
+			rs.Body.Close()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if rs.StatusCode != test.expectedStatusCode {
+				t.Fatalf("expected status code %d, got %d", test.expectedStatusCode, rs.StatusCode)
+			}
+			if rs.StatusCode == http.StatusOK {
+				err = json.Unmarshal(body, &response)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+		})
+	}
+
+	doc, err := f.dbClient.GetResourceDoc(context.Background(), cluster.ResourceId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if doc.CompletionWebhook == nil || doc.CompletionWebhook.URL != "https://hooks.example.com/aro" || doc.CompletionWebhook.KeyID == "" {
+		t.Fatalf("expected the webhook to be stored, got %+v", doc.CompletionWebhook)
+	}
+
+	// The secret is only returned, and is derived rather than stored.
+	expectedSecret := database.CompletionWebhookSecret([]byte(f.config.CompletionWebhookSigningKey), doc.CompletionWebhook.KeyID)
+	if response.Secret == "" || response.Secret != expectedSecret {
+		t.Errorf("expected the response to include the derived secret, got %+v", response)
+	}
+
+	req, err := http.NewRequest(http.MethodDelete, webhookURL(dummyClusterName), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rs, err := ts.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rs.Body.Close()
+
+	if rs.StatusCode != http.StatusNoContent {
+		t.Fatalf("expected status code %d, got %d", http.StatusNoContent, rs.StatusCode)
+	}
+
+	doc, err = f.dbClient.GetResourceDoc(context.Background(), cluster.ResourceId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if doc.CompletionWebhook != nil {
+		t.Errorf("expected the webhook to be removed, got %+v", doc.CompletionWebhook)
+	}
+}
@@ -0,0 +1,54 @@
+package frontend
+
+// Copyright (c) Microsoft Corporation.
+// Licensed under the Apache License 2.0.
+
+import (
+	"context"
+	"log/slog"
+)
+
+// Actions recorded in audit events.
+const (
+	AuditActionSubscriptionStateChange = "SubscriptionStateChange"
+	AuditActionResourceDelete          = "ResourceDelete"
+	AuditActionResourceGroupDelete     = "ResourceGroupDelete"
+)
+
+// auditMessage is the message of every audit event, which lets
+// audit events be told apart when no separate sink is configured.
+const auditMessage = "audit"
+
+// SetAuditLogger directs audit events, such as subscription state changes
+// and deletions, to the given logger instead of the operational logs so
+// they can be retained under their own policy. Set the audit logger before
+// the frontend starts serving requests.
+func (f *Frontend) SetAuditLogger(logger *slog.Logger) {
+	f.auditLogger = logger
+}
+
+// audit records an event for the request in ctx. Events go to the audit
+// logger if one is set, or else to the request logger so none are lost.
+func (f *Frontend) audit(ctx context.Context, action string, attrs ...slog.Attr) {
+	logger := f.auditLogger
+
+	if logger == nil {
+		logger = LoggerFromContext(ctx)
+	} else if correlationData, err := CorrelationDataFromContext(ctx); err == nil {
+		// The request logger already carries these.
+		attrs = append(attrs,
+			slog.String("request_id", correlationData.RequestID.String()),
+			slog.String("client_request_id", correlationData.ClientRequestID),
+			slog.String("correlation_request_id", correlationData.CorrelationRequestID))
+	}
+
+	attrs = append(attrs, slog.String("audit_action", action))
+
+	if systemData, err := SystemDataFromContext(ctx); err == nil && systemData != nil {
+		attrs = append(attrs,
+			slog.String("principal", systemData.LastModifiedBy),
+			slog.String("principal_type", string(systemData.LastModifiedByType)))
+	}
+
+	logger.LogAttrs(ctx, slog.LevelInfo, auditMessage, attrs...)
+}
@@ -0,0 +1,219 @@
+package frontend
+
+// Copyright (c) Microsoft Corporation.
+// Licensed under the Apache License 2.0.
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/Azure/ARO-HCP/internal/api"
+	"github.com/Azure/ARO-HCP/internal/api/arm"
+	"github.com/Azure/ARO-HCP/internal/database"
+)
+
+// decodeLogRecords decodes the records written by a slog.JSONHandler.
+func decodeLogRecords(t *testing.T, buffer *bytes.Buffer) []map[string]any {
+	t.Helper()
+
+	var records []map[string]any
+	decoder := json.NewDecoder(buffer)
+	for decoder.More() {
+		var record map[string]any
+		err := decoder.Decode(&record)
+		if err != nil {
+			t.Fatal(err)
+		}
+		records = append(records, record)
+	}
+	return records
+}
+
+// auditRecords returns the audit events among the log records.
+func auditRecords(records []map[string]any) []map[string]any {
+	var audits []map[string]any
+	for _, record := range records {
+		if record["msg"] == auditMessage {
+			audits = append(audits, record)
+		}
+	}
+	return audits
+}
+
+func TestSubscriptionStateChangeAudit(t *testing.T) {
+	tests := []struct {
+		name           string
+		currentState   arm.SubscriptionState
+		requestState   arm.SubscriptionState
+		separateSink   bool
+		expectedAudits int
+	}{
+		{
+			name:           "State change goes to audit sink",
+			currentState:   arm.SubscriptionStateRegistered,
+			requestState:   arm.SubscriptionStateSuspended,
+			separateSink:   true,
+			expectedAudits: 1,
+		},
+		{
+			name:           "Registration goes to audit sink",
+			requestState:   arm.SubscriptionStateRegistered,
+			separateSink:   true,
+			expectedAudits: 1,
+		},
+		{
+			name:           "Unchanged state is not audited",
+			currentState:   arm.SubscriptionStateRegistered,
+			requestState:   arm.SubscriptionStateRegistered,
+			separateSink:   true,
+			expectedAudits: 0,
+		},
+		{
+			name:           "State change goes to request log without audit sink",
+			currentState:   arm.SubscriptionStateRegistered,
+			requestState:   arm.SubscriptionStateWarned,
+			expectedAudits: 1,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var operationalLog, auditLog bytes.Buffer
+
+			f := &Frontend{
+				dbClient: database.NewCache(),
+				metrics:  NewPrometheusEmitter(prometheus.NewRegistry()),
+			}
+			if test.separateSink {
+				f.SetAuditLogger(slog.New(slog.NewJSONHandler(&auditLog, nil)))
+			}
+
+			subscriptionID := "00000000-0000-0000-0000-000000000000"
+
+			if test.currentState != "" {
+				err := f.dbClient.CreateSubscriptionDoc(context.TODO(), database.NewSubscriptionDocument(subscriptionID, &arm.Subscription{
+					State:            test.currentState,
+					RegistrationDate: api.Ptr(time.Now().String()),
+				}))
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			ts := httptest.NewUnstartedServer(f.routes())
+			ts.Config.BaseContext = func(net.Listener) context.Context {
+				ctx := context.Background()
+				ctx = ContextWithLogger(ctx, slog.New(slog.NewJSONHandler(&operationalLog, nil)))
+				ctx = ContextWithDBClient(ctx, f.dbClient)
+				return ctx
+			}
+			ts.Start()
+			defer ts.Close()
+
+			body, err := json.Marshal(&arm.Subscription{
+				State:            test.requestState,
+				RegistrationDate: api.Ptr(time.Now().String()),
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			req, err := http.NewRequest(http.MethodPut, ts.URL+"/subscriptions/"+subscriptionID+"?api-version=2.0", bytes.NewReader(body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set(arm.HeaderNameCorrelationRequestID, "audit-correlation-id")
+
+			rs, err := ts.Client().Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			rs.Body.Close()
+
+			if rs.StatusCode != http.StatusOK {
+				t.Fatalf("expected status code %d, got %d", http.StatusOK, rs.StatusCode)
+			}
+
+			// Closing the server waits for the handler to finish logging.
+			ts.Close()
+
+			operationalAudits := auditRecords(decodeLogRecords(t, &operationalLog))
+			sinkAudits := auditRecords(decodeLogRecords(t, &auditLog))
+
+			audits := operationalAudits
+			if test.separateSink {
+				audits = sinkAudits
+				if len(operationalAudits) != 0 {
+					t.Errorf("expected no audit events in the operational log, got %v", operationalAudits)
+				}
+			}
+
+			if len(audits) != test.expectedAudits {
+				t.Fatalf("expected %d audit events, got %d: %v", test.expectedAudits, len(audits), audits)
+			}
+			for _, audit := range audits {
+				if audit["audit_action"] != AuditActionSubscriptionStateChange {
+					t.Errorf("expected audit action %q, got %v", AuditActionSubscriptionStateChange, audit["audit_action"])
+				}
+				if audit["state"] != string(test.requestState) {
+					t.Errorf("expected state %q, got %v", test.requestState, audit["state"])
+				}
+				if audit["previous_state"] != string(test.currentState) {
+					t.Errorf("expected previous state %q, got %v", test.currentState, audit["previous_state"])
+				}
+				if audit["correlation_request_id"] != "audit-correlation-id" {
+					t.Errorf("expected correlation request ID, got %v", audit["correlation_request_id"])
+				}
+			}
+		})
+	}
+}
+
+func TestResourceDeleteAudit(t *testing.T) {
+	var auditLog bytes.Buffer
+
+	f, ts := newTestListServer(t)
+	f.SetAuditLogger(slog.New(slog.NewJSONHandler(&auditLog, nil)))
+
+	doc := addTestCluster(t, f, "audited-cluster", nil)
+	clusterURL := ts.URL + doc.ResourceId.String() + "?api-version=2024-06-10-preview"
+
+	req, err := http.NewRequest(http.MethodDelete, clusterURL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rs, err := ts.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rs.Body.Close()
+
+	if rs.StatusCode != http.StatusAccepted {
+		t.Fatalf("expected status code %d, got %d", http.StatusAccepted, rs.StatusCode)
+	}
+
+	ts.Close()
+
+	audits := auditRecords(decodeLogRecords(t, &auditLog))
+	if len(audits) != 1 {
+		t.Fatalf("expected 1 audit event, got %d: %v", len(audits), audits)
+	}
+	if audits[0]["audit_action"] != AuditActionResourceDelete {
+		t.Errorf("expected audit action %q, got %v", AuditActionResourceDelete, audits[0]["audit_action"])
+	}
+	if !strings.EqualFold(audits[0]["resource_id"].(string), doc.ResourceId.String()) {
+		t.Errorf("expected resource ID %q, got %v", doc.ResourceId, audits[0]["resource_id"])
+	}
+}
@@ -0,0 +1,285 @@
+package frontend
+
+// Copyright (c) Microsoft Corporation.
+// Licensed under the Apache License 2.0.
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/Azure/ARO-HCP/internal/api/arm"
+)
+
+// Config gathers the tunable settings of a Frontend.
+type Config struct {
+	// Location is the Azure region served by the Frontend.
+	Location string
+
+	// SupportedLocations lists the Azure regions that requests may target
+	// in their path. If empty, only Location is supported. Locations are
+	// compared in their normalized form, so "East US" matches "eastus".
+	SupportedLocations []string
+
+	// DefaultPageSize is the number of items returned in a page of a
+	// resource collection when the client does not request a size.
+	// It must not exceed MaxPageSize.
+	DefaultPageSize int32
+
+	// MaxPageSize caps the number of items a client can request in
+	// a page of a resource collection.
+	MaxPageSize int32
+
+	// MaxNodePools is the number of node pools that may be created in
+	// a single cluster, unless overridden for a subscription.
+	MaxNodePools int
+
+	// MaxClusters is the number of clusters that may be created in a
+	// single subscription, unless overridden for the subscription.
+	// Zero means no limit.
+	MaxClusters int
+
+	// MinNodePoolReplicas is the number of replicas below which a node
+	// pool update may not shrink a node pool, unless the request sets
+	// the HeaderNameAllowNodePoolShrink header. Zero allows any shrink.
+	MinNodePoolReplicas int32
+
+	// MaxOperationWait caps how long a client can ask an operation
+	// result request to wait for the operation to finish.
+	MaxOperationWait time.Duration
+
+	// MaxOperationWaiters caps how many operation result requests and
+	// provisioning state event streams can wait at once. Requests beyond
+	// the cap return without waiting, so that waiting requests cannot
+	// exhaust the server's connections.
+	MaxOperationWaiters int
+
+	// MaxHeaderBytes caps the total size of request header names and
+	// values. Larger requests are rejected with "431 Request Header
+	// Fields Too Large".
+	MaxHeaderBytes int
+
+	// MaxURLLength caps the length of the request URL, path and query
+	// included. Longer requests are rejected with "414 URI Too Long".
+	MaxURLLength int
+
+	// MaxBodyBytes caps the size of request bodies. Larger requests are
+	// rejected with "413 Request Entity Too Large".
+	MaxBodyBytes int64
+
+	// ContentEncodings lists the content encodings, such as "gzip", that
+	// request bodies may be sent in besides identity. Bodies are decoded
+	// before MaxBodyBytes is enforced. Other encodings are rejected with
+	// "415 Unsupported Media Type".
+	ContentEncodings []string
+
+	// ShutdownGracePeriod caps how long Shutdown waits for in-flight
+	// requests to finish before closing their connections.
+	ShutdownGracePeriod time.Duration
+
+	// SubscriptionWriteRetries is how many times a subscription PUT that
+	// conflicts with a concurrent write is retried before the request
+	// fails with "409 Conflict". Zero disables retries.
+	SubscriptionWriteRetries int
+
+	// SubscriptionWriteBackoff is the base delay before retrying a
+	// conflicting subscription write. It doubles with each retry and
+	// is jittered so that concurrent writers spread out.
+	SubscriptionWriteBackoff time.Duration
+
+	// SubscriptionRateLimit is how many requests per second each
+	// subscription may send on average before its requests are rejected
+	// with "429 Too Many Requests".
+	SubscriptionRateLimit float64
+
+	// SubscriptionRateBurst is how many requests a subscription
+	// may send at once, above its average rate.
+	SubscriptionRateBurst int
+
+	// HealthCheckTimeout caps how long /healthz waits for the database
+	// to respond before reporting the frontend unhealthy.
+	HealthCheckTimeout time.Duration
+
+	// SubscriptionMetricsInterval is how often the number of subscriptions
+	// in each state is counted for the subscriptions gauge.
+	SubscriptionMetricsInterval time.Duration
+
+	// SubscriptionRetention is how long the document of a deleted
+	// subscription is kept, for auditing, before it is reaped.
+	SubscriptionRetention time.Duration
+
+	// SubscriptionReapInterval is how often the documents of deleted
+	// subscriptions past their retention are reaped.
+	SubscriptionReapInterval time.Duration
+
+	// DBCircuitBreakerThreshold is how many database calls in a row must
+	// fail before requests are rejected with "503 Service Unavailable",
+	// to give the database room to recover.
+	DBCircuitBreakerThreshold int
+
+	// DBCircuitBreakerCooldown is how long requests are rejected once
+	// the database circuit breaker opens.
+	DBCircuitBreakerCooldown time.Duration
+
+	// IdentityURLHostSuffixes lists the hosts, by domain suffix, that
+	// the managed identity URL passed by ARM on cluster creates and
+	// updates may point at. If empty, the URL is not required, as when
+	// requests do not come through ARM.
+	IdentityURLHostSuffixes []string
+
+	// GlobalPreviewFeatures lists preview features enabled for every
+	// subscription, whether or not the subscription registered them,
+	// as when a feature is rolled out ahead of general availability.
+	GlobalPreviewFeatures []string
+
+	// AdminTokens lists the bearer tokens which authorize requests to
+	// the internal admin routes. If empty, the admin routes are disabled.
+	AdminTokens []string
+
+	// CompletionWebhookSigningKey is the key from which the secrets that
+	// sign completion webhook requests are derived. It must match the
+	// backend's. If empty, completion webhooks are registered unsigned.
+	CompletionWebhookSigningKey string
+
+	// SynchronousOperations completes resource operations inline with a
+	// terminal response instead of returning while the operation is still
+	// in progress. This keeps integration tests deterministic without
+	// polling and must not be enabled in production, since the operation
+	// does not actually wait for Cluster Service.
+	SynchronousOperations bool
+}
+
+// DefaultConfig returns a Config with default values for everything
+// but the location.
+func DefaultConfig() Config {
+	return Config{
+		DefaultPageSize:     DefaultPageSize,
+		MaxPageSize:         MaxPageSize,
+		MaxNodePools:        DefaultMaxNodePools,
+		MaxClusters:         DefaultMaxClusters,
+		MinNodePoolReplicas: DefaultMinNodePoolReplicas,
+		MaxOperationWait:    MaxOperationWait,
+		MaxOperationWaiters: DefaultMaxOperationWaiters,
+		MaxHeaderBytes:      DefaultMaxHeaderBytes,
+		MaxURLLength:        DefaultMaxURLLength,
+		MaxBodyBytes:        DefaultMaxBodyBytes,
+		ContentEncodings:    DefaultContentEncodings(),
+		ShutdownGracePeriod: DefaultShutdownGracePeriod,
+
+		SubscriptionWriteRetries:    DefaultSubscriptionWriteRetries,
+		SubscriptionWriteBackoff:    DefaultSubscriptionWriteBackoff,
+		SubscriptionRateLimit:       DefaultSubscriptionRateLimit,
+		SubscriptionRateBurst:       DefaultSubscriptionRateBurst,
+		HealthCheckTimeout:          DefaultHealthCheckTimeout,
+		SubscriptionMetricsInterval: DefaultSubscriptionMetricsInterval,
+		SubscriptionRetention:       DefaultSubscriptionRetention,
+		SubscriptionReapInterval:    DefaultSubscriptionReapInterval,
+		DBCircuitBreakerThreshold:   DefaultDBCircuitBreakerThreshold,
+		DBCircuitBreakerCooldown:    DefaultDBCircuitBreakerCooldown,
+		IdentityURLHostSuffixes:     DefaultIdentityURLHostSuffixes(),
+	}
+}
+
+// Validate returns an error describing every invalid setting in the
+// Config, or nil if the Config is valid.
+func (c Config) Validate() error {
+	var errs []error
+
+	if c.Location == "" {
+		errs = append(errs, errors.New("location is required"))
+	}
+	if c.DefaultPageSize < 1 || c.MaxPageSize < 1 {
+		errs = append(errs, errors.New("page sizes must be positive"))
+	} else if c.DefaultPageSize > c.MaxPageSize {
+		errs = append(errs, fmt.Errorf("default page size %d exceeds max page size %d", c.DefaultPageSize, c.MaxPageSize))
+	}
+	if c.MaxNodePools < 1 {
+		errs = append(errs, errors.New("max node pools must be positive"))
+	}
+	if c.MaxClusters < 0 {
+		errs = append(errs, errors.New("max clusters must not be negative"))
+	}
+	if c.MinNodePoolReplicas < 0 {
+		errs = append(errs, errors.New("min node pool replicas must not be negative"))
+	}
+	if c.MaxOperationWait < 0 {
+		errs = append(errs, errors.New("max operation wait must not be negative"))
+	}
+	if c.MaxOperationWaiters < 1 {
+		errs = append(errs, errors.New("max operation waiters must be positive"))
+	}
+	if c.MaxHeaderBytes < 1 {
+		errs = append(errs, errors.New("max header bytes must be positive"))
+	}
+	if c.MaxURLLength < 1 {
+		errs = append(errs, errors.New("max URL length must be positive"))
+	}
+	if c.MaxBodyBytes < 1 {
+		errs = append(errs, errors.New("max body bytes must be positive"))
+	}
+	if c.ShutdownGracePeriod < 0 {
+		errs = append(errs, errors.New("shutdown grace period must not be negative"))
+	}
+	if c.SubscriptionWriteRetries < 0 {
+		errs = append(errs, errors.New("subscription write retries must not be negative"))
+	}
+	if c.SubscriptionWriteBackoff < 0 {
+		errs = append(errs, errors.New("subscription write backoff must not be negative"))
+	}
+	if c.SubscriptionRateLimit < 0 {
+		errs = append(errs, errors.New("subscription rate limit must not be negative"))
+	}
+	if c.SubscriptionRateBurst < 0 {
+		errs = append(errs, errors.New("subscription rate burst must not be negative"))
+	}
+	if c.HealthCheckTimeout < 0 {
+		errs = append(errs, errors.New("health check timeout must not be negative"))
+	}
+	if c.SubscriptionMetricsInterval < 0 {
+		errs = append(errs, errors.New("subscription metrics interval must not be negative"))
+	}
+	if c.SubscriptionRetention <= 0 {
+		errs = append(errs, errors.New("subscription retention must be positive"))
+	}
+	if c.SubscriptionReapInterval <= 0 {
+		errs = append(errs, errors.New("subscription reap interval must be positive"))
+	}
+	if c.DBCircuitBreakerThreshold < 1 {
+		errs = append(errs, errors.New("database circuit breaker threshold must be positive"))
+	}
+	if c.DBCircuitBreakerCooldown <= 0 {
+		errs = append(errs, errors.New("database circuit breaker cooldown must be positive"))
+	}
+
+	for _, suffix := range c.IdentityURLHostSuffixes {
+		if strings.Trim(suffix, ".") == "" {
+			errs = append(errs, fmt.Errorf("invalid identity URL host suffix %q", suffix))
+		}
+	}
+
+	for _, encoding := range c.ContentEncodings {
+		if _, ok := contentDecoders[strings.ToLower(encoding)]; !ok {
+			errs = append(errs, fmt.Errorf("unsupported content encoding %q", encoding))
+		}
+	}
+
+	for _, feature := range c.GlobalPreviewFeatures {
+		if !slices.ContainsFunc(previewFeatures, func(name string) bool { return strings.EqualFold(name, feature) }) {
+			errs = append(errs, fmt.Errorf("unknown global preview feature %q", feature))
+		}
+	}
+
+	for _, location := range c.SupportedLocations {
+		if arm.NormalizeLocation(location) == "" {
+			errs = append(errs, fmt.Errorf("invalid supported location %q", location))
+		}
+	}
+
+	if slices.Contains(c.AdminTokens, "") {
+		errs = append(errs, errors.New("admin tokens must not be empty"))
+	}
+
+	return errors.Join(errs...)
+}
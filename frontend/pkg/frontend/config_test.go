@@ -0,0 +1,262 @@
+package frontend
+
+// Copyright (c) Microsoft Corporation.
+// Licensed under the Apache License 2.0.
+
+import (
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/Azure/ARO-HCP/internal/api"
+	"github.com/Azure/ARO-HCP/internal/database"
+)
+
+func TestConfigValidate(t *testing.T) {
+	tests := []struct {
+		name        string
+		modify      func(*Config)
+		expectError bool
+	}{
+		{
+			name:        "Defaults with location",
+			modify:      func(c *Config) {},
+			expectError: false,
+		},
+		{
+			name:        "Missing location",
+			modify:      func(c *Config) { c.Location = "" },
+			expectError: true,
+		},
+		{
+			name: "Valid page sizes",
+			modify: func(c *Config) {
+				c.DefaultPageSize = 10
+				c.MaxPageSize = 100
+			},
+			expectError: false,
+		},
+		{
+			name: "Equal page sizes",
+			modify: func(c *Config) {
+				c.DefaultPageSize = 50
+				c.MaxPageSize = 50
+			},
+			expectError: false,
+		},
+		{
+			name: "Default page size exceeds max",
+			modify: func(c *Config) {
+				c.DefaultPageSize = 200
+				c.MaxPageSize = 100
+			},
+			expectError: true,
+		},
+		{
+			name:        "Zero default page size",
+			modify:      func(c *Config) { c.DefaultPageSize = 0 },
+			expectError: true,
+		},
+		{
+			name:        "Negative max page size",
+			modify:      func(c *Config) { c.MaxPageSize = -1 },
+			expectError: true,
+		},
+		{
+			name:        "Valid max node pools",
+			modify:      func(c *Config) { c.MaxNodePools = 5 },
+			expectError: false,
+		},
+		{
+			name:        "Zero max node pools",
+			modify:      func(c *Config) { c.MaxNodePools = 0 },
+			expectError: true,
+		},
+		{
+			name:        "Negative max node pools",
+			modify:      func(c *Config) { c.MaxNodePools = -1 },
+			expectError: true,
+		},
+		{
+			name:        "Zero max clusters",
+			modify:      func(c *Config) { c.MaxClusters = 0 },
+			expectError: false,
+		},
+		{
+			name:        "Negative max clusters",
+			modify:      func(c *Config) { c.MaxClusters = -1 },
+			expectError: true,
+		},
+		{
+			name:        "Zero min node pool replicas",
+			modify:      func(c *Config) { c.MinNodePoolReplicas = 0 },
+			expectError: false,
+		},
+		{
+			name:        "Negative min node pool replicas",
+			modify:      func(c *Config) { c.MinNodePoolReplicas = -1 },
+			expectError: true,
+		},
+		{
+			name:        "Zero max operation wait",
+			modify:      func(c *Config) { c.MaxOperationWait = 0 },
+			expectError: false,
+		},
+		{
+			name:        "Negative max operation wait",
+			modify:      func(c *Config) { c.MaxOperationWait = -time.Second },
+			expectError: true,
+		},
+		{
+			name:        "Zero max operation waiters",
+			modify:      func(c *Config) { c.MaxOperationWaiters = 0 },
+			expectError: true,
+		},
+		{
+			name:        "Zero max header bytes",
+			modify:      func(c *Config) { c.MaxHeaderBytes = 0 },
+			expectError: true,
+		},
+		{
+			name:        "Zero max URL length",
+			modify:      func(c *Config) { c.MaxURLLength = 0 },
+			expectError: true,
+		},
+		{
+			name:        "Zero max body bytes",
+			modify:      func(c *Config) { c.MaxBodyBytes = 0 },
+			expectError: true,
+		},
+		{
+			name:        "No content encodings",
+			modify:      func(c *Config) { c.ContentEncodings = nil },
+			expectError: false,
+		},
+		{
+			name:        "Unsupported content encoding",
+			modify:      func(c *Config) { c.ContentEncodings = []string{"gzip", "br"} },
+			expectError: true,
+		},
+		{
+			name:        "Negative shutdown grace period",
+			modify:      func(c *Config) { c.ShutdownGracePeriod = -time.Second },
+			expectError: true,
+		},
+		{
+			name:        "Negative subscription rate limit",
+			modify:      func(c *Config) { c.SubscriptionRateLimit = -1 },
+			expectError: true,
+		},
+		{
+			name:        "Negative subscription rate burst",
+			modify:      func(c *Config) { c.SubscriptionRateBurst = -1 },
+			expectError: true,
+		},
+		{
+			name:        "Negative health check timeout",
+			modify:      func(c *Config) { c.HealthCheckTimeout = -time.Second },
+			expectError: true,
+		},
+		{
+			name:        "Zero subscription write retries",
+			modify:      func(c *Config) { c.SubscriptionWriteRetries = 0 },
+			expectError: false,
+		},
+		{
+			name:        "Negative subscription write retries",
+			modify:      func(c *Config) { c.SubscriptionWriteRetries = -1 },
+			expectError: true,
+		},
+		{
+			name:        "Negative subscription write backoff",
+			modify:      func(c *Config) { c.SubscriptionWriteBackoff = -time.Second },
+			expectError: true,
+		},
+		{
+			name:        "Negative subscription metrics interval",
+			modify:      func(c *Config) { c.SubscriptionMetricsInterval = -time.Minute },
+			expectError: true,
+		},
+		{
+			name:        "Zero subscription retention",
+			modify:      func(c *Config) { c.SubscriptionRetention = 0 },
+			expectError: true,
+		},
+		{
+			name:        "Zero subscription reap interval",
+			modify:      func(c *Config) { c.SubscriptionReapInterval = 0 },
+			expectError: true,
+		},
+		{
+			name:        "Zero database circuit breaker threshold",
+			modify:      func(c *Config) { c.DBCircuitBreakerThreshold = 0 },
+			expectError: true,
+		},
+		{
+			name:        "Zero database circuit breaker cooldown",
+			modify:      func(c *Config) { c.DBCircuitBreakerCooldown = 0 },
+			expectError: true,
+		},
+		{
+			name:        "No identity URL host suffixes",
+			modify:      func(c *Config) { c.IdentityURLHostSuffixes = nil },
+			expectError: false,
+		},
+		{
+			name:        "Empty identity URL host suffix",
+			modify:      func(c *Config) { c.IdentityURLHostSuffixes = []string{"identity.azure.net", "."} },
+			expectError: true,
+		},
+		{
+			name:        "Supported locations",
+			modify:      func(c *Config) { c.SupportedLocations = []string{"eastus", "West Europe"} },
+			expectError: false,
+		},
+		{
+			name:        "Blank supported location",
+			modify:      func(c *Config) { c.SupportedLocations = []string{"eastus", " "} },
+			expectError: true,
+		},
+		{
+			name:        "Empty admin token",
+			modify:      func(c *Config) { c.AdminTokens = []string{""} },
+			expectError: true,
+		},
+		{
+			name:        "Known global preview feature",
+			modify:      func(c *Config) { c.GlobalPreviewFeatures = []string{api.FeatureExternalAuth} },
+			expectError: false,
+		},
+		{
+			name:        "Unknown global preview feature",
+			modify:      func(c *Config) { c.GlobalPreviewFeatures = []string{"Microsoft.RedHatOpenShift/Bogus"} },
+			expectError: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			config := DefaultConfig()
+			config.Location = dummyLocation
+			test.modify(&config)
+
+			err := config.Validate()
+			if test.expectError && err == nil {
+				t.Error("expected an error, got nil")
+			} else if !test.expectError && err != nil {
+				t.Errorf("expected no error, got %v", err)
+			}
+		})
+	}
+}
+
+func TestNewFrontendRejectsInvalidConfig(t *testing.T) {
+	config := DefaultConfig()
+
+	_, err := NewFrontend(config, slog.Default(), nil, nil, NewPrometheusEmitter(prometheus.NewRegistry()), database.NewCache(), nil)
+	if err == nil {
+		t.Error("expected an error for a config without a location")
+	}
+}
@@ -9,9 +9,30 @@ const (
 	// APIVersionKey is the request parameter name for the API version.
 	APIVersionKey = "api-version"
 
+	// ChangedSinceKey is the list request parameter name for limiting
+	// results to resources modified after a given RFC 3339 timestamp.
+	ChangedSinceKey = "changedSince"
+
+	// WaitKey is the operation request parameter name for the number of
+	// seconds to wait for the operation to reach a terminal state.
+	WaitKey = "wait"
+
+	// ValidateOnlyKey is the write request parameter name for validating
+	// a request without applying it.
+	ValidateOnlyKey = "validateOnly"
+
+	// StatusKey, RequestKey, StartedAfterKey and StartedBeforeKey are the
+	// admin operation list request parameter names for filtering by status,
+	// operation type and RFC 3339 start time bounds.
+	StatusKey        = "status"
+	RequestKey       = "request"
+	StartedAfterKey  = "startedAfter"
+	StartedBeforeKey = "startedBefore"
+
 	// Wildcard path segment names for request multiplexing, must be lowercase as we lowercase the request URL pattern when registering handlers
 	PathSegmentActionName        = "actionname"
 	PathSegmentDeploymentName    = "deploymentname"
+	PathSegmentDiagnosticSetting = "diagnosticsettingname"
 	PathSegmentLocation          = "location"
 	PathSegmentNodePoolName      = "nodepoolname"
 	PathSegmentOperationID       = "operationid"
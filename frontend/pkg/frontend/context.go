@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"log/slog"
+	"net/url"
 
 	"github.com/Azure/ARO-HCP/frontend/pkg/config"
 	"github.com/Azure/ARO-HCP/internal/api"
@@ -34,6 +35,9 @@ const (
 	contextKeyResourceID
 	contextKeyCorrelationData
 	contextKeySystemData
+	contextKeyEmitter
+	contextKeySubscription
+	contextKeyIdentityURL
 )
 
 func ContextWithOriginalPath(ctx context.Context, originalPath string) context.Context {
@@ -158,3 +162,48 @@ func SystemDataFromContext(ctx context.Context) (*arm.SystemData, error) {
 	}
 	return systemData, nil
 }
+
+func ContextWithEmitter(ctx context.Context, emitter Emitter) context.Context {
+	return context.WithValue(ctx, contextKeyEmitter, emitter)
+}
+
+func EmitterFromContext(ctx context.Context) (Emitter, error) {
+	emitter, ok := ctx.Value(contextKeyEmitter).(Emitter)
+	if !ok {
+		err := &ContextError{
+			got: emitter,
+		}
+		return emitter, err
+	}
+	return emitter, nil
+}
+
+func ContextWithSubscription(ctx context.Context, subscription *arm.Subscription) context.Context {
+	return context.WithValue(ctx, contextKeySubscription, subscription)
+}
+
+func SubscriptionFromContext(ctx context.Context) (*arm.Subscription, error) {
+	subscription, ok := ctx.Value(contextKeySubscription).(*arm.Subscription)
+	if !ok {
+		err := &ContextError{
+			got: subscription,
+		}
+		return subscription, err
+	}
+	return subscription, nil
+}
+
+func ContextWithIdentityURL(ctx context.Context, identityURL *url.URL) context.Context {
+	return context.WithValue(ctx, contextKeyIdentityURL, identityURL)
+}
+
+func IdentityURLFromContext(ctx context.Context) (*url.URL, error) {
+	identityURL, ok := ctx.Value(contextKeyIdentityURL).(*url.URL)
+	if !ok {
+		err := &ContextError{
+			got: identityURL,
+		}
+		return identityURL, err
+	}
+	return identityURL, nil
+}
@@ -0,0 +1,226 @@
+package frontend
+
+// Copyright (c) Microsoft Corporation.
+// Licensed under the Apache License 2.0.
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"net/http"
+	"path"
+	"slices"
+	"strings"
+
+	"github.com/Azure/ARO-HCP/internal/api/arm"
+	"github.com/Azure/ARO-HCP/internal/database"
+)
+
+// checkDiagnosticSettingsParent verifies the resource that diagnostic
+// settings are associated with exists, returning a "404 Not Found"
+// error if it does not.
+func (f *Frontend) checkDiagnosticSettingsParent(ctx context.Context, parentID *arm.ResourceID) *arm.CloudError {
+	_, err := f.dbClient.GetResourceDoc(ctx, parentID)
+	if err != nil {
+		return toCloudError(ctx, err, parentID)
+	}
+
+	return nil
+}
+
+func (f *Frontend) ArmDiagnosticSettingsList(writer http.ResponseWriter, request *http.Request) {
+	ctx := request.Context()
+	logger := LoggerFromContext(ctx)
+
+	// The collection path is not a valid resource ID, so strip the
+	// "providers/Microsoft.Insights/diagnosticSettings" segments
+	// to obtain the resource the settings are associated with.
+	originalPath, _ := OriginalPathFromContext(ctx)
+	if originalPath == "" {
+		originalPath = request.URL.Path
+	}
+	parentID, err := arm.ParseResourceID(path.Dir(path.Dir(path.Dir(originalPath))))
+	if err != nil {
+		logger.Error(err.Error())
+		arm.WriteInternalServerError(writer)
+		return
+	}
+
+	cloudError := f.checkDiagnosticSettingsParent(ctx, parentID)
+	if cloudError != nil {
+		arm.WriteCloudError(writer, cloudError)
+		return
+	}
+
+	list := arm.DiagnosticSettingsList{Value: []*arm.DiagnosticSetting{}}
+
+	doc, err := f.dbClient.GetDiagnosticSettingsDoc(ctx, parentID)
+	if err != nil && !errors.Is(err, database.ErrNotFound) {
+		logger.Error(err.Error())
+		arm.WriteInternalServerError(writer)
+		return
+	}
+	if doc != nil {
+		for _, key := range slices.Sorted(maps.Keys(doc.Settings)) {
+			list.Value = append(list.Value, doc.Settings[key])
+		}
+	}
+
+	_, err = arm.WriteJSONResponse(writer, http.StatusOK, list)
+	if err != nil {
+		logger.Error(err.Error())
+	}
+}
+
+func (f *Frontend) ArmDiagnosticSettingGet(writer http.ResponseWriter, request *http.Request) {
+	ctx := request.Context()
+	logger := LoggerFromContext(ctx)
+
+	resourceID, err := ResourceIDFromContext(ctx)
+	if err != nil {
+		logger.Error(err.Error())
+		arm.WriteInternalServerError(writer)
+		return
+	}
+
+	cloudError := f.checkDiagnosticSettingsParent(ctx, resourceID.GetParent())
+	if cloudError != nil {
+		arm.WriteCloudError(writer, cloudError)
+		return
+	}
+
+	var setting *arm.DiagnosticSetting
+
+	doc, err := f.dbClient.GetDiagnosticSettingsDoc(ctx, resourceID.GetParent())
+	if err != nil && !errors.Is(err, database.ErrNotFound) {
+		logger.Error(err.Error())
+		arm.WriteInternalServerError(writer)
+		return
+	}
+	if doc != nil {
+		setting = doc.Settings[strings.ToLower(resourceID.Name)]
+	}
+	if setting == nil {
+		arm.WriteResourceNotFoundError(writer, resourceID)
+		return
+	}
+
+	_, err = arm.WriteJSONResponse(writer, http.StatusOK, setting)
+	if err != nil {
+		logger.Error(err.Error())
+	}
+}
+
+func (f *Frontend) ArmDiagnosticSettingCreateOrUpdate(writer http.ResponseWriter, request *http.Request) {
+	ctx := request.Context()
+	logger := LoggerFromContext(ctx)
+
+	resourceID, err := ResourceIDFromContext(ctx)
+	if err != nil {
+		logger.Error(err.Error())
+		arm.WriteInternalServerError(writer)
+		return
+	}
+
+	cloudError := f.checkDiagnosticSettingsParent(ctx, resourceID.GetParent())
+	if cloudError != nil {
+		arm.WriteCloudError(writer, cloudError)
+		return
+	}
+
+	body, err := BodyFromContext(ctx)
+	if err != nil {
+		logger.Error(err.Error())
+		arm.WriteInternalServerError(writer)
+		return
+	}
+
+	var setting arm.DiagnosticSetting
+	err = json.Unmarshal(body, &setting)
+	if err != nil {
+		logger.Error(err.Error())
+		arm.WriteInvalidRequestContentError(writer, err)
+		return
+	}
+
+	if !setting.Properties.HasDestination() {
+		arm.WriteError(writer, http.StatusBadRequest,
+			arm.CloudErrorCodeInvalidRequestContent, "properties",
+			"At least one destination must be specified: storageAccountId, serviceBusRuleId, eventHubAuthorizationRuleId, workspaceId or marketplacePartnerId.")
+		return
+	}
+
+	// Read-only fields come from the request URL.
+	setting.ID = resourceID.String()
+	setting.Name = resourceID.Name
+	setting.Type = arm.DiagnosticSettingsResourceType.String()
+	setting.SystemData = nil
+
+	key := strings.ToLower(resourceID.Name)
+
+	_, err = f.dbClient.UpdateDiagnosticSettingsDoc(ctx, resourceID.GetParent(), func(doc *database.DiagnosticSettingsDocument) bool {
+		if doc.Settings == nil {
+			doc.Settings = make(map[string]*arm.DiagnosticSetting)
+		}
+		doc.Settings[key] = &setting
+		return true
+	})
+	if errors.Is(err, database.ErrNotFound) {
+		doc := database.NewDiagnosticSettingsDocument(resourceID.GetParent())
+		doc.Settings[key] = &setting
+		err = f.dbClient.CreateDiagnosticSettingsDoc(ctx, doc)
+	}
+	if err != nil {
+		logger.Error(err.Error())
+		arm.WriteInternalServerError(writer)
+		return
+	}
+	logger.Info(fmt.Sprintf("stored diagnostic setting %s", resourceID))
+
+	_, err = arm.WriteJSONResponse(writer, http.StatusOK, setting)
+	if err != nil {
+		logger.Error(err.Error())
+	}
+}
+
+func (f *Frontend) ArmDiagnosticSettingDelete(writer http.ResponseWriter, request *http.Request) {
+	ctx := request.Context()
+	logger := LoggerFromContext(ctx)
+
+	resourceID, err := ResourceIDFromContext(ctx)
+	if err != nil {
+		logger.Error(err.Error())
+		arm.WriteInternalServerError(writer)
+		return
+	}
+
+	cloudError := f.checkDiagnosticSettingsParent(ctx, resourceID.GetParent())
+	if cloudError != nil {
+		arm.WriteCloudError(writer, cloudError)
+		return
+	}
+
+	key := strings.ToLower(resourceID.Name)
+
+	deleted, err := f.dbClient.UpdateDiagnosticSettingsDoc(ctx, resourceID.GetParent(), func(doc *database.DiagnosticSettingsDocument) bool {
+		if _, ok := doc.Settings[key]; !ok {
+			return false
+		}
+		delete(doc.Settings, key)
+		return true
+	})
+	if err != nil && !errors.Is(err, database.ErrNotFound) {
+		logger.Error(err.Error())
+		arm.WriteInternalServerError(writer)
+		return
+	}
+
+	if deleted {
+		logger.Info(fmt.Sprintf("deleted diagnostic setting %s", resourceID))
+		writer.WriteHeader(http.StatusOK)
+	} else {
+		writer.WriteHeader(http.StatusNoContent)
+	}
+}
@@ -0,0 +1,168 @@
+package frontend
+
+// Copyright (c) Microsoft Corporation.
+// Licensed under the Apache License 2.0.
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/Azure/ARO-HCP/internal/api"
+	"github.com/Azure/ARO-HCP/internal/api/arm"
+)
+
+const diagnosticSettingsAPIVersion = "2021-05-01-preview"
+
+func TestDiagnosticSettings(t *testing.T) {
+	f, ts := newTestListServer(t)
+	cluster := addTestCluster(t, f, dummyClusterName, nil)
+
+	collectionURL := ts.URL + cluster.ResourceId.String() + "/" + PatternDiagnosticSettingsCollection
+	settingURL := collectionURL + "/my-setting?api-version=" + diagnosticSettingsAPIVersion
+	collectionURL += "?api-version=" + diagnosticSettingsAPIVersion
+
+	do := func(t *testing.T, method, url string, body any) *http.Response {
+		t.Helper()
+
+		var data []byte
+		if body != nil {
+			var err error
+			data, err = json.Marshal(body)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		req, err := http.NewRequest(method, url, bytes.NewReader(data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Content-Type", "application/json")
+
+		rs, err := ts.Client().Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { rs.Body.Close() })
+
+		return rs
+	}
+
+	listNames := func(t *testing.T) []string {
+		t.Helper()
+
+		rs := do(t, http.MethodGet, collectionURL, nil)
+		if rs.StatusCode != http.StatusOK {
+			t.Fatalf("expected status code %d, got %d", http.StatusOK, rs.StatusCode)
+		}
+
+		var list arm.DiagnosticSettingsList
+		err := json.NewDecoder(rs.Body).Decode(&list)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if list.Value == nil {
+			t.Fatal("expected a value array")
+		}
+
+		var names []string
+		for _, setting := range list.Value {
+			names = append(names, setting.Name)
+		}
+		return names
+	}
+
+	setting := arm.DiagnosticSetting{
+		Properties: arm.DiagnosticSettingProperties{
+			WorkspaceID: api.Ptr("/subscriptions/" + dummySubscrtiptionId + "/resourceGroups/monitoring/providers/Microsoft.OperationalInsights/workspaces/logs"),
+			Logs: []arm.LogSettings{
+				{CategoryGroup: api.Ptr("allLogs"), Enabled: true},
+			},
+		},
+	}
+
+	t.Run("List is initially empty", func(t *testing.T) {
+		if names := listNames(t); len(names) != 0 {
+			t.Errorf("expected no diagnostic settings, got %v", names)
+		}
+	})
+
+	t.Run("Create requires a destination", func(t *testing.T) {
+		rs := do(t, http.MethodPut, settingURL, arm.DiagnosticSetting{})
+		if rs.StatusCode != http.StatusBadRequest {
+			t.Errorf("expected status code %d, got %d", http.StatusBadRequest, rs.StatusCode)
+		}
+	})
+
+	t.Run("Create", func(t *testing.T) {
+		rs := do(t, http.MethodPut, settingURL, setting)
+		if rs.StatusCode != http.StatusOK {
+			t.Fatalf("expected status code %d, got %d", http.StatusOK, rs.StatusCode)
+		}
+
+		var created arm.DiagnosticSetting
+		err := json.NewDecoder(rs.Body).Decode(&created)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if created.Name != "my-setting" || created.Type != arm.DiagnosticSettingsResourceType.String() {
+			t.Errorf("unexpected name or type: %s %s", created.Name, created.Type)
+		}
+	})
+
+	t.Run("Get", func(t *testing.T) {
+		rs := do(t, http.MethodGet, settingURL, nil)
+		if rs.StatusCode != http.StatusOK {
+			t.Fatalf("expected status code %d, got %d", http.StatusOK, rs.StatusCode)
+		}
+
+		var fetched arm.DiagnosticSetting
+		err := json.NewDecoder(rs.Body).Decode(&fetched)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if fetched.Properties.WorkspaceID == nil || *fetched.Properties.WorkspaceID != *setting.Properties.WorkspaceID {
+			t.Errorf("expected workspace %s, got %v", *setting.Properties.WorkspaceID, fetched.Properties.WorkspaceID)
+		}
+	})
+
+	t.Run("List includes the setting", func(t *testing.T) {
+		if names := listNames(t); len(names) != 1 || names[0] != "my-setting" {
+			t.Errorf("expected [my-setting], got %v", names)
+		}
+	})
+
+	t.Run("Delete", func(t *testing.T) {
+		rs := do(t, http.MethodDelete, settingURL, nil)
+		if rs.StatusCode != http.StatusOK {
+			t.Errorf("expected status code %d, got %d", http.StatusOK, rs.StatusCode)
+		}
+
+		rs = do(t, http.MethodDelete, settingURL, nil)
+		if rs.StatusCode != http.StatusNoContent {
+			t.Errorf("expected status code %d on repeated delete, got %d", http.StatusNoContent, rs.StatusCode)
+		}
+
+		rs = do(t, http.MethodGet, settingURL, nil)
+		if rs.StatusCode != http.StatusNotFound {
+			t.Errorf("expected status code %d after delete, got %d", http.StatusNotFound, rs.StatusCode)
+		}
+
+		if names := listNames(t); len(names) != 0 {
+			t.Errorf("expected no diagnostic settings, got %v", names)
+		}
+	})
+
+	t.Run("Missing cluster", func(t *testing.T) {
+		missingURL := ts.URL + "/subscriptions/" + dummySubscrtiptionId + "/resourceGroups/" + dummyResourceGroupId +
+			"/providers/" + api.ProviderNamespace + "/" + api.ClusterResourceTypeName + "/missing/" +
+			PatternDiagnosticSettingsCollection + "/my-setting?api-version=" + diagnosticSettingsAPIVersion
+
+		rs := do(t, http.MethodPut, missingURL, setting)
+		if rs.StatusCode != http.StatusNotFound {
+			t.Errorf("expected status code %d, got %d", http.StatusNotFound, rs.StatusCode)
+		}
+	})
+}
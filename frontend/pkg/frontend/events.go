@@ -0,0 +1,160 @@
+package frontend
+
+// Copyright (c) Microsoft Corporation.
+// Licensed under the Apache License 2.0.
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"path"
+	"time"
+
+	"github.com/Azure/ARO-HCP/internal/api/arm"
+	"github.com/Azure/ARO-HCP/internal/database"
+)
+
+// ProvisioningStateEventsPath is the path segment, appended to a resource
+// path, of the endpoint streaming the resource's provisioning state.
+const ProvisioningStateEventsPath = "provisioningStateEvents"
+
+// provisioningStateEventName is the server-sent event type for a
+// provisioning state transition.
+const provisioningStateEventName = "provisioningState"
+
+// maxProvisioningStateEventsDuration bounds how long a single stream of
+// provisioning state events stays open. Clients reconnect to continue
+// following an operation that outlasts it. This is a variable so tests
+// can shorten it.
+var maxProvisioningStateEventsDuration = 10 * time.Minute
+
+// operationEvents returns the status history of an operation document.
+// Operations created before history was recorded have none, so their
+// current status stands in as the only event.
+func operationEvents(doc *database.OperationDocument) []database.OperationEvent {
+	if len(doc.History) > 0 {
+		return doc.History
+	}
+	return []database.OperationEvent{{
+		Time:   doc.LastTransitionTime,
+		Status: doc.Status,
+		Error:  doc.Error,
+	}}
+}
+
+// writeProvisioningStateEvent writes an operation event to the
+// ResponseWriter in the server-sent event format.
+func writeProvisioningStateEvent(writer http.ResponseWriter, event database.OperationEvent) error {
+	// Compact encoding keeps the event data on a single line.
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintf(writer, "event: %s\ndata: %s\n\n", provisioningStateEventName, data)
+	return err
+}
+
+// ArmResourceProvisioningStateEvents streams the provisioning state
+// transitions of the latest operation on a resource as server-sent
+// events. The stream ends when the operation reaches a terminal state,
+// the client disconnects, the maximum stream duration elapses, or the
+// frontend starts shutting down. A stream counts against the cap on
+// requests waiting on an operation; beyond it, the stream ends after
+// the events so far, and the client reconnects to follow the rest.
+func (f *Frontend) ArmResourceProvisioningStateEvents(writer http.ResponseWriter, request *http.Request) {
+	ctx := request.Context()
+	logger := LoggerFromContext(ctx)
+
+	// The events path is not a valid resource ID, so strip
+	// the last segment to obtain the resource being followed.
+	originalPath, _ := OriginalPathFromContext(ctx)
+	if originalPath == "" {
+		originalPath = request.URL.Path
+	}
+	resourceID, err := arm.ParseResourceID(path.Dir(originalPath))
+	if err != nil {
+		logger.Error(err.Error())
+		arm.WriteInternalServerError(writer)
+		return
+	}
+
+	doc, err := f.dbClient.GetLatestOperationForResource(ctx, resourceID.String())
+	if errors.Is(err, database.ErrNotFound) {
+		arm.WriteResourceNotFoundError(writer, resourceID)
+		return
+	} else if err != nil {
+		logger.Error(err.Error())
+		arm.WriteInternalServerError(writer)
+		return
+	}
+
+	following := f.acquireOperationWaiter()
+	if following {
+		defer f.releaseOperationWaiter()
+	} else {
+		logger.Info("Too many waiting requests, ending provisioning state event stream without following")
+	}
+
+	timer := time.NewTimer(maxProvisioningStateEventsDuration)
+	defer timer.Stop()
+
+	ticker := time.NewTicker(operationPollInterval)
+	defer ticker.Stop()
+
+	drained := f.requests.drained()
+
+	controller := http.NewResponseController(writer)
+
+	writer.Header().Set("Content-Type", "text/event-stream")
+	writer.Header().Set("Cache-Control", "no-cache")
+	writer.WriteHeader(http.StatusOK)
+
+	var lastSent time.Time
+
+	for {
+		for _, event := range operationEvents(doc) {
+			if !event.Time.After(lastSent) {
+				continue
+			}
+			err = writeProvisioningStateEvent(writer, event)
+			if err != nil {
+				logger.Error(err.Error())
+				return
+			}
+			lastSent = event.Time
+		}
+
+		err = controller.Flush()
+		if err != nil {
+			logger.Error(err.Error())
+			return
+		}
+
+		if doc.Status.IsTerminal() || !following {
+			return
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-drained:
+			logger.Info("Ending provisioning state event stream for shutdown")
+			return
+		case <-timer.C:
+			logger.Info("Provisioning state event stream reached its maximum duration")
+			return
+		case <-ticker.C:
+			latest, err := f.dbClient.GetOperationDoc(ctx, doc.ID)
+			if err != nil {
+				// A cancelled request is not an error.
+				if ctx.Err() == nil {
+					logger.Error(err.Error())
+				}
+				return
+			}
+			doc = latest
+		}
+	}
+}
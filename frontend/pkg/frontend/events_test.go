@@ -0,0 +1,251 @@
+package frontend
+
+// Copyright (c) Microsoft Corporation.
+// Licensed under the Apache License 2.0.
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Azure/ARO-HCP/internal/api/arm"
+	"github.com/Azure/ARO-HCP/internal/database"
+)
+
+// transitioningOperationDBClient advances an operation through one more
+// of the given transitions each time the operation is read, simulating
+// an operation progressing in the background.
+type transitioningOperationDBClient struct {
+	database.DBClient
+	transitions []arm.ProvisioningState
+	reads       int
+}
+
+func (c *transitioningOperationDBClient) GetOperationDoc(ctx context.Context, operationID string) (*database.OperationDocument, error) {
+	doc, err := c.DBClient.GetOperationDoc(ctx, operationID)
+	if err != nil {
+		return nil, err
+	}
+
+	c.reads = min(c.reads+1, len(c.transitions))
+
+	transitioned := *doc
+	transitioned.History = slices.Clone(doc.History)
+	for i, status := range c.transitions[:c.reads] {
+		transitioned.Status = status
+		transitioned.History = append(transitioned.History, database.OperationEvent{
+			Time:   doc.StartTime.Add(time.Duration(i+1) * time.Second),
+			Status: status,
+		})
+	}
+
+	return &transitioned, nil
+}
+
+func TestArmResourceProvisioningStateEvents(t *testing.T) {
+	savedPollInterval := operationPollInterval
+	operationPollInterval = 10 * time.Millisecond
+	t.Cleanup(func() { operationPollInterval = savedPollInterval })
+
+	savedMaxDuration := maxProvisioningStateEventsDuration
+	t.Cleanup(func() { maxProvisioningStateEventsDuration = savedMaxDuration })
+
+	tests := []struct {
+		name               string
+		createOperation    bool
+		transitions        []arm.ProvisioningState
+		maxDuration        time.Duration
+		expectedStatusCode int
+		expectedStatuses   []arm.ProvisioningState
+	}{
+		{
+			name:               "Streams transitions until terminal",
+			createOperation:    true,
+			transitions:        []arm.ProvisioningState{arm.ProvisioningStateProvisioning, arm.ProvisioningStateSucceeded},
+			maxDuration:        time.Minute,
+			expectedStatusCode: http.StatusOK,
+			expectedStatuses:   []arm.ProvisioningState{arm.ProvisioningStateAccepted, arm.ProvisioningStateProvisioning, arm.ProvisioningStateSucceeded},
+		},
+		{
+			name:               "Closes after max duration",
+			createOperation:    true,
+			maxDuration:        50 * time.Millisecond,
+			expectedStatusCode: http.StatusOK,
+			expectedStatuses:   []arm.ProvisioningState{arm.ProvisioningStateAccepted},
+		},
+		{
+			name:               "No operation",
+			createOperation:    false,
+			maxDuration:        time.Minute,
+			expectedStatusCode: http.StatusNotFound,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			maxProvisioningStateEventsDuration = test.maxDuration
+
+			f, ts := newTestListServer(t)
+			cluster := addTestCluster(t, f, "streaming-cluster", nil)
+
+			if test.createOperation {
+				operationDoc := database.NewOperationDocument(database.OperationRequestCreate, cluster.ResourceId, cluster.InternalID)
+				err := f.dbClient.CreateOperationDoc(context.Background(), operationDoc)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			f.dbClient = &transitioningOperationDBClient{DBClient: f.dbClient, transitions: test.transitions}
+
+			requestURL := ts.URL + cluster.ResourceId.String() + "/" + ProvisioningStateEventsPath + "?api-version=2024-06-10-preview"
+
+			rs, err := ts.Client().Get(requestURL)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer rs.Body.Close()
+
+			if rs.StatusCode != test.expectedStatusCode {
+				t.Fatalf("expected status code %d, got %d", test.expectedStatusCode, rs.StatusCode)
+			}
+			if test.expectedStatusCode != http.StatusOK {
+				return
+			}
+			if contentType := rs.Header.Get("Content-Type"); contentType != "text/event-stream" {
+				t.Errorf("expected Content-Type text/event-stream, got %q", contentType)
+			}
+
+			// The server closes the stream, so reading ends on its own.
+			statuses := readProvisioningStates(t, rs)
+
+			if !slices.Equal(statuses, test.expectedStatuses) {
+				t.Errorf("expected statuses %v, got %v", test.expectedStatuses, statuses)
+			}
+		})
+	}
+}
+
+// readProvisioningStates reads provisioning state events from a stream
+// until the server closes it.
+func readProvisioningStates(t *testing.T, rs *http.Response) []arm.ProvisioningState {
+	t.Helper()
+
+	var statuses []arm.ProvisioningState
+	scanner := bufio.NewScanner(rs.Body)
+	for scanner.Scan() {
+		data, found := strings.CutPrefix(scanner.Text(), "data: ")
+		if !found {
+			continue
+		}
+
+		var event database.OperationEvent
+		err := json.Unmarshal([]byte(data), &event)
+		if err != nil {
+			t.Fatal(err)
+		}
+		statuses = append(statuses, event.Status)
+	}
+	if err := scanner.Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	return statuses
+}
+
+func TestArmResourceProvisioningStateEventsLimits(t *testing.T) {
+	savedPollInterval := operationPollInterval
+	operationPollInterval = 10 * time.Millisecond
+	t.Cleanup(func() { operationPollInterval = savedPollInterval })
+
+	tests := []struct {
+		name     string
+		saturate bool
+		drain    bool
+	}{
+		{
+			name:     "Ends without following beyond the waiter cap",
+			saturate: true,
+		},
+		{
+			name:  "Ends when draining starts",
+			drain: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			f, ts := newTestListServer(t)
+			f.config.MaxOperationWaiters = 1
+			cluster := addTestCluster(t, f, "streaming-cluster", nil)
+
+			// The operation never finishes on its own.
+			operationDoc := database.NewOperationDocument(database.OperationRequestCreate, cluster.ResourceId, cluster.InternalID)
+			err := f.dbClient.CreateOperationDoc(context.Background(), operationDoc)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if test.saturate && !f.acquireOperationWaiter() {
+				t.Fatal("failed to acquire an operation waiter below the cap")
+			}
+
+			requestURL := ts.URL + cluster.ResourceId.String() + "/" + ProvisioningStateEventsPath + "?api-version=2024-06-10-preview"
+
+			// Reading fails if the stream does not end on its own.
+			client := ts.Client()
+			client.Timeout = 5 * time.Second
+
+			rs, err := client.Get(requestURL)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer rs.Body.Close()
+
+			if rs.StatusCode != http.StatusOK {
+				t.Fatalf("expected status code %d, got %d", http.StatusOK, rs.StatusCode)
+			}
+
+			if test.drain {
+				f.requests.drain()
+			}
+
+			statuses := readProvisioningStates(t, rs)
+
+			expected := []arm.ProvisioningState{arm.ProvisioningStateAccepted}
+			if !slices.Equal(statuses, expected) {
+				t.Errorf("expected statuses %v, got %v", expected, statuses)
+			}
+
+			if test.drain && f.operationWaiters.Load() != 0 {
+				t.Errorf("expected the stream to release its operation waiter, %d held", f.operationWaiters.Load())
+			}
+		})
+	}
+}
+
+func TestOperationEvents(t *testing.T) {
+	doc := &database.OperationDocument{
+		LastTransitionTime: time.Now().UTC(),
+		Status:             arm.ProvisioningStateProvisioning,
+	}
+
+	// Operations created before history was recorded have none.
+	events := operationEvents(doc)
+	if len(events) != 1 || events[0].Status != doc.Status || !events[0].Time.Equal(doc.LastTransitionTime) {
+		t.Errorf("expected the current status as the only event, got %+v", events)
+	}
+
+	doc.History = []database.OperationEvent{
+		{Time: doc.LastTransitionTime.Add(-time.Second), Status: arm.ProvisioningStateAccepted},
+		{Time: doc.LastTransitionTime, Status: arm.ProvisioningStateProvisioning},
+	}
+	if events := operationEvents(doc); !slices.Equal(events, doc.History) {
+		t.Errorf("expected the recorded history, got %+v", events)
+	}
+}
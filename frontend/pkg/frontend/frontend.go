@@ -14,11 +14,14 @@ import (
 	"net/http"
 	"os"
 	"path"
+	"reflect"
 	"strconv"
 	"strings"
 	"sync/atomic"
+	"time"
 
 	cmv1 "github.com/openshift-online/ocm-sdk-go/clustersmgmt/v1"
+	"go.opentelemetry.io/otel/trace"
 	"golang.org/x/sync/errgroup"
 
 	"github.com/Azure/ARO-HCP/internal/api"
@@ -27,6 +30,10 @@ import (
 	"github.com/Azure/ARO-HCP/internal/ocm"
 )
 
+// validate is shared by the request handlers, since creating a
+// validator registers every custom validation and alias again.
+var validate = api.NewValidator()
+
 type Frontend struct {
 	clusterServiceClient ocm.ClusterServiceClientSpec
 	listener             net.Listener
@@ -37,10 +44,144 @@ type Frontend struct {
 	ready                atomic.Value
 	done                 chan struct{}
 	metrics              Emitter
-	location             string
+	config               Config
+
+	// operationWaiters counts the requests waiting on an operation.
+	operationWaiters atomic.Int64
+
+	// jobs tracks background jobs started with RunBackgroundJob.
+	jobs backgroundJobs
+
+	// requests tracks in-flight requests so Shutdown can drain them.
+	requests requestTracker
+
+	// validationHooks holds the hooks added by RegisterValidationHook.
+	validationHooks map[database.OperationRequest][]ValidationHook
+
+	// contractAPIVersions overrides the resource provider contract API
+	// versions accepted by subscription and provider metadata endpoints.
+	contractAPIVersions []string
+
+	// auditLogger receives audit events if set with SetAuditLogger.
+	auditLogger *slog.Logger
+
+	// tracerProvider is nil unless tracing is enabled.
+	tracerProvider trace.TracerProvider
+
+	// now is nil unless a test overrides the clock.
+	now func() time.Time
+}
+
+const (
+	// DefaultPageSize is the number of items returned in a page of
+	// a resource collection when the client does not request a size.
+	DefaultPageSize int32 = 100
+
+	// MaxPageSize caps the number of items a client can request in a
+	// page of a resource collection, which keeps responses below ARM's
+	// response size limit.
+	MaxPageSize int32 = 1000
+
+	// DefaultMaxNodePools is the number of node pools a cluster
+	// may have unless configured otherwise.
+	DefaultMaxNodePools = 100
+
+	// DefaultMaxClusters is the number of clusters a subscription
+	// may have unless configured otherwise. Zero means no limit.
+	DefaultMaxClusters = 0
+
+	// DefaultMinNodePoolReplicas is the number of replicas below which
+	// a node pool update may not shrink a node pool without an override.
+	DefaultMinNodePoolReplicas = 1
+
+	// DefaultMaxHeaderBytes caps the total size of request headers
+	// unless configured otherwise.
+	DefaultMaxHeaderBytes = 64 << 10
+
+	// DefaultMaxURLLength caps the length of request URLs
+	// unless configured otherwise.
+	DefaultMaxURLLength = 4096
+
+	// DefaultMaxBodyBytes caps the size of request bodies unless
+	// configured otherwise. This matches the largest request body ARM
+	// accepts, so any request ARM forwards fits. See
+	// https://github.com/Azure/azure-resource-manager-rpc/blob/master/v1.0/common-api-details.md#max-request-body-size
+	DefaultMaxBodyBytes = 4 << 20
+
+	// DefaultShutdownGracePeriod is how long Shutdown waits for in-flight
+	// requests to finish unless configured otherwise.
+	DefaultShutdownGracePeriod = 30 * time.Second
+
+	// DefaultSubscriptionWriteRetries is how many times a conflicting
+	// subscription write is retried unless configured otherwise.
+	DefaultSubscriptionWriteRetries = 3
+
+	// DefaultSubscriptionWriteBackoff is the base delay before retrying
+	// a conflicting subscription write unless configured otherwise.
+	DefaultSubscriptionWriteBackoff = 50 * time.Millisecond
+
+	// DefaultSubscriptionRateLimit is how many requests per second each
+	// subscription may send on average unless configured otherwise.
+	DefaultSubscriptionRateLimit = 20.0
+
+	// DefaultSubscriptionRateBurst is how many requests a subscription
+	// may send at once unless configured otherwise.
+	DefaultSubscriptionRateBurst = 100
+
+	// DefaultHealthCheckTimeout is how long a health check waits for
+	// the database to respond unless configured otherwise.
+	DefaultHealthCheckTimeout = 2 * time.Second
+
+	// DefaultSubscriptionMetricsInterval is how often subscriptions are
+	// counted by state unless configured otherwise.
+	DefaultSubscriptionMetricsInterval = time.Minute
+
+	// DefaultDBCircuitBreakerThreshold is how many database calls in a
+	// row must fail to open the circuit breaker unless configured otherwise.
+	DefaultDBCircuitBreakerThreshold = 5
+
+	// DefaultDBCircuitBreakerCooldown is how long the database circuit
+	// breaker stays open unless configured otherwise.
+	DefaultDBCircuitBreakerCooldown = 30 * time.Second
+
+	// DefaultSubscriptionRetention is how long the document of a
+	// deleted subscription is kept for auditing unless configured otherwise.
+	DefaultSubscriptionRetention = 30 * 24 * time.Hour
+
+	// DefaultSubscriptionReapInterval is how often the documents of deleted
+	// subscriptions past their retention are removed unless configured otherwise.
+	DefaultSubscriptionReapInterval = time.Hour
+)
+
+// DefaultIdentityURLHostSuffixes returns the hosts, by domain suffix, of
+// the managed identity URLs that ARM passes in public Azure.
+func DefaultIdentityURLHostSuffixes() []string {
+	return []string{"identity.azure.net"}
+}
+
+// DefaultContentEncodings returns the content encodings, besides
+// identity, that request bodies may be sent in.
+func DefaultContentEncodings() []string {
+	return []string{"gzip"}
 }
 
-func NewFrontend(logger *slog.Logger, listener net.Listener, metricsListener net.Listener, emitter Emitter, dbClient database.DBClient, location string, csClient ocm.ClusterServiceClientSpec) *Frontend {
+// NewFrontend returns a Frontend with the given configuration and
+// dependencies, or an error if the configuration is invalid.
+func NewFrontend(config Config, logger *slog.Logger, listener net.Listener, metricsListener net.Listener, emitter Emitter, dbClient database.DBClient, csClient ocm.ClusterServiceClientSpec) (*Frontend, error) {
+	err := config.Validate()
+	if err != nil {
+		return nil, fmt.Errorf("invalid frontend configuration: %w", err)
+	}
+
+	// Locations are compared and embedded in URLs in canonical form.
+	config.Location = arm.NormalizeLocation(config.Location)
+
+	// A misconfigured deployment should lose metrics, not crash.
+	if pe, ok := emitter.(*PrometheusEmitter); emitter == nil || (ok && pe.registry == nil) {
+		logger.Warn("No metrics registry configured, metrics will not be emitted")
+		emitter = NoopEmitter{}
+	}
+
 	f := &Frontend{
 		clusterServiceClient: csClient,
 		listener:             listener,
@@ -48,10 +189,15 @@ func NewFrontend(logger *slog.Logger, listener net.Listener, metricsListener net
 		metrics:              emitter,
 		server: http.Server{
 			ErrorLog: slog.NewLogLogger(logger.Handler(), slog.LevelError),
+			// MiddlewareHeaderSize enforces the configured limit with an
+			// ARM error response. Headers far beyond the limit are cut off
+			// by the server before they are fully read.
+			MaxHeaderBytes: 2 * config.MaxHeaderBytes,
 			BaseContext: func(net.Listener) context.Context {
 				ctx := context.Background()
 				ctx = ContextWithLogger(ctx, logger)
 				ctx = ContextWithDBClient(ctx, dbClient)
+				ctx = ContextWithEmitter(ctx, emitter)
 				return ctx
 			},
 		},
@@ -63,33 +209,253 @@ func NewFrontend(logger *slog.Logger, listener net.Listener, metricsListener net
 		},
 		dbClient: dbClient,
 		done:     make(chan struct{}),
-		location: strings.ToLower(location),
+		config:   config,
 	}
 
 	f.server.Handler = f.routes()
 	f.metricsServer.Handler = f.metricsRoutes()
 
-	return f
+	return f, nil
+}
+
+// The following accessors fall back to default values for settings
+// left unset, as in a Frontend not constructed through NewFrontend.
+
+// pageSizes returns the default and max page sizes for resource
+// collection requests.
+func (f *Frontend) pageSizes() (int32, int32) {
+	if f.config.DefaultPageSize == 0 || f.config.MaxPageSize == 0 {
+		return DefaultPageSize, MaxPageSize
+	}
+	return f.config.DefaultPageSize, f.config.MaxPageSize
+}
+
+// getMaxNodePools returns the number of node pools that may be
+// created in a single cluster.
+func (f *Frontend) getMaxNodePools() int {
+	if f.config.MaxNodePools == 0 {
+		return DefaultMaxNodePools
+	}
+	return f.config.MaxNodePools
+}
+
+// getMaxClusters returns the number of clusters that may be
+// created in a single subscription, or zero for no limit.
+func (f *Frontend) getMaxClusters() int {
+	return f.config.MaxClusters
+}
+
+// getMaxHeaderBytes returns the total size of request headers
+// above which a request is rejected.
+func (f *Frontend) getMaxHeaderBytes() int {
+	if f.config.MaxHeaderBytes == 0 {
+		return DefaultMaxHeaderBytes
+	}
+	return f.config.MaxHeaderBytes
+}
+
+// getMaxURLLength returns the length of request URLs
+// above which a request is rejected.
+func (f *Frontend) getMaxURLLength() int {
+	if f.config.MaxURLLength == 0 {
+		return DefaultMaxURLLength
+	}
+	return f.config.MaxURLLength
+}
+
+// currentTime returns the current time according to the frontend's clock.
+func (f *Frontend) currentTime() time.Time {
+	if f.now == nil {
+		return time.Now()
+	}
+	return f.now()
+}
+
+// getMaxBodyBytes returns the size of request bodies
+// above which a request is rejected.
+func (f *Frontend) getMaxBodyBytes() int64 {
+	if f.config.MaxBodyBytes == 0 {
+		return DefaultMaxBodyBytes
+	}
+	return f.config.MaxBodyBytes
+}
+
+// getContractAPIVersions returns the resource provider contract
+// API versions accepted by the endpoints ARM defines.
+func (f *Frontend) getContractAPIVersions() []string {
+	if f.contractAPIVersions == nil {
+		return api.ContractVersions()
+	}
+	return f.contractAPIVersions
+}
+
+// getShutdownGracePeriod returns how long Shutdown waits for
+// in-flight requests to finish.
+func (f *Frontend) getShutdownGracePeriod() time.Duration {
+	if f.config.ShutdownGracePeriod == 0 {
+		return DefaultShutdownGracePeriod
+	}
+	return f.config.ShutdownGracePeriod
+}
+
+// getSubscriptionWriteRetries returns how many times a conflicting
+// subscription write is retried. Zero is meaningful here, so unlike
+// most settings it does not fall back to a default; DefaultConfig
+// provides one instead.
+func (f *Frontend) getSubscriptionWriteRetries() int {
+	return f.config.SubscriptionWriteRetries
+}
+
+// getSubscriptionWriteBackoff returns the base delay before
+// retrying a conflicting subscription write.
+func (f *Frontend) getSubscriptionWriteBackoff() time.Duration {
+	if f.config.SubscriptionWriteBackoff == 0 {
+		return DefaultSubscriptionWriteBackoff
+	}
+	return f.config.SubscriptionWriteBackoff
+}
+
+// getSubscriptionRateLimit returns how many requests per
+// second each subscription may send on average.
+func (f *Frontend) getSubscriptionRateLimit() float64 {
+	if f.config.SubscriptionRateLimit == 0 {
+		return DefaultSubscriptionRateLimit
+	}
+	return f.config.SubscriptionRateLimit
+}
+
+// getSubscriptionRateBurst returns how many requests
+// a subscription may send at once.
+func (f *Frontend) getSubscriptionRateBurst() int {
+	if f.config.SubscriptionRateBurst == 0 {
+		return DefaultSubscriptionRateBurst
+	}
+	return f.config.SubscriptionRateBurst
+}
+
+// getHealthCheckTimeout returns how long a health
+// check waits for the database to respond.
+func (f *Frontend) getHealthCheckTimeout() time.Duration {
+	if f.config.HealthCheckTimeout == 0 {
+		return DefaultHealthCheckTimeout
+	}
+	return f.config.HealthCheckTimeout
+}
+
+// getSubscriptionMetricsInterval returns how
+// often subscriptions are counted by state.
+func (f *Frontend) getSubscriptionMetricsInterval() time.Duration {
+	if f.config.SubscriptionMetricsInterval == 0 {
+		return DefaultSubscriptionMetricsInterval
+	}
+	return f.config.SubscriptionMetricsInterval
+}
+
+// getSubscriptionReaping returns how often the documents of deleted
+// subscriptions are reaped, and how long they are retained before then.
+func (f *Frontend) getSubscriptionReaping() (time.Duration, time.Duration) {
+	interval, retention := f.config.SubscriptionReapInterval, f.config.SubscriptionRetention
+	if interval == 0 {
+		interval = DefaultSubscriptionReapInterval
+	}
+	if retention == 0 {
+		retention = DefaultSubscriptionRetention
+	}
+	return interval, retention
+}
+
+// getDBCircuitBreaker returns how many database calls in a row must
+// fail to open the circuit breaker, and how long it then stays open.
+func (f *Frontend) getDBCircuitBreaker() (int, time.Duration) {
+	threshold, cooldown := f.config.DBCircuitBreakerThreshold, f.config.DBCircuitBreakerCooldown
+	if threshold == 0 {
+		threshold = DefaultDBCircuitBreakerThreshold
+	}
+	if cooldown == 0 {
+		cooldown = DefaultDBCircuitBreakerCooldown
+	}
+	return threshold, cooldown
+}
+
+// getIdentityURLHostSuffixes returns the allowed host suffixes of the
+// managed identity URL. Unlike the other settings, leaving this unset
+// disables the managed identity URL validation.
+func (f *Frontend) getIdentityURLHostSuffixes() []string {
+	return f.config.IdentityURLHostSuffixes
+}
+
+// getContentEncodings returns the content encodings request bodies may
+// be sent in besides identity. Like the managed identity URL host
+// suffixes, leaving this unset accepts only identity.
+func (f *Frontend) getContentEncodings() []string {
+	return f.config.ContentEncodings
+}
+
+// getSupportedLocations returns the Azure regions that requests may
+// target, which default to the frontend's own location. No locations
+// means any location is allowed, as when no location is configured.
+func (f *Frontend) getSupportedLocations() []string {
+	if len(f.config.SupportedLocations) > 0 {
+		return f.config.SupportedLocations
+	}
+	if f.config.Location != "" {
+		return []string{f.config.Location}
+	}
+	return nil
+}
+
+// getMaxOperationWaiters returns the number of operation result
+// requests that may wait at once.
+func (f *Frontend) getMaxOperationWaiters() int {
+	if f.config.MaxOperationWaiters == 0 {
+		return DefaultMaxOperationWaiters
+	}
+	return f.config.MaxOperationWaiters
+}
+
+// getMaxOperationWait returns the longest time an operation result
+// request may wait for the operation to finish.
+func (f *Frontend) getMaxOperationWait() time.Duration {
+	if f.config.MaxOperationWait == 0 {
+		return MaxOperationWait
+	}
+	return f.config.MaxOperationWait
 }
 
 func (f *Frontend) Run(ctx context.Context, stop <-chan struct{}) {
+	// This just digs up the logger passed to NewFrontend.
+	logger := LoggerFromContext(f.server.BaseContext(f.listener))
+
 	if stop != nil {
 		go func() {
 			<-stop
 			f.ready.Store(false)
-			_ = f.server.Shutdown(ctx)
-			_ = f.metricsServer.Shutdown(ctx)
+			// Report what is still in flight so operators
+			// can judge how long draining might take.
+			f.logActiveOperations(ctx, logger)
+			err := f.Shutdown(ctx)
+			if err != nil {
+				logger.Error(fmt.Sprintf("Shutdown did not complete cleanly: %v", err))
+			}
 		}()
 	}
 
-	// This just digs up the logger passed to NewFrontend.
-	logger := LoggerFromContext(f.server.BaseContext(f.listener))
-
 	logger.Info(fmt.Sprintf("listening on %s", f.listener.Addr().String()))
 	logger.Info(fmt.Sprintf("metrics listening on %s", f.metricsListener.Addr().String()))
 	f.ready.Store(true)
 
-	errs, ctx := errgroup.WithContext(ctx)
+	// Stop background jobs once the servers stop.
+	jobsCtx, cancel := context.WithCancel(ContextWithLogger(ctx, logger))
+	defer cancel()
+	f.RunBackgroundJob(jobsCtx, "subscription-metrics", func(ctx context.Context) error {
+		return f.CollectSubscriptionMetrics(ctx, f.getSubscriptionMetricsInterval())
+	})
+	f.RunBackgroundJob(jobsCtx, "subscription-reaper", func(ctx context.Context) error {
+		return f.ReapDeletedSubscriptions(ctx, f.getSubscriptionReaping())
+	})
+
+	// Keep ctx intact for the shutdown goroutine above.
+	errs, _ := errgroup.WithContext(ctx)
 	errs.Go(func() error {
 		return f.server.Serve(f.listener)
 	})
@@ -105,21 +471,71 @@ func (f *Frontend) Run(ctx context.Context, stop <-chan struct{}) {
 	close(f.done)
 }
 
+// Shutdown stops the frontend gracefully. It reports the frontend not ready,
+// so /healthz fails and the load balancer stops routing to it, and rejects
+// new requests. It then waits up to the configured grace period for in-flight
+// requests to finish before shutting down the servers. Requests still running
+// after the grace period have their connections closed.
+func (f *Frontend) Shutdown(ctx context.Context) error {
+	f.ready.Store(false)
+	f.requests.drain()
+
+	graceCtx, cancel := context.WithTimeout(ctx, f.getShutdownGracePeriod())
+	defer cancel()
+
+	err := f.requests.wait(graceCtx)
+	if err != nil {
+		err = fmt.Errorf("in-flight requests did not finish: %w", err)
+		return errors.Join(err, f.server.Close(), f.metricsServer.Close())
+	}
+
+	return errors.Join(f.server.Shutdown(ctx), f.metricsServer.Shutdown(ctx))
+}
+
 func (f *Frontend) Join() {
 	<-f.done
 }
 
-func (f *Frontend) CheckReady(ctx context.Context) bool {
-	logger := LoggerFromContext(ctx)
+// Components named by health checks that fail.
+const (
+	healthComponentDatabase       = "database"
+	healthComponentBackgroundJobs = "background jobs"
+	healthComponentFrontend       = "frontend"
+)
 
-	// Verify the DB is available and accessible
-	if err := f.dbClient.DBConnectionTest(ctx); err != nil {
-		logger.Error(fmt.Sprintf("Database test failed: %v", err))
-		return false
+// checkHealth verifies the frontend and the services it depends on are
+// able to serve requests. If not, it returns the component at fault and
+// an error describing the failure.
+func (f *Frontend) checkHealth(ctx context.Context) (string, error) {
+	// Verify the DB is available and accessible, without letting
+	// an unresponsive DB hold up the health check.
+	dbCtx, cancel := context.WithTimeout(ctx, f.getHealthCheckTimeout())
+	defer cancel()
+
+	if err := f.dbClient.DBConnectionTest(dbCtx); err != nil {
+		return healthComponentDatabase, fmt.Errorf("database test failed: %w", err)
+	}
+	LoggerFromContext(ctx).Debug("Database check completed")
+
+	// A critical background job that stopped leaves the frontend unable
+	// to do all of its work, so report not ready to drain traffic.
+	if stopped := f.jobs.stoppedJobs(); len(stopped) > 0 {
+		return healthComponentBackgroundJobs, fmt.Errorf("background jobs stopped: %s", strings.Join(stopped, ", "))
 	}
-	logger.Debug("Database check completed")
 
-	return f.ready.Load().(bool)
+	if !f.ready.Load().(bool) {
+		return healthComponentFrontend, errors.New("frontend is not ready")
+	}
+
+	return "", nil
+}
+
+func (f *Frontend) CheckReady(ctx context.Context) bool {
+	if _, err := f.checkHealth(ctx); err != nil {
+		LoggerFromContext(ctx).Error(err.Error())
+		return false
+	}
+	return true
 }
 
 func (f *Frontend) NotFound(writer http.ResponseWriter, request *http.Request) {
@@ -129,15 +545,23 @@ func (f *Frontend) NotFound(writer http.ResponseWriter, request *http.Request) {
 		"The requested path could not be found.")
 }
 
+// Healthz reports whether the frontend is ready to serve requests,
+// including whether the database is reachable. A failure names the
+// component at fault.
 func (f *Frontend) Healthz(writer http.ResponseWriter, request *http.Request) {
 	var healthStatus float64
 
-	if f.CheckReady(request.Context()) {
+	ctx := request.Context()
+
+	if component, err := f.checkHealth(ctx); err != nil {
+		LoggerFromContext(ctx).Error(err.Error())
+		arm.WriteError(writer, http.StatusInternalServerError,
+			arm.CloudErrorCodeInternalServerError, "",
+			"Health check failed: %s is unavailable.", component)
+		healthStatus = 0.0
+	} else {
 		writer.WriteHeader(http.StatusOK)
 		healthStatus = 1.0
-	} else {
-		arm.WriteInternalServerError(writer)
-		healthStatus = 0.0
 	}
 
 	f.metrics.EmitGauge("frontend_health", healthStatus, map[string]string{
@@ -145,6 +569,13 @@ func (f *Frontend) Healthz(writer http.ResponseWriter, request *http.Request) {
 	})
 }
 
+// HealthzLive reports whether the frontend is alive. Unlike Healthz it
+// ignores the database and readiness, so a transient database outage or
+// draining for shutdown does not get the frontend restarted.
+func (f *Frontend) HealthzLive(writer http.ResponseWriter, request *http.Request) {
+	writer.WriteHeader(http.StatusOK)
+}
+
 func (f *Frontend) ArmResourceList(writer http.ResponseWriter, request *http.Request) {
 	ctx := request.Context()
 	logger := LoggerFromContext(ctx)
@@ -156,8 +587,9 @@ func (f *Frontend) ArmResourceList(writer http.ResponseWriter, request *http.Req
 		return
 	}
 
-	var pageSizeHint int32 = 20
+	pageSizeHint, maxPageSize := f.pageSizes()
 	var continuationToken *string
+	var changedSince *time.Time
 	var pagedResponse arm.PagedResponse
 
 	// The Resource Provider Contract implies $top is only honored when
@@ -165,16 +597,35 @@ func (f *Frontend) ArmResourceList(writer http.ResponseWriter, request *http.Req
 	// So only check for it when the URL includes a $skipToken.
 	urlQuery := request.URL.Query()
 	if urlQuery.Has("$skipToken") {
-		continuationToken = api.Ptr(urlQuery.Get("$skipToken"))
+		// Reject a token that does not decode rather than silently
+		// listing from the beginning, which would return duplicates.
+		skipToken := urlQuery.Get("$skipToken")
+		if _, err := database.DecodeContinuationToken(skipToken); err != nil {
+			logger.Warn(fmt.Sprintf("Invalid $skipToken: %v", err))
+			arm.WriteError(writer, http.StatusBadRequest,
+				arm.CloudErrorCodeInvalidContinuationToken, "$skipToken",
+				"The continuation token is malformed.")
+			return
+		}
+		continuationToken = api.Ptr(skipToken)
 		top, err := strconv.ParseInt(urlQuery.Get("$top"), 10, 32)
 		if err == nil && top > 0 {
-			pageSizeHint = int32(top)
+			pageSizeHint = min(int32(top), maxPageSize)
 		}
 	}
 
-	// FIXME We may want to cap pageSizeHint. If we get a large enough
-	//       $top argument (and there's enough actual clusters to reach
-	//       that), we could potentially hit the 8MB response size limit.
+	if urlQuery.Has(ChangedSinceKey) {
+		timestamp, err := time.Parse(time.RFC3339, urlQuery.Get(ChangedSinceKey))
+		if err != nil {
+			arm.WriteError(
+				writer, http.StatusBadRequest,
+				arm.CloudErrorCodeInvalidParameter, ChangedSinceKey,
+				"The value '%s' for parameter '%s' is not a valid RFC 3339 timestamp.",
+				urlQuery.Get(ChangedSinceKey), ChangedSinceKey)
+			return
+		}
+		changedSince = &timestamp
+	}
 
 	subscriptionID := request.PathValue(PathSegmentSubscriptionID)
 	resourceGroupName := request.PathValue(PathSegmentResourceGroupName)
@@ -183,7 +634,8 @@ func (f *Frontend) ArmResourceList(writer http.ResponseWriter, request *http.Req
 
 	// Even though the bulk of the list content comes from Cluster Service,
 	// we start by querying Cosmos DB because its continuation token meets
-	// the requirements of a skipToken for ARM pagination. We then query
+	// the requirements of a skipToken for ARM pagination. The token encodes
+	// the last key seen so it remains valid across frontend restarts. We then query
 	// Cluster Service for the exact set of IDs returned by Cosmos.
 
 	prefixString := "/subscriptions/" + subscriptionID
@@ -204,7 +656,12 @@ func (f *Frontend) ArmResourceList(writer http.ResponseWriter, request *http.Req
 		return
 	}
 
-	dbIterator := f.dbClient.ListResourceDocs(ctx, prefix, pageSizeHint, continuationToken)
+	var dbIterator database.DBClientIterator
+	if changedSince != nil {
+		dbIterator = f.dbClient.ListChangedResourceDocs(ctx, prefix, *changedSince, pageSizeHint, continuationToken)
+	} else {
+		dbIterator = f.dbClient.ListResourceDocs(ctx, prefix, pageSizeHint, continuationToken)
+	}
 
 	// Build a map of cluster documents by Cluster Service cluster ID.
 	documentMap := make(map[string]*database.ResourceDocument)
@@ -220,9 +677,10 @@ func (f *Frontend) ArmResourceList(writer http.ResponseWriter, request *http.Req
 
 		// FIXME This filtering could be made part of the query expression. It would
 		//       require some reworking (or elimination) of the DBClient interface.
-		if strings.HasSuffix(strings.ToLower(doc.ResourceId.ResourceType.Type), resourceTypeName) {
-			documentMap[doc.InternalID.ID()] = &doc
+		if !strings.HasSuffix(strings.ToLower(doc.ResourceId.ResourceType.Type), resourceTypeName) {
+			continue
 		}
+		documentMap[doc.InternalID.ID()] = &doc
 	}
 
 	err = dbIterator.GetError()
@@ -238,10 +696,15 @@ func (f *Frontend) ArmResourceList(writer http.ResponseWriter, request *http.Req
 		queryIDs = append(queryIDs, "'"+key+"'")
 	}
 	query := fmt.Sprintf("id in (%s)", strings.Join(queryIDs, ", "))
-	logger.Info(fmt.Sprintf("Searching Cluster Service for %q", query))
 
 	switch resourceTypeName {
 	case strings.ToLower(api.ClusterResourceTypeName):
+		// An empty scope is not an error; respond with an empty collection.
+		if len(documentMap) == 0 {
+			break
+		}
+
+		logger.Info(fmt.Sprintf("Searching Cluster Service for %q", query))
 		csIterator := f.clusterServiceClient.ListCSClusters(query)
 
 		for csCluster := range csIterator.Items(ctx) {
@@ -263,11 +726,16 @@ func (f *Frontend) ArmResourceList(writer http.ResponseWriter, request *http.Req
 		// Fetch the cluster document for the Cluster Service ID.
 		resourceDoc, err = f.dbClient.GetResourceDoc(ctx, prefix)
 		if err != nil {
-			logger.Error(err.Error())
-			arm.WriteInternalServerError(writer)
+			arm.WriteCloudError(writer, toCloudError(ctx, err, prefix))
 			return
 		}
 
+		// An empty scope is not an error; respond with an empty collection.
+		if len(documentMap) == 0 {
+			break
+		}
+
+		logger.Info(fmt.Sprintf("Searching Cluster Service for %q", query))
 		csIterator := f.clusterServiceClient.ListCSNodePools(resourceDoc.InternalID, query)
 
 		for csNodePool := range csIterator.Items(ctx) {
@@ -294,7 +762,7 @@ func (f *Frontend) ArmResourceList(writer http.ResponseWriter, request *http.Req
 		return
 	}
 
-	err = pagedResponse.SetNextLink(request.Referer(), dbIterator.GetContinuationToken())
+	err = pagedResponse.SetNextLink(originalRequestURL(request), dbIterator.GetContinuationToken())
 	if err != nil {
 		logger.Error(err.Error())
 		arm.WriteInternalServerError(writer)
@@ -334,6 +802,9 @@ func (f *Frontend) ArmResourceRead(writer http.ResponseWriter, request *http.Req
 		return
 	}
 
+	f.AddOperationIDHeader(ctx, writer, resourceID)
+	writer.Header().Set("ETag", ResponseETag(responseBody))
+
 	_, err = arm.WriteJSONResponse(writer, http.StatusOK, responseBody)
 	if err != nil {
 		logger.Error(err.Error())
@@ -408,6 +879,7 @@ func (f *Frontend) ArmResourceCreateOrUpdate(writer http.ResponseWriter, request
 		}
 
 		hcpCluster := ConvertCStoHCPOpenShiftCluster(resourceID, csCluster)
+		applyResourceDocIdentity(hcpCluster, doc)
 
 		// Do not set the TrackedResource.Tags field here. We need
 		// the Tags map to remain nil so we can see if the request
@@ -418,8 +890,14 @@ func (f *Frontend) ArmResourceCreateOrUpdate(writer http.ResponseWriter, request
 		// This is slightly repetitive for the sake of clarity on PUT vs PATCH.
 		switch request.Method {
 		case http.MethodPut:
+			// Read-only fields are managed downstream, so the default
+			// resource struct carries them over from the existing
+			// resource. Omitting them in the request body keeps their
+			// values, and changing them fails visibility validation.
+			defaultCluster := api.NewDefaultHCPOpenShiftCluster()
+			defaultCluster.PreserveReadOnly(hcpCluster)
 			versionedCurrentCluster = versionedInterface.NewHCPOpenShiftCluster(hcpCluster)
-			versionedRequestCluster = versionedInterface.NewHCPOpenShiftCluster(nil)
+			versionedRequestCluster = versionedInterface.NewHCPOpenShiftCluster(defaultCluster)
 			successStatusCode = http.StatusOK
 		case http.MethodPatch:
 			versionedCurrentCluster = versionedInterface.NewHCPOpenShiftCluster(hcpCluster)
@@ -458,6 +936,12 @@ func (f *Frontend) ArmResourceCreateOrUpdate(writer http.ResponseWriter, request
 		arm.WriteInternalServerError(writer)
 		return
 	}
+	cloudError = CheckBodyName(resourceID, body)
+	if cloudError != nil {
+		logger.Error(cloudError.Error())
+		arm.WriteCloudError(writer, cloudError)
+		return
+	}
 	if err = json.Unmarshal(body, versionedRequestCluster); err != nil {
 		logger.Error(err.Error())
 		arm.WriteInvalidRequestContentError(writer, err)
@@ -471,10 +955,84 @@ func (f *Frontend) ArmResourceCreateOrUpdate(writer http.ResponseWriter, request
 		return
 	}
 
+	// All validation that can be done synchronously must happen before
+	// the operation document is created, so that obviously bad requests
+	// fail fast with a "400 Bad Request" instead of a failed operation.
+	if request.Header.Get(arm.HeaderNameHomeTenantID) == "" {
+		logger.Error(fmt.Sprintf("missing %s header", arm.HeaderNameHomeTenantID))
+		arm.WriteError(
+			writer, http.StatusBadRequest,
+			arm.CloudErrorCodeInvalidParameter, "",
+			"The request is missing required header '%s'.",
+			arm.HeaderNameHomeTenantID)
+		return
+	}
+
 	hcpCluster := api.NewDefaultHCPOpenShiftCluster()
 	versionedRequestCluster.Normalize(hcpCluster)
 
+	cloudError = api.ValidateResourceReferences(resourceID, hcpCluster.ResourceReferences())
+	if cloudError != nil {
+		logger.Error(cloudError.Error())
+		arm.WriteCloudError(writer, cloudError)
+		return
+	}
+
+	// External authentication can only be enabled at creation
+	// and is gated behind a preview feature registration.
+	if !updating && hcpCluster.Properties.Spec.ExternalAuth.Enabled {
+		cloudError = f.CheckPreviewFeature(ctx, api.FeatureExternalAuth)
+		if cloudError != nil {
+			logger.Error(cloudError.Error())
+			arm.WriteCloudError(writer, cloudError)
+			return
+		}
+	}
+
+	// A subscription with no cluster limit gets no quota headers.
+	var remainingClusters int
+	var quotaWarning string
+	var clusterLimited bool
+	if !updating {
+		policy, err := f.getSubscriptionPolicy(ctx, resourceID.SubscriptionID)
+		if err != nil {
+			logger.Error(err.Error())
+			arm.WriteInternalServerError(writer)
+			return
+		}
+		if maxClusters := policy.MaxClusters; maxClusters > 0 {
+			clusterCount, err := f.countClusters(ctx, resourceID.SubscriptionID)
+			if err != nil {
+				logger.Error(err.Error())
+				arm.WriteInternalServerError(writer)
+				return
+			}
+			if clusterCount >= maxClusters {
+				arm.WriteError(writer, http.StatusBadRequest,
+					arm.CloudErrorCodeClusterLimitExceeded, resourceID.String(),
+					"Subscription '%s' already has the maximum number of clusters (%d).",
+					resourceID.SubscriptionID, maxClusters)
+				return
+			}
+			clusterLimited = true
+			remainingClusters = maxClusters - clusterCount - 1
+			quotaWarning = clusterQuotaWarning(clusterCount+1, maxClusters)
+		}
+	}
+
 	hcpCluster.Name = request.PathValue(PathSegmentResourceName)
+
+	cloudError = f.runValidationHooks(ctx, ValidationRequest{
+		Operation:  operationRequest,
+		ResourceID: resourceID,
+		Resource:   hcpCluster,
+	})
+	if cloudError != nil {
+		logger.Error(cloudError.Error())
+		arm.WriteCloudError(writer, cloudError)
+		return
+	}
+
 	csCluster, err := f.BuildCSCluster(resourceID, request.Header, hcpCluster, updating)
 	if err != nil {
 		logger.Error(err.Error())
@@ -482,12 +1040,21 @@ func (f *Frontend) ArmResourceCreateOrUpdate(writer http.ResponseWriter, request
 		return
 	}
 
+	// A dry run stops here, having run the same validation as a real
+	// request, before anything is written to Cluster Service or the
+	// database.
+	if IsValidationOnly(request) {
+		logger.Info(fmt.Sprintf("validated resource %s without applying it", resourceID))
+		writer.WriteHeader(http.StatusNoContent)
+		return
+	}
+
 	if updating {
 		logger.Info(fmt.Sprintf("updating resource %s", resourceID))
 		csCluster, err = f.clusterServiceClient.UpdateCSCluster(ctx, doc.InternalID, csCluster)
 		if err != nil {
 			logger.Error(err.Error())
-			arm.WriteInternalServerError(writer)
+			arm.WriteCloudError(writer, CSErrorToCloudError(err, resourceID))
 			return
 		}
 	} else {
@@ -495,7 +1062,7 @@ func (f *Frontend) ArmResourceCreateOrUpdate(writer http.ResponseWriter, request
 		csCluster, err = f.clusterServiceClient.PostCSCluster(ctx, csCluster)
 		if err != nil {
 			logger.Error(err.Error())
-			arm.WriteInternalServerError(writer)
+			arm.WriteCloudError(writer, CSErrorToCloudError(err, resourceID))
 			return
 		}
 
@@ -543,6 +1110,15 @@ func (f *Frontend) ArmResourceCreateOrUpdate(writer http.ResponseWriter, request
 			doc.Tags = hcpCluster.TrackedResource.Tags
 		}
 
+		// The identity type is required, so an identity without one was
+		// omitted from the request body. A PUT replaces the resource, so
+		// omitting the identity removes it. A PATCH leaves it alone.
+		if hcpCluster.Identity.Type != "" {
+			doc.Identity = &hcpCluster.Identity
+		} else if request.Method == http.MethodPut {
+			doc.Identity = nil
+		}
+
 		return true
 	}
 
@@ -574,6 +1150,18 @@ func (f *Frontend) ArmResourceCreateOrUpdate(writer http.ResponseWriter, request
 		}
 	}
 
+	if f.config.SynchronousOperations {
+		doc, err = f.CompleteOperation(ctx, writer, operationDoc)
+		if err != nil {
+			logger.Error(err.Error())
+			arm.WriteInternalServerError(writer)
+			return
+		}
+		if successStatusCode == http.StatusAccepted {
+			successStatusCode = http.StatusOK
+		}
+	}
+
 	responseBody, err := marshalCSCluster(csCluster, doc, versionedInterface)
 	if err != nil {
 		logger.Error(err.Error())
@@ -581,6 +1169,16 @@ func (f *Frontend) ArmResourceCreateOrUpdate(writer http.ResponseWriter, request
 		return
 	}
 
+	// Let clients know how many more clusters they can create
+	// before reaching the subscription's limit, and warn them when
+	// the limit is drawing near.
+	if clusterLimited {
+		writer.Header().Set(HeaderNameQuotaRemaining, strconv.Itoa(remainingClusters))
+		if quotaWarning != "" {
+			writer.Header().Add(HeaderNameWarning, quotaWarning)
+		}
+	}
+
 	_, err = arm.WriteJSONResponse(writer, successStatusCode, responseBody)
 	if err != nil {
 		logger.Error(err.Error())
@@ -625,6 +1223,16 @@ func (f *Frontend) ArmResourceDelete(writer http.ResponseWriter, request *http.R
 		return
 	}
 
+	cloudError = f.runValidationHooks(ctx, ValidationRequest{
+		Operation:  operationRequest,
+		ResourceID: resourceID,
+	})
+	if cloudError != nil {
+		logger.Error(cloudError.Error())
+		arm.WriteCloudError(writer, cloudError)
+		return
+	}
+
 	operationID, cloudError := f.DeleteResource(ctx, resourceDoc)
 	if cloudError != nil {
 		// For resource not found errors on deletion, ARM requires
@@ -637,6 +1245,10 @@ func (f *Frontend) ArmResourceDelete(writer http.ResponseWriter, request *http.R
 		return
 	}
 
+	f.audit(ctx, AuditActionResourceDelete,
+		slog.String("resource_id", resourceID.String()),
+		slog.String("operation_id", operationID))
+
 	err = f.ExposeOperation(writer, request, operationID)
 	if err != nil {
 		logger.Error(err.Error())
@@ -644,13 +1256,124 @@ func (f *Frontend) ArmResourceDelete(writer http.ResponseWriter, request *http.R
 		return
 	}
 
+	if f.config.SynchronousOperations {
+		operationDoc, err := f.dbClient.GetOperationDoc(ctx, operationID)
+		if err == nil {
+			_, err = f.CompleteOperation(ctx, writer, operationDoc)
+		}
+		if err != nil {
+			logger.Error(err.Error())
+			arm.WriteInternalServerError(writer)
+			return
+		}
+		writer.WriteHeader(http.StatusOK)
+		return
+	}
+
 	writer.WriteHeader(http.StatusAccepted)
 }
 
+// ArmResourceGroupClustersDelete deletes all clusters in a resource group,
+// such as when the resource group itself is being deleted. The request may
+// be repeated to poll the aggregate progress of the deletion:
+// * 202 with a progress summary while any cluster remains
+// * 204 once no clusters remain and leftover documents have been removed
+func (f *Frontend) ArmResourceGroupClustersDelete(writer http.ResponseWriter, request *http.Request) {
+	ctx := request.Context()
+	logger := LoggerFromContext(ctx)
+
+	prefix, err := arm.ParseResourceID(path.Join("/",
+		"subscriptions", request.PathValue(PathSegmentSubscriptionID),
+		"resourceGroups", request.PathValue(PathSegmentResourceGroupName)))
+	if err != nil {
+		logger.Error(err.Error())
+		arm.WriteInternalServerError(writer)
+		return
+	}
+
+	progress, cloudError := f.DeleteAllClusters(ctx, prefix)
+	if cloudError != nil {
+		arm.WriteCloudError(writer, cloudError)
+		return
+	}
+
+	if progress.Total == 0 {
+		// Every cluster is gone, so clear out any documents left behind
+		// in the resource group, such as those of orphaned node pools.
+		deleted, err := f.dbClient.DeleteResourceGroupResources(ctx, prefix.SubscriptionID, prefix.ResourceGroupName)
+		if err != nil {
+			logger.Error(err.Error())
+			arm.WriteInternalServerError(writer)
+			return
+		}
+		if deleted > 0 {
+			logger.Info(fmt.Sprintf("deleted %d remaining resource documents in %s", deleted, prefix))
+		}
+		writer.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	if progress.Started > 0 {
+		f.audit(ctx, AuditActionResourceGroupDelete,
+			slog.String("resource_id", prefix.String()),
+			slog.Int("clusters_started", progress.Started))
+	}
+
+	logger.Info(fmt.Sprintf("deleting %d clusters in %s (%d started)", progress.Total, prefix, progress.Started))
+
+	_, err = arm.WriteJSONResponse(writer, http.StatusAccepted, progress)
+	if err != nil {
+		logger.Error(err.Error())
+	}
+}
+
 func (f *Frontend) ArmResourceAction(writer http.ResponseWriter, request *http.Request) {
 	writer.WriteHeader(http.StatusOK)
 }
 
+// ArmProviderGet lists the resource types offered by this resource
+// provider along with the API versions supporting each resource type.
+func (f *Frontend) ArmProviderGet(writer http.ResponseWriter, request *http.Request) {
+	ctx := request.Context()
+	logger := LoggerFromContext(ctx)
+
+	_, err := arm.WriteJSONResponse(writer, http.StatusOK, api.ProviderMetadata())
+	if err != nil {
+		logger.Error(err.Error())
+	}
+}
+
+// subscriptionResponse is the body of a subscription GET response. For
+// convenience it adds how long ago the subscription was registered.
+type subscriptionResponse struct {
+	*arm.Subscription
+
+	// RegistrationAgeSeconds is nil if the registration date is unknown.
+	RegistrationAgeSeconds *int64 `json:"registrationAgeSeconds,omitempty"`
+}
+
+// MarshalJSON implements json.Marshaler. Without it, the MarshalJSON
+// method promoted from arm.Subscription would drop RegistrationAgeSeconds.
+func (r subscriptionResponse) MarshalJSON() ([]byte, error) {
+	// Alias the type to shed its MarshalJSON method.
+	type subscription arm.Subscription
+
+	if r.Subscription == nil {
+		return json.Marshal(r.Subscription)
+	}
+
+	// Match arm.Subscription.MarshalJSON.
+	s := subscription(*r.Subscription)
+	if s.Properties == nil {
+		s.Properties = &arm.SubscriptionProperties{}
+	}
+
+	return json.Marshal(struct {
+		subscription
+		RegistrationAgeSeconds *int64 `json:"registrationAgeSeconds,omitempty"`
+	}{s, r.RegistrationAgeSeconds})
+}
+
 func (f *Frontend) ArmSubscriptionGet(writer http.ResponseWriter, request *http.Request) {
 	ctx := request.Context()
 	logger := LoggerFromContext(ctx)
@@ -666,16 +1389,29 @@ func (f *Frontend) ArmSubscriptionGet(writer http.ResponseWriter, request *http.
 
 	doc, err := f.dbClient.GetSubscriptionDoc(ctx, subscriptionID)
 	if err != nil {
-		logger.Error(err.Error())
-		if errors.Is(err, database.ErrNotFound) {
-			arm.WriteResourceNotFoundError(writer, resourceID)
-		} else {
-			arm.WriteInternalServerError(writer)
-		}
+		arm.WriteCloudError(writer, toCloudError(ctx, err, resourceID))
+		return
+	}
+
+	if doc.ETag != "" {
+		writer.Header().Set("ETag", string(doc.ETag))
+	}
+	if !doc.LastModified.IsZero() {
+		writer.Header().Set("Last-Modified", doc.LastModified.UTC().Format(http.TimeFormat))
+	}
+
+	if NotModifiedSince(request, doc.LastModified) {
+		writer.WriteHeader(http.StatusNotModified)
 		return
 	}
 
-	_, err = arm.WriteJSONResponse(writer, http.StatusOK, &doc.Subscription)
+	response := subscriptionResponse{Subscription: doc.Subscription}
+	if age, ok := doc.Subscription.RegistrationAge(f.currentTime()); ok {
+		// A registration date in the future means the clocks disagree.
+		response.RegistrationAgeSeconds = api.Ptr(int64(max(age, 0) / time.Second))
+	}
+
+	_, err = arm.WriteJSONResponse(writer, http.StatusOK, response)
 	if err != nil {
 		logger.Error(err.Error())
 	}
@@ -693,7 +1429,7 @@ func (f *Frontend) ArmSubscriptionPut(writer http.ResponseWriter, request *http.
 	}
 
 	var subscription arm.Subscription
-	err = json.Unmarshal(body, &subscription)
+	err = DecodeStrictJSON(body, &subscription)
 	if err != nil {
 		logger.Error(err.Error())
 		arm.WriteInvalidRequestContentError(writer, err)
@@ -707,56 +1443,168 @@ func (f *Frontend) ArmSubscriptionPut(writer http.ResponseWriter, request *http.
 		return
 	}
 
-	subscriptionID := request.PathValue(PathSegmentSubscriptionID)
+	// A PUT replaces the subscription, whether or not it exists.
+	f.applySubscription(writer, request, func(*arm.Subscription) (*arm.Subscription, *arm.CloudError) {
+		return &subscription, nil
+	})
+}
 
-	_, err = f.dbClient.GetSubscriptionDoc(ctx, subscriptionID)
-	if errors.Is(err, database.ErrNotFound) {
-		doc := database.NewSubscriptionDocument(subscriptionID, &subscription)
-		err = f.dbClient.CreateSubscriptionDoc(ctx, doc)
-		if err != nil {
-			logger.Error(err.Error())
-			arm.WriteInternalServerError(writer)
-			return
-		}
-		logger.Info(fmt.Sprintf("created document for subscription %s", subscriptionID))
-	} else if err != nil {
+// ArmSubscriptionPatch updates only the subscription fields present in the
+// request body, merging them onto the stored subscription as a JSON merge
+// patch (RFC 7386): an omitted field is left as is, while a field that is
+// explicitly null is cleared.
+func (f *Frontend) ArmSubscriptionPatch(writer http.ResponseWriter, request *http.Request) {
+	ctx := request.Context()
+	logger := LoggerFromContext(ctx)
+
+	resourceID, err := ResourceIDFromContext(ctx)
+	if err != nil {
 		logger.Error(err.Error())
 		arm.WriteInternalServerError(writer)
 		return
-	} else {
-		updated, err := f.dbClient.UpdateSubscriptionDoc(ctx, subscriptionID, func(doc *database.SubscriptionDocument) bool {
-			messages := getSubscriptionDifferences(doc.Subscription, &subscription)
-			for _, message := range messages {
-				logger.Info(message)
-			}
+	}
 
-			doc.Subscription = &subscription
+	body, err := BodyFromContext(ctx)
+	if err != nil {
+		logger.Error(err.Error())
+		arm.WriteInternalServerError(writer)
+		return
+	}
 
-			return len(messages) > 0
-		})
+	// Keep fields as raw JSON so an explicit null can be
+	// told apart from a field omitted from the request.
+	var patch map[string]json.RawMessage
+	err = json.Unmarshal(body, &patch)
+	if err == nil && patch == nil {
+		err = errors.New("request body must be a JSON object")
+	}
+	if err != nil {
+		logger.Error(err.Error())
+		arm.WriteInvalidRequestContentError(writer, err)
+		return
+	}
+
+	f.applySubscription(writer, request, func(current *arm.Subscription) (*arm.Subscription, *arm.CloudError) {
+		// A PATCH never creates a subscription.
+		if current == nil {
+			return nil, arm.NewResourceNotFoundError(resourceID)
+		}
+
+		currentJSON, err := json.Marshal(current)
 		if err != nil {
 			logger.Error(err.Error())
-			arm.WriteInternalServerError(writer)
-			return
+			return nil, arm.NewInternalServerError()
 		}
-		if updated {
-			logger.Info(fmt.Sprintf("updated document for subscription %s", subscriptionID))
+
+		var subscription arm.Subscription
+		err = DecodeStrictJSON(jsonMergePatch(currentJSON, body), &subscription)
+		if err != nil {
+			logger.Error(err.Error())
+			return nil, arm.NewInvalidRequestContentError(err)
+		}
+
+		cloudError := api.ValidateSubscription(&subscription)
+		if cloudError != nil {
+			logger.Error(cloudError.Error())
+			return nil, cloudError
+		}
+
+		return &subscription, nil
+	})
+}
+
+// subscriptionMutation returns the subscription to store in place of the
+// current subscription, which is nil if the subscription does not exist.
+// A CloudError is returned if the request cannot be applied.
+type subscriptionMutation func(current *arm.Subscription) (*arm.Subscription, *arm.CloudError)
+
+// applySubscription stores the subscription returned by mutate and writes
+// the response. The side effects of a state change, such as cleaning up
+// the resources of a deleted subscription, happen here.
+func (f *Frontend) applySubscription(writer http.ResponseWriter, request *http.Request, mutate subscriptionMutation) {
+	ctx := request.Context()
+	logger := LoggerFromContext(ctx)
+
+	subscriptionID := request.PathValue(PathSegmentSubscriptionID)
+
+	// Writes that lose to a concurrent write of the same subscription
+	// are retried against the latest document, which may change the
+	// outcome, such as whether the state transition is allowed.
+	var previousState arm.SubscriptionState
+	var subscription *arm.Subscription
+	var cloudError *arm.CloudError
+	var err error
+	for attempt := 0; ; attempt++ {
+		previousState, subscription, cloudError, err = f.writeSubscription(ctx, request, subscriptionID, mutate)
+		if !isWriteConflict(err) || attempt >= f.getSubscriptionWriteRetries() {
+			break
+		}
+
+		logger.Info(fmt.Sprintf("retrying conflicting write for subscription %s: %v", subscriptionID, err))
+
+		select {
+		case <-ctx.Done():
+			err = ctx.Err()
+		case <-time.After(jitteredBackoff(f.getSubscriptionWriteBackoff(), attempt)):
+			continue
 		}
+		break
+	}
+	if isWriteConflict(err) {
+		logger.Warn(err.Error())
+		arm.WriteError(writer, http.StatusConflict,
+			arm.CloudErrorCodeConflict, "",
+			"Subscription '%s' was modified concurrently. Please retry the request.",
+			subscriptionID)
+		return
+	} else if err != nil {
+		logger.Error(err.Error())
+		arm.WriteInternalServerError(writer)
+		return
+	} else if cloudError != nil {
+		arm.WriteCloudError(writer, cloudError)
+		return
+	}
+
+	if previousState != subscription.State {
+		f.audit(ctx, AuditActionSubscriptionStateChange,
+			slog.String("subscription_id", subscriptionID),
+			slog.String("previous_state", string(previousState)),
+			slog.String("state", string(subscription.State)))
 	}
 
 	f.metrics.EmitGauge("subscription_lifecycle", 1, map[string]string{
-		"location":       f.location,
+		"location":       f.config.Location,
 		"subscriptionid": subscriptionID,
 		"state":          string(subscription.State),
 	})
 
-	// Clean up resources if subscription is deleted.
+	// Retain the subscription document for auditing but
+	// clean up resources if the subscription is deleted.
 	if subscription.State == arm.SubscriptionStateDeleted {
-		cloudError := f.DeleteAllResources(ctx, subscriptionID)
+		err = f.dbClient.SoftDeleteSubscriptionDoc(ctx, subscriptionID)
+		if err != nil {
+			logger.Error(err.Error())
+			arm.WriteInternalServerError(writer)
+			return
+		}
+
+		progress, cloudError := f.DeleteAllResources(ctx, subscriptionID)
 		if cloudError != nil {
 			arm.WriteCloudError(writer, cloudError)
 			return
 		}
+
+		// ARM cannot force the deletion, so always tell
+		// the client about any clusters deleted with it.
+		if warning := remainingClustersWarning(subscriptionID, progress); warning != "" {
+			writer.Header().Add(HeaderNameWarning, fmt.Sprintf("299 - %q", warning))
+		}
+	}
+
+	// Report the entity tag of the stored document for the next write.
+	if doc, err := f.dbClient.GetSubscriptionDoc(ctx, subscriptionID); err == nil && doc.ETag != "" {
+		writer.Header().Set("ETag", string(doc.ETag))
 	}
 
 	_, err = arm.WriteJSONResponse(writer, http.StatusOK, subscription)
@@ -765,6 +1613,98 @@ func (f *Frontend) ArmSubscriptionPut(writer http.ResponseWriter, request *http.
 	}
 }
 
+// writeSubscription creates or updates the document for a subscription
+// with the subscription returned by mutate, and returns the state the
+// subscription was in, which is empty for a new subscription, along with
+// the stored subscription. A CloudError is returned if the request cannot
+// be applied, and an error if the database write fails.
+func (f *Frontend) writeSubscription(ctx context.Context, request *http.Request, subscriptionID string, mutate subscriptionMutation) (arm.SubscriptionState, *arm.Subscription, *arm.CloudError, error) {
+	logger := LoggerFromContext(ctx)
+
+	_, err := f.dbClient.GetSubscriptionDoc(ctx, subscriptionID)
+	if errors.Is(err, database.ErrNotFound) {
+		subscription, cloudError := mutate(nil)
+		if cloudError != nil {
+			return "", nil, cloudError, nil
+		}
+
+		cloudError = CheckPreconditions(request, "", false)
+		if cloudError != nil {
+			return "", nil, cloudError, nil
+		}
+
+		// A subscription's lifecycle begins with its registration.
+		if subscription.State != arm.SubscriptionStateRegistered {
+			return "", nil, arm.NewCloudError(http.StatusBadRequest,
+				arm.CloudErrorCodeInvalidSubscriptionStateTransition, "state",
+				"Subscription '%s' must be registered before it can be in state '%s'.",
+				subscriptionID, subscription.State), nil
+		}
+
+		doc := database.NewSubscriptionDocument(subscriptionID, subscription)
+		err = f.dbClient.CreateSubscriptionDoc(ctx, doc)
+		if err != nil {
+			return "", nil, nil, err
+		}
+		logger.Info(fmt.Sprintf("created document for subscription %s", subscriptionID))
+		return "", subscription, nil, nil
+	} else if err != nil {
+		return "", nil, nil, err
+	}
+
+	var previousState arm.SubscriptionState
+	var subscription *arm.Subscription
+	var cloudError *arm.CloudError
+
+	updated, err := f.dbClient.UpdateSubscriptionDoc(ctx, subscriptionID, func(doc *database.SubscriptionDocument) bool {
+		// Evaluate preconditions against the document being
+		// replaced, whose entity tag guards the replacement.
+		cloudError = CheckPreconditions(request, doc.ETag, true)
+		if cloudError != nil {
+			return false
+		}
+
+		subscription, cloudError = mutate(doc.Subscription)
+		if cloudError != nil {
+			return false
+		}
+
+		if !doc.Subscription.State.CanTransitionTo(subscription.State) {
+			cloudError = arm.NewCloudError(http.StatusBadRequest,
+				arm.CloudErrorCodeInvalidSubscriptionStateTransition, "state",
+				"Subscription '%s' cannot transition from state '%s' to '%s'.",
+				subscriptionID, doc.Subscription.State, subscription.State)
+			return false
+		}
+
+		previousState = doc.Subscription.State
+
+		messages := getSubscriptionDifferences(doc.Subscription, subscription)
+		for _, message := range messages {
+			logger.Info(message)
+		}
+
+		// Not every difference is logged, such as a
+		// field cleared by a PATCH, but all are stored.
+		changed := !reflect.DeepEqual(doc.Subscription, subscription)
+
+		doc.Subscription = subscription
+
+		return changed
+	})
+	if err != nil {
+		return "", nil, nil, err
+	}
+	if cloudError != nil {
+		return "", nil, cloudError, nil
+	}
+	if updated {
+		logger.Info(fmt.Sprintf("updated document for subscription %s", subscriptionID))
+	}
+
+	return previousState, subscription, nil, nil
+}
+
 func (f *Frontend) ArmDeploymentPreflight(writer http.ResponseWriter, request *http.Request) {
 	var subscriptionID string = request.PathValue(PathSegmentSubscriptionID)
 	var resourceGroup string = request.PathValue(PathSegmentResourceGroupName)
@@ -789,7 +1729,6 @@ func (f *Frontend) ArmDeploymentPreflight(writer http.ResponseWriter, request *h
 		return
 	}
 
-	validate := api.NewValidator()
 	preflightErrors := []arm.CloudErrorBody{}
 
 	for index, raw := range deploymentPreflight.Resources {
@@ -889,21 +1828,16 @@ func (f *Frontend) OperationStatus(writer http.ResponseWriter, request *http.Req
 		return
 	}
 
-	doc, err := f.dbClient.GetOperationDoc(ctx, resourceID.Name)
-	if err != nil {
-		logger.Error(err.Error())
-		if errors.Is(err, database.ErrNotFound) {
-			writer.WriteHeader(http.StatusNotFound)
-		} else {
-			writer.WriteHeader(http.StatusInternalServerError)
-		}
+	doc, cloudError := f.getOperationDoc(ctx, resourceID)
+	if cloudError != nil {
+		arm.WriteCloudError(writer, cloudError)
 		return
 	}
 
 	// Validate the identity retrieving the operation result is the
 	// same identity that triggered the operation. Return 404 if not.
 	if !f.OperationIsVisible(request, doc) {
-		writer.WriteHeader(http.StatusNotFound)
+		arm.WriteCloudError(writer, newOperationNotFoundError(resourceID))
 		return
 	}
 
@@ -920,10 +1854,37 @@ func marshalCSCluster(csCluster *cmv1.Cluster, doc *database.ResourceDocument, v
 	hcpCluster.TrackedResource.Resource.SystemData = doc.SystemData
 	hcpCluster.TrackedResource.Tags = maps.Clone(doc.Tags)
 	hcpCluster.Properties.ProvisioningState = doc.ProvisioningState
+	applyResourceDocIdentity(hcpCluster, doc)
 
 	return arm.Marshal(versionedInterface.NewHCPOpenShiftCluster(hcpCluster))
 }
 
+// applyResourceDocIdentity replaces the identity converted from Cluster
+// Service with the identity recorded from ARM, if any. Cluster Service
+// still supplies client and principal IDs for the user-assigned
+// identities it knows about.
+func applyResourceDocIdentity(hcpCluster *api.HCPOpenShiftCluster, doc *database.ResourceDocument) {
+	if doc.Identity == nil {
+		return
+	}
+
+	// Resource IDs are case-insensitive.
+	csIdentities := make(map[string]*arm.UserAssignedIdentity, len(hcpCluster.Identity.UserAssignedIdentities))
+	for key, value := range hcpCluster.Identity.UserAssignedIdentities {
+		csIdentities[strings.ToLower(key)] = value
+	}
+
+	identity := *doc.Identity
+	identity.UserAssignedIdentities = make(map[string]*arm.UserAssignedIdentity, len(doc.Identity.UserAssignedIdentities))
+	for key, value := range doc.Identity.UserAssignedIdentities {
+		if csValue, ok := csIdentities[strings.ToLower(key)]; ok {
+			value = csValue
+		}
+		identity.UserAssignedIdentities[key] = value
+	}
+	hcpCluster.Identity = identity
+}
+
 func getSubscriptionDifferences(oldSub, newSub *arm.Subscription) []string {
 	var messages []string
 
@@ -978,24 +1939,42 @@ func (f *Frontend) OperationResult(writer http.ResponseWriter, request *http.Req
 		return
 	}
 
-	doc, err := f.dbClient.GetOperationDoc(ctx, resourceID.Name)
-	if err != nil {
-		logger.Error(err.Error())
-		if errors.Is(err, database.ErrNotFound) {
-			writer.WriteHeader(http.StatusNotFound)
-		} else {
-			writer.WriteHeader(http.StatusInternalServerError)
-		}
+	doc, cloudError := f.getOperationDoc(ctx, resourceID)
+	if cloudError != nil {
+		arm.WriteCloudError(writer, cloudError)
 		return
 	}
 
 	// Validate the identity retrieving the operation result is the
 	// same identity that triggered the operation. Return 404 if not.
 	if !f.OperationIsVisible(request, doc) {
-		writer.WriteHeader(http.StatusNotFound)
+		arm.WriteCloudError(writer, newOperationNotFoundError(resourceID))
 		return
 	}
 
+	wait, cloudError := ParseOperationWait(request, f.getMaxOperationWait())
+	if cloudError != nil {
+		arm.WriteCloudError(writer, cloudError)
+		return
+	}
+
+	// Long-poll for the operation to finish if the client asked to,
+	// unless too many requests are waiting already. In that case the
+	// current status is returned immediately and the client polls.
+	if !doc.Status.IsTerminal() && wait > 0 {
+		if f.acquireOperationWaiter() {
+			doc, err = f.WaitForOperation(ctx, doc, wait)
+			f.releaseOperationWaiter()
+			if err != nil {
+				logger.Error(err.Error())
+				arm.WriteInternalServerError(writer)
+				return
+			}
+		} else {
+			logger.Info("Too many waiting requests, returning operation result without waiting")
+		}
+	}
+
 	if !doc.Status.IsTerminal() {
 		f.AddLocationHeader(writer, request, doc)
 		writer.WriteHeader(http.StatusAccepted)
@@ -1019,10 +1998,14 @@ func (f *Frontend) OperationResult(writer http.ResponseWriter, request *http.Req
 		return
 	default:
 		logger.Error(fmt.Sprintf("Unhandled request type: %s", doc.Request))
-		writer.WriteHeader(http.StatusInternalServerError)
+		arm.WriteInternalServerError(writer)
 		return
 	}
 
+	// Render the resource using the API version that initiated the
+	// operation, which may differ from the API version used to poll.
+	versionedInterface = OperationVersion(doc, versionedInterface)
+
 	responseBody, cloudError := f.MarshalResource(ctx, doc.ExternalID, versionedInterface)
 	if cloudError != nil {
 		writer.WriteHeader(cloudError.StatusCode)
@@ -3,62 +3,159 @@ package frontend
 import (
 	"bytes"
 	"context"
+	"encoding/base64"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
 	"log/slog"
 	"net"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"path"
+	"reflect"
+	"slices"
+	"strings"
 	"testing"
 	"time"
 
+	azcorearm "github.com/Azure/azure-sdk-for-go/sdk/azcore/arm"
+	cmv1 "github.com/openshift-online/ocm-sdk-go/clustersmgmt/v1"
 	"github.com/prometheus/client_golang/prometheus"
 
 	"github.com/Azure/ARO-HCP/internal/api"
 	"github.com/Azure/ARO-HCP/internal/api/arm"
+	"github.com/Azure/ARO-HCP/internal/api/v20240610preview/generated"
 	"github.com/Azure/ARO-HCP/internal/database"
+	"github.com/Azure/ARO-HCP/internal/ocm"
 )
 
 var testLogger = slog.New(slog.NewTextHandler(io.Discard, nil))
 
+// testAdminToken authorizes requests to the admin routes of a test server.
+const testAdminToken = "test-admin-token"
+
+// adminAuthTransport adds testAdminToken to requests that
+// do not already carry an authorization header.
+type adminAuthTransport struct {
+	base http.RoundTripper
+}
+
+func (t *adminAuthTransport) RoundTrip(request *http.Request) (*http.Response, error) {
+	if request.Header.Get("Authorization") == "" {
+		request = request.Clone(request.Context())
+		request.Header.Set("Authorization", "Bearer "+testAdminToken)
+	}
+	return t.base.RoundTrip(request)
+}
+
+func (t *adminAuthTransport) CloseIdleConnections() {
+	if closer, ok := t.base.(interface{ CloseIdleConnections() }); ok {
+		closer.CloseIdleConnections()
+	}
+}
+
+// unhealthyDBClient fails or stalls database connection tests.
+type unhealthyDBClient struct {
+	database.DBClient
+	err   error
+	stall bool
+}
+
+func (c *unhealthyDBClient) DBConnectionTest(ctx context.Context) error {
+	if c.stall {
+		<-ctx.Done()
+		return ctx.Err()
+	}
+	return c.err
+}
+
 func TestReadiness(t *testing.T) {
 	tests := []struct {
 		name               string
 		ready              bool
+		dbErr              error
+		dbStall            bool
 		expectedStatusCode int
+		expectedComponent  string
 	}{
 		{
 			name:               "Not ready - returns 500",
 			ready:              false,
 			expectedStatusCode: http.StatusInternalServerError,
+			expectedComponent:  healthComponentFrontend,
 		},
 		{
 			name:               "Ready - returns 200",
 			ready:              true,
 			expectedStatusCode: http.StatusOK,
 		},
+		{
+			name:               "Database error - returns 500",
+			ready:              true,
+			dbErr:              errors.New("connection refused"),
+			expectedStatusCode: http.StatusInternalServerError,
+			expectedComponent:  healthComponentDatabase,
+		},
+		{
+			name:               "Database timeout - returns 500",
+			ready:              true,
+			dbStall:            true,
+			expectedStatusCode: http.StatusInternalServerError,
+			expectedComponent:  healthComponentDatabase,
+		},
 	}
 
 	for _, test := range tests {
 		t.Run(test.name, func(t *testing.T) {
 			f := &Frontend{
-				dbClient: database.NewCache(),
-				metrics:  NewPrometheusEmitter(prometheus.NewRegistry()),
+				dbClient: &unhealthyDBClient{
+					DBClient: database.NewCache(),
+					err:      test.dbErr,
+					stall:    test.dbStall,
+				},
+				metrics: NewPrometheusEmitter(prometheus.NewRegistry()),
+				config:  Config{HealthCheckTimeout: 10 * time.Millisecond},
 			}
 			f.ready.Store(test.ready)
-			ts := httptest.NewServer(f.routes())
+			ts := httptest.NewUnstartedServer(f.routes())
 			ts.Config.BaseContext = func(net.Listener) context.Context {
 				return ContextWithLogger(context.Background(), testLogger)
 			}
+			ts.Start()
+			defer ts.Close()
 
 			rs, err := ts.Client().Get(ts.URL + "/healthz")
 			if err != nil {
 				t.Fatal(err)
 			}
+			defer rs.Body.Close()
 
 			if rs.StatusCode != test.expectedStatusCode {
 				t.Errorf("expected status code %d, got %d", test.expectedStatusCode, rs.StatusCode)
 			}
+
+			if test.expectedComponent != "" {
+				var body arm.CloudError
+				if err := json.NewDecoder(rs.Body).Decode(&body); err != nil {
+					t.Fatal(err)
+				}
+				if body.CloudErrorBody == nil || !strings.Contains(body.Message, test.expectedComponent) {
+					t.Errorf("expected error naming %q, got %+v", test.expectedComponent, body.CloudErrorBody)
+				}
+			}
+
+			// Liveness ignores readiness and the database.
+			rs, err = ts.Client().Get(ts.URL + "/healthz/live")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer rs.Body.Close()
+
+			if rs.StatusCode != http.StatusOK {
+				t.Errorf("expected liveness status code %d, got %d", http.StatusOK, rs.StatusCode)
+			}
 		})
 	}
 }
@@ -66,11 +163,14 @@ func TestReadiness(t *testing.T) {
 func TestSubscriptionsGET(t *testing.T) {
 	tests := []struct {
 		name               string
+		subscriptionID     string
 		subDoc             *database.SubscriptionDocument
 		expectedStatusCode int
+		expectedErrorCode  string
 	}{
 		{
-			name: "GET Subscription - Doc Exists",
+			name:           "GET Subscription - Doc Exists",
+			subscriptionID: "00000000-0000-0000-0000-000000000000",
 			subDoc: &database.SubscriptionDocument{
 				BaseDocument: database.BaseDocument{
 					ID: "00000000-0000-0000-0000-000000000000",
@@ -85,8 +185,17 @@ func TestSubscriptionsGET(t *testing.T) {
 		},
 		{
 			name:               "GET Subscription - No Doc",
+			subscriptionID:     "00000000-0000-0000-0000-000000000000",
 			subDoc:             nil,
 			expectedStatusCode: http.StatusNotFound,
+			expectedErrorCode:  arm.CloudErrorCodeSubscriptionNotFound,
+		},
+		{
+			name:               "GET Subscription - Malformed ID",
+			subscriptionID:     "oopsie-i-no-good0",
+			subDoc:             nil,
+			expectedStatusCode: http.StatusBadRequest,
+			expectedErrorCode:  arm.CloudErrorCodeInvalidSubscriptionID,
 		},
 	}
 
@@ -112,14 +221,301 @@ func TestSubscriptionsGET(t *testing.T) {
 				return ctx
 			}
 
-			rs, err := ts.Client().Get(ts.URL + "/subscriptions/00000000-0000-0000-0000-000000000000?api-version=2.0")
+			rs, err := ts.Client().Get(ts.URL + "/subscriptions/" + test.subscriptionID + "?api-version=2.0")
 			if err != nil {
 				t.Fatal(err)
 			}
+			defer rs.Body.Close()
 
 			if rs.StatusCode != test.expectedStatusCode {
 				t.Errorf("expected status code %d, got %d", test.expectedStatusCode, rs.StatusCode)
 			}
+
+			if test.expectedErrorCode != "" {
+				var cloudError arm.CloudError
+				err = json.NewDecoder(rs.Body).Decode(&cloudError)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if cloudError.CloudErrorBody == nil || cloudError.Code != test.expectedErrorCode {
+					t.Errorf("expected error code %s, got %+v", test.expectedErrorCode, cloudError.CloudErrorBody)
+				}
+			} else if rs.StatusCode == http.StatusOK {
+				var body map[string]json.RawMessage
+				err = json.NewDecoder(rs.Body).Decode(&body)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if string(body["properties"]) != "{}" {
+					t.Errorf("expected empty properties object, got %s", body["properties"])
+				}
+			}
+
+			if test.subDoc != nil && rs.Header.Get("ETag") != string(test.subDoc.ETag) {
+				t.Errorf("expected ETag %s, got %s", test.subDoc.ETag, rs.Header.Get("ETag"))
+			}
+		})
+	}
+}
+
+func TestSubscriptionsGETConditional(t *testing.T) {
+	f := &Frontend{
+		dbClient: database.NewCache(),
+		metrics:  NewPrometheusEmitter(prometheus.NewRegistry()),
+	}
+
+	doc := database.NewSubscriptionDocument(dummySubscrtiptionId, &arm.Subscription{
+		State:            arm.SubscriptionStateRegistered,
+		RegistrationDate: api.Ptr(time.Now().String()),
+	})
+	err := f.dbClient.CreateSubscriptionDoc(context.TODO(), doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ts := httptest.NewServer(f.routes())
+	ts.Config.BaseContext = func(net.Listener) context.Context {
+		ctx := context.Background()
+		ctx = ContextWithLogger(ctx, testLogger)
+		ctx = ContextWithDBClient(ctx, f.dbClient)
+		return ctx
+	}
+	defer ts.Close()
+
+	get := func(ifModifiedSince string) *http.Response {
+		t.Helper()
+
+		req, err := http.NewRequest(http.MethodGet, ts.URL+"/subscriptions/"+dummySubscrtiptionId+"?api-version=2.0", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ifModifiedSince != "" {
+			req.Header.Set("If-Modified-Since", ifModifiedSince)
+		}
+
+		rs, err := ts.Client().Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return rs
+	}
+
+	// A fresh GET returns the subscription and when it was last modified.
+	rs := get("")
+	body, err := io.ReadAll(rs.Body)
+	rs.Body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rs.StatusCode != http.StatusOK {
+		t.Fatalf("expected status code %d, got %d", http.StatusOK, rs.StatusCode)
+	}
+	if len(body) == 0 {
+		t.Error("expected a response body")
+	}
+	lastModified := rs.Header.Get("Last-Modified")
+	if lastModified != doc.LastModified.Format(http.TimeFormat) {
+		t.Fatalf("expected Last-Modified %q, got %q", doc.LastModified.Format(http.TimeFormat), lastModified)
+	}
+
+	tests := []struct {
+		name               string
+		ifModifiedSince    string
+		expectedStatusCode int
+	}{
+		{
+			name:               "Matching If-Modified-Since",
+			ifModifiedSince:    lastModified,
+			expectedStatusCode: http.StatusNotModified,
+		},
+		{
+			name:               "Later If-Modified-Since",
+			ifModifiedSince:    doc.LastModified.Add(time.Hour).Format(http.TimeFormat),
+			expectedStatusCode: http.StatusNotModified,
+		},
+		{
+			name:               "Stale If-Modified-Since",
+			ifModifiedSince:    doc.LastModified.Add(-time.Hour).Format(http.TimeFormat),
+			expectedStatusCode: http.StatusOK,
+		},
+		{
+			name:               "Malformed If-Modified-Since",
+			ifModifiedSince:    "yesterday",
+			expectedStatusCode: http.StatusOK,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rs := get(test.ifModifiedSince)
+			body, err := io.ReadAll(rs.Body)
+			rs.Body.Close()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if rs.StatusCode != test.expectedStatusCode {
+				t.Fatalf("expected status code %d, got %d", test.expectedStatusCode, rs.StatusCode)
+			}
+			if test.expectedStatusCode == http.StatusNotModified && len(body) != 0 {
+				t.Errorf("expected no response body, got %s", body)
+			}
+			if test.expectedStatusCode == http.StatusOK && len(body) == 0 {
+				t.Error("expected a response body")
+			}
+			if rs.Header.Get("Last-Modified") != lastModified {
+				t.Errorf("expected Last-Modified %q, got %q", lastModified, rs.Header.Get("Last-Modified"))
+			}
+		})
+	}
+
+	// Writing the subscription moves its last-modified time forward.
+	time.Sleep(time.Second)
+	_, err = f.dbClient.UpdateSubscriptionDoc(context.TODO(), dummySubscrtiptionId, func(doc *database.SubscriptionDocument) bool {
+		doc.Subscription.State = arm.SubscriptionStateWarned
+		return true
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rs = get(lastModified)
+	rs.Body.Close()
+	if rs.StatusCode != http.StatusOK {
+		t.Errorf("expected status code %d after an update, got %d", http.StatusOK, rs.StatusCode)
+	}
+}
+
+func TestSubscriptionsGETRegistrationAge(t *testing.T) {
+	now := time.Date(2024, time.June, 10, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name             string
+		registrationDate string
+		expectedAge      *int64
+	}{
+		{
+			name:             "RFC1123 registration date",
+			registrationDate: "Mon, 03 Jun 2024 12:00:00 GMT",
+			expectedAge:      api.Ptr(int64(7 * 24 * 60 * 60)),
+		},
+		{
+			name:             "RFC3339 registration date",
+			registrationDate: "2024-06-10T11:58:59.9Z",
+			expectedAge:      api.Ptr(int64(60)),
+		},
+		{
+			name:             "Registration date in the future",
+			registrationDate: "2024-06-10T12:05:00Z",
+			expectedAge:      api.Ptr(int64(0)),
+		},
+		{
+			name:             "Unrecognized registration date",
+			registrationDate: "last Tuesday",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			f := &Frontend{
+				dbClient: database.NewCache(),
+				metrics:  NewPrometheusEmitter(prometheus.NewRegistry()),
+				now:      func() time.Time { return now },
+			}
+
+			err := f.dbClient.CreateSubscriptionDoc(context.TODO(), database.NewSubscriptionDocument(
+				dummySubscrtiptionId, &arm.Subscription{
+					State:            arm.SubscriptionStateRegistered,
+					RegistrationDate: api.Ptr(test.registrationDate),
+				}))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			ts := httptest.NewServer(f.routes())
+			ts.Config.BaseContext = func(net.Listener) context.Context {
+				ctx := context.Background()
+				ctx = ContextWithLogger(ctx, testLogger)
+				ctx = ContextWithDBClient(ctx, f.dbClient)
+				return ctx
+			}
+			defer ts.Close()
+
+			rs, err := ts.Client().Get(ts.URL + "/subscriptions/" + dummySubscrtiptionId + "?api-version=2.0")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer rs.Body.Close()
+
+			if rs.StatusCode != http.StatusOK {
+				t.Fatalf("expected status code %d, got %d", http.StatusOK, rs.StatusCode)
+			}
+
+			var body struct {
+				State                  arm.SubscriptionState `json:"state"`
+				RegistrationAgeSeconds *int64                `json:"registrationAgeSeconds"`
+			}
+			err = json.NewDecoder(rs.Body).Decode(&body)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if body.State != arm.SubscriptionStateRegistered {
+				t.Errorf("expected state %s, got %s", arm.SubscriptionStateRegistered, body.State)
+			}
+			switch {
+			case test.expectedAge == nil && body.RegistrationAgeSeconds != nil:
+				t.Errorf("expected no registration age, got %d", *body.RegistrationAgeSeconds)
+			case test.expectedAge != nil && body.RegistrationAgeSeconds == nil:
+				t.Errorf("expected registration age %d, got none", *test.expectedAge)
+			case test.expectedAge != nil && *body.RegistrationAgeSeconds != *test.expectedAge:
+				t.Errorf("expected registration age %d, got %d", *test.expectedAge, *body.RegistrationAgeSeconds)
+			}
+		})
+	}
+}
+
+func TestSubscriptionResponseMarshalJSON(t *testing.T) {
+	tests := []struct {
+		name     string
+		response subscriptionResponse
+		expected string
+	}{
+		{
+			name:     "Empty subscription with registration age",
+			response: subscriptionResponse{Subscription: &arm.Subscription{}, RegistrationAgeSeconds: api.Ptr(int64(5))},
+			expected: `{"state":"","registrationDate":null,"properties":{},"registrationAgeSeconds":5}`,
+		},
+		{
+			name:     "Empty subscription without registration age",
+			response: subscriptionResponse{Subscription: &arm.Subscription{}},
+			expected: `{"state":"","registrationDate":null,"properties":{}}`,
+		},
+		{
+			name:     "No subscription",
+			response: subscriptionResponse{},
+			expected: `null`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			data, err := json.Marshal(test.response)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// Compare decoded values so field order does not matter.
+			var actual, expected any
+			if err := json.Unmarshal(data, &actual); err != nil {
+				t.Fatalf("invalid JSON %s: %v", data, err)
+			}
+			if err := json.Unmarshal([]byte(test.expected), &expected); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(actual, expected) {
+				t.Errorf("expected %s, got %s", test.expected, data)
+			}
 		})
 	}
 }
@@ -129,8 +525,11 @@ func TestSubscriptionsPUT(t *testing.T) {
 		name               string
 		urlPath            string
 		subscription       *arm.Subscription
+		rawBody            string
 		subDoc             *database.SubscriptionDocument
 		expectedStatusCode int
+		expectedErrorCode  string
+		expectedErrorText  string
 	}{
 		{
 			name:    "PUT Subscription - Doc does not exist",
@@ -173,6 +572,7 @@ func TestSubscriptionsPUT(t *testing.T) {
 			},
 			subDoc:             nil,
 			expectedStatusCode: http.StatusBadRequest,
+			expectedErrorCode:  arm.CloudErrorCodeInvalidSubscriptionID,
 		},
 		{
 			name:    "PUT Subscription - Missing State",
@@ -183,6 +583,7 @@ func TestSubscriptionsPUT(t *testing.T) {
 			},
 			subDoc:             nil,
 			expectedStatusCode: http.StatusBadRequest,
+			expectedErrorCode:  arm.CloudErrorCodeMissingSubscriptionState,
 		},
 		{
 			name:    "PUT Subscription - Invalid State",
@@ -194,6 +595,29 @@ func TestSubscriptionsPUT(t *testing.T) {
 			},
 			subDoc:             nil,
 			expectedStatusCode: http.StatusBadRequest,
+			expectedErrorCode:  arm.CloudErrorCodeInvalidSubscriptionState,
+		},
+		{
+			name:    "PUT Subscription - Lowercase State",
+			urlPath: "/subscriptions/00000000-0000-0000-0000-000000000000?api-version=2.0",
+			subscription: &arm.Subscription{
+				State:            "registered",
+				RegistrationDate: api.Ptr(time.Now().String()),
+				Properties:       nil,
+			},
+			subDoc:             nil,
+			expectedStatusCode: http.StatusOK,
+		},
+		{
+			name:    "PUT Subscription - Uppercase State",
+			urlPath: "/subscriptions/00000000-0000-0000-0000-000000000000?api-version=2.0",
+			subscription: &arm.Subscription{
+				State:            "REGISTERED",
+				RegistrationDate: api.Ptr(time.Now().String()),
+				Properties:       nil,
+			},
+			subDoc:             nil,
+			expectedStatusCode: http.StatusOK,
 		},
 		{
 			name:    "PUT Subscription - Missing RegistrationDate",
@@ -204,6 +628,49 @@ func TestSubscriptionsPUT(t *testing.T) {
 			},
 			subDoc:             nil,
 			expectedStatusCode: http.StatusBadRequest,
+			expectedErrorCode:  arm.CloudErrorCodeInvalidRequestContent,
+		},
+		{
+			name:               "PUT Subscription - Unknown field",
+			urlPath:            "/subscriptions/00000000-0000-0000-0000-000000000000?api-version=2.0",
+			rawBody:            `{"state": "Registered", "registrationDate": "Mon, 03 Jun 2024 12:00:00 GMT", "registrationDat": "Mon, 03 Jun 2024 12:00:00 GMT"}`,
+			subDoc:             nil,
+			expectedStatusCode: http.StatusBadRequest,
+			expectedErrorCode:  arm.CloudErrorCodeInvalidRequestContent,
+			expectedErrorText:  "registrationDat",
+		},
+		{
+			name:               "PUT Subscription - Unknown nested field",
+			urlPath:            "/subscriptions/00000000-0000-0000-0000-000000000000?api-version=2.0",
+			rawBody:            `{"state": "Registered", "registrationDate": "Mon, 03 Jun 2024 12:00:00 GMT", "properties": {"tenantId": "00000000-0000-0000-0000-000000000000", "bogus": true}}`,
+			subDoc:             nil,
+			expectedStatusCode: http.StatusBadRequest,
+			expectedErrorCode:  arm.CloudErrorCodeInvalidRequestContent,
+			expectedErrorText:  "bogus",
+		},
+		{
+			name:               "PUT Subscription - Account owner",
+			urlPath:            "/subscriptions/00000000-0000-0000-0000-000000000000?api-version=2.0",
+			rawBody:            `{"state": "Registered", "registrationDate": "Mon, 03 Jun 2024 12:00:00 GMT", "properties": {"accountOwner": {"puid": "1234", "email": "owner@example.com"}}}`,
+			subDoc:             nil,
+			expectedStatusCode: http.StatusOK,
+		},
+		{
+			name:               "PUT Subscription - Unknown account owner field",
+			urlPath:            "/subscriptions/00000000-0000-0000-0000-000000000000?api-version=2.0",
+			rawBody:            `{"state": "Registered", "registrationDate": "Mon, 03 Jun 2024 12:00:00 GMT", "properties": {"accountOwner": {"puid": "1234", "emial": "owner@example.com"}}}`,
+			subDoc:             nil,
+			expectedStatusCode: http.StatusBadRequest,
+			expectedErrorCode:  arm.CloudErrorCodeInvalidRequestContent,
+			expectedErrorText:  "emial",
+		},
+		{
+			name:               "PUT Subscription - Concatenated JSON objects",
+			urlPath:            "/subscriptions/00000000-0000-0000-0000-000000000000?api-version=2.0",
+			rawBody:            `{"state": "Registered", "registrationDate": "Mon, 03 Jun 2024 12:00:00 GMT"}{"state": "Deleted"}`,
+			subDoc:             nil,
+			expectedStatusCode: http.StatusBadRequest,
+			expectedErrorCode:  arm.CloudErrorCodeInvalidRequestContent,
 		},
 	}
 
@@ -214,9 +681,13 @@ func TestSubscriptionsPUT(t *testing.T) {
 				metrics:  NewPrometheusEmitter(prometheus.NewRegistry()),
 			}
 
-			body, err := json.Marshal(&test.subscription)
-			if err != nil {
-				t.Fatal(err)
+			body := []byte(test.rawBody)
+			if test.rawBody == "" {
+				var err error
+				body, err = json.Marshal(&test.subscription)
+				if err != nil {
+					t.Fatal(err)
+				}
 			}
 
 			if test.subDoc != nil {
@@ -248,6 +719,2983 @@ func TestSubscriptionsPUT(t *testing.T) {
 			if rs.StatusCode != test.expectedStatusCode {
 				t.Errorf("expected status code %d, got %d", test.expectedStatusCode, rs.StatusCode)
 			}
+
+			if test.expectedErrorCode != "" {
+				var cloudError arm.CloudError
+				err = json.NewDecoder(rs.Body).Decode(&cloudError)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if cloudError.CloudErrorBody == nil || cloudError.Code != test.expectedErrorCode {
+					t.Errorf("expected error code %s, got %+v", test.expectedErrorCode, cloudError.CloudErrorBody)
+				} else if !strings.Contains(cloudError.Message, test.expectedErrorText) {
+					t.Errorf("expected error message to mention %q, got %q", test.expectedErrorText, cloudError.Message)
+				}
+			}
+
+			// Accepted states are stored in their canonical casing.
+			if rs.StatusCode == http.StatusOK {
+				doc, err := f.dbClient.GetSubscriptionDoc(context.TODO(), "00000000-0000-0000-0000-000000000000")
+				if err != nil {
+					t.Fatal(err)
+				}
+				if doc.Subscription.State != arm.SubscriptionStateRegistered {
+					t.Errorf("expected state %s, got %s", arm.SubscriptionStateRegistered, doc.Subscription.State)
+				}
+			}
+		})
+	}
+}
+
+func TestSubscriptionsPUTContractExample(t *testing.T) {
+	// The example subscription body from the resource provider contract.
+	const body = `{
+		"state": "Registered",
+		"registrationDate": "Fri, 20 Dec 2019 06:42:44 GMT",
+		"properties": {
+			"tenantId": "00000000-0000-0000-0000-000000000000",
+			"locationPlacementId": "Public_2014-09-01",
+			"quotaId": "Default_2014-09-01",
+			"registeredFeatures": [
+				{
+					"name": "Microsoft.RedHatOpenShift/FeatureA",
+					"state": "Registered"
+				}
+			],
+			"availabilityZones": {
+				"location": "eastus",
+				"zoneMappings": [
+					{
+						"logicalZone": "1",
+						"physicalZone": "eastus-az1"
+					}
+				]
+			},
+			"spendingLimit": "Off",
+			"accountOwner": {
+				"puid": "1000000000000000",
+				"email": "owner@example.com"
+			},
+			"managedByTenants": [
+				{
+					"tenantId": "11111111-1111-1111-1111-111111111111"
+				}
+			],
+			"additionalProperties": {
+				"resourceProviderProperties": "{\"resourceProviderNamespace\":\"Microsoft.RedHatOpenShift\"}"
+			}
+		}
+	}`
+
+	f := &Frontend{
+		dbClient: database.NewCache(),
+		metrics:  NewPrometheusEmitter(prometheus.NewRegistry()),
+	}
+
+	ts := httptest.NewServer(f.routes())
+	ts.Config.BaseContext = func(net.Listener) context.Context {
+		ctx := context.Background()
+		ctx = ContextWithLogger(ctx, testLogger)
+		ctx = ContextWithDBClient(ctx, f.dbClient)
+		return ctx
+	}
+	defer ts.Close()
+
+	req, err := http.NewRequest(http.MethodPut, ts.URL+"/subscriptions/00000000-0000-0000-0000-000000000000?api-version=2.0", strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	rs, err := ts.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rs.Body.Close()
+
+	responseBody, err := io.ReadAll(rs.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rs.StatusCode != http.StatusOK {
+		t.Fatalf("expected status code %d, got %d: %s", http.StatusOK, rs.StatusCode, responseBody)
+	}
+	if strings.Contains(string(responseBody), "owner@example.com") {
+		t.Errorf("expected the response to omit the account owner email, got %s", responseBody)
+	}
+
+	doc, err := f.dbClient.GetSubscriptionDoc(context.TODO(), "00000000-0000-0000-0000-000000000000")
+	if err != nil {
+		t.Fatal(err)
+	}
+	zones := doc.Subscription.Properties.AvailabilityZones
+	if zones == nil || zones.ZoneMappings == nil || len(*zones.ZoneMappings) != 1 {
+		t.Errorf("expected one zone mapping, got %+v", zones)
+	}
+
+	// The stored document never includes the account owner email.
+	stored, err := json.Marshal(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(stored), "owner@example.com") {
+		t.Errorf("expected the stored subscription to omit the account owner email, got %s", stored)
+	}
+}
+
+func TestSubscriptionsPUTPreconditions(t *testing.T) {
+	const subscriptionPath = "/subscriptions/00000000-0000-0000-0000-000000000000?api-version=2.0"
+
+	tests := []struct {
+		name               string
+		docExists          bool
+		ifMatch            string
+		ifNoneMatch        string
+		expectedStatusCode int
+	}{
+		{
+			name:               "No preconditions",
+			docExists:          true,
+			expectedStatusCode: http.StatusOK,
+		},
+		{
+			name:               "If-Match current entity tag",
+			docExists:          true,
+			ifMatch:            "current",
+			expectedStatusCode: http.StatusOK,
+		},
+		{
+			name:               "If-Match stale entity tag",
+			docExists:          true,
+			ifMatch:            "stale",
+			expectedStatusCode: http.StatusPreconditionFailed,
+		},
+		{
+			name:               "If-Match any with no document",
+			docExists:          false,
+			ifMatch:            "*",
+			expectedStatusCode: http.StatusPreconditionFailed,
+		},
+		{
+			name:               "If-None-Match any with existing document",
+			docExists:          true,
+			ifNoneMatch:        "*",
+			expectedStatusCode: http.StatusPreconditionFailed,
+		},
+		{
+			name:               "If-None-Match any with no document",
+			docExists:          false,
+			ifNoneMatch:        "*",
+			expectedStatusCode: http.StatusOK,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			f := &Frontend{
+				dbClient: database.NewCache(),
+				metrics:  NewPrometheusEmitter(prometheus.NewRegistry()),
+			}
+
+			ts := httptest.NewServer(f.routes())
+			ts.Config.BaseContext = func(net.Listener) context.Context {
+				ctx := context.Background()
+				ctx = ContextWithLogger(ctx, testLogger)
+				ctx = ContextWithDBClient(ctx, f.dbClient)
+				return ctx
+			}
+			defer ts.Close()
+
+			put := func(state arm.SubscriptionState, header http.Header) *http.Response {
+				body, err := json.Marshal(&arm.Subscription{
+					State:            state,
+					RegistrationDate: api.Ptr(time.Now().String()),
+				})
+				if err != nil {
+					t.Fatal(err)
+				}
+				req, err := http.NewRequest(http.MethodPut, ts.URL+subscriptionPath, bytes.NewReader(body))
+				if err != nil {
+					t.Fatal(err)
+				}
+				req.Header = header
+				req.Header.Set("Content-Type", "application/json")
+				rs, err := ts.Client().Do(req)
+				if err != nil {
+					t.Fatal(err)
+				}
+				rs.Body.Close()
+				return rs
+			}
+
+			var staleETag, currentETag string
+			if test.docExists {
+				// Write the document twice so its original
+				// entity tag is stale.
+				staleETag = put(arm.SubscriptionStateRegistered, http.Header{}).Header.Get("ETag")
+				currentETag = put(arm.SubscriptionStateWarned, http.Header{}).Header.Get("ETag")
+				if staleETag == "" || currentETag == "" || staleETag == currentETag {
+					t.Fatalf("expected distinct entity tags, got %q and %q", staleETag, currentETag)
+				}
+			}
+
+			header := http.Header{}
+			switch test.ifMatch {
+			case "current":
+				header.Set("If-Match", currentETag)
+			case "stale":
+				header.Set("If-Match", staleETag)
+			case "":
+			default:
+				header.Set("If-Match", test.ifMatch)
+			}
+			if test.ifNoneMatch != "" {
+				header.Set("If-None-Match", test.ifNoneMatch)
+			}
+
+			rs := put(arm.SubscriptionStateRegistered, header)
+			if rs.StatusCode != test.expectedStatusCode {
+				t.Fatalf("expected status code %d, got %d", test.expectedStatusCode, rs.StatusCode)
+			}
+
+			doc, err := f.dbClient.GetSubscriptionDoc(context.TODO(), "00000000-0000-0000-0000-000000000000")
+			if rs.StatusCode == http.StatusOK {
+				if err != nil {
+					t.Fatal(err)
+				}
+				if doc.Subscription.State != arm.SubscriptionStateRegistered {
+					t.Errorf("expected state %s, got %s", arm.SubscriptionStateRegistered, doc.Subscription.State)
+				}
+				if rs.Header.Get("ETag") != string(doc.ETag) {
+					t.Errorf("expected ETag %s, got %s", doc.ETag, rs.Header.Get("ETag"))
+				}
+			} else if test.docExists {
+				if err != nil {
+					t.Fatal(err)
+				}
+				if doc.Subscription.State != arm.SubscriptionStateWarned {
+					t.Errorf("expected the rejected write to leave state %s, got %s", arm.SubscriptionStateWarned, doc.Subscription.State)
+				}
+			} else if !errors.Is(err, database.ErrNotFound) {
+				t.Errorf("expected no document after the rejected write, got %v", err)
+			}
+		})
+	}
+}
+
+func TestSubscriptionsPUTStateTransitions(t *testing.T) {
+	const subscriptionID = "00000000-0000-0000-0000-000000000000"
+
+	tests := []struct {
+		name               string
+		currentState       arm.SubscriptionState
+		requestState       arm.SubscriptionState
+		expectedStatusCode int
+	}{
+		{
+			name:               "New subscription registered",
+			requestState:       arm.SubscriptionStateRegistered,
+			expectedStatusCode: http.StatusOK,
+		},
+		{
+			name:               "New subscription not registered",
+			requestState:       arm.SubscriptionStateWarned,
+			expectedStatusCode: http.StatusBadRequest,
+		},
+		{
+			name:               "Registered to Suspended",
+			currentState:       arm.SubscriptionStateRegistered,
+			requestState:       arm.SubscriptionStateSuspended,
+			expectedStatusCode: http.StatusOK,
+		},
+		{
+			name:               "Suspended to Registered",
+			currentState:       arm.SubscriptionStateSuspended,
+			requestState:       arm.SubscriptionStateRegistered,
+			expectedStatusCode: http.StatusOK,
+		},
+		{
+			name:               "Suspended to Warned",
+			currentState:       arm.SubscriptionStateSuspended,
+			requestState:       arm.SubscriptionStateWarned,
+			expectedStatusCode: http.StatusBadRequest,
+		},
+		{
+			name:               "Deleted to Registered",
+			currentState:       arm.SubscriptionStateDeleted,
+			requestState:       arm.SubscriptionStateRegistered,
+			expectedStatusCode: http.StatusBadRequest,
+		},
+		{
+			name:               "Deleted to Deleted",
+			currentState:       arm.SubscriptionStateDeleted,
+			requestState:       arm.SubscriptionStateDeleted,
+			expectedStatusCode: http.StatusOK,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			f := &Frontend{
+				dbClient: database.NewCache(),
+				metrics:  NewPrometheusEmitter(prometheus.NewRegistry()),
+			}
+
+			if test.currentState != "" {
+				err := f.dbClient.CreateSubscriptionDoc(context.TODO(), database.NewSubscriptionDocument(subscriptionID, &arm.Subscription{
+					State:            test.currentState,
+					RegistrationDate: api.Ptr(time.Now().String()),
+				}))
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			ts := httptest.NewServer(f.routes())
+			ts.Config.BaseContext = func(net.Listener) context.Context {
+				ctx := context.Background()
+				ctx = ContextWithLogger(ctx, testLogger)
+				ctx = ContextWithDBClient(ctx, f.dbClient)
+				return ctx
+			}
+			defer ts.Close()
+
+			body, err := json.Marshal(&arm.Subscription{
+				State:            test.requestState,
+				RegistrationDate: api.Ptr(time.Now().String()),
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			req, err := http.NewRequest(http.MethodPut, ts.URL+"/subscriptions/"+subscriptionID+"?api-version=2.0", bytes.NewReader(body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.Header.Set("Content-Type", "application/json")
+
+			rs, err := ts.Client().Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer rs.Body.Close()
+
+			if rs.StatusCode != test.expectedStatusCode {
+				t.Fatalf("expected status code %d, got %d", test.expectedStatusCode, rs.StatusCode)
+			}
+
+			expectedState := test.requestState
+			if rs.StatusCode != http.StatusOK {
+				var cloudError arm.CloudError
+				err = json.NewDecoder(rs.Body).Decode(&cloudError)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if cloudError.CloudErrorBody == nil || cloudError.Code != arm.CloudErrorCodeInvalidSubscriptionStateTransition {
+					t.Errorf("expected error code %s, got %+v", arm.CloudErrorCodeInvalidSubscriptionStateTransition, cloudError.CloudErrorBody)
+				}
+				expectedState = test.currentState
+			}
+
+			doc, err := f.dbClient.GetSubscriptionDoc(context.TODO(), subscriptionID)
+			if expectedState == "" {
+				if !errors.Is(err, database.ErrNotFound) {
+					t.Errorf("expected no document after the rejected write, got %v", err)
+				}
+			} else if err != nil {
+				t.Fatal(err)
+			} else if doc.Subscription.State != expectedState {
+				t.Errorf("expected state %s, got %s", expectedState, doc.Subscription.State)
+			} else if rs.StatusCode == http.StatusOK && (doc.DeletedAt != nil) != (expectedState == arm.SubscriptionStateDeleted) {
+				t.Errorf("expected deleted subscription to be soft-deleted, got DeletedAt %v", doc.DeletedAt)
+			}
+		})
+	}
+}
+
+func TestSubscriptionsPUTDeleteWithClusters(t *testing.T) {
+	ctx := context.Background()
+
+	f, ts := newTestListServer(t)
+	cluster := addTestCluster(t, f, dummyClusterName, nil)
+
+	deleteSubscription := func() *http.Response {
+		t.Helper()
+
+		body, err := json.Marshal(&arm.Subscription{
+			State:            arm.SubscriptionStateDeleted,
+			RegistrationDate: api.Ptr(time.Now().String()),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		req, err := http.NewRequest(http.MethodPut, ts.URL+"/subscriptions/"+dummySubscrtiptionId+"?api-version=2.0", bytes.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Content-Type", "application/json")
+
+		rs, err := ts.Client().Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rs.Body.Close()
+
+		if rs.StatusCode != http.StatusOK {
+			t.Fatalf("expected status code %d, got %d", http.StatusOK, rs.StatusCode)
+		}
+		return rs
+	}
+
+	rs := deleteSubscription()
+	warning := rs.Header.Get(HeaderNameWarning)
+	if !strings.Contains(warning, "still owned 1 clusters") || !strings.Contains(warning, "1 deletions started") {
+		t.Errorf("expected a warning about the remaining cluster, got %q", warning)
+	}
+
+	doc, err := f.dbClient.GetResourceDoc(ctx, cluster.ResourceId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if doc.ProvisioningState != arm.ProvisioningStateDeleting {
+		t.Errorf("expected cluster provisioning state %s, got %s", arm.ProvisioningStateDeleting, doc.ProvisioningState)
+	}
+
+	// Repeating the deletion reports the cluster still being deleted.
+	rs = deleteSubscription()
+	warning = rs.Header.Get(HeaderNameWarning)
+	if !strings.Contains(warning, "still owned 1 clusters") || !strings.Contains(warning, "0 deletions started") {
+		t.Errorf("expected a warning about the cluster being deleted, got %q", warning)
+	}
+}
+
+func TestSubscriptionsPATCH(t *testing.T) {
+	tenantID := "11111111-1111-1111-1111-111111111111"
+	registrationDate := "Mon, 01 Jul 2024 00:00:00 GMT"
+
+	tests := []struct {
+		name               string
+		existing           bool
+		body               string
+		expectedStatusCode int
+		expectedState      arm.SubscriptionState
+		expectedProperties bool
+	}{
+		{
+			name:               "Omitted fields are left as is",
+			existing:           true,
+			body:               `{"state":"Warned"}`,
+			expectedStatusCode: http.StatusOK,
+			expectedState:      arm.SubscriptionStateWarned,
+			expectedProperties: true,
+		},
+		{
+			name:               "Null field is cleared",
+			existing:           true,
+			body:               `{"properties":null}`,
+			expectedStatusCode: http.StatusOK,
+			expectedState:      arm.SubscriptionStateRegistered,
+			expectedProperties: false,
+		},
+		{
+			name:               "Empty patch changes nothing",
+			existing:           true,
+			body:               `{}`,
+			expectedStatusCode: http.StatusOK,
+			expectedState:      arm.SubscriptionStateRegistered,
+			expectedProperties: true,
+		},
+		{
+			name:               "Clearing a required field fails validation",
+			existing:           true,
+			body:               `{"state":null}`,
+			expectedStatusCode: http.StatusBadRequest,
+			expectedState:      arm.SubscriptionStateRegistered,
+			expectedProperties: true,
+		},
+		{
+			name:               "Body is not an object",
+			existing:           true,
+			body:               `["Warned"]`,
+			expectedStatusCode: http.StatusBadRequest,
+			expectedState:      arm.SubscriptionStateRegistered,
+			expectedProperties: true,
+		},
+		{
+			name:               "Subscription not found",
+			body:               `{"state":"Registered"}`,
+			expectedStatusCode: http.StatusNotFound,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctx := context.Background()
+
+			f := &Frontend{
+				dbClient: database.NewCache(),
+				metrics:  NewPrometheusEmitter(prometheus.NewRegistry()),
+			}
+
+			if test.existing {
+				err := f.dbClient.CreateSubscriptionDoc(ctx, database.NewSubscriptionDocument(dummySubscrtiptionId, &arm.Subscription{
+					State:            arm.SubscriptionStateRegistered,
+					RegistrationDate: &registrationDate,
+					Properties:       &arm.SubscriptionProperties{TenantId: &tenantID},
+				}))
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			ts := httptest.NewUnstartedServer(f.routes())
+			ts.Config.BaseContext = func(net.Listener) context.Context {
+				ctx := context.Background()
+				ctx = ContextWithLogger(ctx, testLogger)
+				ctx = ContextWithDBClient(ctx, f.dbClient)
+				return ctx
+			}
+			ts.Start()
+			defer ts.Close()
+
+			req, err := http.NewRequest(http.MethodPatch, ts.URL+"/subscriptions/"+dummySubscrtiptionId+"?api-version=2.0", strings.NewReader(test.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.Header.Set("Content-Type", "application/json")
+
+			rs, err := ts.Client().Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			rs.Body.Close()
+
+			if rs.StatusCode != test.expectedStatusCode {
+				t.Fatalf("expected status code %d, got %d", test.expectedStatusCode, rs.StatusCode)
+			}
+
+			doc, err := f.dbClient.GetSubscriptionDoc(ctx, dummySubscrtiptionId)
+			if !test.existing {
+				if !errors.Is(err, database.ErrNotFound) {
+					t.Errorf("expected no subscription document, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if doc.Subscription.State != test.expectedState {
+				t.Errorf("expected state %s, got %s", test.expectedState, doc.Subscription.State)
+			}
+			if doc.Subscription.RegistrationDate == nil || *doc.Subscription.RegistrationDate != registrationDate {
+				t.Errorf("expected registration date %q to be kept, got %v", registrationDate, doc.Subscription.RegistrationDate)
+			}
+			if hasProperties := doc.Subscription.Properties != nil; hasProperties != test.expectedProperties {
+				t.Errorf("expected properties present %t, got %t", test.expectedProperties, hasProperties)
+			}
+		})
+	}
+}
+
+func TestSubscriptionsPUTWriteConflicts(t *testing.T) {
+	tests := []struct {
+		name               string
+		existing           bool
+		retries            int
+		conflicts          int
+		expectedStatusCode int
+		expectedState      arm.SubscriptionState
+	}{
+		{
+			name:               "Conflicting update is retried",
+			existing:           true,
+			retries:            DefaultSubscriptionWriteRetries,
+			conflicts:          1,
+			expectedStatusCode: http.StatusOK,
+			expectedState:      arm.SubscriptionStateSuspended,
+		},
+		{
+			name:               "Conflicting create is retried",
+			retries:            DefaultSubscriptionWriteRetries,
+			conflicts:          1,
+			expectedStatusCode: http.StatusOK,
+			expectedState:      arm.SubscriptionStateRegistered,
+		},
+		{
+			name:               "Persistent conflicts are reported",
+			existing:           true,
+			retries:            DefaultSubscriptionWriteRetries,
+			conflicts:          DefaultSubscriptionWriteRetries + 1,
+			expectedStatusCode: http.StatusConflict,
+			expectedState:      arm.SubscriptionStateRegistered,
+		},
+		{
+			name:               "Zero retries reports the first conflict",
+			existing:           true,
+			conflicts:          1,
+			expectedStatusCode: http.StatusConflict,
+			expectedState:      arm.SubscriptionStateRegistered,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctx := context.Background()
+
+			dbClient := database.NewCache()
+			f := &Frontend{
+				dbClient: dbClient,
+				metrics:  NewPrometheusEmitter(prometheus.NewRegistry()),
+				config: Config{
+					SubscriptionWriteRetries: test.retries,
+					SubscriptionWriteBackoff: time.Millisecond,
+				},
+			}
+
+			requestState := arm.SubscriptionStateRegistered
+			if test.existing {
+				err := dbClient.CreateSubscriptionDoc(ctx, database.NewSubscriptionDocument(dummySubscrtiptionId, &arm.Subscription{
+					State:            arm.SubscriptionStateRegistered,
+					RegistrationDate: api.Ptr(time.Now().String()),
+				}))
+				if err != nil {
+					t.Fatal(err)
+				}
+				requestState = arm.SubscriptionStateSuspended
+			}
+
+			dbClient.(*database.Cache).InjectSubscriptionWriteConflicts(test.conflicts)
+
+			ts := httptest.NewUnstartedServer(f.routes())
+			ts.Config.BaseContext = func(net.Listener) context.Context {
+				ctx := context.Background()
+				ctx = ContextWithLogger(ctx, testLogger)
+				ctx = ContextWithDBClient(ctx, dbClient)
+				return ctx
+			}
+			ts.Start()
+			defer ts.Close()
+
+			body, err := json.Marshal(&arm.Subscription{
+				State:            requestState,
+				RegistrationDate: api.Ptr(time.Now().String()),
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			req, err := http.NewRequest(http.MethodPut, ts.URL+"/subscriptions/"+dummySubscrtiptionId+"?api-version=2.0", bytes.NewReader(body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.Header.Set("Content-Type", "application/json")
+
+			rs, err := ts.Client().Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			rs.Body.Close()
+
+			if rs.StatusCode != test.expectedStatusCode {
+				t.Fatalf("expected status code %d, got %d", test.expectedStatusCode, rs.StatusCode)
+			}
+
+			doc, err := dbClient.GetSubscriptionDoc(ctx, dummySubscrtiptionId)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if doc.Subscription.State != test.expectedState {
+				t.Errorf("expected subscription state %s, got %s", test.expectedState, doc.Subscription.State)
+			}
+		})
+	}
+}
+
+func TestShutdownReportsActiveOperations(t *testing.T) {
+	resourceID, err := arm.ParseResourceID(dummyClusterID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	internalID, err := ocm.NewInternalID(dummyClusterHREF)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dbClient := database.NewCache()
+
+	activeDoc := database.NewOperationDocument(database.OperationRequestCreate, resourceID, internalID)
+	err = dbClient.CreateOperationDoc(context.TODO(), activeDoc)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	terminalDoc := database.NewOperationDocument(database.OperationRequestUpdate, resourceID, internalID)
+	terminalDoc.Status = arm.ProvisioningStateSucceeded
+	err = dbClient.CreateOperationDoc(context.TODO(), terminalDoc)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	listener, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	metricsListener, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var logOutput bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&logOutput, nil))
+	mockCSClient := ocm.NewMockClusterServiceClient()
+
+	config := DefaultConfig()
+	config.Location = dummyLocation
+
+	f, err := NewFrontend(config, logger, listener, metricsListener, NewPrometheusEmitter(prometheus.NewRegistry()), dbClient, &mockCSClient)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stop := make(chan struct{})
+	go f.Run(context.Background(), stop)
+	close(stop)
+	f.Join()
+
+	output := logOutput.String()
+
+	if !strings.Contains(output, "1 operations in progress") {
+		t.Errorf("expected shutdown to report 1 operation in progress, got:\n%s", output)
+	}
+
+	if !strings.Contains(output, activeDoc.ID) {
+		t.Errorf("expected shutdown to report active operation '%s'", activeDoc.ID)
+	}
+
+	if strings.Contains(output, terminalDoc.ID) {
+		t.Errorf("expected shutdown to omit terminal operation '%s'", terminalDoc.ID)
+	}
+}
+
+func TestClusterCreateValidation(t *testing.T) {
+	validCluster := generated.HcpOpenShiftClusterResource{
+		Location: &dummyLocation,
+		Properties: &generated.HcpOpenShiftClusterProperties{
+			Spec: &generated.ClusterSpec{
+				Version: &generated.VersionProfile{
+					ID:           &dummyVersionID,
+					ChannelGroup: &dummyChannelGroup,
+				},
+				Network: &generated.NetworkProfile{
+					PodCidr:     api.Ptr("10.128.0.0/14"),
+					ServiceCidr: api.Ptr("172.30.0.0/16"),
+					MachineCidr: api.Ptr("10.0.0.0/16"),
+				},
+				API: &generated.APIProfile{
+					Visibility: api.Ptr(generated.VisibilityPublic),
+				},
+				Platform: &generated.PlatformProfile{
+					SubnetID: api.Ptr("/subscriptions/" + dummySubscrtiptionId + "/resourceGroups/network/providers/Microsoft.Network/virtualNetworks/vnet/subnets/subnet"),
+				},
+			},
+		},
+	}
+
+	externalAuthSpec := *validCluster.Properties.Spec
+	externalAuthSpec.ExternalAuth = &generated.ExternalAuthConfigProfile{Enabled: api.Ptr(true)}
+	externalAuthCluster := validCluster
+	externalAuthCluster.Properties = &generated.HcpOpenShiftClusterProperties{Spec: &externalAuthSpec}
+
+	tests := []struct {
+		name               string
+		body               any
+		tenantID           string
+		features           []arm.Feature
+		validateOnly       string
+		expectedStatusCode int
+	}{
+		{
+			name:               "Valid cluster is accepted",
+			body:               validCluster,
+			tenantID:           dummyTenantId,
+			expectedStatusCode: http.StatusCreated,
+		},
+		{
+			name: "Missing required properties",
+			body: generated.HcpOpenShiftClusterResource{
+				Location:   &dummyLocation,
+				Properties: &generated.HcpOpenShiftClusterProperties{},
+			},
+			tenantID:           dummyTenantId,
+			expectedStatusCode: http.StatusBadRequest,
+		},
+		{
+			name:               "Missing home tenant",
+			body:               validCluster,
+			expectedStatusCode: http.StatusBadRequest,
+		},
+		{
+			name:     "External auth with preview feature registered",
+			body:     externalAuthCluster,
+			tenantID: dummyTenantId,
+			features: []arm.Feature{
+				{Name: api.Ptr(api.FeatureExternalAuth), State: api.Ptr(arm.FeatureStateRegistered)},
+			},
+			expectedStatusCode: http.StatusCreated,
+		},
+		{
+			name:               "External auth without preview feature registered",
+			body:               externalAuthCluster,
+			tenantID:           dummyTenantId,
+			expectedStatusCode: http.StatusConflict,
+		},
+		{
+			name:     "External auth with preview feature pending",
+			body:     externalAuthCluster,
+			tenantID: dummyTenantId,
+			features: []arm.Feature{
+				{Name: api.Ptr(api.FeatureExternalAuth), State: api.Ptr("Pending")},
+			},
+			expectedStatusCode: http.StatusConflict,
+		},
+		{
+			name:               "Dry run of a valid cluster",
+			body:               validCluster,
+			tenantID:           dummyTenantId,
+			validateOnly:       "query",
+			expectedStatusCode: http.StatusNoContent,
+		},
+		{
+			name:               "Dry run of a valid cluster by header",
+			body:               validCluster,
+			tenantID:           dummyTenantId,
+			validateOnly:       "header",
+			expectedStatusCode: http.StatusNoContent,
+		},
+		{
+			name: "Dry run of an invalid cluster",
+			body: generated.HcpOpenShiftClusterResource{
+				Location:   &dummyLocation,
+				Properties: &generated.HcpOpenShiftClusterProperties{},
+			},
+			tenantID:           dummyTenantId,
+			validateOnly:       "query",
+			expectedStatusCode: http.StatusBadRequest,
+		},
+		{
+			name:               "Dry run without preview feature registered",
+			body:               externalAuthCluster,
+			tenantID:           dummyTenantId,
+			validateOnly:       "query",
+			expectedStatusCode: http.StatusConflict,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctx := context.Background()
+			mockCSClient := ocm.NewMockClusterServiceClient()
+
+			f := &Frontend{
+				dbClient:             database.NewCache(),
+				metrics:              NewPrometheusEmitter(prometheus.NewRegistry()),
+				clusterServiceClient: &mockCSClient,
+			}
+
+			subscription := &arm.Subscription{
+				State:            arm.SubscriptionStateRegistered,
+				RegistrationDate: api.Ptr(time.Now().String()),
+			}
+			if test.tenantID != "" || test.features != nil {
+				subscription.Properties = &arm.SubscriptionProperties{RegisteredFeatures: &test.features}
+				if test.tenantID != "" {
+					subscription.Properties.TenantId = &test.tenantID
+				}
+			}
+			err := f.dbClient.CreateSubscriptionDoc(ctx, database.NewSubscriptionDocument(dummySubscrtiptionId, subscription))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			ts := httptest.NewServer(f.routes())
+			ts.Config.BaseContext = func(net.Listener) context.Context {
+				ctx := context.Background()
+				ctx = ContextWithLogger(ctx, testLogger)
+				ctx = ContextWithDBClient(ctx, f.dbClient)
+				ctx = ContextWithSystemData(ctx, &arm.SystemData{})
+				return ctx
+			}
+			defer ts.Close()
+
+			body, err := json.Marshal(test.body)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			requestURL := ts.URL + dummyClusterID + "?api-version=2024-06-10-preview"
+			if test.validateOnly == "query" {
+				requestURL += "&" + ValidateOnlyKey + "=true"
+			}
+
+			req, err := http.NewRequest(http.MethodPut, requestURL, bytes.NewReader(body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.Header.Set("Content-Type", "application/json")
+			if test.validateOnly == "header" {
+				req.Header.Set(arm.HeaderNameValidationOnly, "true")
+			}
+
+			rs, err := ts.Client().Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			rs.Body.Close()
+
+			if rs.StatusCode != test.expectedStatusCode {
+				t.Errorf("expected status code %d, got %d", test.expectedStatusCode, rs.StatusCode)
+			}
+
+			var operationCount int
+			iterator := f.dbClient.ListAllOperationDocs(ctx)
+			for range iterator.Items(ctx) {
+				operationCount++
+			}
+			if err := iterator.GetError(); err != nil {
+				t.Fatal(err)
+			}
+
+			// Only a request that passes synchronous validation may start an operation.
+			expectedOperations := 0
+			if test.expectedStatusCode == http.StatusCreated {
+				expectedOperations = 1
+			}
+			if operationCount != expectedOperations {
+				t.Errorf("expected %d operation documents, got %d", expectedOperations, operationCount)
+			}
+
+			// Likewise for the resource document, which a dry run never creates.
+			resourceID, err := arm.ParseResourceID(dummyClusterID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = f.dbClient.GetResourceDoc(ctx, resourceID)
+			if test.expectedStatusCode == http.StatusCreated && err != nil {
+				t.Errorf("expected a resource document, got %v", err)
+			} else if test.expectedStatusCode != http.StatusCreated && !errors.Is(err, database.ErrNotFound) {
+				t.Errorf("expected no resource document, got %v", err)
+			}
+		})
+	}
+}
+
+func TestClusterPUTPreservesReadOnlyFields(t *testing.T) {
+	const (
+		consoleURL = "https://console.example.com"
+		apiURL     = "https://api.example.com"
+	)
+
+	requestCluster := func(console *generated.ConsoleProfile) generated.HcpOpenShiftClusterResource {
+		return generated.HcpOpenShiftClusterResource{
+			Location: &dummyLocation,
+			Properties: &generated.HcpOpenShiftClusterProperties{
+				Spec: &generated.ClusterSpec{
+					Version: &generated.VersionProfile{
+						ID:           &dummyVersionID,
+						ChannelGroup: &dummyChannelGroup,
+					},
+					Network: &generated.NetworkProfile{
+						PodCidr:     api.Ptr("10.128.0.0/14"),
+						ServiceCidr: api.Ptr("172.30.0.0/16"),
+						MachineCidr: api.Ptr("10.0.0.0/16"),
+					},
+					API: &generated.APIProfile{
+						Visibility: api.Ptr(generated.VisibilityPublic),
+					},
+					Console: console,
+					Platform: &generated.PlatformProfile{
+						SubnetID: api.Ptr("/subscriptions/" + dummySubscrtiptionId + "/resourceGroups/network/providers/Microsoft.Network/virtualNetworks/vnet/subnets/subnet"),
+					},
+				},
+			},
+		}
+	}
+
+	tests := []struct {
+		name               string
+		body               generated.HcpOpenShiftClusterResource
+		expectedStatusCode int
+	}{
+		{
+			name:               "PUT omits a read-only field",
+			body:               requestCluster(nil),
+			expectedStatusCode: http.StatusOK,
+		},
+		{
+			name:               "PUT repeats a read-only field",
+			body:               requestCluster(&generated.ConsoleProfile{URL: api.Ptr(consoleURL)}),
+			expectedStatusCode: http.StatusOK,
+		},
+		{
+			name:               "PUT overwrites a read-only field",
+			body:               requestCluster(&generated.ConsoleProfile{URL: api.Ptr("https://console.invalid")}),
+			expectedStatusCode: http.StatusBadRequest,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctx := context.Background()
+			f, ts := newTestListServer(t)
+
+			resourceID, err := arm.ParseResourceID(dummyClusterID)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// Cluster Service manages the console and API URLs.
+			requestHeader := make(http.Header)
+			requestHeader.Set(arm.HeaderNameHomeTenantID, dummyTenantId)
+			hcpCluster := api.NewDefaultHCPOpenShiftCluster()
+			hcpCluster.Name = resourceID.Name
+			hcpCluster.Properties.Spec.API.Visibility = api.VisibilityPublic
+			csCluster, err := f.BuildCSCluster(resourceID, requestHeader, hcpCluster, false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			csCluster, err = cmv1.NewCluster().Copy(csCluster).
+				Console(cmv1.NewClusterConsole().URL(consoleURL)).
+				API(cmv1.NewClusterAPI().URL(apiURL).Listening(cmv1.ListeningMethodExternal)).
+				Build()
+			if err != nil {
+				t.Fatal(err)
+			}
+			csCluster, err = f.clusterServiceClient.PostCSCluster(ctx, csCluster)
+			if err != nil {
+				t.Fatal(err)
+			}
+			doc := database.NewResourceDocument(resourceID)
+			doc.InternalID, err = ocm.NewInternalID(csCluster.HREF())
+			if err != nil {
+				t.Fatal(err)
+			}
+			doc.ProvisioningState = arm.ProvisioningStateSucceeded
+			if err = f.dbClient.CreateResourceDoc(ctx, doc); err != nil {
+				t.Fatal(err)
+			}
+
+			// The update sees the cluster as it will be.
+			var updated *api.HCPOpenShiftCluster
+			f.RegisterValidationHook(database.OperationRequestUpdate, func(ctx context.Context, request ValidationRequest) error {
+				updated = request.Resource.(*api.HCPOpenShiftCluster)
+				return nil
+			})
+
+			body, err := json.Marshal(test.body)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			req, err := http.NewRequest(http.MethodPut, ts.URL+dummyClusterID+"?api-version=2024-06-10-preview", bytes.NewReader(body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set(arm.HeaderNameHomeTenantID, dummyTenantId)
+			req.Header.Set(arm.HeaderNameARMResourceSystemData, "{}")
+
+			rs, err := ts.Client().Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer rs.Body.Close()
+
+			if rs.StatusCode != test.expectedStatusCode {
+				t.Fatalf("expected status code %d, got %d", test.expectedStatusCode, rs.StatusCode)
+			}
+
+			if rs.StatusCode != http.StatusOK {
+				if updated != nil {
+					t.Error("expected a rejected update not to reach the validation hooks")
+				}
+				return
+			}
+
+			if updated == nil {
+				t.Fatal("expected the update to reach the validation hooks")
+			}
+			if updated.Properties.Spec.Console.URL != consoleURL {
+				t.Errorf("expected console URL %q, got %q", consoleURL, updated.Properties.Spec.Console.URL)
+			}
+			if updated.Properties.Spec.API.URL != apiURL {
+				t.Errorf("expected API URL %q, got %q", apiURL, updated.Properties.Spec.API.URL)
+			}
+		})
+	}
+}
+
+func TestClusterPUTIdentity(t *testing.T) {
+	userAssignedIdentityID := "/subscriptions/" + dummySubscrtiptionId + "/resourceGroups/identities/providers/Microsoft.ManagedIdentity/userAssignedIdentities/cluster"
+
+	requestCluster := func(identity *generated.ManagedServiceIdentity) generated.HcpOpenShiftClusterResource {
+		return generated.HcpOpenShiftClusterResource{
+			Location: &dummyLocation,
+			Identity: identity,
+			Properties: &generated.HcpOpenShiftClusterProperties{
+				Spec: &generated.ClusterSpec{
+					Version: &generated.VersionProfile{
+						ID:           &dummyVersionID,
+						ChannelGroup: &dummyChannelGroup,
+					},
+					Network: &generated.NetworkProfile{
+						PodCidr:     api.Ptr("10.128.0.0/14"),
+						ServiceCidr: api.Ptr("172.30.0.0/16"),
+						MachineCidr: api.Ptr("10.0.0.0/16"),
+					},
+					API: &generated.APIProfile{
+						Visibility: api.Ptr(generated.VisibilityPublic),
+					},
+					Platform: &generated.PlatformProfile{
+						SubnetID: api.Ptr("/subscriptions/" + dummySubscrtiptionId + "/resourceGroups/network/providers/Microsoft.Network/virtualNetworks/vnet/subnets/subnet"),
+					},
+				},
+			},
+		}
+	}
+
+	tests := []struct {
+		name               string
+		identity           *generated.ManagedServiceIdentity
+		expectedStatusCode int
+	}{
+		{
+			name:               "No identity",
+			expectedStatusCode: http.StatusCreated,
+		},
+		{
+			name: "None",
+			identity: &generated.ManagedServiceIdentity{
+				Type: api.Ptr(generated.ManagedServiceIdentityTypeNone),
+			},
+			expectedStatusCode: http.StatusCreated,
+		},
+		{
+			name: "SystemAssigned",
+			identity: &generated.ManagedServiceIdentity{
+				Type: api.Ptr(generated.ManagedServiceIdentityTypeSystemAssigned),
+			},
+			expectedStatusCode: http.StatusCreated,
+		},
+		{
+			name: "UserAssigned",
+			identity: &generated.ManagedServiceIdentity{
+				Type: api.Ptr(generated.ManagedServiceIdentityTypeUserAssigned),
+				UserAssignedIdentities: map[string]*generated.UserAssignedIdentity{
+					userAssignedIdentityID: {},
+				},
+			},
+			expectedStatusCode: http.StatusCreated,
+		},
+		{
+			name: "SystemAssigned,UserAssigned",
+			identity: &generated.ManagedServiceIdentity{
+				Type: api.Ptr(generated.ManagedServiceIdentityTypeSystemAssignedUserAssigned),
+				UserAssignedIdentities: map[string]*generated.UserAssignedIdentity{
+					userAssignedIdentityID: {},
+				},
+			},
+			expectedStatusCode: http.StatusCreated,
+		},
+		{
+			name: "UserAssigned without identities",
+			identity: &generated.ManagedServiceIdentity{
+				Type: api.Ptr(generated.ManagedServiceIdentityTypeUserAssigned),
+			},
+			expectedStatusCode: http.StatusBadRequest,
+		},
+		{
+			name: "SystemAssigned,UserAssigned without identities",
+			identity: &generated.ManagedServiceIdentity{
+				Type:                   api.Ptr(generated.ManagedServiceIdentityTypeSystemAssignedUserAssigned),
+				UserAssignedIdentities: map[string]*generated.UserAssignedIdentity{},
+			},
+			expectedStatusCode: http.StatusBadRequest,
+		},
+		{
+			name: "SystemAssigned in lowercase",
+			identity: &generated.ManagedServiceIdentity{
+				Type: api.Ptr(generated.ManagedServiceIdentityType("systemassigned")),
+			},
+			expectedStatusCode: http.StatusCreated,
+		},
+		{
+			name: "Unknown type",
+			identity: &generated.ManagedServiceIdentity{
+				Type: api.Ptr(generated.ManagedServiceIdentityType("Bogus")),
+			},
+			expectedStatusCode: http.StatusBadRequest,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, ts := newTestListServer(t)
+
+			body, err := json.Marshal(requestCluster(test.identity))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			req, err := http.NewRequest(http.MethodPut, ts.URL+dummyClusterID+"?api-version=2024-06-10-preview", bytes.NewReader(body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set(arm.HeaderNameHomeTenantID, dummyTenantId)
+			req.Header.Set(arm.HeaderNameARMResourceSystemData, "{}")
+
+			rs, err := ts.Client().Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			rs.Body.Close()
+
+			if rs.StatusCode != test.expectedStatusCode {
+				t.Fatalf("expected status code %d, got %d", test.expectedStatusCode, rs.StatusCode)
+			}
+			if rs.StatusCode != http.StatusCreated {
+				return
+			}
+
+			// The identity reads back as it was sent.
+			rs, err = ts.Client().Get(ts.URL + dummyClusterID + "?api-version=2024-06-10-preview")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer rs.Body.Close()
+
+			if rs.StatusCode != http.StatusOK {
+				t.Fatalf("expected status code %d, got %d", http.StatusOK, rs.StatusCode)
+			}
+
+			var cluster generated.HcpOpenShiftClusterResource
+			if err := json.NewDecoder(rs.Body).Decode(&cluster); err != nil {
+				t.Fatal(err)
+			}
+
+			if test.identity == nil {
+				if cluster.Identity != nil {
+					t.Errorf("expected no identity, got %+v", cluster.Identity)
+				}
+				return
+			}
+			if cluster.Identity == nil || cluster.Identity.Type == nil {
+				t.Fatalf("expected identity type %q, got none", *test.identity.Type)
+			}
+			if *cluster.Identity.Type != *test.identity.Type {
+				t.Errorf("expected identity type %q, got %q", *test.identity.Type, *cluster.Identity.Type)
+			}
+			if len(cluster.Identity.UserAssignedIdentities) != len(test.identity.UserAssignedIdentities) {
+				t.Errorf("expected %d user-assigned identities, got %d", len(test.identity.UserAssignedIdentities), len(cluster.Identity.UserAssignedIdentities))
+			}
+			for key := range test.identity.UserAssignedIdentities {
+				if _, ok := cluster.Identity.UserAssignedIdentities[key]; !ok {
+					t.Errorf("expected user-assigned identity %s", key)
+				}
+			}
+			if cluster.Identity.PrincipalID != nil || cluster.Identity.TenantID != nil {
+				t.Errorf("expected no principal or tenant ID, got %+v", cluster.Identity)
+			}
+		})
+	}
+
+	t.Run("PUT without identity removes it", func(t *testing.T) {
+		f, ts := newTestListServer(t)
+
+		put := func(identity *generated.ManagedServiceIdentity, expectedStatusCode int) {
+			t.Helper()
+
+			body, err := json.Marshal(requestCluster(identity))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			req, err := http.NewRequest(http.MethodPut, ts.URL+dummyClusterID+"?api-version=2024-06-10-preview", bytes.NewReader(body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set(arm.HeaderNameHomeTenantID, dummyTenantId)
+			req.Header.Set(arm.HeaderNameARMResourceSystemData, "{}")
+
+			rs, err := ts.Client().Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			rs.Body.Close()
+
+			if rs.StatusCode != expectedStatusCode {
+				t.Fatalf("expected status code %d, got %d", expectedStatusCode, rs.StatusCode)
+			}
+		}
+
+		put(&generated.ManagedServiceIdentity{
+			Type: api.Ptr(generated.ManagedServiceIdentityTypeSystemAssigned),
+		}, http.StatusCreated)
+
+		resourceID, err := arm.ParseResourceID(dummyClusterID)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// Let the creation finish so the resource can be updated.
+		_, err = f.dbClient.UpdateResourceDoc(context.Background(), resourceID, func(doc *database.ResourceDocument) bool {
+			doc.ProvisioningState = arm.ProvisioningStateSucceeded
+			return true
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		put(nil, http.StatusOK)
+
+		doc, err := f.dbClient.GetResourceDoc(context.Background(), resourceID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if doc.Identity != nil {
+			t.Errorf("expected no identity, got %+v", doc.Identity)
+		}
+	})
+}
+
+func TestProviderGET(t *testing.T) {
+	f := &Frontend{
+		dbClient: database.NewCache(),
+		metrics:  NewPrometheusEmitter(prometheus.NewRegistry()),
+	}
+
+	ts := httptest.NewServer(f.routes())
+	ts.Config.BaseContext = func(net.Listener) context.Context {
+		ctx := context.Background()
+		ctx = ContextWithLogger(ctx, testLogger)
+		ctx = ContextWithDBClient(ctx, f.dbClient)
+		return ctx
+	}
+	defer ts.Close()
+
+	rs, err := ts.Client().Get(ts.URL + "/providers/Microsoft.RedHatOpenShift?api-version=2.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rs.Body.Close()
+
+	if rs.StatusCode != http.StatusOK {
+		t.Fatalf("expected status code %d, got %d", http.StatusOK, rs.StatusCode)
+	}
+
+	var provider arm.Provider
+	err = json.NewDecoder(rs.Body).Decode(&provider)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if provider.Namespace != api.ProviderNamespace {
+		t.Errorf("expected namespace %q, got %q", api.ProviderNamespace, provider.Namespace)
+	}
+
+	apiVersions := make(map[string][]string)
+	for _, resourceType := range provider.ResourceTypes {
+		apiVersions[resourceType.ResourceType] = resourceType.APIVersions
+	}
+
+	for _, resourceType := range []azcorearm.ResourceType{
+		api.ClusterResourceType,
+		api.NodePoolResourceType,
+		api.OperationResultResourceType,
+		api.OperationStatusResourceType,
+	} {
+		if !slices.Contains(apiVersions[resourceType.Type], "2024-06-10-preview") {
+			t.Errorf("expected resource type %q to support API version 2024-06-10-preview, got %v", resourceType.Type, apiVersions[resourceType.Type])
+		}
+	}
+}
+
+// addTestCluster adds a cluster to both the database and the mock
+// Cluster Service and returns its resource document.
+func addTestCluster(t *testing.T, f *Frontend, name string, systemData *arm.SystemData) *database.ResourceDocument {
+	t.Helper()
+
+	ctx := context.Background()
+
+	resourceID, err := arm.ParseResourceID(
+		"/subscriptions/" + dummySubscrtiptionId + "/resourceGroups/" + dummyResourceGroupId +
+			"/providers/" + api.ProviderNamespace + "/" + api.ClusterResourceTypeName + "/" + name)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	requestHeader := make(http.Header)
+	requestHeader.Add(arm.HeaderNameHomeTenantID, dummyTenantId)
+
+	hcpCluster := api.NewDefaultHCPOpenShiftCluster()
+	hcpCluster.Name = name
+	csCluster, err := f.BuildCSCluster(resourceID, requestHeader, hcpCluster, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	csCluster, err = f.clusterServiceClient.PostCSCluster(ctx, csCluster)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	doc := database.NewResourceDocument(resourceID)
+	doc.InternalID, err = ocm.NewInternalID(csCluster.HREF())
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc.ProvisioningState = arm.ProvisioningStateSucceeded
+	doc.SystemData = systemData
+	err = f.dbClient.CreateResourceDoc(ctx, doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return doc
+}
+
+// newTestListServer returns a test server for a Frontend with a
+// registered subscription, suitable for resource list requests.
+func newTestListServer(t *testing.T) (*Frontend, *httptest.Server) {
+	t.Helper()
+
+	mockCSClient := ocm.NewMockClusterServiceClient()
+	f := &Frontend{
+		dbClient:             database.NewCache(),
+		metrics:              NewPrometheusEmitter(prometheus.NewRegistry()),
+		clusterServiceClient: &mockCSClient,
+		config:               Config{AdminTokens: []string{testAdminToken}},
+	}
+
+	err := f.dbClient.CreateSubscriptionDoc(context.Background(), database.NewSubscriptionDocument(
+		dummySubscrtiptionId, &arm.Subscription{
+			State:            arm.SubscriptionStateRegistered,
+			RegistrationDate: api.Ptr(time.Now().String()),
+		}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ts := httptest.NewUnstartedServer(f.routes())
+	ts.Config.BaseContext = func(net.Listener) context.Context {
+		ctx := context.Background()
+		ctx = ContextWithLogger(ctx, testLogger)
+		ctx = ContextWithDBClient(ctx, f.dbClient)
+		return ctx
+	}
+	ts.Start()
+	t.Cleanup(ts.Close)
+
+	// Authorize requests to the admin routes.
+	ts.Client().Transport = &adminAuthTransport{base: ts.Client().Transport}
+
+	return f, ts
+}
+
+func TestArmResourceListChangedSince(t *testing.T) {
+	since := time.Date(2024, time.June, 1, 0, 0, 0, 0, time.UTC)
+	before := since.Add(-time.Hour)
+	after := since.Add(time.Hour)
+
+	f, ts := newTestListServer(t)
+	addTestCluster(t, f, "stale-cluster", &arm.SystemData{CreatedAt: &before, LastModifiedAt: &before})
+	addTestCluster(t, f, "recently-modified", &arm.SystemData{CreatedAt: &before, LastModifiedAt: &after})
+	addTestCluster(t, f, "recently-created", &arm.SystemData{CreatedAt: &after})
+	addTestCluster(t, f, "no-system-data", nil)
+
+	listURL := ts.URL + "/subscriptions/" + dummySubscrtiptionId + "/providers/" + api.ProviderNamespace + "/" + api.ClusterResourceTypeName + "?api-version=2024-06-10-preview"
+
+	tests := []struct {
+		name               string
+		changedSince       string
+		expectedStatusCode int
+		expectedNames      []string
+	}{
+		{
+			name:               "No filter",
+			expectedStatusCode: http.StatusOK,
+			expectedNames:      []string{"no-system-data", "recently-created", "recently-modified", "stale-cluster"},
+		},
+		{
+			name:               "Only recently changed",
+			changedSince:       since.Format(time.RFC3339),
+			expectedStatusCode: http.StatusOK,
+			expectedNames:      []string{"no-system-data", "recently-created", "recently-modified"},
+		},
+		{
+			name:               "Invalid timestamp",
+			changedSince:       "yesterday",
+			expectedStatusCode: http.StatusBadRequest,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			requestURL := listURL
+			if test.changedSince != "" {
+				requestURL += "&" + ChangedSinceKey + "=" + test.changedSince
+			}
+
+			rs, err := ts.Client().Get(requestURL)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer rs.Body.Close()
+
+			if rs.StatusCode != test.expectedStatusCode {
+				t.Fatalf("expected status code %d, got %d", test.expectedStatusCode, rs.StatusCode)
+			}
+			if rs.StatusCode != http.StatusOK {
+				return
+			}
+
+			var response struct {
+				Value []struct {
+					Name string `json:"name"`
+				} `json:"value"`
+			}
+			err = json.NewDecoder(rs.Body).Decode(&response)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var names []string
+			for _, value := range response.Value {
+				names = append(names, value.Name)
+			}
+			slices.Sort(names)
+
+			if !slices.Equal(names, test.expectedNames) {
+				t.Errorf("expected clusters %v, got %v", test.expectedNames, names)
+			}
+		})
+	}
+}
+
+func TestArmResourceListPageSize(t *testing.T) {
+	f, ts := newTestListServer(t)
+	for i := range 5 {
+		addTestCluster(t, f, fmt.Sprintf("cluster-%d", i), nil)
+	}
+
+	f.config.DefaultPageSize = 2
+	f.config.MaxPageSize = 3
+
+	listURL := ts.URL + "/subscriptions/" + dummySubscrtiptionId + "/providers/" + api.ProviderNamespace + "/" + api.ClusterResourceTypeName + "?api-version=2024-06-10-preview"
+
+	list := func(requestURL string) arm.PagedResponse {
+		t.Helper()
+
+		req, err := http.NewRequest(http.MethodGet, requestURL, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// ARM passes the original request URL in the Referer header,
+		// which the frontend uses to build the nextLink.
+		req.Header.Set("Referer", requestURL)
+
+		rs, err := ts.Client().Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer rs.Body.Close()
+
+		if rs.StatusCode != http.StatusOK {
+			t.Fatalf("expected status code %d, got %d", http.StatusOK, rs.StatusCode)
+		}
+
+		var response arm.PagedResponse
+		err = json.NewDecoder(rs.Body).Decode(&response)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return response
+	}
+
+	// Without $top the default page size applies.
+	response := list(listURL)
+	if len(response.Value) != 2 {
+		t.Errorf("expected default page size of 2, got %d items", len(response.Value))
+	}
+	if response.NextLink == "" {
+		t.Fatal("expected a nextLink")
+	}
+
+	// A large $top is clamped to the max page size.
+	response = list(response.NextLink + "&$top=100")
+	if len(response.Value) != 3 {
+		t.Errorf("expected max page size of 3, got %d items", len(response.Value))
+	}
+}
+
+func TestArmResourceListNextLinkWithoutReferer(t *testing.T) {
+	f, ts := newTestListServer(t)
+	for i := range 3 {
+		addTestCluster(t, f, fmt.Sprintf("cluster-%d", i), nil)
+	}
+
+	f.config.DefaultPageSize = 2
+	f.config.MaxPageSize = 2
+
+	listPath := "/subscriptions/" + dummySubscrtiptionId + "/providers/" + api.ProviderNamespace + "/" + api.ClusterResourceTypeName
+	listURL := ts.URL + listPath + "?api-version=2024-06-10-preview"
+
+	rs, err := ts.Client().Get(listURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rs.Body.Close()
+
+	if rs.StatusCode != http.StatusOK {
+		t.Fatalf("expected status code %d, got %d", http.StatusOK, rs.StatusCode)
+	}
+
+	var response arm.PagedResponse
+	err = json.NewDecoder(rs.Body).Decode(&response)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The nextLink is built from the request itself and must be
+	// absolute and keep the original path casing and API version.
+	nextLink, err := url.Parse(response.NextLink)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !nextLink.IsAbs() || nextLink.Host != strings.TrimPrefix(ts.URL, "http://") {
+		t.Errorf("expected an absolute nextLink on the test server, got %q", response.NextLink)
+	}
+	if nextLink.Path != listPath {
+		t.Errorf("expected nextLink path %q, got %q", listPath, nextLink.Path)
+	}
+	if apiVersion := nextLink.Query().Get(APIVersionKey); apiVersion != "2024-06-10-preview" {
+		t.Errorf("expected nextLink to keep api-version, got %q", apiVersion)
+	}
+	if nextLink.Query().Get("$skipToken") == "" {
+		t.Errorf("expected nextLink to have a $skipToken, got %q", response.NextLink)
+	}
+}
+
+func TestArmResourceListSkipToken(t *testing.T) {
+	f, ts := newTestListServer(t)
+	for i := range 3 {
+		addTestCluster(t, f, fmt.Sprintf("cluster-%d", i), nil)
+	}
+
+	listURL := ts.URL + "/subscriptions/" + dummySubscrtiptionId + "/providers/" + api.ProviderNamespace + "/" + api.ClusterResourceTypeName + "?api-version=2024-06-10-preview"
+
+	firstClusterID := "/subscriptions/" + dummySubscrtiptionId + "/resourcegroups/" + dummyResourceGroupId + "/providers/" + api.ProviderNamespace + "/" + api.ClusterResourceTypeName + "/cluster-0"
+
+	tests := []struct {
+		name               string
+		skipToken          string
+		expectedStatusCode int
+		expectedItems      int
+	}{
+		{
+			name:               "Valid token",
+			skipToken:          database.EncodeContinuationToken(firstClusterID),
+			expectedStatusCode: http.StatusOK,
+			expectedItems:      2,
+		},
+		{
+			name:               "Garbage token",
+			skipToken:          "!!!not-a-token!!!",
+			expectedStatusCode: http.StatusBadRequest,
+		},
+		{
+			name:               "Tampered token",
+			skipToken:          base64.RawURLEncoding.EncodeToString([]byte(`{"lastKey":`)),
+			expectedStatusCode: http.StatusBadRequest,
+		},
+		{
+			name:               "Token without last key",
+			skipToken:          base64.RawURLEncoding.EncodeToString([]byte(`{}`)),
+			expectedStatusCode: http.StatusBadRequest,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			requestURL := listURL + "&$skipToken=" + url.QueryEscape(test.skipToken)
+
+			req, err := http.NewRequest(http.MethodGet, requestURL, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.Header.Set("Referer", requestURL)
+
+			rs, err := ts.Client().Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer rs.Body.Close()
+
+			if rs.StatusCode != test.expectedStatusCode {
+				t.Fatalf("expected status code %d, got %d", test.expectedStatusCode, rs.StatusCode)
+			}
+
+			if test.expectedStatusCode == http.StatusOK {
+				var response arm.PagedResponse
+				err = json.NewDecoder(rs.Body).Decode(&response)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if len(response.Value) != test.expectedItems {
+					t.Errorf("expected %d items, got %d", test.expectedItems, len(response.Value))
+				}
+				return
+			}
+
+			var cloudError arm.CloudError
+			err = json.NewDecoder(rs.Body).Decode(&cloudError)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if cloudError.CloudErrorBody == nil || cloudError.Code != arm.CloudErrorCodeInvalidContinuationToken {
+				t.Errorf("expected error code %s, got %+v", arm.CloudErrorCodeInvalidContinuationToken, cloudError.CloudErrorBody)
+			}
+		})
+	}
+}
+
+func TestArmResourceListEmptyScope(t *testing.T) {
+	f, ts := newTestListServer(t)
+
+	// A cluster elsewhere in the subscription must not leak into
+	// the resource group scoped lists.
+	cluster := addTestCluster(t, f, "lonely-cluster", nil)
+
+	emptyResourceGroup := "/subscriptions/" + dummySubscrtiptionId + "/resourceGroups/empty-rg"
+
+	tests := []struct {
+		name               string
+		urlPath            string
+		expectedStatusCode int
+	}{
+		{
+			name:               "Empty resource group",
+			urlPath:            emptyResourceGroup + "/providers/" + api.ProviderNamespace + "/" + api.ClusterResourceTypeName,
+			expectedStatusCode: http.StatusOK,
+		},
+		{
+			name:               "Empty subscription",
+			urlPath:            "/subscriptions/11111111-1111-1111-1111-111111111111/providers/" + api.ProviderNamespace + "/" + api.ClusterResourceTypeName,
+			expectedStatusCode: http.StatusOK,
+		},
+		{
+			name:               "Cluster without node pools",
+			urlPath:            cluster.ResourceId.String() + "/" + api.NodePoolResourceTypeName,
+			expectedStatusCode: http.StatusOK,
+		},
+		{
+			name:               "Node pools of a missing cluster",
+			urlPath:            emptyResourceGroup + "/providers/" + api.ProviderNamespace + "/" + api.ClusterResourceTypeName + "/missing/" + api.NodePoolResourceTypeName,
+			expectedStatusCode: http.StatusNotFound,
+		},
+	}
+
+	// Register the second subscription used above.
+	err := f.dbClient.CreateSubscriptionDoc(context.Background(), database.NewSubscriptionDocument(
+		"11111111-1111-1111-1111-111111111111", &arm.Subscription{
+			State:            arm.SubscriptionStateRegistered,
+			RegistrationDate: api.Ptr(time.Now().String()),
+		}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rs, err := ts.Client().Get(ts.URL + test.urlPath + "?api-version=2024-06-10-preview")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer rs.Body.Close()
+
+			if rs.StatusCode != test.expectedStatusCode {
+				t.Fatalf("expected status code %d, got %d", test.expectedStatusCode, rs.StatusCode)
+			}
+			if rs.StatusCode != http.StatusOK {
+				return
+			}
+
+			var response map[string]json.RawMessage
+			err = json.NewDecoder(rs.Body).Decode(&response)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var value []json.RawMessage
+			err = json.Unmarshal(response["value"], &value)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if value == nil {
+				t.Errorf("expected an empty value array, got %s", response["value"])
+			} else if len(value) != 0 {
+				t.Errorf("expected no items, got %d", len(value))
+			}
+		})
+	}
+}
+
+func TestErrorResponseCorrelationID(t *testing.T) {
+	const correlationRequestID = "the_correlation_request_id"
+
+	_, ts := newTestListServer(t)
+
+	requestURL := ts.URL + "/subscriptions/" + dummySubscrtiptionId + "/resourceGroups/" + dummyResourceGroupId +
+		"/providers/" + api.ProviderNamespace + "/" + api.ClusterResourceTypeName + "/missing?api-version=2024-06-10-preview"
+
+	req, err := http.NewRequest(http.MethodGet, requestURL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set(arm.HeaderNameCorrelationRequestID, correlationRequestID)
+
+	rs, err := ts.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rs.Body.Close()
+
+	if rs.StatusCode != http.StatusNotFound {
+		t.Fatalf("expected status code %d, got %d", http.StatusNotFound, rs.StatusCode)
+	}
+
+	var cloudError arm.CloudError
+	err = json.NewDecoder(rs.Body).Decode(&cloudError)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cloudError.CloudErrorBody == nil || cloudError.CorrelationID != correlationRequestID {
+		t.Errorf("expected error body with correlationId %q, got %+v", correlationRequestID, cloudError.CloudErrorBody)
+	}
+}
+
+// pendingOperationDBClient reports every operation as accepted until it has
+// been read pendingReads times, simulating an operation that completes in the
+// background. A negative pendingReads means the operation never completes.
+type pendingOperationDBClient struct {
+	database.DBClient
+	reads        int
+	pendingReads int
+}
+
+func (c *pendingOperationDBClient) GetOperationDoc(ctx context.Context, operationID string) (*database.OperationDocument, error) {
+	doc, err := c.DBClient.GetOperationDoc(ctx, operationID)
+	if err != nil {
+		return nil, err
+	}
+
+	c.reads++
+	if c.pendingReads < 0 || c.reads <= c.pendingReads {
+		pending := *doc
+		pending.Status = arm.ProvisioningStateAccepted
+		return &pending, nil
+	}
+
+	return doc, nil
+}
+
+func TestOperationResultWait(t *testing.T) {
+	savedPollInterval := operationPollInterval
+	operationPollInterval = 10 * time.Millisecond
+	t.Cleanup(func() { operationPollInterval = savedPollInterval })
+
+	tests := []struct {
+		name               string
+		wait               string
+		pendingReads       int
+		expectedStatusCode int
+	}{
+		{
+			name:               "No wait returns immediately",
+			wait:               "",
+			pendingReads:       1,
+			expectedStatusCode: http.StatusAccepted,
+		},
+		{
+			name:               "Resource becomes available during wait",
+			wait:               "10",
+			pendingReads:       3,
+			expectedStatusCode: http.StatusCreated,
+		},
+		{
+			name:               "Wait elapses before operation completes",
+			wait:               "1",
+			pendingReads:       -1,
+			expectedStatusCode: http.StatusAccepted,
+		},
+		{
+			name:               "Invalid wait",
+			wait:               "soon",
+			pendingReads:       1,
+			expectedStatusCode: http.StatusBadRequest,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			f, ts := newTestListServer(t)
+			cluster := addTestCluster(t, f, "waiting-cluster", nil)
+
+			operationDoc := database.NewOperationDocument(database.OperationRequestCreate, cluster.ResourceId, cluster.InternalID)
+			operationDoc.Status = arm.ProvisioningStateSucceeded
+			operationID, err := arm.ParseResourceID(path.Join("/",
+				"subscriptions", dummySubscrtiptionId,
+				"providers", api.ProviderNamespace,
+				"locations", dummyLocation,
+				api.OperationStatusResourceTypeName, operationDoc.ID))
+			if err != nil {
+				t.Fatal(err)
+			}
+			operationDoc.OperationID = operationID
+			err = f.dbClient.CreateOperationDoc(context.Background(), operationDoc)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			f.dbClient = &pendingOperationDBClient{DBClient: f.dbClient, pendingReads: test.pendingReads}
+
+			requestURL := ts.URL + path.Join("/",
+				"subscriptions", dummySubscrtiptionId,
+				"providers", api.ProviderNamespace,
+				"locations", dummyLocation,
+				api.OperationResultResourceTypeName, operationDoc.ID) +
+				"?api-version=2024-06-10-preview"
+			if test.wait != "" {
+				requestURL += "&" + WaitKey + "=" + test.wait
+			}
+
+			rs, err := ts.Client().Get(requestURL)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer rs.Body.Close()
+
+			if rs.StatusCode != test.expectedStatusCode {
+				t.Errorf("expected status code %d, got %d", test.expectedStatusCode, rs.StatusCode)
+			}
+		})
+	}
+}
+
+func TestOperationResultWaiterCap(t *testing.T) {
+	savedPollInterval := operationPollInterval
+	operationPollInterval = 10 * time.Millisecond
+	t.Cleanup(func() { operationPollInterval = savedPollInterval })
+
+	f, ts := newTestListServer(t)
+	f.config.MaxOperationWaiters = 2
+	cluster := addTestCluster(t, f, "waiting-cluster", nil)
+
+	operationDoc := database.NewOperationDocument(database.OperationRequestCreate, cluster.ResourceId, cluster.InternalID)
+	operationID, err := arm.ParseResourceID(path.Join("/",
+		"subscriptions", dummySubscrtiptionId,
+		"providers", api.ProviderNamespace,
+		"locations", dummyLocation,
+		api.OperationStatusResourceTypeName, operationDoc.ID))
+	if err != nil {
+		t.Fatal(err)
+	}
+	operationDoc.OperationID = operationID
+	err = f.dbClient.CreateOperationDoc(context.Background(), operationDoc)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The operation never completes, so any request that waits will
+	// wait for the full duration it asked for.
+	f.dbClient = &pendingOperationDBClient{DBClient: f.dbClient, pendingReads: -1}
+
+	requestURL := ts.URL + path.Join("/",
+		"subscriptions", dummySubscrtiptionId,
+		"providers", api.ProviderNamespace,
+		"locations", dummyLocation,
+		api.OperationResultResourceTypeName, operationDoc.ID) +
+		"?api-version=2024-06-10-preview&" + WaitKey + "="
+
+	getOperationResult := func(wait string) time.Duration {
+		t.Helper()
+
+		start := time.Now()
+		rs, err := ts.Client().Get(requestURL + wait)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer rs.Body.Close()
+
+		if rs.StatusCode != http.StatusAccepted {
+			t.Errorf("expected status code %d, got %d", http.StatusAccepted, rs.StatusCode)
+		}
+
+		return time.Since(start)
+	}
+
+	// Saturate the waiter cap.
+	for range f.config.MaxOperationWaiters {
+		if !f.acquireOperationWaiter() {
+			t.Fatal("failed to acquire an operation waiter below the cap")
+		}
+	}
+
+	if f.acquireOperationWaiter() {
+		t.Error("acquired an operation waiter beyond the cap")
+	}
+
+	if elapsed := getOperationResult("10"); elapsed >= 5*time.Second {
+		t.Errorf("expected an excess request to return immediately, took %s", elapsed)
+	}
+
+	// Freeing a slot lets requests wait again.
+	f.releaseOperationWaiter()
+
+	if elapsed := getOperationResult("1"); elapsed < time.Second {
+		t.Errorf("expected a request to wait for 1s, took %s", elapsed)
+	}
+
+	if waiters := f.operationWaiters.Load(); waiters != int64(f.config.MaxOperationWaiters-1) {
+		t.Errorf("expected %d operation waiters after the request, got %d", f.config.MaxOperationWaiters-1, waiters)
+	}
+}
+
+func TestWaitForOperationCancelled(t *testing.T) {
+	dbClient := &pendingOperationDBClient{DBClient: database.NewCache(), pendingReads: -1}
+	f := &Frontend{dbClient: dbClient}
+
+	doc := database.NewOperationDocument(database.OperationRequestCreate, nil, ocm.InternalID{})
+	err := dbClient.CreateOperationDoc(context.Background(), doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	start := time.Now()
+	result, err := f.WaitForOperation(ctx, doc, MaxOperationWait)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("expected a cancelled wait to return promptly, took %s", elapsed)
+	}
+	if result.Status.IsTerminal() {
+		t.Errorf("expected a non-terminal operation, got status %s", result.Status)
+	}
+}
+
+// taggedVersion is an API version which renders every resource as its own
+// version string, making it easy to tell which version serialized a result.
+type taggedVersion string
+
+type taggedResource struct {
+	APIVersion string `json:"apiVersion"`
+}
+
+type taggedCluster struct{ taggedResource }
+
+type taggedNodePool struct{ taggedResource }
+
+func (v taggedVersion) String() string { return string(v) }
+
+func (v taggedVersion) NewHCPOpenShiftCluster(*api.HCPOpenShiftCluster) api.VersionedHCPOpenShiftCluster {
+	return &taggedCluster{taggedResource{APIVersion: string(v)}}
+}
+
+func (v taggedVersion) NewHCPOpenShiftClusterNodePool(*api.HCPOpenShiftClusterNodePool) api.VersionedHCPOpenShiftClusterNodePool {
+	return &taggedNodePool{taggedResource{APIVersion: string(v)}}
+}
+
+func (c *taggedCluster) Normalize(*api.HCPOpenShiftCluster) {}
+
+func (c *taggedCluster) ValidateStatic(api.VersionedHCPOpenShiftCluster, bool, string) *arm.CloudError {
+	return nil
+}
+
+func (n *taggedNodePool) Normalize(*api.HCPOpenShiftClusterNodePool) {}
+
+func (n *taggedNodePool) ValidateStatic(api.VersionedHCPOpenShiftClusterNodePool, bool, string) *arm.CloudError {
+	return nil
+}
+
+func TestOperationResultAPIVersion(t *testing.T) {
+	const initiatingAPIVersion = "2098-01-01-preview"
+
+	api.Register(taggedVersion(initiatingAPIVersion), api.OperationResultResourceType)
+
+	tests := []struct {
+		name               string
+		storedAPIVersion   string
+		expectedAPIVersion string
+	}{
+		{
+			name:               "Stored API version is used",
+			storedAPIVersion:   initiatingAPIVersion,
+			expectedAPIVersion: initiatingAPIVersion,
+		},
+		{
+			name:             "Missing API version falls back to request",
+			storedAPIVersion: "",
+		},
+		{
+			name:             "Unregistered API version falls back to request",
+			storedAPIVersion: "2000-01-01",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			f, ts := newTestListServer(t)
+			cluster := addTestCluster(t, f, "versioned-cluster", nil)
+
+			operationDoc := database.NewOperationDocument(database.OperationRequestCreate, cluster.ResourceId, cluster.InternalID)
+			operationDoc.Status = arm.ProvisioningStateSucceeded
+			operationDoc.APIVersion = test.storedAPIVersion
+			operationID, err := arm.ParseResourceID(path.Join("/",
+				"subscriptions", dummySubscrtiptionId,
+				"providers", api.ProviderNamespace,
+				"locations", dummyLocation,
+				api.OperationStatusResourceTypeName, operationDoc.ID))
+			if err != nil {
+				t.Fatal(err)
+			}
+			operationDoc.OperationID = operationID
+			err = f.dbClient.CreateOperationDoc(context.Background(), operationDoc)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			rs, err := ts.Client().Get(ts.URL + path.Join("/",
+				"subscriptions", dummySubscrtiptionId,
+				"providers", api.ProviderNamespace,
+				"locations", dummyLocation,
+				api.OperationResultResourceTypeName, operationDoc.ID) +
+				"?api-version=2024-06-10-preview")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer rs.Body.Close()
+
+			if rs.StatusCode != http.StatusCreated {
+				t.Fatalf("expected status code %d, got %d", http.StatusCreated, rs.StatusCode)
+			}
+
+			var result taggedResource
+			err = json.NewDecoder(rs.Body).Decode(&result)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if result.APIVersion != test.expectedAPIVersion {
+				t.Errorf("expected result rendered by API version %q, got %q", test.expectedAPIVersion, result.APIVersion)
+			}
+		})
+	}
+}
+
+func TestOperationURLsUseCanonicalLocation(t *testing.T) {
+	const alias = "Spain Central"
+
+	f, ts := newTestListServer(t)
+	f.config.Location = alias
+	cluster := addTestCluster(t, f, dummyClusterName, nil)
+
+	body, err := json.Marshal(generated.HcpOpenShiftClusterNodePoolResource{
+		Location:   api.Ptr(alias),
+		Properties: &generated.NodePoolProperties{Spec: &generated.NodePoolSpec{Platform: &generated.NodePoolPlatformProfile{VMSize: &dummyVMSize}, Version: &generated.VersionProfile{ID: &dummyVersionID, ChannelGroup: &dummyChannelGroup}}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	nodePoolURL := ts.URL + cluster.ResourceId.String() + "/" + api.NodePoolResourceTypeName + "/my-node-pool?api-version=2024-06-10-preview"
+	expectedPrefix := ts.URL + "/subscriptions/" + dummySubscrtiptionId + "/providers/" + api.ProviderNamespace + "/locations/spaincentral/"
+
+	for _, method := range []string{http.MethodPut, http.MethodDelete} {
+		var requestBody io.Reader
+		if method == http.MethodPut {
+			requestBody = bytes.NewReader(body)
+		}
+
+		req, err := http.NewRequest(method, nodePoolURL, requestBody)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set(arm.HeaderNameARMResourceSystemData, "{}")
+		req.Header.Set("Referer", req.URL.String())
+
+		rs, err := ts.Client().Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rs.Body.Close()
+
+		headers := []string{arm.HeaderNameAsyncOperation}
+		if method == http.MethodDelete {
+			headers = append(headers, "Location")
+		}
+		for _, header := range headers {
+			if value := rs.Header.Get(header); !strings.HasPrefix(value, expectedPrefix) {
+				t.Errorf("%s: expected %s header to start with %q, got %q", method, header, expectedPrefix, value)
+			}
+		}
+	}
+}
+
+func TestSynchronousOperations(t *testing.T) {
+	tests := []struct {
+		name                   string
+		synchronous            bool
+		expectedCreateStatus   int
+		expectedDeleteStatus   int
+		expectedProvisioning   arm.ProvisioningState
+		expectAsyncHeader      bool
+		expectResourcesDeleted bool
+	}{
+		{
+			name:                 "Asynchronous by default",
+			synchronous:          false,
+			expectedCreateStatus: http.StatusCreated,
+			expectedDeleteStatus: http.StatusAccepted,
+			expectedProvisioning: arm.ProvisioningStateAccepted,
+			expectAsyncHeader:    true,
+		},
+		{
+			name:                   "Synchronous completes inline",
+			synchronous:            true,
+			expectedCreateStatus:   http.StatusCreated,
+			expectedDeleteStatus:   http.StatusOK,
+			expectedProvisioning:   arm.ProvisioningStateSucceeded,
+			expectResourcesDeleted: true,
+		},
+	}
+
+	body, err := json.Marshal(generated.HcpOpenShiftClusterNodePoolResource{
+		Location:   &dummyLocation,
+		Properties: &generated.NodePoolProperties{Spec: &generated.NodePoolSpec{Platform: &generated.NodePoolPlatformProfile{VMSize: &dummyVMSize}, Version: &generated.VersionProfile{ID: &dummyVersionID, ChannelGroup: &dummyChannelGroup}}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctx := context.Background()
+
+			f, ts := newTestListServer(t)
+			f.config.SynchronousOperations = test.synchronous
+			cluster := addTestCluster(t, f, dummyClusterName, nil)
+
+			nodePoolID, err := arm.ParseResourceID(cluster.ResourceId.String() + "/" + api.NodePoolResourceTypeName + "/my-node-pool")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			req, err := http.NewRequest(http.MethodPut, ts.URL+nodePoolID.String()+"?api-version=2024-06-10-preview", bytes.NewReader(body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set(arm.HeaderNameARMResourceSystemData, "{}")
+			// ARM always passes a Referer, from which async operation URLs are built.
+			req.Header.Set("Referer", req.URL.String())
+
+			rs, err := ts.Client().Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer rs.Body.Close()
+
+			if rs.StatusCode != test.expectedCreateStatus {
+				t.Fatalf("expected create status code %d, got %d", test.expectedCreateStatus, rs.StatusCode)
+			}
+			if hasHeader := rs.Header.Get(arm.HeaderNameAsyncOperation) != ""; hasHeader != test.expectAsyncHeader {
+				t.Errorf("expected %s header present to be %t", arm.HeaderNameAsyncOperation, test.expectAsyncHeader)
+			}
+
+			var nodePool generated.HcpOpenShiftClusterNodePoolResource
+			err = json.NewDecoder(rs.Body).Decode(&nodePool)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if nodePool.Properties == nil || nodePool.Properties.ProvisioningState == nil ||
+				arm.ProvisioningState(*nodePool.Properties.ProvisioningState) != test.expectedProvisioning {
+				t.Errorf("expected provisioning state %s, got %+v", test.expectedProvisioning, nodePool.Properties)
+			}
+
+			req, err = http.NewRequest(http.MethodDelete, ts.URL+cluster.ResourceId.String()+"?api-version=2024-06-10-preview", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			rs, err = ts.Client().Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer rs.Body.Close()
+
+			if rs.StatusCode != test.expectedDeleteStatus {
+				t.Fatalf("expected delete status code %d, got %d", test.expectedDeleteStatus, rs.StatusCode)
+			}
+
+			for _, resourceID := range []*arm.ResourceID{cluster.ResourceId, nodePoolID} {
+				_, err = f.dbClient.GetResourceDoc(ctx, resourceID)
+				if deleted := errors.Is(err, database.ErrNotFound); deleted != test.expectResourcesDeleted {
+					t.Errorf("expected %s deleted to be %t, got error %v", resourceID, test.expectResourcesDeleted, err)
+				}
+			}
+		})
+	}
+}
+
+func TestArmResourceGroupClustersDelete(t *testing.T) {
+	ctx := context.Background()
+
+	f, ts := newTestListServer(t)
+	clusters := []*database.ResourceDocument{
+		addTestCluster(t, f, "cluster-1", nil),
+		addTestCluster(t, f, "cluster-2", nil),
+	}
+
+	// A cluster in another resource group must be left alone.
+	otherID, err := arm.ParseResourceID(
+		"/subscriptions/" + dummySubscrtiptionId + "/resourceGroups/otherResourceGroup" +
+			"/providers/" + api.ProviderNamespace + "/" + api.ClusterResourceTypeName + "/other-cluster")
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherDoc := database.NewResourceDocument(otherID)
+	otherDoc.ProvisioningState = arm.ProvisioningStateSucceeded
+	err = f.dbClient.CreateResourceDoc(ctx, otherDoc)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	requestURL := ts.URL + "/subscriptions/" + dummySubscrtiptionId + "/resourceGroups/" + dummyResourceGroupId +
+		"/providers/" + api.ProviderNamespace + "/" + api.ClusterResourceTypeName + "?api-version=2024-06-10-preview"
+
+	deleteAll := func(t *testing.T, expectedStatusCode int) *ClusterDeletionProgress {
+		t.Helper()
+
+		req, err := http.NewRequest(http.MethodDelete, requestURL, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rs, err := ts.Client().Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer rs.Body.Close()
+
+		if rs.StatusCode != expectedStatusCode {
+			t.Fatalf("expected status code %d, got %d", expectedStatusCode, rs.StatusCode)
+		}
+		if rs.StatusCode != http.StatusAccepted {
+			return nil
+		}
+
+		var progress ClusterDeletionProgress
+		err = json.NewDecoder(rs.Body).Decode(&progress)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return &progress
+	}
+
+	t.Run("Deletion starts for every cluster", func(t *testing.T) {
+		progress := deleteAll(t, http.StatusAccepted)
+		if *progress != (ClusterDeletionProgress{Total: 2, Started: 2}) {
+			t.Errorf("unexpected progress %+v", *progress)
+		}
+
+		for _, cluster := range clusters {
+			doc, err := f.dbClient.GetResourceDoc(ctx, cluster.ResourceId)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if doc.ProvisioningState != arm.ProvisioningStateDeleting {
+				t.Errorf("expected %s to be %s, got %s", cluster.ResourceId.Name, arm.ProvisioningStateDeleting, doc.ProvisioningState)
+			}
+		}
+
+		doc, err := f.dbClient.GetResourceDoc(ctx, otherID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if doc.ProvisioningState != arm.ProvisioningStateSucceeded {
+			t.Errorf("expected cluster in another resource group to be untouched, got %s", doc.ProvisioningState)
+		}
+	})
+
+	t.Run("Repeated request is idempotent", func(t *testing.T) {
+		progress := deleteAll(t, http.StatusAccepted)
+		if *progress != (ClusterDeletionProgress{Total: 2, Started: 0}) {
+			t.Errorf("unexpected progress %+v", *progress)
+		}
+	})
+
+	t.Run("Completed deletion returns no content", func(t *testing.T) {
+		// Simulate the backend completing the deletions,
+		// but leaving behind a node pool document.
+		for _, cluster := range clusters {
+			err := f.dbClient.DeleteResourceDoc(ctx, cluster.ResourceId)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		nodePoolID, err := arm.ParseResourceID(clusters[0].ResourceId.String() + "/" + api.NodePoolResourceTypeName + "/orphan")
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = f.dbClient.CreateResourceDoc(ctx, database.NewResourceDocument(nodePoolID))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		deleteAll(t, http.StatusNoContent)
+
+		_, err = f.dbClient.GetResourceDoc(ctx, nodePoolID)
+		if !errors.Is(err, database.ErrNotFound) {
+			t.Errorf("expected leftover node pool document to be deleted, got %v", err)
+		}
+		_, err = f.dbClient.GetResourceDoc(ctx, otherID)
+		if err != nil {
+			t.Errorf("expected cluster in another resource group to remain, got %v", err)
+		}
+	})
+}
+
+func TestArmResourceGroupClustersDeleteStale(t *testing.T) {
+	ctx := context.Background()
+
+	f, ts := newTestListServer(t)
+	cluster := addTestCluster(t, f, "stale-cluster", nil)
+
+	nodePoolID, err := arm.ParseResourceID(cluster.ResourceId.String() + "/" + api.NodePoolResourceTypeName + "/stale-node-pool")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = f.dbClient.CreateResourceDoc(ctx, database.NewResourceDocument(nodePoolID))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Cluster Service lost the cluster, leaving its documents behind.
+	err = f.clusterServiceClient.DeleteCSCluster(ctx, cluster.InternalID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	requestURL := ts.URL + "/subscriptions/" + dummySubscrtiptionId + "/resourceGroups/" + dummyResourceGroupId +
+		"/providers/" + api.ProviderNamespace + "/" + api.ClusterResourceTypeName + "?api-version=2024-06-10-preview"
+
+	req, err := http.NewRequest(http.MethodDelete, requestURL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rs, err := ts.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rs.Body.Close()
+
+	if rs.StatusCode != http.StatusNoContent {
+		t.Fatalf("expected status code %d, got %d", http.StatusNoContent, rs.StatusCode)
+	}
+
+	for _, resourceID := range []*arm.ResourceID{cluster.ResourceId, nodePoolID} {
+		_, err = f.dbClient.GetResourceDoc(ctx, resourceID)
+		if !errors.Is(err, database.ErrNotFound) {
+			t.Errorf("expected the document of %s to be deleted, got %v", resourceID, err)
+		}
+	}
+}
+
+func TestClusterQuotaRemainingHeader(t *testing.T) {
+	const maxClusters = 2
+
+	ctx := context.Background()
+	mockCSClient := ocm.NewMockClusterServiceClient()
+
+	f := &Frontend{
+		dbClient:             database.NewCache(),
+		metrics:              NewPrometheusEmitter(prometheus.NewRegistry()),
+		clusterServiceClient: &mockCSClient,
+		config:               Config{MaxClusters: maxClusters},
+	}
+
+	err := f.dbClient.CreateSubscriptionDoc(ctx, database.NewSubscriptionDocument(dummySubscrtiptionId, &arm.Subscription{
+		State:            arm.SubscriptionStateRegistered,
+		RegistrationDate: api.Ptr(time.Now().String()),
+		Properties:       &arm.SubscriptionProperties{TenantId: api.Ptr(dummyTenantId)},
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ts := httptest.NewServer(f.routes())
+	ts.Config.BaseContext = func(net.Listener) context.Context {
+		ctx := context.Background()
+		ctx = ContextWithLogger(ctx, testLogger)
+		ctx = ContextWithDBClient(ctx, f.dbClient)
+		ctx = ContextWithSystemData(ctx, &arm.SystemData{})
+		return ctx
+	}
+	defer ts.Close()
+
+	body, err := json.Marshal(generated.HcpOpenShiftClusterResource{
+		Location: &dummyLocation,
+		Properties: &generated.HcpOpenShiftClusterProperties{
+			Spec: &generated.ClusterSpec{
+				Version: &generated.VersionProfile{
+					ID:           &dummyVersionID,
+					ChannelGroup: &dummyChannelGroup,
+				},
+				Network: &generated.NetworkProfile{
+					PodCidr:     api.Ptr("10.128.0.0/14"),
+					ServiceCidr: api.Ptr("172.30.0.0/16"),
+					MachineCidr: api.Ptr("10.0.0.0/16"),
+				},
+				API: &generated.APIProfile{
+					Visibility: api.Ptr(generated.VisibilityPublic),
+				},
+				Platform: &generated.PlatformProfile{
+					SubnetID: api.Ptr("/subscriptions/" + dummySubscrtiptionId + "/resourceGroups/network/providers/Microsoft.Network/virtualNetworks/vnet/subnets/subnet"),
+				},
+			},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		clusterName        string
+		expectedStatusCode int
+		expectedRemaining  string
+		expectedWarning    bool
+	}{
+		{
+			clusterName:        "cluster-1",
+			expectedStatusCode: http.StatusCreated,
+			expectedRemaining:  "1",
+			expectedWarning:    false,
+		},
+		{
+			clusterName:        "cluster-2",
+			expectedStatusCode: http.StatusCreated,
+			expectedRemaining:  "0",
+			expectedWarning:    true,
+		},
+		{
+			clusterName:        "cluster-3",
+			expectedStatusCode: http.StatusBadRequest,
+		},
+	}
+
+	// Subtests run in order, since each create consumes quota.
+	for _, test := range tests {
+		t.Run(test.clusterName, func(t *testing.T) {
+			clusterURL := ts.URL + "/subscriptions/" + dummySubscrtiptionId + "/resourceGroups/" + dummyResourceGroupId +
+				"/providers/" + api.ProviderNamespace + "/" + api.ClusterResourceTypeName + "/" + test.clusterName +
+				"?api-version=2024-06-10-preview"
+
+			req, err := http.NewRequest(http.MethodPut, clusterURL, bytes.NewReader(body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.Header.Set("Content-Type", "application/json")
+
+			rs, err := ts.Client().Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer rs.Body.Close()
+
+			if rs.StatusCode != test.expectedStatusCode {
+				t.Fatalf("expected status code %d, got %d", test.expectedStatusCode, rs.StatusCode)
+			}
+			if remaining := rs.Header.Get(HeaderNameQuotaRemaining); remaining != test.expectedRemaining {
+				t.Errorf("expected %s header %q, got %q", HeaderNameQuotaRemaining, test.expectedRemaining, remaining)
+			}
+			if warning := rs.Header.Get(HeaderNameWarning); (warning != "") != test.expectedWarning {
+				t.Errorf("expected %s header: %t, got %q", HeaderNameWarning, test.expectedWarning, warning)
+			}
+
+			if test.expectedStatusCode != http.StatusBadRequest {
+				return
+			}
+
+			var cloudError arm.CloudError
+			err = json.NewDecoder(rs.Body).Decode(&cloudError)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if cloudError.CloudErrorBody == nil || cloudError.Code != arm.CloudErrorCodeClusterLimitExceeded {
+				t.Errorf("expected error code %s, got %+v", arm.CloudErrorCodeClusterLimitExceeded, cloudError.CloudErrorBody)
+			}
+		})
+	}
+}
+
+func TestCountClusters(t *testing.T) {
+	ctx := context.Background()
+
+	f, _ := newTestListServer(t)
+
+	states := map[string]arm.ProvisioningState{
+		"succeeded":     arm.ProvisioningStateSucceeded,
+		"deleting":      arm.ProvisioningStateDeleting,
+		"failed-create": arm.ProvisioningStateFailed,
+		"failed-delete": arm.ProvisioningStateFailed,
+	}
+	for name, state := range states {
+		doc := addTestCluster(t, f, name, nil)
+		_, err := f.dbClient.UpdateResourceDoc(ctx, doc.ResourceId, func(updateDoc *database.ResourceDocument) bool {
+			updateDoc.ProvisioningState = state
+			return true
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		request := database.OperationRequestCreate
+		if name == "failed-delete" {
+			request = database.OperationRequestDelete
+		}
+		err = f.dbClient.CreateOperationDoc(ctx, database.NewOperationDocument(request, doc.ResourceId, doc.InternalID))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	count, err := f.countClusters(ctx, dummySubscrtiptionId)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Only "succeeded" and "failed-create" count against the limit.
+	if count != 2 {
+		t.Errorf("expected 2 clusters, got %d", count)
+	}
+}
+
+func TestOperationIDHeader(t *testing.T) {
+	ctx := context.Background()
+
+	f, ts := newTestListServer(t)
+	f.config.SynchronousOperations = true
+	cluster := addTestCluster(t, f, dummyClusterName, nil)
+
+	nodePoolURL := ts.URL + cluster.ResourceId.String() + "/" + api.NodePoolResourceTypeName + "/" + dummyNodePoolName + "?api-version=2024-06-10-preview"
+
+	body, err := json.Marshal(generated.HcpOpenShiftClusterNodePoolResource{
+		Location:   &dummyLocation,
+		Properties: &generated.NodePoolProperties{Spec: &generated.NodePoolSpec{Platform: &generated.NodePoolPlatformProfile{VMSize: &dummyVMSize}, Version: &generated.VersionProfile{ID: &dummyVersionID, ChannelGroup: &dummyChannelGroup}}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req, err := http.NewRequest(http.MethodPut, nodePoolURL, bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(arm.HeaderNameARMResourceSystemData, "{}")
+
+	rs, err := ts.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rs.Body.Close()
+
+	if rs.StatusCode != http.StatusCreated {
+		t.Fatalf("expected status code %d, got %d", http.StatusCreated, rs.StatusCode)
+	}
+
+	operationID := rs.Header.Get(arm.HeaderNameOperationID)
+	if operationID == "" {
+		t.Fatalf("expected %s header on PUT response", arm.HeaderNameOperationID)
+	}
+
+	nodePoolID, err := arm.ParseResourceID(cluster.ResourceId.String() + "/" + api.NodePoolResourceTypeName + "/" + dummyNodePoolName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	operationDoc, err := f.dbClient.GetLatestOperationForResource(ctx, nodePoolID.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if operationDoc.Status != arm.ProvisioningStateSucceeded {
+		t.Errorf("expected operation status %s, got %s", arm.ProvisioningStateSucceeded, operationDoc.Status)
+	}
+	if operationID != operationDoc.ID {
+		t.Errorf("expected PUT %s header %q, got %q", arm.HeaderNameOperationID, operationDoc.ID, operationID)
+	}
+
+	tests := []struct {
+		name                string
+		url                 string
+		expectedOperationID string
+	}{
+		{
+			name:                "Resource with a completed operation",
+			url:                 nodePoolURL,
+			expectedOperationID: operationDoc.ID,
+		},
+		{
+			name:                "Resource without operations",
+			url:                 ts.URL + cluster.ResourceId.String() + "?api-version=2024-06-10-preview",
+			expectedOperationID: "",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rs, err := ts.Client().Get(test.url)
+			if err != nil {
+				t.Fatal(err)
+			}
+			rs.Body.Close()
+
+			if rs.StatusCode != http.StatusOK {
+				t.Fatalf("expected status code %d, got %d", http.StatusOK, rs.StatusCode)
+			}
+			if actual := rs.Header.Get(arm.HeaderNameOperationID); actual != test.expectedOperationID {
+				t.Errorf("expected %s header %q, got %q", arm.HeaderNameOperationID, test.expectedOperationID, actual)
+			}
+		})
+	}
+}
+
+func TestArmResourceHead(t *testing.T) {
+	f, ts := newTestListServer(t)
+	cluster := addTestCluster(t, f, dummyClusterName, nil)
+
+	tests := []struct {
+		name               string
+		resourceID         string
+		expectedStatusCode int
+	}{
+		{
+			name:               "Existing resource",
+			resourceID:         cluster.ResourceId.String(),
+			expectedStatusCode: http.StatusOK,
+		},
+		{
+			name:               "Missing resource",
+			resourceID:         cluster.ResourceId.String() + "-missing",
+			expectedStatusCode: http.StatusNotFound,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			requestURL := ts.URL + test.resourceID + "?api-version=2024-06-10-preview"
+
+			getResponse, err := ts.Client().Get(requestURL)
+			if err != nil {
+				t.Fatal(err)
+			}
+			getBody, err := io.ReadAll(getResponse.Body)
+			getResponse.Body.Close()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			headResponse, err := ts.Client().Head(requestURL)
+			if err != nil {
+				t.Fatal(err)
+			}
+			headBody, err := io.ReadAll(headResponse.Body)
+			headResponse.Body.Close()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if headResponse.StatusCode != test.expectedStatusCode {
+				t.Fatalf("expected status code %d, got %d", test.expectedStatusCode, headResponse.StatusCode)
+			}
+			if getResponse.StatusCode != headResponse.StatusCode {
+				t.Errorf("expected GET and HEAD status codes to match, got %d and %d", getResponse.StatusCode, headResponse.StatusCode)
+			}
+			if len(headBody) != 0 {
+				t.Errorf("expected an empty HEAD response body, got %q", headBody)
+			}
+			if headResponse.ContentLength != int64(len(getBody)) {
+				t.Errorf("expected HEAD Content-Length %d, got %d", len(getBody), headResponse.ContentLength)
+			}
+
+			for _, header := range []string{"Content-Type", "ETag", arm.HeaderNameErrorCode} {
+				if getValue, headValue := getResponse.Header.Get(header), headResponse.Header.Get(header); getValue != headValue {
+					t.Errorf("expected GET and HEAD %s headers to match, got %q and %q", header, getValue, headValue)
+				}
+			}
+
+			if test.expectedStatusCode == http.StatusOK && headResponse.Header.Get("ETag") != ResponseETag(getBody) {
+				t.Errorf("expected ETag %s, got %s", ResponseETag(getBody), headResponse.Header.Get("ETag"))
+			}
+		})
+	}
+}
+
+func TestArmResourceReadHTMLCharacters(t *testing.T) {
+	f, ts := newTestListServer(t)
+	cluster := addTestCluster(t, f, dummyClusterName, nil)
+
+	const tagValue = "R&D <platform>"
+
+	_, err := f.dbClient.UpdateResourceDoc(context.Background(), cluster.ResourceId, func(doc *database.ResourceDocument) bool {
+		doc.Tags = map[string]string{"team": tagValue}
+		return true
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rs, err := ts.Client().Get(ts.URL + cluster.ResourceId.String() + "?api-version=2024-06-10-preview")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rs.Body.Close()
+
+	body, err := io.ReadAll(rs.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if rs.StatusCode != http.StatusOK {
+		t.Fatalf("expected status code %d, got %d", http.StatusOK, rs.StatusCode)
+	}
+	if !bytes.Contains(body, []byte(`"`+tagValue+`"`)) {
+		t.Errorf("expected tag value %q to be unescaped in response, got %s", tagValue, body)
+	}
+	if !json.Valid(body) {
+		t.Errorf("expected a valid JSON response, got %s", body)
+	}
+}
+
+func TestOperationStatusRetention(t *testing.T) {
+	tests := []struct {
+		name               string
+		status             arm.ProvisioningState
+		age                time.Duration
+		missing            bool
+		expectedStatusCode int
+		expectedErrorCode  string
+	}{
+		{
+			name:               "Recently succeeded operation",
+			status:             arm.ProvisioningStateSucceeded,
+			age:                time.Hour,
+			expectedStatusCode: http.StatusOK,
+		},
+		{
+			name:               "Operation terminal beyond retention",
+			status:             arm.ProvisioningStateFailed,
+			age:                database.OperationRetention + time.Hour,
+			expectedStatusCode: http.StatusNotFound,
+			expectedErrorCode:  arm.CloudErrorCodeOperationExpired,
+		},
+		{
+			name:               "Operation tombstone about to be purged",
+			status:             arm.ProvisioningStateSucceeded,
+			age:                database.OperationRetention + database.OperationTombstoneRetention - time.Hour,
+			expectedStatusCode: http.StatusNotFound,
+			expectedErrorCode:  arm.CloudErrorCodeOperationExpired,
+		},
+		{
+			name:               "Long-running operation still in progress",
+			status:             arm.ProvisioningStateProvisioning,
+			age:                database.OperationRetention + time.Hour,
+			expectedStatusCode: http.StatusOK,
+		},
+		{
+			name:               "Missing operation",
+			missing:            true,
+			expectedStatusCode: http.StatusNotFound,
+			expectedErrorCode:  arm.CloudErrorCodeOperationNotFound,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			f, ts := newTestListServer(t)
+			cluster := addTestCluster(t, f, dummyClusterName, nil)
+
+			operationDoc := database.NewOperationDocument(database.OperationRequestCreate, cluster.ResourceId, cluster.InternalID)
+			operationDoc.Status = test.status
+			operationDoc.LastTransitionTime = time.Now().UTC().Add(-test.age)
+			operationID, err := arm.ParseResourceID(path.Join("/",
+				"subscriptions", dummySubscrtiptionId,
+				"providers", api.ProviderNamespace,
+				"locations", dummyLocation,
+				api.OperationStatusResourceTypeName, operationDoc.ID))
+			if err != nil {
+				t.Fatal(err)
+			}
+			operationDoc.OperationID = operationID
+			if !test.missing {
+				err = f.dbClient.CreateOperationDoc(context.Background(), operationDoc)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			rs, err := ts.Client().Get(ts.URL + operationID.String() + "?api-version=2024-06-10-preview")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer rs.Body.Close()
+
+			if rs.StatusCode != test.expectedStatusCode {
+				t.Fatalf("expected status code %d, got %d", test.expectedStatusCode, rs.StatusCode)
+			}
+
+			if test.expectedErrorCode != "" {
+				var cloudError arm.CloudError
+				err = json.NewDecoder(rs.Body).Decode(&cloudError)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if cloudError.CloudErrorBody == nil || cloudError.Code != test.expectedErrorCode {
+					t.Errorf("expected error code %s, got %+v", test.expectedErrorCode, cloudError.CloudErrorBody)
+				}
+			}
+
+			if rs.StatusCode == http.StatusOK {
+				var status arm.Operation
+				err = json.NewDecoder(rs.Body).Decode(&status)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if status.Status != test.status {
+					t.Errorf("expected status %s, got %s", test.status, status.Status)
+				}
+				if status.StartTime == nil {
+					t.Error("expected a start time")
+				}
+			}
 		})
 	}
 }
@@ -4,13 +4,20 @@ package frontend
 // Licensed under the Apache License 2.0.
 
 import (
+	"bytes"
 	"context"
+	"crypto/sha256"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
+	"math/rand/v2"
 	"net/http"
+	"strconv"
 	"strings"
+	"time"
 
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
 	cmv1 "github.com/openshift-online/ocm-sdk-go/clustersmgmt/v1"
 	ocmerrors "github.com/openshift-online/ocm-sdk-go/errors"
 
@@ -19,6 +26,140 @@ import (
 	"github.com/Azure/ARO-HCP/internal/database"
 )
 
+// CSErrorToCloudError maps a Cluster Service error for the given resource to
+// a CloudError. Cluster Service rejecting the request content is reported
+// to the client as a "400 Bad Request" so it can correct the request.
+func CSErrorToCloudError(err error, resourceID *arm.ResourceID) *arm.CloudError {
+	var ocmError *ocmerrors.Error
+	if errors.As(err, &ocmError) {
+		switch ocmError.Status() {
+		case http.StatusBadRequest:
+			return arm.NewCloudError(
+				http.StatusBadRequest,
+				arm.CloudErrorCodeInvalidRequestContent,
+				resourceID.String(),
+				"%s", ocmError.Reason())
+		case http.StatusNotFound:
+			return arm.NewResourceNotFoundError(resourceID)
+		}
+	}
+	return arm.NewInternalServerError()
+}
+
+// hasResponseStatus returns true if err is a Cosmos DB response error with
+// the given HTTP status code.
+func hasResponseStatus(err error, statusCode int) bool {
+	var responseError *azcore.ResponseError
+	return errors.As(err, &responseError) && responseError.StatusCode == statusCode
+}
+
+// isWriteConflict returns true if a database write failed because of a
+// concurrent write, either creating the same item or replacing the item
+// since it was read.
+func isWriteConflict(err error) bool {
+	return errors.Is(err, database.ErrConflict) || hasResponseStatus(err, http.StatusConflict) ||
+		errors.Is(err, database.ErrPreconditionFailed) || hasResponseStatus(err, http.StatusPreconditionFailed)
+}
+
+// jitteredBackoff returns a random delay between half and all of the
+// base delay doubled for each earlier attempt.
+func jitteredBackoff(base time.Duration, attempt int) time.Duration {
+	backoff := base << attempt
+	return backoff/2 + rand.N(backoff/2+1)
+}
+
+// jsonMergePatch applies a JSON merge patch (RFC 7386) to the target
+// document. Members of a patch object are merged recursively onto the
+// target object and removed from it if null. A patch that is not an
+// object replaces the target.
+func jsonMergePatch(target, patch []byte) []byte {
+	var patchObject map[string]json.RawMessage
+	if json.Unmarshal(patch, &patchObject) != nil || patchObject == nil {
+		return patch
+	}
+
+	var targetObject map[string]json.RawMessage
+	if json.Unmarshal(target, &targetObject) != nil || targetObject == nil {
+		targetObject = make(map[string]json.RawMessage)
+	}
+
+	for name, value := range patchObject {
+		if bytes.Equal(bytes.TrimSpace(value), []byte("null")) {
+			delete(targetObject, name)
+		} else {
+			targetObject[name] = jsonMergePatch(targetObject[name], value)
+		}
+	}
+
+	// Marshalling a map of raw messages only fails if a
+	// raw message is invalid, which Unmarshal rules out.
+	merged, _ := json.Marshal(targetObject)
+	return merged
+}
+
+// toCloudError maps an error from the database or Cluster Service to a
+// CloudError, so that handlers agree on the status and code for each kind
+// of failure. The resource ID, if not nil, is the subject of not found
+// errors. Unrecognized errors are logged and mapped to an internal server
+// error, which does not leak their details to the client.
+func toCloudError(ctx context.Context, err error, resourceID *arm.ResourceID) *arm.CloudError {
+	var ocmError *ocmerrors.Error
+
+	switch {
+	case errors.As(err, &ocmError) && resourceID != nil:
+		return CSErrorToCloudError(err, resourceID)
+	case errors.Is(err, database.ErrNotFound) || hasResponseStatus(err, http.StatusNotFound):
+		if resourceID != nil {
+			return arm.NewResourceNotFoundError(resourceID)
+		}
+		return arm.NewCloudError(
+			http.StatusNotFound,
+			arm.CloudErrorCodeNotFound, "",
+			"The requested resource could not be found.")
+	case errors.Is(err, database.ErrConflict) || hasResponseStatus(err, http.StatusConflict):
+		return arm.NewCloudError(
+			http.StatusConflict,
+			arm.CloudErrorCodeConflict, "",
+			"The request conflicts with the current state of the resource.")
+	case errors.Is(err, database.ErrPreconditionFailed) || hasResponseStatus(err, http.StatusPreconditionFailed):
+		return arm.NewCloudError(
+			http.StatusPreconditionFailed,
+			arm.CloudErrorCodePreconditionFailed, "",
+			"The resource was modified concurrently. Please retry the request.")
+	case errors.Is(err, database.ErrThrottled) || hasResponseStatus(err, http.StatusTooManyRequests):
+		return arm.NewCloudError(
+			http.StatusTooManyRequests,
+			arm.CloudErrorCodeTooManyRequests, "",
+			"Too many requests. Please retry the request later.")
+	default:
+		LoggerFromContext(ctx).Error(err.Error())
+		return arm.NewInternalServerError()
+	}
+}
+
+// originalRequestURL returns the absolute URL of the client's request. ARM
+// passes it in the Referer header; requests that did not come through ARM,
+// such as admin requests or those from test environments, have it
+// reconstructed from the request with the path in its original casing.
+func originalRequestURL(request *http.Request) string {
+	if referer := request.Referer(); referer != "" {
+		return referer
+	}
+
+	u := *request.URL
+	if originalPath, _ := OriginalPathFromContext(request.Context()); originalPath != "" {
+		u.Path = originalPath
+		u.RawPath = ""
+	}
+	u.Host = request.Host
+	if request.TLS != nil {
+		u.Scheme = "https"
+	} else {
+		u.Scheme = "http"
+	}
+	return u.String()
+}
+
 // CheckForProvisioningStateConflict returns a "409 Conflict" error response if the
 // provisioning state of the resource is non-terminal, or any of its parent resources
 // within the same provider namespace are in a "Deleting" state.
@@ -72,40 +213,184 @@ func (f *Frontend) CheckForProvisioningStateConflict(ctx context.Context, operat
 	return nil
 }
 
-func (f *Frontend) DeleteAllResources(ctx context.Context, subscriptionID string) *arm.CloudError {
+// DeleteAllResources starts deleting every cluster in a subscription
+// and reports the clusters that remained in the subscription.
+func (f *Frontend) DeleteAllResources(ctx context.Context, subscriptionID string) (*ClusterDeletionProgress, *arm.CloudError) {
 	logger := LoggerFromContext(ctx)
 
 	prefix, err := arm.ParseResourceID("/subscriptions/" + subscriptionID)
 	if err != nil {
 		logger.Error(err.Error())
-		return arm.NewInternalServerError()
+		return nil, arm.NewInternalServerError()
 	}
 
-	dbIterator := f.dbClient.ListResourceDocs(ctx, prefix, -1, nil)
+	return f.DeleteAllClusters(ctx, prefix)
+}
+
+// ClusterDeletionProgress summarizes a batch deletion of clusters.
+type ClusterDeletionProgress struct {
+	// Total is the number of clusters remaining under the scope,
+	// all of which are being deleted.
+	Total int `json:"total"`
+	// Started is the number of cluster deletions started by this
+	// request. The rest were already being deleted.
+	Started int `json:"started"`
+}
+
+// DeleteAllClusters starts a deletion operation for every cluster under
+// the given scope, such as a subscription or resource group, unless one
+// is already in progress. It is therefore safe to call repeatedly. The
+// clusters are listed a page at a time so that a scope with many clusters
+// is not read into memory all at once.
+func (f *Frontend) DeleteAllClusters(ctx context.Context, prefix *arm.ResourceID) (*ClusterDeletionProgress, *arm.CloudError) {
+	logger := LoggerFromContext(ctx)
+
+	var progress ClusterDeletionProgress
+	var continuationToken *string
+
+	pageSize, _ := f.pageSizes()
+
+	for {
+		var resourceDocs []*database.ResourceDocument
+
+		dbIterator := f.dbClient.ListResourceDocs(ctx, prefix, pageSize, continuationToken)
 
-	// Start a deletion operation for all clusters under the subscription.
-	// Cluster Service will delete all node pools belonging to these clusters
-	// so we don't need to explicitly delete node pools here.
-	for item := range dbIterator.Items(ctx) {
-		var resourceDoc *database.ResourceDocument
+		for item := range dbIterator.Items(ctx) {
+			var resourceDoc *database.ResourceDocument
+
+			err := json.Unmarshal(item, &resourceDoc)
+			if err != nil {
+				logger.Error(err.Error())
+				return nil, arm.NewInternalServerError()
+			}
+
+			if strings.EqualFold(resourceDoc.ResourceId.ResourceType.String(), api.ClusterResourceType.String()) {
+				resourceDocs = append(resourceDocs, resourceDoc)
+			}
+		}
 
-		err = json.Unmarshal(item, &resourceDoc)
+		err := dbIterator.GetError()
 		if err != nil {
 			logger.Error(err.Error())
-			return arm.NewInternalServerError()
+			return nil, arm.NewInternalServerError()
+		}
+
+		// Start a deletion operation for all clusters under the scope.
+		// Cluster Service will delete all node pools belonging to these
+		// clusters so we don't need to explicitly delete node pools here.
+		for _, resourceDoc := range resourceDocs {
+			// Allow this method to be idempotent.
+			if resourceDoc.ProvisioningState != arm.ProvisioningStateDeleting {
+				_, cloudError := f.DeleteResource(ctx, resourceDoc)
+				if cloudError != nil {
+					// The cluster is already gone from Cluster Service, so
+					// no operation will ever remove its documents.
+					if cloudError.StatusCode == http.StatusNotFound {
+						logger.Info(fmt.Sprintf("deleting documents of %s, which Cluster Service no longer has", resourceDoc.ResourceId))
+						err = f.deleteStaleResourceDocs(ctx, resourceDoc)
+						if err != nil {
+							logger.Error(err.Error())
+							return nil, arm.NewInternalServerError()
+						}
+						continue
+					}
+					return nil, cloudError
+				}
+				progress.Started++
+			}
+
+			progress.Total++
 		}
 
-		if !strings.EqualFold(resourceDoc.ResourceId.ResourceType.String(), api.ClusterResourceType.String()) {
+		token := dbIterator.GetContinuationToken()
+		if token == "" {
+			return &progress, nil
+		}
+		continuationToken = &token
+	}
+}
+
+// countClusters returns the number of clusters in the given subscription
+// that count against its cluster limit. Clusters being deleted, or whose
+// deletion failed, are on their way out and are not counted.
+func (f *Frontend) countClusters(ctx context.Context, subscriptionID string) (int, error) {
+	var count int
+
+	prefix, err := arm.ParseResourceID("/subscriptions/" + subscriptionID)
+	if err != nil {
+		return 0, err
+	}
+
+	iterator := f.dbClient.ListResourceDocs(ctx, prefix, -1, nil)
+
+	for item := range iterator.Items(ctx) {
+		var doc database.ResourceDocument
+		err := json.Unmarshal(item, &doc)
+		if err != nil {
+			return 0, err
+		}
+		if !strings.EqualFold(doc.ResourceId.ResourceType.String(), api.ClusterResourceType.String()) {
 			continue
 		}
 
-		// Allow this method to be idempotent.
-		if resourceDoc.ProvisioningState != arm.ProvisioningStateDeleting {
-			_, cloudError := f.DeleteResource(ctx, resourceDoc)
-			if cloudError != nil {
-				return cloudError
+		switch doc.ProvisioningState {
+		case arm.ProvisioningStateDeleting:
+			continue
+		case arm.ProvisioningStateFailed:
+			// The resource document does not record which operation
+			// failed, so consult the latest operation on the cluster.
+			operationDoc, err := f.dbClient.GetLatestOperationForResource(ctx, doc.ResourceId.String())
+			if err != nil && !errors.Is(err, database.ErrNotFound) {
+				return 0, err
+			}
+			if operationDoc != nil && operationDoc.Request == database.OperationRequestDelete {
+				continue
 			}
 		}
+
+		count++
+	}
+
+	err = iterator.GetError()
+	if err != nil {
+		return 0, err
+	}
+
+	return count, nil
+}
+
+// deleteStaleResourceDocs deletes the documents of a resource that Cluster
+// Service no longer has, along with those of its child resources, and
+// cancels their active operations.
+func (f *Frontend) deleteStaleResourceDocs(ctx context.Context, resourceDoc *database.ResourceDocument) error {
+	// Read the child documents in full before deleting
+	// any so that deletions do not disturb the query.
+	var children []*database.ResourceDocument
+
+	iterator := f.dbClient.ListResourceDocs(ctx, resourceDoc.ResourceId, -1, nil)
+	for item := range iterator.Items(ctx) {
+		var child *database.ResourceDocument
+		err := json.Unmarshal(item, &child)
+		if err != nil {
+			return err
+		}
+		children = append(children, child)
+	}
+
+	err := iterator.GetError()
+	if err != nil {
+		return err
+	}
+
+	for _, doc := range append(children, resourceDoc) {
+		err = f.CancelActiveOperation(ctx, doc)
+		if err != nil {
+			return err
+		}
+		err = f.deleteResourceDocs(ctx, doc.ResourceId)
+		if err != nil && !errors.Is(err, database.ErrNotFound) {
+			return err
+		}
 	}
 
 	return nil
@@ -229,6 +514,133 @@ func (f *Frontend) DeleteResource(ctx context.Context, resourceDoc *database.Res
 	return operationDoc.ID, nil
 }
 
+// IsValidationOnly returns true if a write request asks to be validated
+// without being applied, as a dry run.
+func IsValidationOnly(request *http.Request) bool {
+	value := request.URL.Query().Get(ValidateOnlyKey)
+	if value == "" {
+		value = request.Header.Get(arm.HeaderNameValidationOnly)
+	}
+	validateOnly, _ := strconv.ParseBool(value)
+	return validateOnly
+}
+
+// DecodeStrictJSON decodes a request body into v. Unlike json.Unmarshal, it
+// rejects properties that v does not define, since a misspelled property
+// would otherwise be silently ignored. Data after the JSON value is also
+// rejected. The error is a CloudError if it names an unknown property.
+func DecodeStrictJSON(body []byte, v any) error {
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.DisallowUnknownFields()
+
+	err := decoder.Decode(v)
+	if err != nil {
+		// The json package has no error type for unknown fields.
+		if field, ok := strings.CutPrefix(err.Error(), "json: unknown field "); ok {
+			return arm.NewCloudError(
+				http.StatusBadRequest,
+				arm.CloudErrorCodeInvalidRequestContent, strings.Trim(field, `"`),
+				"The request content has an unknown property %s.", field)
+		}
+		return err
+	}
+
+	if _, err = decoder.Token(); err != io.EOF {
+		return errors.New("unexpected data after the JSON value")
+	}
+
+	return nil
+}
+
+// CheckBodyName returns a CloudError if a request body carries a resource
+// name that disagrees with the name in the resource ID. The request path is
+// authoritative, so a body without a name is accepted. A body that is not a
+// JSON object is left for the caller's own unmarshalling to reject.
+func CheckBodyName(resourceID *arm.ResourceID, body []byte) *arm.CloudError {
+	var resource struct {
+		Name *string `json:"name"`
+	}
+
+	if err := json.Unmarshal(body, &resource); err != nil || resource.Name == nil {
+		return nil
+	}
+
+	// Resource names are case-insensitive.
+	if !strings.EqualFold(*resource.Name, resourceID.Name) {
+		return arm.NewCloudError(
+			http.StatusBadRequest,
+			arm.CloudErrorCodeNameMismatch, "name",
+			"The resource name '%s' in the request body does not match the resource name '%s' in the request path.",
+			*resource.Name, resourceID.Name)
+	}
+
+	return nil
+}
+
+// etagListContains returns true if the comma-separated entity tag list in
+// an If-Match or If-None-Match header value includes etag or is "*".
+func etagListContains(list string, etag azcore.ETag) bool {
+	for _, item := range strings.Split(list, ",") {
+		item = strings.TrimSpace(item)
+		if item == "*" || (etag != "" && item == string(etag)) {
+			return true
+		}
+	}
+	return false
+}
+
+// CheckPreconditions evaluates the If-Match and If-None-Match headers of a
+// write request against the current entity tag of the target document, where
+// exists is false if there is no such document. It returns a "412 Precondition
+// Failed" error if the write must not proceed, which prevents lost updates
+// when concurrent requests race to modify the same document.
+func CheckPreconditions(request *http.Request, etag azcore.ETag, exists bool) *arm.CloudError {
+	if ifMatch := request.Header.Get("If-Match"); ifMatch != "" {
+		if !exists || !etagListContains(ifMatch, etag) {
+			return arm.NewCloudError(
+				http.StatusPreconditionFailed,
+				arm.CloudErrorCodePreconditionFailed, "",
+				"The If-Match condition '%s' does not match the current entity tag.", ifMatch)
+		}
+	}
+
+	if ifNoneMatch := request.Header.Get("If-None-Match"); ifNoneMatch != "" {
+		if exists && etagListContains(ifNoneMatch, etag) {
+			return arm.NewCloudError(
+				http.StatusPreconditionFailed,
+				arm.CloudErrorCodePreconditionFailed, "",
+				"The If-None-Match condition '%s' matches the current entity tag.", ifNoneMatch)
+		}
+	}
+
+	return nil
+}
+
+// NotModifiedSince returns true if the If-Modified-Since header of a GET
+// request is at or after lastModified, in which case the response can be
+// "304 Not Modified". HTTP dates have one second resolution, so lastModified
+// is truncated to the second before comparing. The header is ignored if
+// lastModified is unknown or the request also has an If-None-Match header.
+func NotModifiedSince(request *http.Request, lastModified time.Time) bool {
+	if lastModified.IsZero() || request.Header.Get("If-None-Match") != "" {
+		return false
+	}
+
+	ifModifiedSince, err := http.ParseTime(request.Header.Get("If-Modified-Since"))
+	if err != nil {
+		return false
+	}
+
+	return !ifModifiedSince.Before(lastModified.Truncate(time.Second))
+}
+
+// ResponseETag returns a strong entity tag for a response body, so that
+// clients can tell whether a resource representation has changed. GET and
+// HEAD responses for the same resource state carry the same entity tag.
+func ResponseETag(body []byte) string {
+	return fmt.Sprintf("\"%x\"", sha256.Sum256(body))
+}
+
 func (f *Frontend) MarshalResource(ctx context.Context, resourceID *arm.ResourceID, versionedInterface api.Version) ([]byte, *arm.CloudError) {
 	var responseBody []byte
 
@@ -236,12 +648,7 @@ func (f *Frontend) MarshalResource(ctx context.Context, resourceID *arm.Resource
 
 	doc, err := f.dbClient.GetResourceDoc(ctx, resourceID)
 	if err != nil {
-		logger.Error(err.Error())
-		if errors.Is(err, database.ErrNotFound) {
-			return nil, arm.NewResourceNotFoundError(resourceID)
-		} else {
-			return nil, arm.NewInternalServerError()
-		}
+		return nil, toCloudError(ctx, err, resourceID)
 	}
 
 	switch doc.InternalID.Kind() {
@@ -284,3 +691,26 @@ func (f *Frontend) MarshalResource(ctx context.Context, resourceID *arm.Resource
 
 	return responseBody, nil
 }
+
+// CheckPreviewFeature returns a "409 Conflict" error if the subscription in
+// the request context has not registered the named preview feature, unless
+// the feature is enabled globally.
+func (f *Frontend) CheckPreviewFeature(ctx context.Context, feature string) *arm.CloudError {
+	logger := LoggerFromContext(ctx)
+
+	subscription, err := SubscriptionFromContext(ctx)
+	if err != nil {
+		logger.Error(err.Error())
+		return arm.NewInternalServerError()
+	}
+
+	if !f.isPreviewFeatureEnabled(subscription, feature) {
+		return arm.NewCloudError(
+			http.StatusConflict,
+			arm.CloudErrorCodeFeatureNotRegistered, "",
+			"The subscription is not registered for the preview feature '%s'.",
+			feature)
+	}
+
+	return nil
+}
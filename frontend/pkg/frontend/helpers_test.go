@@ -5,10 +5,16 @@ package frontend
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
+	"reflect"
 	"testing"
 
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	ocmerrors "github.com/openshift-online/ocm-sdk-go/errors"
+
 	"github.com/Azure/ARO-HCP/internal/api/arm"
 	"github.com/Azure/ARO-HCP/internal/database"
 )
@@ -218,3 +224,298 @@ func TestCheckForProvisioningStateConflict(t *testing.T) {
 		}
 	}
 }
+
+func TestCSErrorToCloudError(t *testing.T) {
+	const clusterResourceID = "/subscriptions/00000000-0000-0000-0000-000000000000/resourceGroups/testGroup/providers/Microsoft.RedHatOpenShift/hcpOpenShiftClusters/testCluster"
+
+	resourceID, err := arm.ParseResourceID(clusterResourceID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	newOCMError := func(status int, reason string) error {
+		ocmError, err := ocmerrors.NewError().Status(status).Reason(reason).Build()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return ocmError
+	}
+
+	tests := []struct {
+		name               string
+		err                error
+		expectedStatusCode int
+		expectedCode       string
+		expectedMessage    string
+	}{
+		{
+			name:               "Bad request",
+			err:                newOCMError(http.StatusBadRequest, "Version 'bogus' is not supported"),
+			expectedStatusCode: http.StatusBadRequest,
+			expectedCode:       arm.CloudErrorCodeInvalidRequestContent,
+			expectedMessage:    "Version 'bogus' is not supported",
+		},
+		{
+			name:               "Not found",
+			err:                newOCMError(http.StatusNotFound, "Cluster not found"),
+			expectedStatusCode: http.StatusNotFound,
+			expectedCode:       arm.CloudErrorCodeResourceNotFound,
+		},
+		{
+			name:               "Server error",
+			err:                newOCMError(http.StatusServiceUnavailable, "Try again later"),
+			expectedStatusCode: http.StatusInternalServerError,
+			expectedCode:       arm.CloudErrorCodeInternalServerError,
+		},
+		{
+			name:               "Not a Cluster Service error",
+			err:                fmt.Errorf("connection refused"),
+			expectedStatusCode: http.StatusInternalServerError,
+			expectedCode:       arm.CloudErrorCodeInternalServerError,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cloudError := CSErrorToCloudError(tt.err, resourceID)
+			if cloudError.StatusCode != tt.expectedStatusCode {
+				t.Errorf("expected status code %d, got %d", tt.expectedStatusCode, cloudError.StatusCode)
+			}
+			if cloudError.Code != tt.expectedCode {
+				t.Errorf("expected code %q, got %q", tt.expectedCode, cloudError.Code)
+			}
+			if tt.expectedMessage != "" && cloudError.Message != tt.expectedMessage {
+				t.Errorf("expected message %q, got %q", tt.expectedMessage, cloudError.Message)
+			}
+		})
+	}
+}
+
+func TestCheckBodyName(t *testing.T) {
+	const clusterResourceID = "/subscriptions/00000000-0000-0000-0000-000000000000/resourceGroups/testGroup/providers/Microsoft.RedHatOpenShift/hcpOpenShiftClusters/testCluster"
+
+	resourceID, err := arm.ParseResourceID(clusterResourceID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name        string
+		body        string
+		expectError bool
+	}{
+		{
+			name:        "No name",
+			body:        `{"location":"eastus"}`,
+			expectError: false,
+		},
+		{
+			name:        "Matching name",
+			body:        `{"name":"testCluster"}`,
+			expectError: false,
+		},
+		{
+			name:        "Matching name in different case",
+			body:        `{"name":"TESTCLUSTER"}`,
+			expectError: false,
+		},
+		{
+			name:        "Mismatched name",
+			body:        `{"name":"otherCluster"}`,
+			expectError: true,
+		},
+		{
+			name:        "Empty name",
+			body:        `{"name":""}`,
+			expectError: true,
+		},
+		{
+			name:        "Not an object",
+			body:        `[]`,
+			expectError: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cloudError := CheckBodyName(resourceID, []byte(tt.body))
+			if !tt.expectError {
+				if cloudError != nil {
+					t.Errorf("expected no error, got %v", cloudError)
+				}
+				return
+			}
+			if cloudError == nil {
+				t.Fatal("expected an error, got nil")
+			}
+			if cloudError.StatusCode != http.StatusBadRequest || cloudError.Code != arm.CloudErrorCodeNameMismatch {
+				t.Errorf("expected %d %s, got %v", http.StatusBadRequest, arm.CloudErrorCodeNameMismatch, cloudError)
+			}
+		})
+	}
+}
+
+func TestJSONMergePatch(t *testing.T) {
+	tests := []struct {
+		name     string
+		target   string
+		patch    string
+		expected string
+	}{
+		{
+			name:     "Omitted member is kept",
+			target:   `{"a":"b","c":"d"}`,
+			patch:    `{"a":"z"}`,
+			expected: `{"a":"z","c":"d"}`,
+		},
+		{
+			name:     "Null member is removed",
+			target:   `{"a":"b","c":"d"}`,
+			patch:    `{"a":null}`,
+			expected: `{"c":"d"}`,
+		},
+		{
+			name:     "Nested objects are merged",
+			target:   `{"a":{"b":"c","d":"e"}}`,
+			patch:    `{"a":{"b":"z","d":null,"f":"g"}}`,
+			expected: `{"a":{"b":"z","f":"g"}}`,
+		},
+		{
+			name:     "Arrays are replaced",
+			target:   `{"a":[1,2]}`,
+			patch:    `{"a":[3]}`,
+			expected: `{"a":[3]}`,
+		},
+		{
+			name:     "Object replaces scalar",
+			target:   `{"a":"b"}`,
+			patch:    `{"a":{"c":null,"d":"e"}}`,
+			expected: `{"a":{"d":"e"}}`,
+		},
+		{
+			name:     "Non-object patch replaces target",
+			target:   `{"a":"b"}`,
+			patch:    `["c"]`,
+			expected: `["c"]`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var merged, expected any
+
+			err := json.Unmarshal(jsonMergePatch([]byte(tt.target), []byte(tt.patch)), &merged)
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = json.Unmarshal([]byte(tt.expected), &expected)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(merged, expected) {
+				t.Errorf("expected %v, got %v", expected, merged)
+			}
+		})
+	}
+}
+
+func TestToCloudError(t *testing.T) {
+	const clusterResourceID = "/subscriptions/00000000-0000-0000-0000-000000000000/resourceGroups/testGroup/providers/Microsoft.RedHatOpenShift/hcpOpenShiftClusters/testCluster"
+
+	resourceID, err := arm.ParseResourceID(clusterResourceID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ocmError, err := ocmerrors.NewError().Status(http.StatusNotFound).Reason("Cluster not found").Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name               string
+		err                error
+		resourceID         *arm.ResourceID
+		expectedStatusCode int
+		expectedCode       string
+	}{
+		{
+			name:               "Not found",
+			err:                database.ErrNotFound,
+			resourceID:         resourceID,
+			expectedStatusCode: http.StatusNotFound,
+			expectedCode:       arm.CloudErrorCodeResourceNotFound,
+		},
+		{
+			name:               "Not found without a resource ID",
+			err:                database.ErrNotFound,
+			expectedStatusCode: http.StatusNotFound,
+			expectedCode:       arm.CloudErrorCodeNotFound,
+		},
+		{
+			name:               "Wrapped not found",
+			err:                fmt.Errorf("failed to read resource: %w", database.ErrNotFound),
+			resourceID:         resourceID,
+			expectedStatusCode: http.StatusNotFound,
+			expectedCode:       arm.CloudErrorCodeResourceNotFound,
+		},
+		{
+			name:               "Conflict",
+			err:                database.ErrConflict,
+			expectedStatusCode: http.StatusConflict,
+			expectedCode:       arm.CloudErrorCodeConflict,
+		},
+		{
+			name:               "Precondition failed",
+			err:                database.ErrPreconditionFailed,
+			expectedStatusCode: http.StatusPreconditionFailed,
+			expectedCode:       arm.CloudErrorCodePreconditionFailed,
+		},
+		{
+			name:               "Throttled",
+			err:                database.ErrThrottled,
+			expectedStatusCode: http.StatusTooManyRequests,
+			expectedCode:       arm.CloudErrorCodeTooManyRequests,
+		},
+		{
+			name:               "Cosmos DB precondition failed",
+			err:                &azcore.ResponseError{StatusCode: http.StatusPreconditionFailed},
+			expectedStatusCode: http.StatusPreconditionFailed,
+			expectedCode:       arm.CloudErrorCodePreconditionFailed,
+		},
+		{
+			name:               "Cosmos DB throttled",
+			err:                &azcore.ResponseError{StatusCode: http.StatusTooManyRequests},
+			expectedStatusCode: http.StatusTooManyRequests,
+			expectedCode:       arm.CloudErrorCodeTooManyRequests,
+		},
+		{
+			name:               "Cluster Service error",
+			err:                ocmError,
+			resourceID:         resourceID,
+			expectedStatusCode: http.StatusNotFound,
+			expectedCode:       arm.CloudErrorCodeResourceNotFound,
+		},
+		{
+			name:               "Unknown error",
+			err:                errors.New("connection reset"),
+			expectedStatusCode: http.StatusInternalServerError,
+			expectedCode:       arm.CloudErrorCodeInternalServerError,
+		},
+	}
+
+	ctx := ContextWithLogger(context.Background(), testLogger)
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cloudError := toCloudError(ctx, tt.err, tt.resourceID)
+			if cloudError.StatusCode != tt.expectedStatusCode {
+				t.Errorf("expected status code %d, got %d", tt.expectedStatusCode, cloudError.StatusCode)
+			}
+			if cloudError.Code != tt.expectedCode {
+				t.Errorf("expected code %q, got %q", tt.expectedCode, cloudError.Code)
+			}
+		})
+	}
+}
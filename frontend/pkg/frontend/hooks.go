@@ -0,0 +1,90 @@
+package frontend
+
+// Copyright (c) Microsoft Corporation.
+// Licensed under the Apache License 2.0.
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/Azure/ARO-HCP/internal/api/arm"
+	"github.com/Azure/ARO-HCP/internal/database"
+)
+
+// validationHookTimeout bounds how long the validation hooks for a single
+// request may run in total. This is a variable so tests can shorten it.
+var validationHookTimeout = 5 * time.Second
+
+// ValidationRequest describes a request being checked by a ValidationHook.
+type ValidationRequest struct {
+	Operation  database.OperationRequest
+	ResourceID *arm.ResourceID
+
+	// Resource is the requested state of the resource, either an
+	// *api.HCPOpenShiftCluster or an *api.HCPOpenShiftClusterNodePool.
+	// It is nil for delete requests.
+	Resource any
+}
+
+// ValidationHook checks a request synchronously, before any operation is
+// created for it, to catch problems that static validation cannot, such as
+// a lack of downstream capacity. Returning an error rejects the request with
+// "400 Bad Request", or with the given status if the error is a CloudError.
+//
+// Hooks run on the request path and must be fast. They must also honor the
+// cancellation of their context, which expires after validationHookTimeout.
+type ValidationHook func(ctx context.Context, request ValidationRequest) error
+
+// RegisterValidationHook adds a hook to run for requests of the given
+// operation type. Hooks run in the order they are registered. Register all
+// hooks before the frontend starts serving requests.
+func (f *Frontend) RegisterValidationHook(operation database.OperationRequest, hook ValidationHook) {
+	if f.validationHooks == nil {
+		f.validationHooks = make(map[database.OperationRequest][]ValidationHook)
+	}
+	f.validationHooks[operation] = append(f.validationHooks[operation], hook)
+}
+
+// runValidationHooks runs the hooks registered for the request's operation
+// type, stopping at the first to reject the request.
+func (f *Frontend) runValidationHooks(ctx context.Context, request ValidationRequest) *arm.CloudError {
+	hooks := f.validationHooks[request.Operation]
+	if len(hooks) == 0 {
+		return nil
+	}
+
+	logger := LoggerFromContext(ctx)
+
+	ctx, cancel := context.WithTimeout(ctx, validationHookTimeout)
+	defer cancel()
+
+	for _, hook := range hooks {
+		err := hook(ctx, request)
+		if err == nil {
+			continue
+		}
+
+		var cloudError *arm.CloudError
+		if errors.As(err, &cloudError) {
+			return cloudError
+		}
+
+		// A hook that fails to finish in time says nothing
+		// about the request, so do not blame the client.
+		if ctx.Err() != nil {
+			logger.Error(fmt.Sprintf("Validation hook for %s did not finish: %v", request.Operation, err))
+			return arm.NewInternalServerError()
+		}
+
+		return arm.NewCloudError(
+			http.StatusBadRequest,
+			arm.CloudErrorCodeInvalidRequestContent,
+			request.ResourceID.String(),
+			"%s", err.Error())
+	}
+
+	return nil
+}
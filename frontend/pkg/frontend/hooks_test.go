@@ -0,0 +1,153 @@
+package frontend
+
+// Copyright (c) Microsoft Corporation.
+// Licensed under the Apache License 2.0.
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/Azure/ARO-HCP/internal/api"
+	"github.com/Azure/ARO-HCP/internal/api/arm"
+	"github.com/Azure/ARO-HCP/internal/api/v20240610preview/generated"
+	"github.com/Azure/ARO-HCP/internal/database"
+)
+
+func TestValidationHooks(t *testing.T) {
+	savedTimeout := validationHookTimeout
+	validationHookTimeout = 50 * time.Millisecond
+	t.Cleanup(func() { validationHookTimeout = savedTimeout })
+
+	// maxReplicas stands in for downstream capacity.
+	const maxReplicas = 3
+
+	capacityHook := func(ctx context.Context, request ValidationRequest) error {
+		nodePool, ok := request.Resource.(*api.HCPOpenShiftClusterNodePool)
+		if !ok {
+			return errors.New("unexpected resource type")
+		}
+		if nodePool.Properties.Spec.Replicas > maxReplicas {
+			return errors.New("insufficient capacity for the requested replicas")
+		}
+		return nil
+	}
+
+	slowHook := func(ctx context.Context, request ValidationRequest) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}
+
+	tests := []struct {
+		name               string
+		hook               ValidationHook
+		replicas           int32
+		expectedStatusCode int
+	}{
+		{
+			name:               "Create accepted by hook",
+			hook:               capacityHook,
+			replicas:           maxReplicas,
+			expectedStatusCode: http.StatusCreated,
+		},
+		{
+			name:               "Create rejected by hook",
+			hook:               capacityHook,
+			replicas:           maxReplicas + 1,
+			expectedStatusCode: http.StatusBadRequest,
+		},
+		{
+			name: "Create rejected by hook with a cloud error",
+			hook: func(ctx context.Context, request ValidationRequest) error {
+				return arm.NewCloudError(http.StatusConflict, arm.CloudErrorCodeConflict, "", "Try again later.")
+			},
+			replicas:           1,
+			expectedStatusCode: http.StatusConflict,
+		},
+		{
+			name:               "Hook exceeds its timeout",
+			hook:               slowHook,
+			replicas:           1,
+			expectedStatusCode: http.StatusInternalServerError,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			f, ts := newTestListServer(t)
+			cluster := addTestCluster(t, f, dummyClusterName, nil)
+
+			f.config.SynchronousOperations = true
+			f.RegisterValidationHook(database.OperationRequestCreate, test.hook)
+
+			body, err := json.Marshal(generated.HcpOpenShiftClusterNodePoolResource{
+				Location:   &dummyLocation,
+				Properties: &generated.NodePoolProperties{Spec: &generated.NodePoolSpec{Replicas: api.Ptr(test.replicas), Platform: &generated.NodePoolPlatformProfile{VMSize: &dummyVMSize}, Version: &generated.VersionProfile{ID: &dummyVersionID, ChannelGroup: &dummyChannelGroup}}},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			nodePoolID := cluster.ResourceId.String() + "/" + api.NodePoolResourceTypeName + "/" + dummyNodePoolName
+			requestURL := ts.URL + nodePoolID + "?api-version=2024-06-10-preview"
+
+			req, err := http.NewRequest(http.MethodPut, requestURL, bytes.NewReader(body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set(arm.HeaderNameARMResourceSystemData, "{}")
+
+			rs, err := ts.Client().Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer rs.Body.Close()
+
+			if rs.StatusCode != test.expectedStatusCode {
+				t.Fatalf("expected status code %d, got %d", test.expectedStatusCode, rs.StatusCode)
+			}
+
+			// A rejected create must not leave a resource behind.
+			if rs.StatusCode != http.StatusCreated {
+				resourceID, err := arm.ParseResourceID(nodePoolID)
+				if err != nil {
+					t.Fatal(err)
+				}
+				_, err = f.dbClient.GetResourceDoc(context.Background(), resourceID)
+				if !errors.Is(err, database.ErrNotFound) {
+					t.Errorf("expected no node pool after a rejected create, got %v", err)
+				}
+			}
+		})
+	}
+}
+
+func TestValidationHooksOperationType(t *testing.T) {
+	f, _ := newTestListServer(t)
+
+	var calls []database.OperationRequest
+	f.RegisterValidationHook(database.OperationRequestDelete, func(ctx context.Context, request ValidationRequest) error {
+		calls = append(calls, request.Operation)
+		return nil
+	})
+
+	ctx := ContextWithLogger(context.Background(), testLogger)
+	for _, operation := range []database.OperationRequest{
+		database.OperationRequestCreate,
+		database.OperationRequestUpdate,
+		database.OperationRequestDelete,
+	} {
+		if cloudError := f.runValidationHooks(ctx, ValidationRequest{Operation: operation}); cloudError != nil {
+			t.Errorf("unexpected error for %s: %v", operation, cloudError)
+		}
+	}
+
+	if len(calls) != 1 || calls[0] != database.OperationRequestDelete {
+		t.Errorf("expected the hook to run only for %s, ran for %v", database.OperationRequestDelete, calls)
+	}
+}
@@ -0,0 +1,107 @@
+package frontend
+
+// Copyright (c) Microsoft Corporation.
+// Licensed under the Apache License 2.0.
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"runtime/debug"
+	"slices"
+	"sync"
+	"time"
+)
+
+// backgroundJobs tracks the long-running background jobs of a Frontend so
+// that readiness can account for them. The zero value is ready to use.
+type backgroundJobs struct {
+	mutex sync.Mutex
+	// stopped maps the name of each job that stopped
+	// unexpectedly to the reason it stopped.
+	stopped map[string]error
+}
+
+// markStopped records that the named job stopped unexpectedly.
+func (j *backgroundJobs) markStopped(name string, err error) {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+
+	if j.stopped == nil {
+		j.stopped = make(map[string]error)
+	}
+	j.stopped[name] = err
+}
+
+// stoppedJobs returns the sorted names of the jobs that stopped unexpectedly.
+func (j *backgroundJobs) stoppedJobs() []string {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+
+	return slices.Sorted(maps.Keys(j.stopped))
+}
+
+// RunBackgroundJob runs a critical background job in a new goroutine. If the
+// job returns or panics before ctx is cancelled, the frontend reports itself
+// not ready from then on, so that traffic drains away from an instance that
+// can no longer do all of its work. The returned channel is closed when the
+// job stops.
+func (f *Frontend) RunBackgroundJob(ctx context.Context, name string, job func(context.Context) error) <-chan struct{} {
+	logger := LoggerFromContext(ctx)
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+
+		var err error
+
+		defer func() {
+			if e := recover(); e != nil {
+				logger.Error(fmt.Sprintf("panic in background job %s: %#v\n%s\n", name, e, string(debug.Stack())))
+				err = fmt.Errorf("panic: %v", e)
+			}
+
+			// Stopping because the context is done is expected.
+			if ctx.Err() != nil {
+				return
+			}
+
+			if err == nil {
+				err = fmt.Errorf("background job %s returned unexpectedly", name)
+			}
+			logger.Error(fmt.Sprintf("Background job %s stopped: %v", name, err))
+			f.jobs.markStopped(name, err)
+		}()
+
+		err = job(ctx)
+	}()
+
+	return done
+}
+
+// ReapDeletedSubscriptions removes the documents of subscriptions deleted
+// longer ago than retention every interval until ctx is done, then returns
+// the context error. A failed attempt is retried at the next interval. It
+// is meant to be run with RunBackgroundJob.
+func (f *Frontend) ReapDeletedSubscriptions(ctx context.Context, interval, retention time.Duration) error {
+	logger := LoggerFromContext(ctx)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		reaped, err := f.dbClient.ReapDeletedSubscriptions(ctx, retention)
+		if reaped > 0 {
+			logger.Info(fmt.Sprintf("Reaped %d deleted subscriptions", reaped))
+		}
+		if err != nil && ctx.Err() == nil {
+			logger.Warn(fmt.Sprintf("Failed to reap deleted subscriptions: %v", err))
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,184 @@
+package frontend
+
+// Copyright (c) Microsoft Corporation.
+// Licensed under the Apache License 2.0.
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/Azure/ARO-HCP/internal/api/arm"
+	"github.com/Azure/ARO-HCP/internal/database"
+)
+
+func TestBackgroundJobReadiness(t *testing.T) {
+	tests := []struct {
+		name               string
+		job                func(context.Context) error
+		cancel             bool
+		expectedStatusCode int
+	}{
+		{
+			name: "Job returns an error",
+			job: func(ctx context.Context) error {
+				return errors.New("worker failed")
+			},
+			expectedStatusCode: http.StatusInternalServerError,
+		},
+		{
+			name: "Job returns early without an error",
+			job: func(ctx context.Context) error {
+				return nil
+			},
+			expectedStatusCode: http.StatusInternalServerError,
+		},
+		{
+			name: "Job panics",
+			job: func(ctx context.Context) error {
+				panic("worker crashed")
+			},
+			expectedStatusCode: http.StatusInternalServerError,
+		},
+		{
+			name: "Job stopped by cancellation",
+			job: func(ctx context.Context) error {
+				<-ctx.Done()
+				return ctx.Err()
+			},
+			cancel:             true,
+			expectedStatusCode: http.StatusOK,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			f := &Frontend{
+				dbClient: database.NewCache(),
+				metrics:  NewPrometheusEmitter(prometheus.NewRegistry()),
+			}
+			f.ready.Store(true)
+			ts := httptest.NewServer(f.routes())
+			ts.Config.BaseContext = func(net.Listener) context.Context {
+				return ContextWithLogger(context.Background(), testLogger)
+			}
+			defer ts.Close()
+
+			ctx, cancel := context.WithCancel(ContextWithLogger(context.Background(), testLogger))
+			defer cancel()
+
+			done := f.RunBackgroundJob(ctx, "worker", test.job)
+			if test.cancel {
+				cancel()
+			}
+			<-done
+
+			rs, err := ts.Client().Get(ts.URL + "/healthz")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer rs.Body.Close()
+
+			if rs.StatusCode != test.expectedStatusCode {
+				t.Errorf("expected status code %d, got %d", test.expectedStatusCode, rs.StatusCode)
+			}
+		})
+	}
+}
+
+func TestBackgroundJobRunningIsReady(t *testing.T) {
+	f := &Frontend{
+		dbClient: database.NewCache(),
+		metrics:  NewPrometheusEmitter(prometheus.NewRegistry()),
+	}
+	f.ready.Store(true)
+
+	ctx, cancel := context.WithCancel(ContextWithLogger(context.Background(), testLogger))
+
+	started := make(chan struct{})
+	done := f.RunBackgroundJob(ctx, "worker", func(ctx context.Context) error {
+		close(started)
+		<-ctx.Done()
+		return nil
+	})
+	<-started
+
+	if !f.CheckReady(ctx) {
+		t.Error("expected ready while the background job is running")
+	}
+
+	cancel()
+	<-done
+
+	if stopped := f.jobs.stoppedJobs(); len(stopped) != 0 {
+		t.Errorf("expected no stopped jobs after cancellation, got %v", stopped)
+	}
+}
+
+func TestReapDeletedSubscriptions(t *testing.T) {
+	const (
+		reapedSubscriptionID   = "11111111-1111-1111-1111-111111111111"
+		retainedSubscriptionID = "22222222-2222-2222-2222-222222222222"
+	)
+
+	f := &Frontend{
+		dbClient: database.NewCache(),
+		metrics:  NewPrometheusEmitter(prometheus.NewRegistry()),
+	}
+
+	ctx, cancel := context.WithCancel(ContextWithLogger(context.Background(), testLogger))
+	defer cancel()
+
+	for subscriptionID, deletedAt := range map[string]time.Time{
+		reapedSubscriptionID:   time.Now().Add(-2 * time.Hour),
+		retainedSubscriptionID: time.Now(),
+	} {
+		err := f.dbClient.CreateSubscriptionDoc(ctx, database.NewSubscriptionDocument(subscriptionID, &arm.Subscription{
+			State: arm.SubscriptionStateDeleted,
+		}))
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = f.dbClient.UpdateSubscriptionDoc(ctx, subscriptionID, func(doc *database.SubscriptionDocument) bool {
+			doc.DeletedAt = &deletedAt
+			return true
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	done := f.RunBackgroundJob(ctx, "subscription-reaper", func(ctx context.Context) error {
+		return f.ReapDeletedSubscriptions(ctx, time.Millisecond, time.Hour)
+	})
+
+	deadline := time.After(5 * time.Second)
+	for {
+		_, err := f.dbClient.GetSubscriptionDoc(ctx, reapedSubscriptionID)
+		if errors.Is(err, database.ErrNotFound) {
+			break
+		}
+		select {
+		case <-deadline:
+			t.Fatal("expected the deleted subscription past its retention to be reaped")
+		case <-time.After(time.Millisecond):
+		}
+	}
+
+	cancel()
+	<-done
+
+	_, err := f.dbClient.GetSubscriptionDoc(context.Background(), retainedSubscriptionID)
+	if err != nil {
+		t.Errorf("expected the recently deleted subscription to be retained, got %v", err)
+	}
+	if stopped := f.jobs.stoppedJobs(); len(stopped) != 0 {
+		t.Errorf("expected no stopped jobs after cancellation, got %v", stopped)
+	}
+}
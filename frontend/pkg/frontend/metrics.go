@@ -4,30 +4,112 @@ package frontend
 // Licensed under the Apache License 2.0.
 
 import (
+	"context"
+	"fmt"
 	"net/http"
+	"slices"
 	"strconv"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
 	"golang.org/x/exp/maps"
 
+	"github.com/Azure/ARO-HCP/internal/api/arm"
 	"github.com/Azure/ARO-HCP/internal/database"
 )
 
+const (
+	RejectedRequestsMetricName = "aro_hcp_rejected_requests_total"
+	RequestDurationMetricName  = "aro_hcp_request_duration_seconds"
+	SubscriptionsMetricName    = "aro_hcp_subscriptions"
+)
+
+// RejectionReason is the reason label of the rejected requests counter.
+// Only the reasons listed in rejectionReasons may be emitted, which keeps
+// the label cardinality bounded.
+type RejectionReason string
+
+const (
+	RejectionReasonThrottled    RejectionReason = "throttled"
+	RejectionReasonMaintenance  RejectionReason = "maintenance"
+	RejectionReasonBlocked      RejectionReason = "blocked"
+	RejectionReasonTooLarge     RejectionReason = "too_large"
+	RejectionReasonUnauthorized RejectionReason = "unauthorized"
+)
+
+var rejectionReasons = []RejectionReason{
+	RejectionReasonThrottled,
+	// No maintenance mode rejects requests yet, but the reason is
+	// part of the label contract dashboards and alerts rely on.
+	RejectionReasonMaintenance,
+	RejectionReasonBlocked,
+	RejectionReasonTooLarge,
+	RejectionReasonUnauthorized,
+}
+
+// CountRejectedRequest increments the rejected requests counter for the
+// given reason using the Emitter from the request context. Middleware
+// should call this whenever it turns a request away.
+func CountRejectedRequest(ctx context.Context, reason RejectionReason) {
+	logger := LoggerFromContext(ctx)
+
+	if !slices.Contains(rejectionReasons, reason) {
+		logger.Error(fmt.Sprintf("Unknown request rejection reason '%s'", reason))
+		return
+	}
+
+	emitter, err := EmitterFromContext(ctx)
+	if err != nil {
+		// Metrics are best-effort; don't fail the request over them.
+		logger.Debug(err.Error())
+		return
+	}
+
+	emitter.EmitCounter(RejectedRequestsMetricName, 1.0, map[string]string{
+		"reason": string(reason),
+	})
+}
+
 // Emitter emits different types of metrics
 type Emitter interface {
 	EmitCounter(metricName string, value float64, labels map[string]string)
 	EmitGauge(metricName string, value float64, labels map[string]string)
+
+	// RecordRequest records the latency of a request served by the
+	// route with the given pattern. The route must be a pattern and
+	// not a request path, which keeps the label cardinality bounded.
+	RecordRequest(method, route, statusCode string, duration time.Duration)
+
+	// SetSubscriptionCounts records the number of subscriptions in each
+	// state. States missing from counts are recorded as having none.
+	SetSubscriptionCounts(counts map[arm.SubscriptionState]int)
 }
 
+// NoopEmitter discards all metrics.
+type NoopEmitter struct{}
+
+func (NoopEmitter) EmitCounter(string, float64, map[string]string) {}
+
+func (NoopEmitter) EmitGauge(string, float64, map[string]string) {}
+
+func (NoopEmitter) RecordRequest(string, string, string, time.Duration) {}
+
+func (NoopEmitter) SetSubscriptionCounts(map[arm.SubscriptionState]int) {}
+
 type PrometheusEmitter struct {
 	mutex    sync.Mutex
 	gauges   map[string]*prometheus.GaugeVec
 	counters map[string]*prometheus.CounterVec
-	registry prometheus.Registerer
+	requests *prometheus.HistogramVec
+	// subscriptions counts subscriptions by state.
+	subscriptions *prometheus.GaugeVec
+	registry      prometheus.Registerer
 }
 
+// NewPrometheusEmitter returns an Emitter that registers metrics with the
+// given registry. A nil registry causes all metrics to be discarded.
 func NewPrometheusEmitter(r prometheus.Registerer) *PrometheusEmitter {
 	return &PrometheusEmitter{
 		gauges:   make(map[string]*prometheus.GaugeVec),
@@ -37,6 +119,9 @@ func NewPrometheusEmitter(r prometheus.Registerer) *PrometheusEmitter {
 }
 
 func (pe *PrometheusEmitter) EmitGauge(name string, value float64, labels map[string]string) {
+	if pe.registry == nil {
+		return
+	}
 	pe.mutex.Lock()
 	defer pe.mutex.Unlock()
 	vec, exists := pe.gauges[name]
@@ -50,6 +135,9 @@ func (pe *PrometheusEmitter) EmitGauge(name string, value float64, labels map[st
 }
 
 func (pe *PrometheusEmitter) EmitCounter(name string, value float64, labels map[string]string) {
+	if pe.registry == nil {
+		return
+	}
 	pe.mutex.Lock()
 	defer pe.mutex.Unlock()
 	vec, exists := pe.counters[name]
@@ -62,6 +150,62 @@ func (pe *PrometheusEmitter) EmitCounter(name string, value float64, labels map[
 	vec.With(labels).Add(value)
 }
 
+func (pe *PrometheusEmitter) RecordRequest(method, route, statusCode string, duration time.Duration) {
+	if pe.registry == nil {
+		return
+	}
+	pe.mutex.Lock()
+	defer pe.mutex.Unlock()
+	if pe.requests == nil {
+		pe.requests = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    RequestDurationMetricName,
+			Help:    "Latency of frontend requests by method, route and status class.",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"method", "route", "status_class"})
+		pe.registry.MustRegister(pe.requests)
+	}
+	pe.requests.WithLabelValues(method, route, statusClass(statusCode)).Observe(duration.Seconds())
+}
+
+func (pe *PrometheusEmitter) SetSubscriptionCounts(counts map[arm.SubscriptionState]int) {
+	if pe.registry == nil {
+		return
+	}
+	pe.mutex.Lock()
+	defer pe.mutex.Unlock()
+	if pe.subscriptions == nil {
+		pe.subscriptions = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: SubscriptionsMetricName,
+			Help: "Number of subscriptions by state.",
+		}, []string{"state"})
+		pe.registry.MustRegister(pe.subscriptions)
+	}
+	for _, state := range arm.SubscriptionStates() {
+		pe.subscriptions.WithLabelValues(string(state)).Set(float64(counts[state]))
+	}
+}
+
+// statusClass returns the class of an HTTP status code, such as "2xx".
+func statusClass(statusCode string) string {
+	if len(statusCode) != 3 {
+		return "unknown"
+	}
+	return statusCode[:1] + "xx"
+}
+
+// routePattern returns the pattern, without any method, of the route that
+// served the request. Unlike the request path, the number of patterns is
+// bounded, which makes it suitable as a metric label.
+func routePattern(r *http.Request) string {
+	if r.Pattern == "" {
+		return "none"
+	}
+	if _, pattern, found := strings.Cut(r.Pattern, " "); found {
+		return pattern
+	}
+	return r.Pattern
+}
+
 type MetricsMiddleware struct {
 	Emitter
 	dbClient database.DBClient
@@ -78,6 +222,11 @@ func (lrw *logResponseWriter) WriteHeader(code int) {
 	lrw.ResponseWriter.WriteHeader(code)
 }
 
+// Unwrap returns the underlying ResponseWriter for http.ResponseController.
+func (lrw *logResponseWriter) Unwrap() http.ResponseWriter {
+	return lrw.ResponseWriter
+}
+
 // Metrics middleware to capture response time and status code
 func (mm MetricsMiddleware) Metrics() MiddlewareFunc {
 	return func(w http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
@@ -86,13 +235,14 @@ func (mm MetricsMiddleware) Metrics() MiddlewareFunc {
 
 		startTime := time.Now()
 
-		lrw := &logResponseWriter{ResponseWriter: w}
+		lrw := &logResponseWriter{ResponseWriter: w, statusCode: http.StatusOK}
 
 		next(lrw, r) // Process the request
 
-		// Get the route pattern that matched
-		routePattern := r.URL.Path
-		duration := time.Since(startTime).Milliseconds()
+		// The mux sets the pattern that matched on the request.
+		routePattern := routePattern(r)
+		elapsed := time.Since(startTime)
+		duration := elapsed.Milliseconds()
 
 		subscriptionState := "Unknown"
 		subscriptionId := r.PathValue(PathSegmentSubscriptionID)
@@ -120,5 +270,65 @@ func (mm MetricsMiddleware) Metrics() MiddlewareFunc {
 			"code":        strconv.Itoa(lrw.statusCode),
 			"route":       routePattern,
 		})
+
+		mm.Emitter.RecordRequest(r.Method, routePattern, strconv.Itoa(lrw.statusCode), elapsed)
 	}
 }
+
+// CollectSubscriptionMetrics counts the subscriptions in each state every
+// interval until ctx is done, then returns the context error. A failed count
+// is skipped, so the gauges keep their last values while the database is
+// unavailable. It is meant to be run with RunBackgroundJob.
+func (f *Frontend) CollectSubscriptionMetrics(ctx context.Context, interval time.Duration) error {
+	logger := LoggerFromContext(ctx)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		err := f.collectSubscriptionMetrics(ctx)
+		if err != nil && ctx.Err() == nil {
+			logger.Warn(fmt.Sprintf("Failed to collect subscription metrics: %v", err))
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// collectSubscriptionMetrics counts the subscriptions in each known state
+// and records the counts. The counts are only recorded if every page of
+// subscriptions was read, so a failure never leaves partial counts behind.
+func (f *Frontend) collectSubscriptionMetrics(ctx context.Context) error {
+	pageSize, _ := f.pageSizes()
+	states := arm.SubscriptionStates()
+	counts := make(map[arm.SubscriptionState]int, len(states))
+
+	var continuationToken string
+
+	for {
+		docs, nextToken, err := f.dbClient.ListSubscriptionDocs(ctx, continuationToken, int(pageSize))
+		if err != nil {
+			return err
+		}
+
+		for _, doc := range docs {
+			// Unknown states are not counted, which keeps
+			// the label cardinality bounded.
+			if doc.Subscription != nil && slices.Contains(states, doc.Subscription.State) {
+				counts[doc.Subscription.State]++
+			}
+		}
+
+		if nextToken == "" {
+			break
+		}
+		continuationToken = nextToken
+	}
+
+	f.metrics.SetSubscriptionCounts(counts)
+	return nil
+}
@@ -0,0 +1,361 @@
+package frontend
+
+// Copyright (c) Microsoft Corporation.
+// Licensed under the Apache License 2.0.
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"github.com/Azure/ARO-HCP/internal/api/arm"
+	"github.com/Azure/ARO-HCP/internal/database"
+	"github.com/Azure/ARO-HCP/internal/ocm"
+)
+
+// rejectedRequestCounts scrapes the rejected requests counter from the
+// registry and returns its values keyed by reason.
+func rejectedRequestCounts(t *testing.T, registry *prometheus.Registry) map[string]float64 {
+	t.Helper()
+
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	counts := make(map[string]float64)
+	for _, family := range families {
+		if family.GetName() != RejectedRequestsMetricName {
+			continue
+		}
+		for _, metric := range family.GetMetric() {
+			for _, label := range metric.GetLabel() {
+				if label.GetName() == "reason" {
+					counts[label.GetValue()] = metric.GetCounter().GetValue()
+				}
+			}
+		}
+	}
+	return counts
+}
+
+func TestRejectedRequestsCounter(t *testing.T) {
+	const subscriptionID = "00000000-0000-0000-0000-000000000000"
+
+	registry := prometheus.NewRegistry()
+	dbClient := database.NewCache()
+
+	err := dbClient.CreateSubscriptionDoc(context.Background(), database.NewSubscriptionDocument(
+		subscriptionID, &arm.Subscription{State: arm.SubscriptionStateSuspended}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	ctx = ContextWithLogger(ctx, testLogger)
+	ctx = ContextWithDBClient(ctx, dbClient)
+	ctx = ContextWithEmitter(ctx, NewPrometheusEmitter(registry))
+
+	next := func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("request to %s %s was not rejected", r.Method, r.URL.Path)
+	}
+
+	// Oversized request body.
+	request := httptest.NewRequestWithContext(ctx, http.MethodPut, "/", bytes.NewReader(bytes.Repeat([]byte{0}, int(5*megabyte))))
+	MiddlewareBody(4*megabyte)(httptest.NewRecorder(), request, next)
+
+	// Write request to a suspended subscription.
+	request = httptest.NewRequestWithContext(ctx, http.MethodPut, "/subscriptions/"+subscriptionID, nil)
+	request.SetPathValue(PathSegmentSubscriptionID, subscriptionID)
+	MiddlewareValidateSubscriptionState(httptest.NewRecorder(), request, next)
+
+	// Requests over the subscription's rate, after the first
+	// one used up the burst.
+	limiter := newSubscriptionRateLimiter(0.001, 1)
+	for range 3 {
+		request = httptest.NewRequestWithContext(ctx, http.MethodGet, "/subscriptions/"+subscriptionID, nil)
+		request.SetPathValue(PathSegmentSubscriptionID, subscriptionID)
+		limiter.Middleware(httptest.NewRecorder(), request, func(http.ResponseWriter, *http.Request) {})
+	}
+
+	// Admin request without a valid token.
+	request = httptest.NewRequestWithContext(ctx, http.MethodGet, "/admin", nil)
+	RequireAdminAuth("token")(httptest.NewRecorder(), request, next)
+
+	// Reasons not yet tied to a middleware.
+	CountRejectedRequest(ctx, RejectionReasonMaintenance)
+
+	// Reasons outside the closed set are dropped.
+	CountRejectedRequest(ctx, RejectionReason("bogus"))
+
+	expected := map[string]float64{
+		string(RejectionReasonThrottled):    2,
+		string(RejectionReasonMaintenance):  1,
+		string(RejectionReasonBlocked):      1,
+		string(RejectionReasonTooLarge):     1,
+		string(RejectionReasonUnauthorized): 1,
+	}
+
+	counts := rejectedRequestCounts(t, registry)
+	if len(counts) != len(expected) {
+		t.Errorf("expected %d reasons, got %v", len(expected), counts)
+	}
+	for reason, value := range expected {
+		if counts[reason] != value {
+			t.Errorf("expected %s=%v, got %v", reason, value, counts[reason])
+		}
+	}
+}
+
+func TestNilMetricsRegistry(t *testing.T) {
+	tests := []struct {
+		name    string
+		emitter Emitter
+	}{
+		{
+			name:    "Prometheus emitter with nil registry",
+			emitter: NewPrometheusEmitter(nil),
+		},
+		{
+			name:    "Nil emitter",
+			emitter: nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			logger := slog.New(slog.NewTextHandler(&buf, nil))
+			mockCSClient := ocm.NewMockClusterServiceClient()
+
+			config := DefaultConfig()
+			config.Location = "eastus"
+
+			f, err := NewFrontend(config, logger, nil, nil, tt.emitter, database.NewCache(), &mockCSClient)
+			if err != nil {
+				t.Fatal(err)
+			}
+			f.ready.Store(true)
+
+			if !strings.Contains(buf.String(), "metrics will not be emitted") {
+				t.Errorf("expected a warning about the missing metrics registry, got %q", buf.String())
+			}
+
+			ts := httptest.NewUnstartedServer(f.server.Handler)
+			ts.Config.BaseContext = f.server.BaseContext
+			ts.Start()
+			defer ts.Close()
+
+			// Exercise both gauges and counters.
+			for _, path := range []string{
+				"/healthz",
+				"/subscriptions/00000000-0000-0000-0000-000000000000?api-version=2.0",
+			} {
+				rs, err := ts.Client().Get(ts.URL + path)
+				if err != nil {
+					t.Fatal(err)
+				}
+				rs.Body.Close()
+				if rs.StatusCode == http.StatusInternalServerError {
+					t.Errorf("unexpected status code %d for %s", rs.StatusCode, path)
+				}
+			}
+		})
+	}
+
+	// Emitting directly is also safe.
+	NewPrometheusEmitter(nil).EmitCounter("test_counter", 1, map[string]string{"label": "value"})
+	NewPrometheusEmitter(nil).EmitGauge("test_gauge", 1, map[string]string{"label": "value"})
+}
+
+func TestRequestDurationHistogram(t *testing.T) {
+	registry := prometheus.NewRegistry()
+
+	f := &Frontend{
+		dbClient: database.NewCache(),
+		metrics:  NewPrometheusEmitter(registry),
+	}
+	f.ready.Store(true)
+
+	err := f.dbClient.CreateSubscriptionDoc(context.Background(), database.NewSubscriptionDocument(
+		dummySubscrtiptionId, &arm.Subscription{State: arm.SubscriptionStateRegistered}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ts := httptest.NewUnstartedServer(f.routes())
+	ts.Config.BaseContext = func(net.Listener) context.Context {
+		ctx := context.Background()
+		ctx = ContextWithLogger(ctx, testLogger)
+		ctx = ContextWithDBClient(ctx, f.dbClient)
+		return ctx
+	}
+	ts.Start()
+	defer ts.Close()
+
+	for _, path := range []string{
+		"/healthz",
+		"/healthz",
+		"/subscriptions/" + dummySubscrtiptionId + "?api-version=2.0",
+	} {
+		rs, err := ts.Client().Get(ts.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rs.Body.Close()
+	}
+
+	// One series per route; concrete subscription IDs must not appear.
+	count, err := testutil.GatherAndCount(registry, RequestDurationMetricName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 2 {
+		t.Errorf("expected 2 %s series, got %d", RequestDurationMetricName, count)
+	}
+
+	expected := map[string]uint64{
+		"/healthz":                        2,
+		"/subscriptions/{subscriptionid}": 1,
+	}
+
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, family := range families {
+		if family.GetName() != RequestDurationMetricName {
+			continue
+		}
+		for _, metric := range family.GetMetric() {
+			labels := make(map[string]string)
+			for _, label := range metric.GetLabel() {
+				labels[label.GetName()] = label.GetValue()
+			}
+			if labels["method"] != http.MethodGet || labels["status_class"] != "2xx" {
+				t.Errorf("unexpected labels %v", labels)
+			}
+			if got := metric.GetHistogram().GetSampleCount(); got != expected[labels["route"]] {
+				t.Errorf("expected %d samples for route %q, got %d", expected[labels["route"]], labels["route"], got)
+			}
+		}
+	}
+}
+
+// unavailableSubscriptionsDBClient fails to list subscriptions.
+type unavailableSubscriptionsDBClient struct {
+	database.DBClient
+	err   error
+	calls atomic.Int32
+}
+
+func (c *unavailableSubscriptionsDBClient) ListSubscriptionDocs(ctx context.Context, continuationToken string, pageSize int) ([]*database.SubscriptionDocument, string, error) {
+	c.calls.Add(1)
+	return nil, "", c.err
+}
+
+func TestSubscriptionsGauge(t *testing.T) {
+	emitter := NewPrometheusEmitter(prometheus.NewRegistry())
+
+	f := &Frontend{
+		dbClient: database.NewCache(),
+		metrics:  emitter,
+		// Span several pages of subscriptions.
+		config: Config{DefaultPageSize: 2, MaxPageSize: 2},
+	}
+
+	ctx := ContextWithLogger(context.Background(), testLogger)
+
+	for i, state := range []arm.SubscriptionState{
+		arm.SubscriptionStateRegistered,
+		arm.SubscriptionStateRegistered,
+		arm.SubscriptionStateRegistered,
+		arm.SubscriptionStateSuspended,
+	} {
+		err := f.dbClient.CreateSubscriptionDoc(ctx, database.NewSubscriptionDocument(
+			fmt.Sprintf("00000000-0000-0000-0000-00000000000%d", i), &arm.Subscription{State: state}))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	expected := map[arm.SubscriptionState]float64{
+		arm.SubscriptionStateRegistered:   3,
+		arm.SubscriptionStateSuspended:    1,
+		arm.SubscriptionStateUnregistered: 0,
+	}
+
+	checkGauges := func() {
+		t.Helper()
+
+		for state, value := range expected {
+			if actual := testutil.ToFloat64(emitter.subscriptions.WithLabelValues(string(state))); actual != value {
+				t.Errorf("expected %s=%v, got %v", state, value, actual)
+			}
+		}
+	}
+
+	if err := f.collectSubscriptionMetrics(ctx); err != nil {
+		t.Fatal(err)
+	}
+	checkGauges()
+
+	// A database failure leaves the gauges as they were.
+	f.dbClient = &unavailableSubscriptionsDBClient{DBClient: f.dbClient, err: errors.New("database unavailable")}
+	if err := f.collectSubscriptionMetrics(ctx); err == nil {
+		t.Error("expected an error from an unavailable database")
+	}
+	checkGauges()
+}
+
+func TestCollectSubscriptionMetricsJob(t *testing.T) {
+	dbClient := &unavailableSubscriptionsDBClient{DBClient: database.NewCache(), err: errors.ErrUnsupported}
+
+	f := &Frontend{
+		dbClient: dbClient,
+		metrics:  NewPrometheusEmitter(prometheus.NewRegistry()),
+	}
+
+	ctx, cancel := context.WithCancel(ContextWithLogger(context.Background(), testLogger))
+	defer cancel()
+
+	done := f.RunBackgroundJob(ctx, "subscription-metrics", func(ctx context.Context) error {
+		return f.CollectSubscriptionMetrics(ctx, time.Millisecond)
+	})
+
+	// Failures to list subscriptions do not stop collection.
+	deadline := time.After(5 * time.Second)
+	for dbClient.calls.Load() < 3 {
+		select {
+		case <-done:
+			t.Fatal("subscription metrics collection stopped after a failure")
+		case <-deadline:
+			t.Fatal("subscription metrics collection did not retry")
+		case <-time.After(time.Millisecond):
+		}
+	}
+
+	cancel()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("subscription metrics collection did not stop")
+	}
+
+	if stopped := f.jobs.stoppedJobs(); len(stopped) != 0 {
+		t.Errorf("expected no stopped jobs after cancellation, got %v", stopped)
+	}
+}
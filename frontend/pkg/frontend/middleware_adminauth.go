@@ -0,0 +1,55 @@
+package frontend
+
+// Copyright (c) Microsoft Corporation.
+// Licensed under the Apache License 2.0.
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/Azure/ARO-HCP/internal/api/arm"
+)
+
+// bearerToken returns the token in a request's "Authorization: Bearer"
+// header, or false if the request has no bearer token.
+func bearerToken(r *http.Request) (string, bool) {
+	scheme, token, found := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !found || !strings.EqualFold(scheme, "Bearer") {
+		return "", false
+	}
+	token = strings.TrimSpace(token)
+	return token, token != ""
+}
+
+// RequireAdminAuth returns a middleware function that only admits requests
+// bearing one of validTokens, rejecting any others with "403 Forbidden".
+// This keeps internal routes from being reachable by tenants. With no valid
+// tokens, no request can be admitted so the routes respond as if they did
+// not exist.
+func RequireAdminAuth(validTokens ...string) MiddlewareFunc {
+	return func(w http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
+		if len(validTokens) == 0 {
+			arm.WriteError(
+				w, http.StatusNotFound,
+				arm.CloudErrorCodeNotFound, "",
+				"The requested path could not be found.")
+			return
+		}
+
+		token, ok := bearerToken(r)
+		if !ok || !slices.ContainsFunc(validTokens, func(validToken string) bool {
+			return subtle.ConstantTimeCompare([]byte(token), []byte(validToken)) == 1
+		}) {
+			CountRejectedRequest(r.Context(), RejectionReasonUnauthorized)
+			arm.WriteError(
+				w, http.StatusForbidden,
+				arm.CloudErrorCodeAuthorizationFailed, "",
+				"The client is not authorized to perform this action.")
+			return
+		}
+
+		next(w, r)
+	}
+}
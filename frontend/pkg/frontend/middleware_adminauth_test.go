@@ -0,0 +1,162 @@
+package frontend
+
+// Copyright (c) Microsoft Corporation.
+// Licensed under the Apache License 2.0.
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Azure/ARO-HCP/internal/api/arm"
+)
+
+func TestRequireAdminAuth(t *testing.T) {
+	validTokens := []string{"first-token", "second-token"}
+
+	tests := []struct {
+		name               string
+		authorization      string
+		validTokens        []string
+		expectedStatusCode int
+		expectedErrorCode  string
+	}{
+		{
+			name:               "Correct token",
+			authorization:      "Bearer second-token",
+			validTokens:        validTokens,
+			expectedStatusCode: http.StatusOK,
+		},
+		{
+			name:               "Correct token with lowercase scheme",
+			authorization:      "bearer first-token",
+			validTokens:        validTokens,
+			expectedStatusCode: http.StatusOK,
+		},
+		{
+			name:               "Missing token",
+			validTokens:        validTokens,
+			expectedStatusCode: http.StatusForbidden,
+			expectedErrorCode:  arm.CloudErrorCodeAuthorizationFailed,
+		},
+		{
+			name:               "Wrong token",
+			authorization:      "Bearer third-token",
+			validTokens:        validTokens,
+			expectedStatusCode: http.StatusForbidden,
+			expectedErrorCode:  arm.CloudErrorCodeAuthorizationFailed,
+		},
+		{
+			name:               "Wrong scheme",
+			authorization:      "Basic first-token",
+			validTokens:        validTokens,
+			expectedStatusCode: http.StatusForbidden,
+			expectedErrorCode:  arm.CloudErrorCodeAuthorizationFailed,
+		},
+		{
+			name:               "Admin routes disabled",
+			authorization:      "Bearer first-token",
+			validTokens:        nil,
+			expectedStatusCode: http.StatusNotFound,
+			expectedErrorCode:  arm.CloudErrorCodeNotFound,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			writer := httptest.NewRecorder()
+
+			request := httptest.NewRequest(http.MethodGet, "/admin/subscriptions", nil)
+			request = request.WithContext(ContextWithLogger(request.Context(), testLogger))
+			if test.authorization != "" {
+				request.Header.Set("Authorization", test.authorization)
+			}
+
+			var called bool
+			next := func(w http.ResponseWriter, r *http.Request) {
+				called = true
+				w.WriteHeader(http.StatusOK)
+			}
+
+			RequireAdminAuth(test.validTokens...)(writer, request, next)
+
+			if writer.Code != test.expectedStatusCode {
+				t.Fatalf("expected status code %d, got %d", test.expectedStatusCode, writer.Code)
+			}
+
+			if test.expectedStatusCode == http.StatusOK {
+				if !called {
+					t.Error("expected the next handler to be called")
+				}
+				return
+			}
+
+			if called {
+				t.Error("expected the request to be rejected before the next handler")
+			}
+
+			var cloudError arm.CloudError
+			err := json.Unmarshal(writer.Body.Bytes(), &cloudError)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if cloudError.Code != test.expectedErrorCode {
+				t.Errorf("expected error code %s, got %s", test.expectedErrorCode, cloudError.Code)
+			}
+		})
+	}
+}
+
+func TestAdminRoutesRequireAuth(t *testing.T) {
+	f, ts := newTestListServer(t)
+
+	tests := []struct {
+		name               string
+		adminTokens        []string
+		authorization      string
+		expectedStatusCode int
+	}{
+		{
+			name:               "Correct token",
+			adminTokens:        []string{testAdminToken},
+			authorization:      "Bearer " + testAdminToken,
+			expectedStatusCode: http.StatusOK,
+		},
+		{
+			name:               "Wrong token",
+			adminTokens:        []string{testAdminToken},
+			authorization:      "Bearer wrong-token",
+			expectedStatusCode: http.StatusForbidden,
+		},
+		{
+			name:               "Admin routes disabled",
+			adminTokens:        nil,
+			authorization:      "Bearer " + testAdminToken,
+			expectedStatusCode: http.StatusNotFound,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			f.config.AdminTokens = test.adminTokens
+			ts.Config.Handler = f.routes()
+
+			request, err := http.NewRequest(http.MethodGet, ts.URL+"/admin/subscriptions/"+dummySubscrtiptionId+"/policy", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			request.Header.Set("Authorization", test.authorization)
+
+			rs, err := ts.Client().Do(request)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer rs.Body.Close()
+
+			if rs.StatusCode != test.expectedStatusCode {
+				t.Errorf("expected status code %d, got %d", test.expectedStatusCode, rs.StatusCode)
+			}
+		})
+	}
+}
@@ -4,8 +4,11 @@ package frontend
 // Licensed under the Apache License 2.0.
 
 import (
+	"compress/gzip"
+	"errors"
 	"io"
 	"net/http"
+	"slices"
 	"strings"
 
 	"github.com/Azure/ARO-HCP/internal/api/arm"
@@ -13,34 +16,80 @@ import (
 
 const megabyte int64 = (1 << 20)
 
-func MiddlewareBody(w http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
-	switch r.Method {
-	case http.MethodPatch, http.MethodPost, http.MethodPut:
-		// Max request body size accepted by ARM is 4 MB (assuming units in powers of 2).
-		// See https://github.com/Azure/azure-resource-manager-rpc/blob/master/v1.0/common-api-details.md#max-request-body-size
-		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, 4*megabyte))
-		if err != nil {
-			arm.WriteError(
-				w, http.StatusBadRequest,
-				arm.CloudErrorCodeInvalidResource, "",
-				"The resource definition is invalid.")
-			return
-		}
+// contentDecoders maps the content encodings that request bodies may be
+// sent in, besides identity, to a function decoding them.
+var contentDecoders = map[string]func(io.Reader) (io.Reader, error){
+	"gzip": func(r io.Reader) (io.Reader, error) { return gzip.NewReader(r) },
+}
+
+// MiddlewareBody returns a middleware function that reads the body of
+// write requests into the request context, rejecting bodies larger than
+// maxBytes or of a media type other than JSON. Bodies may be sent in any
+// of the given content encodings, and are decoded before being checked
+// against maxBytes.
+func MiddlewareBody(maxBytes int64, contentEncodings ...string) MiddlewareFunc {
+	return func(w http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
+		switch r.Method {
+		case http.MethodPatch, http.MethodPost, http.MethodPut:
+			var reader io.Reader = http.MaxBytesReader(w, r.Body, maxBytes)
+
+			contentEncoding := strings.ToLower(strings.TrimSpace(r.Header.Get("Content-Encoding")))
+			if contentEncoding != "" && contentEncoding != "identity" {
+				decoder, ok := contentDecoders[contentEncoding]
+				if !ok || !slices.ContainsFunc(contentEncodings, func(e string) bool { return strings.EqualFold(e, contentEncoding) }) {
+					arm.WriteError(
+						w, http.StatusUnsupportedMediaType,
+						arm.CloudErrorCodeUnsupportedMediaType, "",
+						"The content encoding '%s' is not supported. Supported encodings are '%s'.",
+						r.Header.Get("Content-Encoding"), strings.Join(append([]string{"identity"}, contentEncodings...), ","))
+					return
+				}
+				var err error
+				reader, err = decoder(reader)
+				if err != nil {
+					arm.WriteError(
+						w, http.StatusBadRequest,
+						arm.CloudErrorCodeInvalidResource, "",
+						"The resource definition is invalid.")
+					return
+				}
+			}
 
-		contentType := strings.SplitN(r.Header.Get("Content-Type"), ";", 2)[0]
+			// The decoded body may be much larger than the encoded
+			// body, so its size is limited separately.
+			body, err := io.ReadAll(io.LimitReader(reader, maxBytes+1))
+			var maxBytesError *http.MaxBytesError
+			if errors.As(err, &maxBytesError) || int64(len(body)) > maxBytes {
+				CountRejectedRequest(r.Context(), RejectionReasonTooLarge)
+				arm.WriteError(
+					w, http.StatusRequestEntityTooLarge,
+					arm.CloudErrorCodeRequestEntityTooLarge, "",
+					"The request body exceeds the maximum size of %d bytes.",
+					maxBytes)
+				return
+			} else if err != nil {
+				arm.WriteError(
+					w, http.StatusBadRequest,
+					arm.CloudErrorCodeInvalidResource, "",
+					"The resource definition is invalid.")
+				return
+			}
 
-		if !strings.EqualFold(contentType, "application/json") && !(len(body) == 0 && contentType == "") {
-			arm.WriteError(
-				w, http.StatusUnsupportedMediaType,
-				arm.CloudErrorCodeUnsupportedMediaType, "",
-				"The content media type '%s' is not supported. Only 'application/json' is supported.",
-				r.Header.Get("Content-Type"))
-			return
+			contentType := strings.SplitN(r.Header.Get("Content-Type"), ";", 2)[0]
+
+			if !strings.EqualFold(contentType, "application/json") && !(len(body) == 0 && contentType == "") {
+				arm.WriteError(
+					w, http.StatusUnsupportedMediaType,
+					arm.CloudErrorCodeUnsupportedMediaType, "",
+					"The content media type '%s' is not supported. Only 'application/json' is supported.",
+					r.Header.Get("Content-Type"))
+				return
+			}
+
+			ctx := ContextWithBody(r.Context(), body)
+			r = r.WithContext(ctx)
 		}
 
-		ctx := ContextWithBody(r.Context(), body)
-		r = r.WithContext(ctx)
+		next(w, r)
 	}
-
-	next(w, r)
 }
@@ -5,11 +5,15 @@ package frontend
 
 import (
 	"bytes"
+	"compress/gzip"
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/Azure/ARO-HCP/internal/api"
 	"github.com/Azure/ARO-HCP/internal/api/arm"
 )
 
@@ -29,7 +33,15 @@ func TestMiddlewareBody(t *testing.T) {
 			name:    "large body",
 			methods: []string{http.MethodPatch, http.MethodPost, http.MethodPut},
 			body:    bytes.Repeat([]byte{0}, int(5*megabyte)),
-			wantErr: "400: InvalidResource: The resource definition is invalid.",
+			wantErr: "413: RequestEntityTooLarge: The request body exceeds the maximum size of 4194304 bytes.",
+		},
+		{
+			name:    "body at the limit",
+			methods: []string{http.MethodPatch, http.MethodPost, http.MethodPut},
+			header: http.Header{
+				"Content-Type": []string{"application/json"},
+			},
+			body: bytes.Repeat([]byte{0}, int(4*megabyte)),
 		},
 		{
 			name:    "invalid media type",
@@ -90,7 +102,7 @@ func TestMiddlewareBody(t *testing.T) {
 					w.WriteHeader(http.StatusOK)
 				}
 
-				MiddlewareBody(writer, request, next)
+				MiddlewareBody(4*megabyte)(writer, request, next)
 
 				if tt.wantErr == "" {
 					if writer.Code != http.StatusOK {
@@ -126,3 +138,183 @@ func TestMiddlewareBody(t *testing.T) {
 		}
 	}
 }
+
+func TestMiddlewareBodyContentEncoding(t *testing.T) {
+	const maxBytes = 1024
+
+	gzipped := func(body []byte) []byte {
+		var buf bytes.Buffer
+		writer := gzip.NewWriter(&buf)
+		if _, err := writer.Write(body); err != nil {
+			t.Fatal(err)
+		}
+		if err := writer.Close(); err != nil {
+			t.Fatal(err)
+		}
+		return buf.Bytes()
+	}
+
+	body := []byte(`{"state":"Registered"}`)
+
+	tests := []struct {
+		name               string
+		contentEncoding    string
+		contentEncodings   []string
+		body               []byte
+		expectedStatusCode int
+		expectedBody       []byte
+	}{
+		{
+			name:               "Identity encoding",
+			contentEncoding:    "identity",
+			body:               body,
+			expectedStatusCode: http.StatusOK,
+			expectedBody:       body,
+		},
+		{
+			name:               "Gzip encoding",
+			contentEncoding:    "gzip",
+			contentEncodings:   []string{"gzip"},
+			body:               gzipped(body),
+			expectedStatusCode: http.StatusOK,
+			expectedBody:       body,
+		},
+		{
+			name:               "Upper-case gzip encoding",
+			contentEncoding:    "GZIP",
+			contentEncodings:   []string{"gzip"},
+			body:               gzipped(body),
+			expectedStatusCode: http.StatusOK,
+			expectedBody:       body,
+		},
+		{
+			name:               "Gzip encoding not allowed",
+			contentEncoding:    "gzip",
+			body:               gzipped(body),
+			expectedStatusCode: http.StatusUnsupportedMediaType,
+		},
+		{
+			name:               "Unsupported encoding",
+			contentEncoding:    "br",
+			contentEncodings:   []string{"gzip"},
+			body:               body,
+			expectedStatusCode: http.StatusUnsupportedMediaType,
+		},
+		{
+			name:               "Decoded body exceeds the limit",
+			contentEncoding:    "gzip",
+			contentEncodings:   []string{"gzip"},
+			body:               gzipped(bytes.Repeat([]byte{' '}, maxBytes+1)),
+			expectedStatusCode: http.StatusRequestEntityTooLarge,
+		},
+		{
+			name:               "Malformed gzip body",
+			contentEncoding:    "gzip",
+			contentEncodings:   []string{"gzip"},
+			body:               body,
+			expectedStatusCode: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			writer := httptest.NewRecorder()
+
+			request := httptest.NewRequest(http.MethodPut, "/", bytes.NewReader(tt.body))
+			request.Header.Set("Content-Type", "application/json")
+			request.Header.Set("Content-Encoding", tt.contentEncoding)
+
+			next := func(w http.ResponseWriter, r *http.Request) {
+				request = r // capture modified request
+				w.WriteHeader(http.StatusOK)
+			}
+
+			MiddlewareBody(maxBytes, tt.contentEncodings...)(writer, request, next)
+
+			if writer.Code != tt.expectedStatusCode {
+				t.Fatalf("expected status code %d, got %d: %s", tt.expectedStatusCode, writer.Code, writer.Body.String())
+			}
+
+			if tt.expectedBody != nil {
+				body, err := BodyFromContext(request.Context())
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !bytes.Equal(body, tt.expectedBody) {
+					t.Errorf("expected body %q, got %q", tt.expectedBody, body)
+				}
+			}
+		})
+	}
+}
+
+func TestMaxBodyBytesEnforced(t *testing.T) {
+	const maxBodyBytes = 1024
+
+	f, ts := newTestListServer(t)
+	f.config.MaxBodyBytes = maxBodyBytes
+
+	// Rebuild the routes as NewFrontend does.
+	ts.Config.Handler = f.routes()
+
+	subscription, err := json.Marshal(arm.Subscription{
+		State:            arm.SubscriptionStateRegistered,
+		RegistrationDate: api.Ptr(time.Now().String()),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Pad the subscription with whitespace to the given size.
+	padded := func(size int) []byte {
+		return append(subscription, strings.Repeat(" ", size-len(subscription))...)
+	}
+
+	tests := []struct {
+		name               string
+		body               []byte
+		expectedStatusCode int
+	}{
+		{
+			name:               "Body just under the limit",
+			body:               padded(maxBodyBytes - 1),
+			expectedStatusCode: http.StatusOK,
+		},
+		{
+			name:               "Oversized body",
+			body:               padded(maxBodyBytes + 1),
+			expectedStatusCode: http.StatusRequestEntityTooLarge,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodPut, ts.URL+"/subscriptions/"+dummySubscrtiptionId+"?api-version=2.0", bytes.NewReader(test.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.Header.Set("Content-Type", "application/json")
+
+			rs, err := ts.Client().Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer rs.Body.Close()
+
+			if rs.StatusCode != test.expectedStatusCode {
+				t.Fatalf("expected status code %d, got %d", test.expectedStatusCode, rs.StatusCode)
+			}
+
+			if rs.StatusCode == http.StatusRequestEntityTooLarge {
+				var cloudError arm.CloudError
+				err = json.NewDecoder(rs.Body).Decode(&cloudError)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if cloudError.CloudErrorBody == nil || cloudError.Code != arm.CloudErrorCodeRequestEntityTooLarge {
+					t.Errorf("expected error code %s, got %+v", arm.CloudErrorCodeRequestEntityTooLarge, cloudError.CloudErrorBody)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,131 @@
+package frontend
+
+// Copyright (c) Microsoft Corporation.
+// Licensed under the Apache License 2.0.
+
+import (
+	"context"
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/Azure/ARO-HCP/internal/api/arm"
+	"github.com/Azure/ARO-HCP/internal/database"
+)
+
+// circuitBreaker stops the frontend from sending requests to a database
+// that keeps failing. After threshold consecutive failures the breaker
+// opens, and requests are turned away until the cooldown elapses, giving
+// the database room to recover. The first failure after the breaker
+// closes again opens it for another cooldown.
+type circuitBreaker struct {
+	threshold int
+	cooldown  time.Duration
+
+	mutex     sync.Mutex
+	failures  int
+	openUntil time.Time
+	probing   bool
+}
+
+// newCircuitBreaker returns a circuit breaker that opens for cooldown
+// after threshold consecutive database failures.
+func newCircuitBreaker(threshold int, cooldown time.Duration) *circuitBreaker {
+	return &circuitBreaker{
+		threshold: threshold,
+		cooldown:  cooldown,
+	}
+}
+
+// record counts the outcome of a database call. A missing document is
+// a successful call, and a call abandoned by the client is not counted.
+func (b *circuitBreaker) record(err error, now time.Time) {
+	if errors.Is(err, context.Canceled) {
+		return
+	}
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if err == nil || errors.Is(err, database.ErrNotFound) {
+		b.failures = 0
+		b.probing = false
+		return
+	}
+
+	b.failures++
+	if b.probing || b.failures >= b.threshold {
+		b.openUntil = now.Add(b.cooldown)
+		b.failures = 0
+		b.probing = false
+	}
+}
+
+// retryAfter returns how long until the breaker closes,
+// or zero if the breaker is closed.
+func (b *circuitBreaker) retryAfter(now time.Time) time.Duration {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if b.openUntil.IsZero() {
+		return 0
+	}
+	if now.Before(b.openUntil) {
+		return b.openUntil.Sub(now)
+	}
+
+	// The cooldown elapsed, so let requests through
+	// to find out whether the database recovered.
+	b.openUntil = time.Time{}
+	b.probing = true
+	return 0
+}
+
+// Middleware rejects requests with "503 Service Unavailable" and a
+// Retry-After header saying when the breaker closes while the breaker
+// is open, except for health checks, which report the database state
+// themselves. Other requests watch their subscription lookup, which
+// every request needing the database makes first.
+func (b *circuitBreaker) Middleware(w http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
+	if r.URL.Path == "/healthz" || r.URL.Path == "/healthz/live" {
+		next(w, r)
+		return
+	}
+
+	ctx := r.Context()
+
+	if wait := b.retryAfter(time.Now()); wait > 0 {
+		LoggerFromContext(ctx).Warn("Rejecting request while the database circuit breaker is open")
+
+		// Retry-After is in whole seconds, so round up.
+		retryAfter := int(math.Ceil(wait.Seconds()))
+		w.Header().Set("Retry-After", strconv.Itoa(max(retryAfter, 1)))
+		arm.WriteError(
+			w, http.StatusServiceUnavailable,
+			arm.CloudErrorCodeServiceUnavailable, "",
+			"The service is temporarily unavailable. Please retry the request later.")
+		return
+	}
+
+	if dbClient, err := DBClientFromContext(ctx); err == nil {
+		r = r.WithContext(ContextWithDBClient(ctx, &circuitBreakerDBClient{DBClient: dbClient, breaker: b}))
+	}
+
+	next(w, r)
+}
+
+// circuitBreakerDBClient reports the outcome of subscription
+// lookups to a circuit breaker.
+type circuitBreakerDBClient struct {
+	database.DBClient
+	breaker *circuitBreaker
+}
+
+func (c *circuitBreakerDBClient) GetSubscriptionDoc(ctx context.Context, subscriptionID string) (*database.SubscriptionDocument, error) {
+	doc, err := c.DBClient.GetSubscriptionDoc(ctx, subscriptionID)
+	c.breaker.record(err, time.Now())
+	return doc, err
+}
@@ -0,0 +1,143 @@
+package frontend
+
+// Copyright (c) Microsoft Corporation.
+// Licensed under the Apache License 2.0.
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/Azure/ARO-HCP/internal/api"
+	"github.com/Azure/ARO-HCP/internal/api/arm"
+	"github.com/Azure/ARO-HCP/internal/database"
+)
+
+// failingSubscriptionDBClient fails subscription lookups.
+type failingSubscriptionDBClient struct {
+	database.DBClient
+}
+
+func (c *failingSubscriptionDBClient) GetSubscriptionDoc(ctx context.Context, subscriptionID string) (*database.SubscriptionDocument, error) {
+	return nil, errors.New("database unavailable")
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	breaker := newCircuitBreaker(2, time.Minute)
+	failure := errors.New("database unavailable")
+	now := time.Now()
+
+	// A success resets the count of consecutive failures.
+	breaker.record(failure, now)
+	breaker.record(nil, now)
+	breaker.record(failure, now)
+	if wait := breaker.retryAfter(now); wait != 0 {
+		t.Fatalf("expected the breaker to be closed, got a wait of %s", wait)
+	}
+
+	// Neither missing documents nor cancelled requests are failures.
+	breaker.record(database.ErrNotFound, now)
+	breaker.record(failure, now)
+	breaker.record(context.Canceled, now)
+	if wait := breaker.retryAfter(now); wait != 0 {
+		t.Fatalf("expected the breaker to be closed, got a wait of %s", wait)
+	}
+
+	breaker.record(failure, now)
+	if wait := breaker.retryAfter(now.Add(15 * time.Second)); wait != 45*time.Second {
+		t.Fatalf("expected to wait %s, got %s", 45*time.Second, wait)
+	}
+
+	// Once the cooldown elapses a single failure opens the breaker again.
+	if wait := breaker.retryAfter(now.Add(time.Minute)); wait != 0 {
+		t.Fatalf("expected the breaker to be closed, got a wait of %s", wait)
+	}
+	breaker.record(failure, now.Add(time.Minute))
+	if wait := breaker.retryAfter(now.Add(time.Minute)); wait != time.Minute {
+		t.Fatalf("expected to wait %s, got %s", time.Minute, wait)
+	}
+
+	// A success after the cooldown keeps the breaker closed.
+	breaker.retryAfter(now.Add(2 * time.Minute))
+	breaker.record(nil, now.Add(2*time.Minute))
+	breaker.record(failure, now.Add(2*time.Minute))
+	if wait := breaker.retryAfter(now.Add(2 * time.Minute)); wait != 0 {
+		t.Errorf("expected the breaker to be closed, got a wait of %s", wait)
+	}
+}
+
+func TestMiddlewareCircuitBreaker(t *testing.T) {
+	const threshold = 3
+
+	f := &Frontend{
+		dbClient: database.NewCache(),
+		metrics:  NewPrometheusEmitter(prometheus.NewRegistry()),
+		config: Config{
+			DBCircuitBreakerThreshold: threshold,
+			DBCircuitBreakerCooldown:  time.Minute,
+		},
+	}
+	f.ready.Store(true)
+
+	ts := httptest.NewUnstartedServer(f.routes())
+	ts.Config.BaseContext = func(net.Listener) context.Context {
+		ctx := context.Background()
+		ctx = ContextWithLogger(ctx, testLogger)
+		ctx = ContextWithDBClient(ctx, &failingSubscriptionDBClient{DBClient: f.dbClient})
+		return ctx
+	}
+	ts.Start()
+	defer ts.Close()
+
+	get := func(path string) *http.Response {
+		t.Helper()
+
+		rs, err := ts.Client().Get(ts.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { rs.Body.Close() })
+		return rs
+	}
+
+	clusterListPath := "/subscriptions/" + dummySubscrtiptionId + "/providers/" + api.ProviderNamespace + "/" + api.ClusterResourceTypeName + "?api-version=2024-06-10-preview"
+
+	for i := range threshold {
+		if rs := get(clusterListPath); rs.StatusCode != http.StatusInternalServerError {
+			t.Fatalf("expected request %d to fail with status code %d, got %d", i+1, http.StatusInternalServerError, rs.StatusCode)
+		}
+	}
+
+	// The breaker is open for every route but health checks.
+	for _, path := range []string{
+		clusterListPath,
+		"/subscriptions/" + dummySubscrtiptionId + "?api-version=2.0",
+	} {
+		rs := get(path)
+		if rs.StatusCode != http.StatusServiceUnavailable {
+			t.Fatalf("expected status code %d for %s, got %d", http.StatusServiceUnavailable, path, rs.StatusCode)
+		}
+		if retryAfter, err := strconv.Atoi(rs.Header.Get("Retry-After")); err != nil || retryAfter < 1 || retryAfter > 60 {
+			t.Errorf("expected a Retry-After within the cooldown, got %q", rs.Header.Get("Retry-After"))
+		}
+		var cloudError arm.CloudError
+		if err := json.NewDecoder(rs.Body).Decode(&cloudError); err != nil {
+			t.Fatal(err)
+		}
+		if cloudError.CloudErrorBody == nil || cloudError.Code != arm.CloudErrorCodeServiceUnavailable {
+			t.Errorf("expected error code %s, got %+v", arm.CloudErrorCodeServiceUnavailable, cloudError.CloudErrorBody)
+		}
+	}
+
+	if rs := get("/healthz/live"); rs.StatusCode != http.StatusOK {
+		t.Errorf("expected /healthz/live status code %d, got %d", http.StatusOK, rs.StatusCode)
+	}
+}
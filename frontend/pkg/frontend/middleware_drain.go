@@ -0,0 +1,97 @@
+package frontend
+
+// Copyright (c) Microsoft Corporation.
+// Licensed under the Apache License 2.0.
+
+import (
+	"context"
+	"net/http"
+	"sync"
+
+	"github.com/Azure/ARO-HCP/internal/api/arm"
+)
+
+// requestTracker counts in-flight requests so that a shutting down
+// frontend can let them finish while turning new requests away.
+type requestTracker struct {
+	// mutex orders drain against new requests
+	// so none are added once waiting begins.
+	mutex    sync.Mutex
+	draining bool
+	inFlight sync.WaitGroup
+
+	// drainStarted is closed by drain. It is created on first
+	// use so that the zero requestTracker is ready to use.
+	drainStarted chan struct{}
+}
+
+// Middleware tracks each request until it completes. Once draining, new
+// requests are rejected with "503 Service Unavailable", except for health
+// checks, which report the frontend's readiness and liveness.
+func (t *requestTracker) Middleware(w http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
+	t.mutex.Lock()
+	if t.draining {
+		t.mutex.Unlock()
+		// Health checks are not tracked, since
+		// they need not finish before shutdown.
+		if r.URL.Path == "/healthz" || r.URL.Path == "/healthz/live" {
+			next(w, r)
+			return
+		}
+		arm.WriteError(
+			w, http.StatusServiceUnavailable,
+			arm.CloudErrorCodeServiceUnavailable, "",
+			"The service is shutting down. Please retry the request.")
+		return
+	}
+	t.inFlight.Add(1)
+	t.mutex.Unlock()
+
+	defer t.inFlight.Done()
+	next(w, r)
+}
+
+// drain stops the tracker from admitting new requests.
+func (t *requestTracker) drain() {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if t.draining {
+		return
+	}
+	t.draining = true
+	if t.drainStarted == nil {
+		t.drainStarted = make(chan struct{})
+	}
+	close(t.drainStarted)
+}
+
+// drained returns a channel that is closed once draining starts, so
+// that long-lived requests like event streams can end without holding
+// up shutdown.
+func (t *requestTracker) drained() <-chan struct{} {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if t.drainStarted == nil {
+		t.drainStarted = make(chan struct{})
+	}
+	return t.drainStarted
+}
+
+// wait blocks until every in-flight request completes or ctx is done,
+// in which case it returns the context's error.
+func (t *requestTracker) wait(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		t.inFlight.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,150 @@
+package frontend
+
+// Copyright (c) Microsoft Corporation.
+// Licensed under the Apache License 2.0.
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/Azure/ARO-HCP/internal/api"
+	"github.com/Azure/ARO-HCP/internal/api/arm"
+	"github.com/Azure/ARO-HCP/internal/database"
+	"github.com/Azure/ARO-HCP/internal/ocm"
+)
+
+// slowDBClient blocks subscription document creation until released.
+type slowDBClient struct {
+	database.DBClient
+	entered chan struct{}
+	release chan struct{}
+}
+
+func (c *slowDBClient) CreateSubscriptionDoc(ctx context.Context, doc *database.SubscriptionDocument) error {
+	close(c.entered)
+	<-c.release
+	return c.DBClient.CreateSubscriptionDoc(ctx, doc)
+}
+
+func TestShutdownDrainsInFlightRequests(t *testing.T) {
+	const subscriptionID = "00000000-0000-0000-0000-000000000000"
+
+	dbClient := &slowDBClient{
+		DBClient: database.NewCache(),
+		entered:  make(chan struct{}),
+		release:  make(chan struct{}),
+	}
+
+	listener, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	metricsListener, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mockCSClient := ocm.NewMockClusterServiceClient()
+
+	config := DefaultConfig()
+	config.Location = dummyLocation
+
+	f, err := NewFrontend(config, testLogger, listener, metricsListener, NewPrometheusEmitter(prometheus.NewRegistry()), dbClient, &mockCSClient)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	go f.Run(context.Background(), nil)
+
+	baseURL := "http://" + listener.Addr().String()
+	subscriptionURL := baseURL + "/subscriptions/" + subscriptionID + "?api-version=2.0"
+
+	// Start a subscription PUT that blocks while writing to the database.
+	body, err := json.Marshal(&arm.Subscription{
+		State:            arm.SubscriptionStateRegistered,
+		RegistrationDate: api.Ptr(time.Now().String()),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	putStatus := make(chan int, 1)
+	go func() {
+		req, err := http.NewRequest(http.MethodPut, subscriptionURL, bytes.NewReader(body))
+		if err != nil {
+			putStatus <- 0
+			return
+		}
+		req.Header.Set("Content-Type", "application/json")
+		rs, err := http.DefaultClient.Do(req)
+		if err != nil {
+			putStatus <- 0
+			return
+		}
+		rs.Body.Close()
+		putStatus <- rs.StatusCode
+	}()
+
+	select {
+	case <-dbClient.entered:
+	case <-time.After(10 * time.Second):
+		t.Fatal("timed out waiting for the request to reach the database")
+	}
+
+	shutdownErr := make(chan error, 1)
+	go func() {
+		shutdownErr <- f.Shutdown(context.Background())
+	}()
+
+	get := func(url string) int {
+		t.Helper()
+
+		rs, err := http.Get(url)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rs.Body.Close()
+		return rs.StatusCode
+	}
+
+	// New requests are turned away once draining begins.
+	deadline := time.Now().Add(10 * time.Second)
+	for get(subscriptionURL) != http.StatusServiceUnavailable {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for new requests to be rejected")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if status := get(baseURL + "/healthz"); status != http.StatusInternalServerError {
+		t.Errorf("expected /healthz status code %d while draining, got %d", http.StatusInternalServerError, status)
+	}
+	if status := get(baseURL + "/healthz/live"); status != http.StatusOK {
+		t.Errorf("expected /healthz/live status code %d while draining, got %d", http.StatusOK, status)
+	}
+
+	// The in-flight request is allowed to finish.
+	close(dbClient.release)
+
+	if status := <-putStatus; status != http.StatusOK {
+		t.Errorf("expected in-flight request status code %d, got %d", http.StatusOK, status)
+	}
+
+	if err := <-shutdownErr; err != nil {
+		t.Errorf("expected a clean shutdown, got %v", err)
+	}
+	f.Join()
+
+	_, err = dbClient.GetSubscriptionDoc(context.Background(), subscriptionID)
+	if err != nil {
+		t.Errorf("expected the in-flight request to write the subscription document: %v", err)
+	}
+}
@@ -0,0 +1,42 @@
+package frontend
+
+// Copyright (c) Microsoft Corporation.
+// Licensed under the Apache License 2.0.
+
+import (
+	"net/http"
+
+	"github.com/Azure/ARO-HCP/internal/api/arm"
+)
+
+// headerSize returns the approximate size of the request line and
+// headers as they appeared on the wire.
+func headerSize(r *http.Request) int {
+	size := len(r.Method) + len(r.RequestURI) + len(r.Proto) + 4
+	for name, values := range r.Header {
+		for _, value := range values {
+			// Account for the ": " separator and the trailing CRLF.
+			size += len(name) + len(value) + 4
+		}
+	}
+	return size
+}
+
+// MiddlewareHeaderSize returns a middleware function that rejects requests
+// whose headers exceed maxBytes in total, such as those carrying oversized
+// tokens, before they reach any further request handling.
+func MiddlewareHeaderSize(maxBytes int) MiddlewareFunc {
+	return func(w http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
+		if headerSize(r) > maxBytes {
+			CountRejectedRequest(r.Context(), RejectionReasonTooLarge)
+			arm.WriteError(
+				w, http.StatusRequestHeaderFieldsTooLarge,
+				arm.CloudErrorCodeHeadersTooLarge, "",
+				"The request headers exceed the maximum size of %d bytes.",
+				maxBytes)
+			return
+		}
+
+		next(w, r)
+	}
+}
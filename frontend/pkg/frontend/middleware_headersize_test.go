@@ -0,0 +1,150 @@
+package frontend
+
+// Copyright (c) Microsoft Corporation.
+// Licensed under the Apache License 2.0.
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/Azure/ARO-HCP/internal/api"
+	"github.com/Azure/ARO-HCP/internal/api/arm"
+)
+
+func TestMiddlewareHeaderSize(t *testing.T) {
+	const maxBytes = 1024
+
+	tests := []struct {
+		name    string
+		header  http.Header
+		wantErr string
+	}{
+		{
+			name: "small headers",
+			header: http.Header{
+				"Authorization": []string{"Bearer token"},
+			},
+		},
+		{
+			name: "oversized header",
+			header: http.Header{
+				"Authorization": []string{"Bearer " + strings.Repeat("x", maxBytes)},
+			},
+			wantErr: "431: RequestHeaderFieldsTooLarge: The request headers exceed the maximum size of 1024 bytes.",
+		},
+		{
+			name: "many headers exceeding the total",
+			header: http.Header{
+				"X-First":  []string{strings.Repeat("x", maxBytes/2)},
+				"X-Second": []string{strings.Repeat("x", maxBytes/2)},
+			},
+			wantErr: "431: RequestHeaderFieldsTooLarge: The request headers exceed the maximum size of 1024 bytes.",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			writer := httptest.NewRecorder()
+
+			request := httptest.NewRequest(http.MethodGet, "/", nil)
+			request.Header = tt.header
+
+			var called bool
+			next := func(w http.ResponseWriter, r *http.Request) {
+				called = true
+				w.WriteHeader(http.StatusOK)
+			}
+
+			MiddlewareHeaderSize(maxBytes)(writer, request, next)
+
+			if tt.wantErr == "" {
+				if !called || writer.Code != http.StatusOK {
+					t.Errorf("expected the request to pass, got status code %d", writer.Code)
+				}
+				return
+			}
+
+			if called {
+				t.Error("expected the request to be rejected before the next handler")
+			}
+
+			var cloudErr *arm.CloudError
+			err := json.Unmarshal(writer.Body.Bytes(), &cloudErr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			cloudErr.StatusCode = writer.Code
+
+			if tt.wantErr != cloudErr.Error() {
+				t.Error(cloudErr)
+			}
+		})
+	}
+}
+
+func TestMaxHeaderBytesEnforced(t *testing.T) {
+	f, ts := newTestListServer(t)
+	f.config.MaxHeaderBytes = 4096
+
+	tests := []struct {
+		name               string
+		headerSize         int
+		expectedStatusCode int
+		expectCloudError   bool
+	}{
+		{
+			name:               "Within the limit",
+			headerSize:         1024,
+			expectedStatusCode: http.StatusOK,
+		},
+		{
+			name:               "Over the limit",
+			headerSize:         6144,
+			expectedStatusCode: http.StatusRequestHeaderFieldsTooLarge,
+			expectCloudError:   true,
+		},
+		{
+			name:               "Far over the server limit",
+			headerSize:         64 << 10,
+			expectedStatusCode: http.StatusRequestHeaderFieldsTooLarge,
+		},
+	}
+
+	// Rebuild the routes and size the server as NewFrontend does.
+	ts.Config.Handler = f.routes()
+	ts.Config.MaxHeaderBytes = 2 * f.config.MaxHeaderBytes
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			request, err := http.NewRequest(http.MethodGet, ts.URL+"/providers/"+api.ProviderNamespace+"?api-version=2.0", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			request.Header.Set("Authorization", "Bearer "+strings.Repeat("x", test.headerSize))
+
+			rs, err := ts.Client().Do(request)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer rs.Body.Close()
+
+			if rs.StatusCode != test.expectedStatusCode {
+				t.Fatalf("expected status code %d, got %d", test.expectedStatusCode, rs.StatusCode)
+			}
+
+			if test.expectCloudError {
+				var cloudErr *arm.CloudError
+				err = json.NewDecoder(rs.Body).Decode(&cloudErr)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if cloudErr.Code != arm.CloudErrorCodeHeadersTooLarge {
+					t.Errorf("expected error code %s, got %s", arm.CloudErrorCodeHeadersTooLarge, cloudErr.Code)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,74 @@
+package frontend
+
+// Copyright (c) Microsoft Corporation.
+// Licensed under the Apache License 2.0.
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/Azure/ARO-HCP/internal/api/arm"
+)
+
+// parseIdentityURL returns the managed identity URL in value if it is a
+// well-formed HTTPS URL whose host has one of the allowed suffixes.
+func parseIdentityURL(value string, allowedHostSuffixes []string) (*url.URL, bool) {
+	u, err := url.Parse(value)
+	if err != nil || !strings.EqualFold(u.Scheme, "https") || u.Hostname() == "" {
+		return nil, false
+	}
+
+	hostname := strings.ToLower(u.Hostname())
+	for _, suffix := range allowedHostSuffixes {
+		suffix = strings.ToLower(strings.TrimPrefix(suffix, "."))
+		if hostname == suffix || strings.HasSuffix(hostname, "."+suffix) {
+			return u, true
+		}
+	}
+
+	return nil, false
+}
+
+// MiddlewareValidateIdentityURL returns a middleware function that requires
+// the HeaderNameIdentityURL header ARM passes with the managed identity
+// credentials of a cluster, and stores the validated URL in the request
+// context. An empty list of allowed host suffixes disables the validation,
+// for environments where requests do not come through ARM.
+func MiddlewareValidateIdentityURL(allowedHostSuffixes []string) MiddlewareFunc {
+	return func(w http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
+		if len(allowedHostSuffixes) == 0 {
+			next(w, r)
+			return
+		}
+
+		value := r.Header.Get(arm.HeaderNameIdentityURL)
+		if value == "" {
+			arm.WriteError(
+				w, http.StatusBadRequest,
+				arm.CloudErrorCodeMissingIdentityURL, "",
+				"The request is missing the %s header.",
+				arm.HeaderNameIdentityURL)
+			return
+		}
+
+		identityURL, ok := parseIdentityURL(value, allowedHostSuffixes)
+		if !ok {
+			// The URL carries credentials in its query, so log only the host.
+			message := "Rejecting malformed " + arm.HeaderNameIdentityURL + " header"
+			if u, err := url.Parse(value); err == nil && u.Host != "" {
+				message += " for host " + u.Host
+			}
+			LoggerFromContext(r.Context()).Info(message)
+			arm.WriteError(
+				w, http.StatusBadRequest,
+				arm.CloudErrorCodeMissingIdentityURL, "",
+				"The %s header must be an HTTPS URL of an allowed managed identity host.",
+				arm.HeaderNameIdentityURL)
+			return
+		}
+
+		r = r.WithContext(ContextWithIdentityURL(r.Context(), identityURL))
+		next(w, r)
+	}
+}
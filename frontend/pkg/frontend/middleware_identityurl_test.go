@@ -0,0 +1,157 @@
+package frontend
+
+// Copyright (c) Microsoft Corporation.
+// Licensed under the Apache License 2.0.
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/Azure/ARO-HCP/internal/api/arm"
+)
+
+func TestMiddlewareValidateIdentityURL(t *testing.T) {
+	allowedHostSuffixes := []string{"identity.azure.net"}
+
+	tests := []struct {
+		name                string
+		identityURL         string
+		allowedHostSuffixes []string
+		expectedStatusCode  int
+	}{
+		{
+			name:                "Valid identity URL",
+			identityURL:         "https://control-eastus.identity.azure.net/subscriptions/00000000-0000-0000-0000-000000000000/credentials?tid=1",
+			allowedHostSuffixes: allowedHostSuffixes,
+			expectedStatusCode:  http.StatusOK,
+		},
+		{
+			name:                "Host matches suffix in another case",
+			identityURL:         "https://Control-EastUS.Identity.Azure.Net/credentials",
+			allowedHostSuffixes: allowedHostSuffixes,
+			expectedStatusCode:  http.StatusOK,
+		},
+		{
+			name:                "Missing header",
+			identityURL:         "",
+			allowedHostSuffixes: allowedHostSuffixes,
+			expectedStatusCode:  http.StatusBadRequest,
+		},
+		{
+			name:                "Non-HTTPS URL",
+			identityURL:         "http://control-eastus.identity.azure.net/credentials",
+			allowedHostSuffixes: allowedHostSuffixes,
+			expectedStatusCode:  http.StatusBadRequest,
+		},
+		{
+			name:                "Disallowed host",
+			identityURL:         "https://identity.example.com/credentials",
+			allowedHostSuffixes: allowedHostSuffixes,
+			expectedStatusCode:  http.StatusBadRequest,
+		},
+		{
+			name:                "Host only ends with the suffix text",
+			identityURL:         "https://evilidentity.azure.net/credentials",
+			allowedHostSuffixes: allowedHostSuffixes,
+			expectedStatusCode:  http.StatusBadRequest,
+		},
+		{
+			name:                "Not a URL",
+			identityURL:         "://identity.azure.net",
+			allowedHostSuffixes: allowedHostSuffixes,
+			expectedStatusCode:  http.StatusBadRequest,
+		},
+		{
+			name:                "Validation disabled",
+			identityURL:         "",
+			allowedHostSuffixes: nil,
+			expectedStatusCode:  http.StatusOK,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			writer := httptest.NewRecorder()
+
+			request := httptest.NewRequest(http.MethodPut, "/", nil)
+			request = request.WithContext(ContextWithLogger(request.Context(), testLogger))
+			if test.identityURL != "" {
+				request.Header.Set(arm.HeaderNameIdentityURL, test.identityURL)
+			}
+
+			var called bool
+			next := func(w http.ResponseWriter, r *http.Request) {
+				called = true
+
+				identityURL, err := IdentityURLFromContext(r.Context())
+				if len(test.allowedHostSuffixes) > 0 {
+					if err != nil {
+						t.Error(err)
+					} else if identityURL.String() != test.identityURL {
+						t.Errorf("expected identity URL %s in context, got %s", test.identityURL, identityURL)
+					}
+				}
+
+				w.WriteHeader(http.StatusOK)
+			}
+
+			MiddlewareValidateIdentityURL(test.allowedHostSuffixes)(writer, request, next)
+
+			if writer.Code != test.expectedStatusCode {
+				t.Fatalf("expected status code %d, got %d", test.expectedStatusCode, writer.Code)
+			}
+
+			if test.expectedStatusCode == http.StatusOK {
+				if !called {
+					t.Error("expected the next handler to be called")
+				}
+				return
+			}
+
+			if called {
+				t.Error("expected the request to be rejected before the next handler")
+			}
+
+			var cloudError arm.CloudError
+			err := json.Unmarshal(writer.Body.Bytes(), &cloudError)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if cloudError.CloudErrorBody == nil || cloudError.Code != arm.CloudErrorCodeMissingIdentityURL {
+				t.Errorf("expected error code %s, got %+v", arm.CloudErrorCodeMissingIdentityURL, cloudError.CloudErrorBody)
+			}
+		})
+	}
+}
+
+func TestMiddlewareValidateIdentityURLLogsHostOnly(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&buf, nil))
+
+	writer := httptest.NewRecorder()
+
+	request := httptest.NewRequest(http.MethodPut, "/", nil)
+	request = request.WithContext(ContextWithLogger(request.Context(), logger))
+	request.Header.Set(arm.HeaderNameIdentityURL, "https://identity.example.com/credentials?sig=secret")
+
+	next := func(w http.ResponseWriter, r *http.Request) {
+		t.Error("expected the request to be rejected before the next handler")
+	}
+
+	MiddlewareValidateIdentityURL([]string{"identity.azure.net"})(writer, request, next)
+
+	if writer.Code != http.StatusBadRequest {
+		t.Fatalf("expected status code %d, got %d", http.StatusBadRequest, writer.Code)
+	}
+	if !strings.Contains(buf.String(), "identity.example.com") {
+		t.Errorf("expected the host to be logged, got %q", buf.String())
+	}
+	if strings.Contains(buf.String(), "secret") || strings.Contains(buf.String(), "/credentials") {
+		t.Errorf("expected only the host to be logged, got %q", buf.String())
+	}
+}
@@ -8,6 +8,7 @@ import (
 	"io"
 	"log/slog"
 	"net/http"
+	"strconv"
 	"strings"
 	"time"
 
@@ -15,6 +16,11 @@ import (
 	"github.com/Azure/ARO-HCP/internal/api/arm"
 )
 
+// HeaderNameProcessingTime is the response header reporting how many
+// milliseconds the server spent on the request before responding, which
+// lets clients tell server slowness apart from network latency.
+const HeaderNameProcessingTime = "X-Aro-Processing-Time-Ms"
+
 type LoggingReadCloser struct {
 	io.ReadCloser
 	bytesRead int
@@ -30,28 +36,46 @@ type LoggingResponseWriter struct {
 	http.ResponseWriter
 	statusCode   int
 	bytesWritten int
+
+	// startTime, if set, is when the request was received
+	// and is used to report the processing time.
+	startTime   time.Time
+	wroteHeader bool
 }
 
 func (w *LoggingResponseWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
 	n, err := w.ResponseWriter.Write(b)
 	w.bytesWritten += n
 	return n, err
 }
 
 func (w *LoggingResponseWriter) WriteHeader(statusCode int) {
+	if !w.wroteHeader && !w.startTime.IsZero() {
+		processingTime := time.Since(w.startTime).Milliseconds()
+		w.Header().Set(HeaderNameProcessingTime, strconv.FormatInt(processingTime, 10))
+	}
+	w.wroteHeader = true
 	w.ResponseWriter.WriteHeader(statusCode)
 	w.statusCode = statusCode
 }
 
+// Unwrap returns the underlying ResponseWriter for http.ResponseController.
+func (w *LoggingResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
 func MiddlewareLogging(w http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
 	ctx := r.Context()
 	logger := LoggerFromContext(ctx)
 
+	startTime := time.Now()
+
 	// Capture request and response data for logging
 	r.Body = &LoggingReadCloser{ReadCloser: r.Body}
-	w = &LoggingResponseWriter{ResponseWriter: w, statusCode: http.StatusOK}
-
-	startTime := time.Now()
+	w = &LoggingResponseWriter{ResponseWriter: w, statusCode: http.StatusOK, startTime: startTime}
 
 	logger = logger.With(
 		"request_method", r.Method,
@@ -65,6 +89,12 @@ func MiddlewareLogging(w http.ResponseWriter, r *http.Request, next http.Handler
 
 	next(w, r)
 
+	// Report the processing time even if
+	// the handler wrote no response at all.
+	if !w.(*LoggingResponseWriter).wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+
 	logger.Info("send response",
 		"body_read_bytes", r.Body.(*LoggingReadCloser).bytesRead,
 		"body_written_bytes", w.(*LoggingResponseWriter).bytesWritten,
@@ -98,6 +128,11 @@ func setHeaders(w http.ResponseWriter, r *http.Request, correlationData *arm.Cor
 
 	w.Header().Set(arm.HeaderNameRequestID, correlationData.RequestID.String())
 
+	// Echoing the correlation request ID also lets error responses include it.
+	if correlationData.CorrelationRequestID != "" {
+		w.Header().Set(arm.HeaderNameCorrelationRequestID, correlationData.CorrelationRequestID)
+	}
+
 	returnClientRequestId := r.Header.Get(arm.HeaderNameReturnClientRequestID)
 	if strings.EqualFold(returnClientRequestId, "true") {
 		w.Header().Set(arm.HeaderNameClientRequestID, correlationData.ClientRequestID)
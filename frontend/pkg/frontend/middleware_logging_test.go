@@ -6,6 +6,7 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"reflect"
+	"strconv"
 	"testing"
 	"time"
 
@@ -70,6 +71,56 @@ func TestMiddlewareLoggingPostMux(t *testing.T) {
 
 }
 
+func TestMiddlewareLoggingProcessingTime(t *testing.T) {
+	tests := []struct {
+		name               string
+		handler            http.HandlerFunc
+		expectedStatusCode int
+	}{
+		{
+			name: "Explicit status code",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusAccepted)
+			},
+			expectedStatusCode: http.StatusAccepted,
+		},
+		{
+			name: "Implicit status code on write",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				_, _ = w.Write([]byte("{}"))
+			},
+			expectedStatusCode: http.StatusOK,
+		},
+		{
+			name:               "No response written",
+			handler:            func(w http.ResponseWriter, r *http.Request) {},
+			expectedStatusCode: http.StatusOK,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			request := httptest.NewRequest(http.MethodGet, "/", nil)
+			request = request.WithContext(ContextWithLogger(request.Context(), testLogger))
+
+			writer := httptest.NewRecorder()
+			MiddlewareLogging(writer, request, test.handler)
+
+			if writer.Code != test.expectedStatusCode {
+				t.Errorf("expected status code %d, got %d", test.expectedStatusCode, writer.Code)
+			}
+
+			value := writer.Header().Get(HeaderNameProcessingTime)
+			if value == "" {
+				t.Fatalf("expected a %s header", HeaderNameProcessingTime)
+			}
+			if ms, err := strconv.ParseInt(value, 10, 64); err != nil || ms < 0 {
+				t.Errorf("expected a non-negative number of milliseconds, got %q", value)
+			}
+		})
+	}
+}
+
 // ReqPathModifier is an alias to a function that receives a request
 // and it should modify its Path value as needed, for testing purposes.
 type ReqPathModifier func(req *http.Request)
@@ -187,6 +238,7 @@ func Test_getLogAttrs(t *testing.T) {
 func Test_setHeaders(t *testing.T) {
 	var expectedRequestId = uuid.New()
 	const expectedClientRequestId = "the_client_request_id"
+	const expectedCorrelationRequestId = "the_correlation_request_id"
 
 	type testCase struct {
 		name            string
@@ -251,6 +303,19 @@ func Test_setHeaders(t *testing.T) {
 				arm.HeaderNameRequestID: []string{expectedRequestId.String()},
 			},
 		},
+		{
+			name: "should set the correlationRequestId header to the value of correlation data when present",
+			w:    &httptest.ResponseRecorder{},
+			r:    &http.Request{},
+			correlationData: &arm.CorrelationData{
+				RequestID:            expectedRequestId,
+				CorrelationRequestID: expectedCorrelationRequestId,
+			},
+			expectedHeaders: http.Header{
+				arm.HeaderNameRequestID:            []string{expectedRequestId.String()},
+				arm.HeaderNameCorrelationRequestID: []string{expectedCorrelationRequestId},
+			},
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
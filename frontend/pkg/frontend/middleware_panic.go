@@ -12,10 +12,18 @@ import (
 )
 
 func MiddlewarePanic(w http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
+	w = &trackingResponseWriter{ResponseWriter: w}
+
 	defer func() {
 		if e := recover(); e != nil {
 			logger := LoggerFromContext(r.Context())
 			logger.Error(fmt.Sprintf("panic: %#v\n%s\n", e, string(debug.Stack())))
+			if ResponseStarted(w) {
+				// Too late for an error response, so abort the
+				// connection rather than let a truncated response
+				// pass for a successful one.
+				panic(http.ErrAbortHandler)
+			}
 			arm.WriteInternalServerError(w)
 		}
 	}()
@@ -0,0 +1,117 @@
+package frontend
+
+// Copyright (c) Microsoft Corporation.
+// Licensed under the Apache License 2.0.
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Azure/ARO-HCP/internal/api/arm"
+)
+
+// tokenBucket holds the tokens available to one subscription. Tokens
+// are refilled lazily from the time they were last counted.
+type tokenBucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+// subscriptionRateLimiter limits the rate of requests from each
+// subscription with a token bucket, so that a misbehaving subscription
+// cannot overwhelm the frontend and the services behind it.
+type subscriptionRateLimiter struct {
+	rate  float64 // tokens added per second
+	burst float64 // bucket capacity
+
+	mutex     sync.Mutex
+	buckets   map[string]*tokenBucket
+	lastSweep time.Time
+}
+
+// newSubscriptionRateLimiter returns a rate limiter allowing each
+// subscription rate requests per second, and bursts of up to burst
+// requests.
+func newSubscriptionRateLimiter(rate float64, burst int) *subscriptionRateLimiter {
+	return &subscriptionRateLimiter{
+		rate:    rate,
+		burst:   float64(burst),
+		buckets: make(map[string]*tokenBucket),
+	}
+}
+
+// allow takes a token from the subscription's bucket. If none is
+// available it returns false and how long until one will be.
+func (l *subscriptionRateLimiter) allow(subscriptionID string, now time.Time) (bool, time.Duration) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	l.sweep(now)
+
+	bucket, ok := l.buckets[subscriptionID]
+	if !ok {
+		bucket = &tokenBucket{tokens: l.burst, updated: now}
+		l.buckets[subscriptionID] = bucket
+	}
+
+	elapsed := now.Sub(bucket.updated).Seconds()
+	bucket.tokens = math.Min(l.burst, bucket.tokens+elapsed*l.rate)
+	bucket.updated = now
+
+	if bucket.tokens < 1 {
+		wait := time.Duration((1 - bucket.tokens) / l.rate * float64(time.Second))
+		return false, wait
+	}
+
+	bucket.tokens--
+	return true, 0
+}
+
+// sweep drops buckets that have refilled completely, which behave the
+// same as a new bucket, so idle subscriptions do not accumulate.
+func (l *subscriptionRateLimiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < time.Minute {
+		return
+	}
+	l.lastSweep = now
+
+	for subscriptionID, bucket := range l.buckets {
+		if bucket.tokens+now.Sub(bucket.updated).Seconds()*l.rate >= l.burst {
+			delete(l.buckets, subscriptionID)
+		}
+	}
+}
+
+// Middleware rejects requests from a subscription that exceeded its rate
+// with "429 Too Many Requests" and a Retry-After header saying when to
+// retry. It must run after the request is routed, since it reads the
+// subscription ID from the path.
+func (l *subscriptionRateLimiter) Middleware(w http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
+	subscriptionID := strings.ToLower(r.PathValue(PathSegmentSubscriptionID))
+	if subscriptionID == "" {
+		next(w, r)
+		return
+	}
+
+	allowed, wait := l.allow(subscriptionID, time.Now())
+	if !allowed {
+		LoggerFromContext(r.Context()).Warn(fmt.Sprintf("subscription %s exceeded its request rate", subscriptionID))
+		CountRejectedRequest(r.Context(), RejectionReasonThrottled)
+
+		// Retry-After is in whole seconds, so round up.
+		retryAfter := int(math.Ceil(wait.Seconds()))
+		w.Header().Set("Retry-After", strconv.Itoa(max(retryAfter, 1)))
+		arm.WriteError(w, http.StatusTooManyRequests,
+			arm.CloudErrorCodeTooManyRequests, "",
+			"Subscription '%s' has sent too many requests. Please retry the request later.",
+			subscriptionID)
+		return
+	}
+
+	next(w, r)
+}
@@ -0,0 +1,127 @@
+package frontend
+
+// Copyright (c) Microsoft Corporation.
+// Licensed under the Apache License 2.0.
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/Azure/ARO-HCP/internal/api/arm"
+	"github.com/Azure/ARO-HCP/internal/database"
+)
+
+func TestSubscriptionRateLimiterAllow(t *testing.T) {
+	limiter := newSubscriptionRateLimiter(2, 2)
+	now := time.Now()
+
+	for i := range 2 {
+		if allowed, _ := limiter.allow("sub", now); !allowed {
+			t.Fatalf("expected request %d within the burst to be allowed", i+1)
+		}
+	}
+
+	allowed, wait := limiter.allow("sub", now)
+	if allowed {
+		t.Fatal("expected request beyond the burst to be throttled")
+	}
+	if wait != 500*time.Millisecond {
+		t.Errorf("expected to wait %s, got %s", 500*time.Millisecond, wait)
+	}
+
+	// A token is refilled after 1/rate seconds.
+	if allowed, _ := limiter.allow("sub", now.Add(500*time.Millisecond)); !allowed {
+		t.Error("expected request after refill to be allowed")
+	}
+
+	// Idle buckets that have refilled are swept.
+	limiter.allow("other", now.Add(time.Hour))
+	if _, ok := limiter.buckets["sub"]; ok {
+		t.Error("expected the idle bucket to be swept")
+	}
+}
+
+func TestMiddlewareSubscriptionRateLimit(t *testing.T) {
+	const (
+		burst                   = 3
+		otherSubscriptionID     = "11111111-1111-1111-1111-111111111111"
+		throttledSubscriptionID = "00000000-0000-0000-0000-000000000000"
+	)
+
+	registry := prometheus.NewRegistry()
+
+	f := &Frontend{
+		dbClient: database.NewCache(),
+		metrics:  NewPrometheusEmitter(registry),
+		config: Config{
+			// Slow enough that no token is refilled during the test.
+			SubscriptionRateLimit: 0.001,
+			SubscriptionRateBurst: burst,
+		},
+	}
+	f.ready.Store(true)
+
+	ts := httptest.NewUnstartedServer(f.routes())
+	ts.Config.BaseContext = func(net.Listener) context.Context {
+		ctx := context.Background()
+		ctx = ContextWithLogger(ctx, testLogger)
+		ctx = ContextWithDBClient(ctx, f.dbClient)
+		ctx = ContextWithEmitter(ctx, f.metrics)
+		return ctx
+	}
+	ts.Start()
+	defer ts.Close()
+
+	get := func(path string) *http.Response {
+		t.Helper()
+
+		rs, err := ts.Client().Get(ts.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { rs.Body.Close() })
+		return rs
+	}
+
+	for i := range burst {
+		if rs := get("/subscriptions/" + throttledSubscriptionID + "?api-version=2.0"); rs.StatusCode == http.StatusTooManyRequests {
+			t.Fatalf("expected request %d within the burst to be allowed", i+1)
+		}
+	}
+
+	rs := get("/subscriptions/" + throttledSubscriptionID + "?api-version=2.0")
+	if rs.StatusCode != http.StatusTooManyRequests {
+		t.Fatalf("expected status code %d, got %d", http.StatusTooManyRequests, rs.StatusCode)
+	}
+	if retryAfter, err := strconv.Atoi(rs.Header.Get("Retry-After")); err != nil || retryAfter < 1 {
+		t.Errorf("expected a positive Retry-After, got %q", rs.Header.Get("Retry-After"))
+	}
+	var cloudError arm.CloudError
+	if err := json.NewDecoder(rs.Body).Decode(&cloudError); err != nil {
+		t.Fatal(err)
+	}
+	if cloudError.CloudErrorBody == nil || cloudError.Code != arm.CloudErrorCodeTooManyRequests {
+		t.Errorf("expected error code %s, got %+v", arm.CloudErrorCodeTooManyRequests, cloudError.CloudErrorBody)
+	}
+	if count := rejectedRequestCounts(t, registry)[string(RejectionReasonThrottled)]; count != 1 {
+		t.Errorf("expected 1 throttled request to be counted, got %v", count)
+	}
+
+	// Other subscriptions and health checks are unaffected.
+	if rs := get("/subscriptions/" + otherSubscriptionID + "?api-version=2.0"); rs.StatusCode == http.StatusTooManyRequests {
+		t.Errorf("expected another subscription not to be throttled")
+	}
+	for range burst + 1 {
+		if rs := get("/healthz"); rs.StatusCode != http.StatusOK {
+			t.Errorf("expected /healthz status code %d, got %d", http.StatusOK, rs.StatusCode)
+		}
+	}
+}
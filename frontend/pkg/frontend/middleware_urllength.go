@@ -0,0 +1,35 @@
+package frontend
+
+// Copyright (c) Microsoft Corporation.
+// Licensed under the Apache License 2.0.
+
+import (
+	"net/http"
+
+	"github.com/Azure/ARO-HCP/internal/api/arm"
+)
+
+// MiddlewareURLLength returns a middleware function that rejects requests
+// whose URL, as it appeared in the request line, exceeds maxLength bytes.
+// Even deep resource paths with long names stay well below a sensible
+// limit, so an excessively long URL suggests abuse.
+func MiddlewareURLLength(maxLength int) MiddlewareFunc {
+	return func(w http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
+		requestURI := r.RequestURI
+		if requestURI == "" {
+			requestURI = r.URL.RequestURI()
+		}
+
+		if len(requestURI) > maxLength {
+			CountRejectedRequest(r.Context(), RejectionReasonTooLarge)
+			arm.WriteError(
+				w, http.StatusRequestURITooLong,
+				arm.CloudErrorCodeURITooLong, "",
+				"The request URL exceeds the maximum length of %d bytes.",
+				maxLength)
+			return
+		}
+
+		next(w, r)
+	}
+}
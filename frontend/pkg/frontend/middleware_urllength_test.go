@@ -0,0 +1,75 @@
+package frontend
+
+// Copyright (c) Microsoft Corporation.
+// Licensed under the Apache License 2.0.
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/Azure/ARO-HCP/internal/api"
+	"github.com/Azure/ARO-HCP/internal/api/arm"
+)
+
+func TestMaxURLLengthEnforced(t *testing.T) {
+	f, ts := newTestListServer(t)
+	f.config.MaxURLLength = 1024
+	addTestCluster(t, f, dummyClusterName, nil)
+
+	// Rebuild the routes as NewFrontend does.
+	ts.Config.Handler = f.routes()
+
+	clusterURL := ts.URL + "/subscriptions/" + dummySubscrtiptionId +
+		"/resourceGroups/" + dummyResourceGroupId +
+		"/providers/" + api.ProviderNamespace +
+		"/" + api.ClusterResourceTypeName + "/"
+
+	tests := []struct {
+		name               string
+		url                string
+		expectedStatusCode int
+	}{
+		{
+			name:               "Normal URL",
+			url:                clusterURL + dummyClusterName + "?api-version=2024-06-10-preview",
+			expectedStatusCode: http.StatusOK,
+		},
+		{
+			name:               "Over-length URL",
+			url:                clusterURL + strings.Repeat("x", 1024) + "?api-version=2024-06-10-preview",
+			expectedStatusCode: http.StatusRequestURITooLong,
+		},
+		{
+			name:               "Over-length query",
+			url:                clusterURL + dummyClusterName + "?api-version=2024-06-10-preview&x=" + strings.Repeat("x", 1024),
+			expectedStatusCode: http.StatusRequestURITooLong,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rs, err := ts.Client().Get(test.url)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer rs.Body.Close()
+
+			if rs.StatusCode != test.expectedStatusCode {
+				t.Fatalf("expected status code %d, got %d", test.expectedStatusCode, rs.StatusCode)
+			}
+
+			if rs.StatusCode == http.StatusRequestURITooLong {
+				var cloudError arm.CloudError
+				err = json.NewDecoder(rs.Body).Decode(&cloudError)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if cloudError.CloudErrorBody == nil || cloudError.Code != arm.CloudErrorCodeURITooLong {
+					t.Errorf("expected error code %s, got %+v", arm.CloudErrorCodeURITooLong, cloudError.CloudErrorBody)
+				}
+			}
+		})
+	}
+}
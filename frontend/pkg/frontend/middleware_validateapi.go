@@ -5,22 +5,60 @@ package frontend
 
 import (
 	"net/http"
+	"path"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	azcorearm "github.com/Azure/azure-sdk-for-go/sdk/azcore/arm"
 
 	"github.com/Azure/ARO-HCP/internal/api"
 	"github.com/Azure/ARO-HCP/internal/api/arm"
 )
 
+var (
+	// dateAPIVersionRegex matches date-based API versions such as
+	// "2024-06-10" or "2024-06-10-preview".
+	dateAPIVersionRegex = regexp.MustCompile(`^(\d{4}-\d{2}-\d{2})(-[a-z]+)?$`)
+
+	// semverAPIVersionRegex matches semantic API versions such as
+	// "1.0" or "1.2.3-beta".
+	semverAPIVersionRegex = regexp.MustCompile(`^\d+\.\d+(\.\d+)?(-[0-9a-z.]+)?$`)
+)
+
+// isWellFormedAPIVersion returns true if apiVersion is formatted as
+// either a date or a semantic version. It says nothing about whether
+// the API version is actually supported.
+func isWellFormedAPIVersion(apiVersion string) bool {
+	apiVersion = strings.ToLower(apiVersion)
+
+	if matches := dateAPIVersionRegex.FindStringSubmatch(apiVersion); matches != nil {
+		_, err := time.Parse(time.DateOnly, matches[1])
+		return err == nil
+	}
+
+	return semverAPIVersionRegex.MatchString(apiVersion)
+}
+
 func MiddlewareValidateAPIVersion(w http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
 	ctx := r.Context()
 	logger := LoggerFromContext(ctx)
 
-	apiVersion := r.URL.Query().Get(APIVersionKey)
-	if apiVersion == "" {
+	query := r.URL.Query()
+	apiVersion := query.Get(APIVersionKey)
+	if !query.Has(APIVersionKey) {
 		arm.WriteError(
 			w, http.StatusBadRequest,
 			arm.CloudErrorCodeInvalidParameter, "",
 			"The request is missing required parameter '%s'.",
 			APIVersionKey)
+	} else if !isWellFormedAPIVersion(apiVersion) {
+		arm.WriteError(
+			w, http.StatusBadRequest,
+			arm.CloudErrorCodeInvalidAPIVersion, "",
+			"The api-version '%s' is invalid. The supported formats are 'yyyy-mm-dd' or 'yyyy-mm-dd-suffix' or a semantic version.",
+			apiVersion)
 	} else if version, ok := api.Lookup(apiVersion); !ok {
 		arm.WriteError(
 			w, http.StatusBadRequest,
@@ -28,6 +66,12 @@ func MiddlewareValidateAPIVersion(w http.ResponseWriter, r *http.Request, next h
 			"The resource type '%s' could not be found API version '%s'.",
 			api.ClusterResourceType,
 			apiVersion)
+	} else if resourceType, ok := requestResourceType(r); ok && !api.SupportsResourceType(apiVersion, resourceType) {
+		arm.WriteError(
+			w, http.StatusBadRequest,
+			arm.CloudErrorCodeNoRegisteredProvider, "",
+			"No registered resource provider found for resource type '%s' and API version '%s'.",
+			resourceType, apiVersion)
 	} else {
 		logger = logger.With("api_version", apiVersion)
 		ctx = ContextWithLogger(ctx, logger)
@@ -36,3 +80,64 @@ func MiddlewareValidateAPIVersion(w http.ResponseWriter, r *http.Request, next h
 		next(w, r)
 	}
 }
+
+// MiddlewareValidateContractAPIVersion returns a middleware function for the
+// endpoints defined by the resource provider contract, which take one of the
+// contract's API versions instead of an ARO-HCP API version.
+func MiddlewareValidateContractAPIVersion(versions []string) MiddlewareFunc {
+	supported := "'" + strings.Join(versions, "', '") + "'"
+
+	return func(w http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
+		query := r.URL.Query()
+		apiVersion := query.Get(APIVersionKey)
+		if !query.Has(APIVersionKey) {
+			arm.WriteError(
+				w, http.StatusBadRequest,
+				arm.CloudErrorCodeInvalidAPIVersion, "",
+				"The request is missing required parameter '%s'. The supported api-versions are %s.",
+				APIVersionKey, supported)
+		} else if !slices.Contains(versions, apiVersion) {
+			arm.WriteError(
+				w, http.StatusBadRequest,
+				arm.CloudErrorCodeInvalidAPIVersion, "",
+				"The api-version '%s' is not supported. The supported api-versions are %s.",
+				apiVersion, supported)
+		} else {
+			next(w, r)
+		}
+	}
+}
+
+// requestResourceType returns the resource type targeted by the request
+// URL, which may be either a resource ID or a resource collection.
+func requestResourceType(r *http.Request) (azcorearm.ResourceType, bool) {
+	// Use the original path to preserve resource type casing.
+	originalPath, _ := OriginalPathFromContext(r.Context())
+	if originalPath == "" {
+		originalPath = r.URL.Path
+	}
+
+	// Provisioning state event paths take the type of the resource they follow.
+	if strings.EqualFold(path.Base(originalPath), ProvisioningStateEventsPath) {
+		originalPath = path.Dir(originalPath)
+	}
+
+	resourceID, err := arm.ParseResourceID(originalPath)
+	if err == nil {
+		return resourceID.ResourceType, true
+	}
+
+	// Top-level resource collection paths such as ".../providers/{namespace}/{type}"
+	// do not parse as resource IDs, so assemble the resource type manually.
+	if strings.EqualFold(path.Base(path.Dir(originalPath)), api.ProviderNamespace) {
+		// The enabled features and policy paths have the same shape
+		// but are not collections.
+		if strings.EqualFold(path.Base(originalPath), EnabledFeaturesPath) ||
+			strings.EqualFold(path.Base(originalPath), SubscriptionPolicyPath) {
+			return azcorearm.ResourceType{}, false
+		}
+		return azcorearm.NewResourceType(api.ProviderNamespace, path.Base(originalPath)), true
+	}
+
+	return azcorearm.ResourceType{}, false
+}
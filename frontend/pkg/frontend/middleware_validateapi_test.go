@@ -0,0 +1,238 @@
+package frontend
+
+// Copyright (c) Microsoft Corporation.
+// Licensed under the Apache License 2.0.
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Azure/ARO-HCP/internal/api"
+	"github.com/Azure/ARO-HCP/internal/api/arm"
+)
+
+func TestMiddlewareValidateAPIVersion(t *testing.T) {
+	const subscriptionPath = "/subscriptions/00000000-0000-0000-0000-000000000000"
+	const clusterPath = subscriptionPath + "/resourceGroups/myRG/providers/Microsoft.RedHatOpenShift/hcpOpenShiftClusters/myCluster"
+
+	tests := []struct {
+		name               string
+		path               string
+		apiVersion         *string
+		expectedStatusCode int
+		expectedErrorCode  string
+	}{
+		{
+			name:               "Missing API version",
+			path:               clusterPath,
+			expectedStatusCode: http.StatusBadRequest,
+			expectedErrorCode:  arm.CloudErrorCodeInvalidParameter,
+		},
+		{
+			name:               "Empty API version",
+			path:               clusterPath,
+			apiVersion:         api.Ptr(""),
+			expectedStatusCode: http.StatusBadRequest,
+			expectedErrorCode:  arm.CloudErrorCodeInvalidAPIVersion,
+		},
+		{
+			name:               "Malformed API version",
+			path:               clusterPath,
+			apiVersion:         api.Ptr("2.x"),
+			expectedStatusCode: http.StatusBadRequest,
+			expectedErrorCode:  arm.CloudErrorCodeInvalidAPIVersion,
+		},
+		{
+			name:               "Malformed date API version",
+			path:               clusterPath,
+			apiVersion:         api.Ptr("2024-13-45-preview"),
+			expectedStatusCode: http.StatusBadRequest,
+			expectedErrorCode:  arm.CloudErrorCodeInvalidAPIVersion,
+		},
+		{
+			name:               "Unknown date API version",
+			path:               clusterPath,
+			apiVersion:         api.Ptr("2099-01-01-preview"),
+			expectedStatusCode: http.StatusBadRequest,
+			expectedErrorCode:  arm.CloudErrorCodeInvalidResourceType,
+		},
+		{
+			name:               "Unknown semantic API version",
+			path:               clusterPath,
+			apiVersion:         api.Ptr("1.2.3"),
+			expectedStatusCode: http.StatusBadRequest,
+			expectedErrorCode:  arm.CloudErrorCodeInvalidResourceType,
+		},
+		{
+			name:               "Cluster resource type is supported",
+			path:               clusterPath,
+			apiVersion:         api.Ptr("2024-06-10-preview"),
+			expectedStatusCode: http.StatusOK,
+		},
+		{
+			name:               "Cluster collection type is supported",
+			path:               subscriptionPath + "/providers/Microsoft.RedHatOpenShift/hcpOpenShiftClusters",
+			apiVersion:         api.Ptr("2024-06-10-preview"),
+			expectedStatusCode: http.StatusOK,
+		},
+		{
+			name:               "Node pool collection type is supported",
+			path:               clusterPath + "/nodePools",
+			apiVersion:         api.Ptr("2024-06-10-preview"),
+			expectedStatusCode: http.StatusOK,
+		},
+		{
+			name:               "Operation status type is supported",
+			path:               subscriptionPath + "/providers/Microsoft.RedHatOpenShift/locations/eastus/hcpOperationsStatus/myOperation",
+			apiVersion:         api.Ptr("2024-06-10-preview"),
+			expectedStatusCode: http.StatusOK,
+		},
+		{
+			name:               "Enabled features path has no resource type",
+			path:               subscriptionPath + "/providers/Microsoft.RedHatOpenShift/" + EnabledFeaturesPath,
+			apiVersion:         api.Ptr("2024-06-10-preview"),
+			expectedStatusCode: http.StatusOK,
+		},
+		{
+			name:               "Policy path has no resource type",
+			path:               subscriptionPath + "/providers/Microsoft.RedHatOpenShift/" + SubscriptionPolicyPath,
+			apiVersion:         api.Ptr("2024-06-10-preview"),
+			expectedStatusCode: http.StatusOK,
+		},
+		{
+			name:               "Unregistered resource type is not supported",
+			path:               clusterPath + "/externalAuths/myExternalAuth",
+			apiVersion:         api.Ptr("2024-06-10-preview"),
+			expectedStatusCode: http.StatusBadRequest,
+			expectedErrorCode:  arm.CloudErrorCodeNoRegisteredProvider,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var nextCalled bool
+
+			next := func(w http.ResponseWriter, r *http.Request) {
+				nextCalled = true
+				w.WriteHeader(http.StatusOK)
+			}
+
+			target := tt.path
+			if tt.apiVersion != nil {
+				target += "?" + APIVersionKey + "=" + *tt.apiVersion
+			}
+
+			request := httptest.NewRequest(http.MethodGet, target, nil)
+			request = request.WithContext(ContextWithLogger(request.Context(), testLogger))
+			request = request.WithContext(ContextWithOriginalPath(request.Context(), tt.path))
+
+			writer := httptest.NewRecorder()
+
+			MiddlewareValidateAPIVersion(writer, request, next)
+
+			if writer.Code != tt.expectedStatusCode {
+				t.Errorf("expected status code %d, got %d", tt.expectedStatusCode, writer.Code)
+			}
+
+			if tt.expectedErrorCode == "" {
+				if !nextCalled {
+					t.Error("expected next handler to be called")
+				}
+			} else {
+				var cloudError arm.CloudError
+				err := json.Unmarshal(writer.Body.Bytes(), &cloudError)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if cloudError.Code != tt.expectedErrorCode {
+					t.Errorf("expected error code '%s', got '%s'", tt.expectedErrorCode, cloudError.Code)
+				}
+				if nextCalled {
+					t.Error("expected next handler not to be called")
+				}
+			}
+		})
+	}
+}
+
+func TestMiddlewareValidateContractAPIVersion(t *testing.T) {
+	tests := []struct {
+		name               string
+		apiVersion         *string
+		expectedStatusCode int
+		expectedMessage    string
+	}{
+		{
+			name:               "Missing API version",
+			expectedStatusCode: http.StatusBadRequest,
+			expectedMessage:    "The request is missing required parameter 'api-version'. The supported api-versions are '2.0'.",
+		},
+		{
+			name:               "Empty API version",
+			apiVersion:         api.Ptr(""),
+			expectedStatusCode: http.StatusBadRequest,
+			expectedMessage:    "The api-version '' is not supported. The supported api-versions are '2.0'.",
+		},
+		{
+			name:               "Unknown API version",
+			apiVersion:         api.Ptr("2024-06-10-preview"),
+			expectedStatusCode: http.StatusBadRequest,
+			expectedMessage:    "The api-version '2024-06-10-preview' is not supported. The supported api-versions are '2.0'.",
+		},
+		{
+			name:               "Supported API version",
+			apiVersion:         api.Ptr("2.0"),
+			expectedStatusCode: http.StatusOK,
+		},
+	}
+
+	middleware := MiddlewareValidateContractAPIVersion([]string{"2.0"})
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var nextCalled bool
+
+			next := func(w http.ResponseWriter, r *http.Request) {
+				nextCalled = true
+				w.WriteHeader(http.StatusOK)
+			}
+
+			target := "/subscriptions/00000000-0000-0000-0000-000000000000"
+			if tt.apiVersion != nil {
+				target += "?" + APIVersionKey + "=" + *tt.apiVersion
+			}
+
+			request := httptest.NewRequest(http.MethodGet, target, nil)
+			writer := httptest.NewRecorder()
+
+			middleware(writer, request, next)
+
+			if writer.Code != tt.expectedStatusCode {
+				t.Errorf("expected status code %d, got %d", tt.expectedStatusCode, writer.Code)
+			}
+
+			if tt.expectedMessage == "" {
+				if !nextCalled {
+					t.Error("expected next handler to be called")
+				}
+			} else {
+				var cloudError arm.CloudError
+				err := json.Unmarshal(writer.Body.Bytes(), &cloudError)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if cloudError.Code != arm.CloudErrorCodeInvalidAPIVersion {
+					t.Errorf("expected error code '%s', got '%s'", arm.CloudErrorCodeInvalidAPIVersion, cloudError.Code)
+				}
+				if cloudError.Message != tt.expectedMessage {
+					t.Errorf("expected message %q, got %q", tt.expectedMessage, cloudError.Message)
+				}
+				if nextCalled {
+					t.Error("expected next handler not to be called")
+				}
+			}
+		})
+	}
+}
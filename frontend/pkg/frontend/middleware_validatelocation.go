@@ -0,0 +1,39 @@
+package frontend
+
+// Copyright (c) Microsoft Corporation.
+// Licensed under the Apache License 2.0.
+
+import (
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/Azure/ARO-HCP/internal/api/arm"
+)
+
+// MiddlewareValidateLocation returns a middleware function that rejects
+// requests whose path targets a location other than the supported ones.
+// Locations are compared in their normalized form, since ARM does not
+// always send them the same way. If no locations are given, requests may
+// target any location.
+func MiddlewareValidateLocation(supportedLocations ...string) MiddlewareFunc {
+	normalized := make([]string, 0, len(supportedLocations))
+	for _, location := range supportedLocations {
+		normalized = append(normalized, arm.NormalizeLocation(location))
+	}
+
+	return func(w http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
+		location := r.PathValue(PathSegmentLocation)
+
+		if len(normalized) > 0 && location != "" && !slices.Contains(normalized, arm.NormalizeLocation(location)) {
+			arm.WriteError(
+				w, http.StatusBadRequest,
+				arm.CloudErrorCodeLocationNotAvailableForResourceType, "location",
+				"The provided location '%s' is not available. List of available regions is '%s'.",
+				location, strings.Join(normalized, ","))
+			return
+		}
+
+		next(w, r)
+	}
+}
@@ -0,0 +1,92 @@
+package frontend
+
+// Copyright (c) Microsoft Corporation.
+// Licensed under the Apache License 2.0.
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Azure/ARO-HCP/internal/api/arm"
+)
+
+func TestMiddlewareValidateLocation(t *testing.T) {
+	tests := []struct {
+		name               string
+		supported          []string
+		location           string
+		expectedStatusCode int
+	}{
+		{
+			name:               "Supported location",
+			supported:          []string{"eastus", "westeurope"},
+			location:           "westeurope",
+			expectedStatusCode: http.StatusOK,
+		},
+		{
+			name:               "Unsupported location",
+			supported:          []string{"eastus", "westeurope"},
+			location:           "australiaeast",
+			expectedStatusCode: http.StatusBadRequest,
+		},
+		{
+			name:               "Differently cased location",
+			supported:          []string{"eastus", "westeurope"},
+			location:           "West Europe",
+			expectedStatusCode: http.StatusOK,
+		},
+		{
+			name:               "Differently cased supported location",
+			supported:          []string{"East US"},
+			location:           "EASTUS",
+			expectedStatusCode: http.StatusOK,
+		},
+		{
+			name:               "No location in path",
+			supported:          []string{"eastus"},
+			expectedStatusCode: http.StatusOK,
+		},
+		{
+			name:               "No supported locations",
+			location:           "australiaeast",
+			expectedStatusCode: http.StatusOK,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var nextCalled bool
+			next := func(w http.ResponseWriter, r *http.Request) {
+				nextCalled = true
+				w.WriteHeader(http.StatusOK)
+			}
+
+			request := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.location != "" {
+				request.SetPathValue(PathSegmentLocation, tt.location)
+			}
+			writer := httptest.NewRecorder()
+
+			MiddlewareValidateLocation(tt.supported...)(writer, request, next)
+
+			if writer.Code != tt.expectedStatusCode {
+				t.Fatalf("expected status code %d, got %d", tt.expectedStatusCode, writer.Code)
+			}
+			if nextCalled != (tt.expectedStatusCode == http.StatusOK) {
+				t.Errorf("unexpected next handler call: %t", nextCalled)
+			}
+
+			if tt.expectedStatusCode != http.StatusOK {
+				var body CloudErrorContainer
+				if err := json.Unmarshal(writer.Body.Bytes(), &body); err != nil {
+					t.Fatal(err)
+				}
+				if body.Error.Code != arm.CloudErrorCodeLocationNotAvailableForResourceType {
+					t.Errorf("expected error code %s, got %s", arm.CloudErrorCodeLocationNotAvailableForResourceType, body.Error.Code)
+				}
+			}
+		})
+	}
+}
@@ -4,6 +4,7 @@ package frontend
 // Licensed under the Apache License 2.0.
 
 import (
+	"fmt"
 	"net/http"
 	"regexp"
 	"strings"
@@ -18,51 +19,104 @@ import (
 var rxHCPOpenShiftClusterResourceName = regexp.MustCompile(`^[a-zA-Z][a-zA-Z0-9-]{2,53}$`)
 var rxNodePoolResourceName = regexp.MustCompile(`^[a-zA-Z][a-zA-Z0-9-]{2,14}$`)
 
+// Resource group names may contain Unicode letters and digits, which \w does not match.
+var rxResourceGroupName = regexp.MustCompile(`^[-\p{L}\p{N}._()]{0,89}[-\p{L}\p{N}_()]$`)
+
 func MiddlewareValidateStatic(w http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
 	// To conform with "OAPI012: Resource IDs must not be case sensitive"
 	// we need to use the original, non-lowercased resource ID components
 	// in response messages.
 	//TODO: Inspect the error instead of ignoring it
 	originalPath, _ := OriginalPathFromContext(r.Context())
+
+	// arm.ParseResourceID skips empty segments, so a path such as
+	// "/subscriptions//resourceGroups/..." would otherwise be parsed
+	// as if its segments were shifted and match the wrong route.
+	if strings.Contains(originalPath, "//") {
+		arm.WriteError(w, http.StatusBadRequest,
+			arm.CloudErrorCodeInvalidResourceID, originalPath,
+			"The request path '%s' has an empty segment.",
+			originalPath)
+		return
+	}
+
 	resource, _ := arm.ParseResourceID(originalPath)
 
 	if resource != nil {
-		if resource.SubscriptionID != "" {
-			if uuid.Validate(resource.SubscriptionID) != nil {
-				arm.WriteError(w, http.StatusBadRequest,
-					arm.CloudErrorCodeInvalidSubscriptionID,
-					resource.String(),
-					"The provided subscription identifier '%s' is malformed or invalid.",
-					resource.SubscriptionID)
-				return
-			}
+		cloudError := validateStaticPathSegments(resource)
+		if cloudError != nil {
+			arm.WriteCloudError(w, cloudError)
+			return
 		}
+	}
+
+	next(w, r)
+}
+
+// validateStaticPathSegments checks the segments of a request's resource ID
+// that can be validated without a database lookup. Every malformed segment
+// is reported so clients can correct them all at once.
+func validateStaticPathSegments(resource *arm.ResourceID) *arm.CloudError {
+	cloudError := arm.NewCloudError(
+		http.StatusBadRequest,
+		arm.CloudErrorCodeMultipleErrorsOccurred, resource.String(),
+		"The request path has multiple invalid segments")
+	cloudError.Details = make([]arm.CloudErrorBody, 0)
 
-		switch strings.ToLower(resource.ResourceType.Type) {
-		case strings.ToLower(api.ClusterResourceType.Type):
-			if !rxHCPOpenShiftClusterResourceName.MatchString(resource.Name) {
-				arm.WriteError(w, http.StatusBadRequest,
-					arm.CloudErrorCodeInvalidResourceName,
-					resource.String(),
-					"The Resource '%s/%s' under resource group '%s' does not conform to the naming restriction.",
-					resource.ResourceType, resource.Name,
-					resource.ResourceGroupName)
-				return
-			}
-		case strings.ToLower(api.NodePoolResourceType.Type):
-			// The collection GET endpoint for nested resources
-			// parses into a ResourceID with an empty Name field.
-			if resource.Name != "" && !rxNodePoolResourceName.MatchString(resource.Name) {
-				arm.WriteError(w, http.StatusBadRequest,
-					arm.CloudErrorCodeInvalidResourceName,
-					resource.String(),
-					"The Resource '%s/%s' under resource group '%s' does not conform to the naming restriction.",
-					resource.ResourceType, resource.Name,
-					resource.ResourceGroupName)
-				return
-			}
+	addDetail := func(code, format string, a ...any) {
+		cloudError.Details = append(cloudError.Details, arm.CloudErrorBody{
+			Code:    code,
+			Message: fmt.Sprintf(format, a...),
+			Target:  resource.String(),
+		})
+	}
+
+	if resource.SubscriptionID != "" {
+		if uuid.Validate(resource.SubscriptionID) != nil {
+			addDetail(arm.CloudErrorCodeInvalidSubscriptionID,
+				"The provided subscription identifier '%s' is malformed or invalid.",
+				resource.SubscriptionID)
 		}
 	}
 
-	next(w, r)
+	if resource.ResourceGroupName != "" {
+		if !rxResourceGroupName.MatchString(resource.ResourceGroupName) {
+			addDetail(arm.CloudErrorCodeInvalidResourceGroupName,
+				"The resource group name '%s' does not conform to the naming restriction.",
+				resource.ResourceGroupName)
+		}
+	}
+
+	invalidResourceName := func(resourceType fmt.Stringer, name string) {
+		addDetail(arm.CloudErrorCodeInvalidResourceName,
+			"The Resource '%s/%s' under resource group '%s' does not conform to the naming restriction.",
+			resourceType, name,
+			resource.ResourceGroupName)
+	}
+
+	switch strings.ToLower(resource.ResourceType.Type) {
+	case strings.ToLower(api.ClusterResourceType.Type):
+		if !rxHCPOpenShiftClusterResourceName.MatchString(resource.Name) {
+			invalidResourceName(resource.ResourceType, resource.Name)
+		}
+	case strings.ToLower(api.NodePoolResourceType.Type):
+		if resource.Parent != nil && !rxHCPOpenShiftClusterResourceName.MatchString(resource.Parent.Name) {
+			invalidResourceName(resource.Parent.ResourceType, resource.Parent.Name)
+		}
+		// The collection GET endpoint for nested resources
+		// parses into a ResourceID with an empty Name field.
+		if resource.Name != "" && !rxNodePoolResourceName.MatchString(resource.Name) {
+			invalidResourceName(resource.ResourceType, resource.Name)
+		}
+	}
+
+	switch len(cloudError.Details) {
+	case 0:
+		cloudError = nil
+	case 1:
+		// Promote a single validation error out of details.
+		cloudError.CloudErrorBody = &cloudError.Details[0]
+	}
+
+	return cloudError
 }
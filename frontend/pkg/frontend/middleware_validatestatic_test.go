@@ -5,9 +5,11 @@ import (
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"slices"
 	"strings"
 	"testing"
 
+	"github.com/Azure/ARO-HCP/internal/api"
 	"github.com/Azure/ARO-HCP/internal/api/arm"
 )
 
@@ -45,6 +47,11 @@ func TestMiddlewareValidateStatic(t *testing.T) {
 			path:               "/Subscriptions/42d9eac4-d29a-4d6e-9e26-3439758b1491/ResourceGroups/MyResourceGroup/Providers/Microsoft.RedHatOpenShift/HCPOpenShiftClusters/MyCluster",
 			expectedStatusCode: http.StatusOK,
 		},
+		{
+			name:               "Valid resource group name with non-ASCII letters",
+			path:               "/Subscriptions/42d9eac4-d29a-4d6e-9e26-3439758b1491/ResourceGroups/Büro_Gruppe-(ß)/Providers/Microsoft.RedHatOpenShift/HCPOpenShiftClusters/MyCluster",
+			expectedStatusCode: http.StatusOK,
+		},
 		{
 			name:               "Invalid hcpopenshiftcluster resource name",
 			path:               "/SUBSCRIPTIONS/00000000-0000-0000-0000-000000000000/RESOURCEGROUPS/MyResourceGroup/PROVIDERS/MICROSOFT.REDHATOPENSHIFT/HCPOPENSHIFTCLUSTERS/$",
@@ -98,6 +105,18 @@ func TestMiddlewareValidateStatic(t *testing.T) {
 			path:               "/SUBSCRIPTIONS/00000000-0000-0000-0000-000000000000",
 			expectedStatusCode: http.StatusOK,
 		},
+		{
+			name:               "Empty subscription segment",
+			path:               "/subscriptions//resourceGroups/MyResourceGroup/providers/Microsoft.RedHatOpenShift/hcpOpenShiftClusters/MyCluster",
+			expectedStatusCode: http.StatusBadRequest,
+			expectedBody:       "The request path '/subscriptions//resourceGroups/MyResourceGroup/providers/Microsoft.RedHatOpenShift/hcpOpenShiftClusters/MyCluster' has an empty segment.",
+		},
+		{
+			name:               "Empty segment between resource types",
+			path:               "/subscriptions/00000000-0000-0000-0000-000000000000/resourceGroups/MyResourceGroup/providers/Microsoft.RedHatOpenShift/hcpOpenShiftClusters/MyCluster//nodePools/MyNodePool",
+			expectedStatusCode: http.StatusBadRequest,
+			expectedBody:       "has an empty segment.",
+		},
 	}
 
 	for _, tc := range tests {
@@ -138,3 +157,131 @@ func TestMiddlewareValidateStatic(t *testing.T) {
 		})
 	}
 }
+
+func TestMiddlewareValidateStaticMultipleErrors(t *testing.T) {
+	nextHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	tests := []struct {
+		name                string
+		path                string
+		expectedCode        string
+		expectedDetailCodes []string
+	}{
+		{
+			name:         "Invalid resource group name",
+			path:         "/SUBSCRIPTIONS/00000000-0000-0000-0000-000000000000/RESOURCEGROUPS/bad!group./PROVIDERS/MICROSOFT.REDHATOPENSHIFT/HCPOPENSHIFTCLUSTERS/MyCluster",
+			expectedCode: arm.CloudErrorCodeInvalidResourceGroupName,
+		},
+		{
+			name:         "Invalid subscription ID and resource group name",
+			path:         "/SUBSCRIPTIONS/invalid!sub!id/RESOURCEGROUPS/bad!group./PROVIDERS/MICROSOFT.REDHATOPENSHIFT/HCPOPENSHIFTCLUSTERS/MyCluster",
+			expectedCode: arm.CloudErrorCodeMultipleErrorsOccurred,
+			expectedDetailCodes: []string{
+				arm.CloudErrorCodeInvalidSubscriptionID,
+				arm.CloudErrorCodeInvalidResourceGroupName,
+			},
+		},
+		{
+			name:         "Every segment invalid",
+			path:         "/SUBSCRIPTIONS/invalid!sub!id/RESOURCEGROUPS/bad!group./PROVIDERS/MICROSOFT.REDHATOPENSHIFT/HCPOPENSHIFTCLUSTERS/$/NODEPOOLS/$",
+			expectedCode: arm.CloudErrorCodeMultipleErrorsOccurred,
+			expectedDetailCodes: []string{
+				arm.CloudErrorCodeInvalidSubscriptionID,
+				arm.CloudErrorCodeInvalidResourceGroupName,
+				arm.CloudErrorCodeInvalidResourceName,
+				arm.CloudErrorCodeInvalidResourceName,
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "http://example.com"+tc.path, nil)
+			req = req.WithContext(ContextWithOriginalPath(req.Context(), tc.path))
+
+			w := httptest.NewRecorder()
+
+			MiddlewareValidateStatic(w, req, nextHandler)
+
+			if w.Code != http.StatusBadRequest {
+				t.Fatalf("handler returned wrong status code: got %v want %v",
+					w.Code, http.StatusBadRequest)
+			}
+
+			var resp CloudErrorContainer
+			err := json.Unmarshal(w.Body.Bytes(), &resp)
+			if err != nil {
+				t.Fatalf("failed to unmarshal response body: %v", err)
+			}
+
+			if resp.Error.Code != tc.expectedCode {
+				t.Errorf("expected error code %s, got %s", tc.expectedCode, resp.Error.Code)
+			}
+
+			detailCodes := make([]string, 0, len(resp.Error.Details))
+			for _, detail := range resp.Error.Details {
+				detailCodes = append(detailCodes, detail.Code)
+			}
+			if tc.expectedDetailCodes != nil && !slices.Equal(detailCodes, tc.expectedDetailCodes) {
+				t.Errorf("expected detail codes %v, got %v", tc.expectedDetailCodes, detailCodes)
+			}
+		})
+	}
+}
+
+func TestEmptyPathSegmentRejected(t *testing.T) {
+	f, ts := newTestListServer(t)
+	addTestCluster(t, f, dummyClusterName, nil)
+
+	clusterPath := func(subscriptionID string) string {
+		return "/subscriptions/" + subscriptionID +
+			"/resourceGroups/" + dummyResourceGroupId +
+			"/providers/" + api.ProviderNamespace +
+			"/" + api.ClusterResourceTypeName + "/" + dummyClusterName +
+			"?api-version=2024-06-10-preview"
+	}
+
+	tests := []struct {
+		name               string
+		path               string
+		expectedStatusCode int
+	}{
+		{
+			name:               "Normal path",
+			path:               clusterPath(dummySubscrtiptionId),
+			expectedStatusCode: http.StatusOK,
+		},
+		{
+			name:               "Empty subscription segment",
+			path:               clusterPath(""),
+			expectedStatusCode: http.StatusBadRequest,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			rs, err := ts.Client().Get(ts.URL + tc.path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer rs.Body.Close()
+
+			if rs.StatusCode != tc.expectedStatusCode {
+				t.Fatalf("expected status code %d, got %d", tc.expectedStatusCode, rs.StatusCode)
+			}
+
+			if rs.StatusCode == http.StatusBadRequest {
+				var resp CloudErrorContainer
+				err = json.NewDecoder(rs.Body).Decode(&resp)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if resp.Error.Code != arm.CloudErrorCodeInvalidResourceID {
+					t.Errorf("expected error code %s, got %s", arm.CloudErrorCodeInvalidResourceID, resp.Error.Code)
+				}
+			}
+		})
+	}
+}
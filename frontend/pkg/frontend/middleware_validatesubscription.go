@@ -4,9 +4,11 @@ package frontend
 // Licensed under the Apache License 2.0.
 
 import (
+	"errors"
 	"net/http"
 
 	"github.com/Azure/ARO-HCP/internal/api/arm"
+	"github.com/Azure/ARO-HCP/internal/database"
 )
 
 const (
@@ -40,7 +42,12 @@ func MiddlewareValidateSubscriptionState(w http.ResponseWriter, r *http.Request,
 	// TODO: Ideally, we don't want to have to hit the database in this middleware
 	// Currently, we are using the database to retrieve the subscription's tenantID and state
 	sub, err := dbClient.GetSubscriptionDoc(ctx, subscriptionId)
-	if err != nil {
+	if err != nil && !errors.Is(err, database.ErrNotFound) {
+		logger.Error(err.Error())
+		arm.WriteInternalServerError(w)
+		return
+	} else if err != nil {
+		CountRejectedRequest(ctx, RejectionReasonBlocked)
 		arm.WriteError(
 			w, http.StatusBadRequest,
 			arm.CloudErrorCodeInvalidSubscriptionState, "",
@@ -63,17 +70,23 @@ func MiddlewareValidateSubscriptionState(w http.ResponseWriter, r *http.Request,
 		}
 	}
 
+	// Later handlers consult the subscription, for example to
+	// check for registered preview features.
+	r = r.WithContext(ContextWithSubscription(ctx, sub.Subscription))
+
 	switch sub.Subscription.State {
 	case arm.SubscriptionStateRegistered:
 		next(w, r)
 	case arm.SubscriptionStateUnregistered:
+		CountRejectedRequest(ctx, RejectionReasonBlocked)
 		arm.WriteError(
 			w, http.StatusBadRequest,
 			arm.CloudErrorCodeInvalidSubscriptionState, "",
 			UnregisteredSubscriptionStateMessage,
 			subscriptionId)
 	case arm.SubscriptionStateWarned, arm.SubscriptionStateSuspended:
-		if r.Method != http.MethodGet && r.Method != http.MethodDelete {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead && r.Method != http.MethodDelete {
+			CountRejectedRequest(ctx, RejectionReasonBlocked)
 			arm.WriteError(w, http.StatusConflict,
 				arm.CloudErrorCodeInvalidSubscriptionState, "",
 				InvalidSubscriptionStateMessage,
@@ -82,6 +95,7 @@ func MiddlewareValidateSubscriptionState(w http.ResponseWriter, r *http.Request,
 		}
 		next(w, r)
 	case arm.SubscriptionStateDeleted:
+		CountRejectedRequest(ctx, RejectionReasonBlocked)
 		arm.WriteError(
 			w, http.StatusBadRequest,
 			arm.CloudErrorCodeInvalidSubscriptionState, "",
@@ -104,6 +104,13 @@ func TestMiddlewareValidateSubscription(t *testing.T) {
 			httpMethod:    http.MethodGet,
 			requestPath:   defaultRequestPath,
 		},
+		{
+			name:          "subscription is suspended - HEAD is allowed",
+			cachedState:   arm.SubscriptionStateSuspended,
+			expectedState: arm.SubscriptionStateSuspended,
+			httpMethod:    http.MethodHead,
+			requestPath:   defaultRequestPath,
+		},
 		{
 			name:          "subscription is warned - DELETE is allowed",
 			cachedState:   arm.SubscriptionStateWarned,
@@ -4,11 +4,13 @@ package frontend
 // Licensed under the Apache License 2.0.
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"maps"
 	"net/http"
+	"strings"
 
 	cmv1 "github.com/openshift-online/ocm-sdk-go/clustersmgmt/v1"
 
@@ -18,6 +20,10 @@ import (
 	"github.com/Azure/ARO-HCP/internal/ocm"
 )
 
+// HeaderNameAllowNodePoolShrink is the request header that allows a node
+// pool update to shrink a node pool below the configured minimum.
+const HeaderNameAllowNodePoolShrink = "X-Aro-Allow-Node-Pool-Shrink"
+
 func (f *Frontend) CreateOrUpdateNodePool(writer http.ResponseWriter, request *http.Request) {
 	var err error
 
@@ -67,6 +73,19 @@ func (f *Frontend) CreateOrUpdateNodePool(writer http.ResponseWriter, request *h
 	var updating = (doc != nil)
 	var operationRequest database.OperationRequest
 
+	// Node pool names are unique within a cluster regardless of case, so
+	// the lookup above finds a node pool whose name differs only in case.
+	// A PUT with such a name is taken as creating a second node pool.
+	if updating && request.Method == http.MethodPut && doc.ResourceId.Name != resourceID.Name {
+		logger.Error(fmt.Sprintf("node pool name %s collides with existing node pool %s", resourceID.Name, doc.ResourceId.Name))
+		arm.WriteError(writer, http.StatusConflict,
+			arm.CloudErrorCodeConflict, resourceID.String(),
+			"Node pool name '%s' conflicts with existing node pool '%s' in cluster '%s'. Node pool names are case-insensitive.",
+			resourceID.Name, doc.ResourceId.Name, resourceID.GetParent().Name)
+		return
+	}
+
+	var currentNodePool *api.HCPOpenShiftClusterNodePool
 	var versionedCurrentNodePool api.VersionedHCPOpenShiftClusterNodePool
 	var versionedRequestNodePool api.VersionedHCPOpenShiftClusterNodePool
 	var successStatusCode int
@@ -85,7 +104,8 @@ func (f *Frontend) CreateOrUpdateNodePool(writer http.ResponseWriter, request *h
 			return
 		}
 
-		hcpNodePool := ConvertCStoNodePool(resourceID, csNodePool)
+		currentNodePool = ConvertCStoNodePool(resourceID, csNodePool)
+		hcpNodePool := currentNodePool
 
 		// Do not set the TrackedResource.Tags field here. We need
 		// the Tags map to remain nil so we can see if the request
@@ -136,6 +156,12 @@ func (f *Frontend) CreateOrUpdateNodePool(writer http.ResponseWriter, request *h
 		arm.WriteInternalServerError(writer)
 		return
 	}
+	cloudError = CheckBodyName(resourceID, body)
+	if cloudError != nil {
+		logger.Error(cloudError.Error())
+		arm.WriteCloudError(writer, cloudError)
+		return
+	}
 	if err = json.Unmarshal(body, versionedRequestNodePool); err != nil {
 		logger.Error(err.Error())
 		arm.WriteInvalidRequestContentError(writer, err)
@@ -152,7 +178,57 @@ func (f *Frontend) CreateOrUpdateNodePool(writer http.ResponseWriter, request *h
 	hcpNodePool := api.NewDefaultHCPOpenShiftClusterNodePool()
 	versionedRequestNodePool.Normalize(hcpNodePool)
 
+	cloudError = api.ValidateResourceReferences(resourceID, hcpNodePool.ResourceReferences())
+	if cloudError != nil {
+		logger.Error(cloudError.Error())
+		arm.WriteCloudError(writer, cloudError)
+		return
+	}
+
+	if updating && !strings.EqualFold(request.Header.Get(HeaderNameAllowNodePoolShrink), "true") {
+		cloudError = f.checkNodePoolShrink(resourceID, currentNodePool, hcpNodePool)
+		if cloudError != nil {
+			logger.Error(cloudError.Error())
+			arm.WriteCloudError(writer, cloudError)
+			return
+		}
+	}
+
+	if !updating {
+		nodePoolCount, err := f.countNodePools(ctx, resourceID.GetParent())
+		if err != nil {
+			logger.Error(err.Error())
+			arm.WriteInternalServerError(writer)
+			return
+		}
+		policy, err := f.getSubscriptionPolicy(ctx, resourceID.SubscriptionID)
+		if err != nil {
+			logger.Error(err.Error())
+			arm.WriteInternalServerError(writer)
+			return
+		}
+		if maxNodePools := policy.MaxNodePools; nodePoolCount >= maxNodePools {
+			arm.WriteError(writer, http.StatusBadRequest,
+				arm.CloudErrorCodeNodePoolLimitExceeded, resourceID.String(),
+				"Cluster '%s' already has the maximum number of node pools (%d).",
+				resourceID.GetParent().Name, maxNodePools)
+			return
+		}
+	}
+
 	hcpNodePool.Name = request.PathValue(PathSegmentNodePoolName)
+
+	cloudError = f.runValidationHooks(ctx, ValidationRequest{
+		Operation:  operationRequest,
+		ResourceID: resourceID,
+		Resource:   hcpNodePool,
+	})
+	if cloudError != nil {
+		logger.Error(cloudError.Error())
+		arm.WriteCloudError(writer, cloudError)
+		return
+	}
+
 	csNodePool, err := f.BuildCSNodePool(ctx, hcpNodePool, updating)
 	if err != nil {
 		logger.Error(err.Error())
@@ -259,6 +335,18 @@ func (f *Frontend) CreateOrUpdateNodePool(writer http.ResponseWriter, request *h
 		}
 	}
 
+	if f.config.SynchronousOperations {
+		doc, err = f.CompleteOperation(ctx, writer, operationDoc)
+		if err != nil {
+			logger.Error(err.Error())
+			arm.WriteInternalServerError(writer)
+			return
+		}
+		if successStatusCode == http.StatusAccepted {
+			successStatusCode = http.StatusOK
+		}
+	}
+
 	responseBody, err := marshalCSNodePool(csNodePool, doc, versionedInterface)
 	if err != nil {
 		logger.Error(err.Error())
@@ -281,3 +369,54 @@ func marshalCSNodePool(csNodePool *cmv1.NodePool, doc *database.ResourceDocument
 
 	return arm.Marshal(versionedInterface.NewHCPOpenShiftClusterNodePool(hcpNodePool))
 }
+
+// countNodePools returns the number of node pools in the given cluster.
+func (f *Frontend) countNodePools(ctx context.Context, clusterResourceID *arm.ResourceID) (int, error) {
+	var count int
+
+	iterator := f.dbClient.ListResourceDocs(ctx, clusterResourceID, -1, nil)
+
+	for item := range iterator.Items(ctx) {
+		var doc database.ResourceDocument
+		err := json.Unmarshal(item, &doc)
+		if err != nil {
+			return 0, err
+		}
+		if strings.EqualFold(doc.ResourceId.ResourceType.String(), api.NodePoolResourceType.String()) {
+			count++
+		}
+	}
+
+	err := iterator.GetError()
+	if err != nil {
+		return 0, err
+	}
+
+	return count, nil
+}
+
+// minimumReplicas returns the fewest replicas the node pool may run with.
+func minimumReplicas(nodePool *api.HCPOpenShiftClusterNodePool) int32 {
+	if nodePool.Properties.Spec.AutoScaling != nil {
+		return nodePool.Properties.Spec.AutoScaling.Min
+	}
+	return nodePool.Properties.Spec.Replicas
+}
+
+// checkNodePoolShrink returns an error if updating the current node pool
+// to the requested node pool would shrink it below the configured minimum.
+func (f *Frontend) checkNodePoolShrink(resourceID *arm.ResourceID, current, requested *api.HCPOpenShiftClusterNodePool) *arm.CloudError {
+	currentReplicas := minimumReplicas(current)
+	requestedReplicas := minimumReplicas(requested)
+
+	if requestedReplicas < currentReplicas && requestedReplicas < f.config.MinNodePoolReplicas {
+		return arm.NewCloudError(http.StatusBadRequest,
+			arm.CloudErrorCodeInvalidRequestContent, resourceID.String(),
+			"Node pool '%s' cannot shrink from %d to %d replicas, below the minimum of %d. "+
+				"Set the '%s' header to 'true' to allow it.",
+			resourceID.Name, currentReplicas, requestedReplicas,
+			f.config.MinNodePoolReplicas, HeaderNameAllowNodePoolShrink)
+	}
+
+	return nil
+}
@@ -279,3 +279,331 @@ func TestCreateNodePool(t *testing.T) {
 // 		})
 // 	}
 // }
+
+func TestCreateNodePoolLimit(t *testing.T) {
+	const maxNodePools = 2
+
+	f, ts := newTestListServer(t)
+	cluster := addTestCluster(t, f, dummyClusterName, nil)
+
+	f.config.MaxNodePools = maxNodePools
+
+	requestBody := generated.HcpOpenShiftClusterNodePoolResource{
+		Location:   &dummyLocation,
+		Properties: &generated.NodePoolProperties{Spec: &generated.NodePoolSpec{Platform: &generated.NodePoolPlatformProfile{VMSize: &dummyVMSize}, Version: &generated.VersionProfile{ID: &dummyVersionID, ChannelGroup: &dummyChannelGroup}}},
+	}
+	body, err := json.Marshal(requestBody)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		nodePoolName       string
+		expectedStatusCode int
+	}{
+		{
+			nodePoolName:       "nodepool-1",
+			expectedStatusCode: http.StatusCreated,
+		},
+		{
+			nodePoolName:       "nodepool-2",
+			expectedStatusCode: http.StatusCreated,
+		},
+		{
+			nodePoolName:       "nodepool-3",
+			expectedStatusCode: http.StatusBadRequest,
+		},
+	}
+
+	// Subtests run in order, each adding to the same cluster.
+	for _, test := range tests {
+		t.Run(test.nodePoolName, func(t *testing.T) {
+			requestURL := ts.URL + cluster.ResourceId.String() + "/" + api.NodePoolResourceTypeName + "/" + test.nodePoolName + "?api-version=2024-06-10-preview"
+
+			req, err := http.NewRequest(http.MethodPut, requestURL, bytes.NewReader(body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set(arm.HeaderNameARMResourceSystemData, "{}")
+
+			rs, err := ts.Client().Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer rs.Body.Close()
+
+			if rs.StatusCode != test.expectedStatusCode {
+				t.Fatalf("expected status code %d, got %d", test.expectedStatusCode, rs.StatusCode)
+			}
+
+			if rs.StatusCode == http.StatusBadRequest {
+				var cloudError arm.CloudError
+				err = json.NewDecoder(rs.Body).Decode(&cloudError)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if cloudError.CloudErrorBody == nil || cloudError.Code != arm.CloudErrorCodeNodePoolLimitExceeded {
+					t.Errorf("expected error code %s, got %+v", arm.CloudErrorCodeNodePoolLimitExceeded, cloudError.CloudErrorBody)
+				}
+			}
+		})
+	}
+}
+
+func TestUpdateNodePoolShrink(t *testing.T) {
+	const minReplicas = 2
+
+	f, ts := newTestListServer(t)
+	cluster := addTestCluster(t, f, dummyClusterName, nil)
+
+	f.config.MinNodePoolReplicas = minReplicas
+	// Complete operations inline so each update can follow the last.
+	f.config.SynchronousOperations = true
+
+	requestURL := ts.URL + cluster.ResourceId.String() + "/" + api.NodePoolResourceTypeName + "/" + dummyNodePoolName + "?api-version=2024-06-10-preview"
+
+	tests := []struct {
+		name               string
+		method             string
+		body               generated.HcpOpenShiftClusterNodePoolResource
+		allowShrink        bool
+		expectedStatusCode int
+	}{
+		{
+			name:   "Create with 3 replicas",
+			method: http.MethodPut,
+			body: generated.HcpOpenShiftClusterNodePoolResource{
+				Location:   &dummyLocation,
+				Properties: &generated.NodePoolProperties{Spec: &generated.NodePoolSpec{Replicas: api.Ptr[int32](3), Platform: &generated.NodePoolPlatformProfile{VMSize: &dummyVMSize}, Version: &generated.VersionProfile{ID: &dummyVersionID, ChannelGroup: &dummyChannelGroup}}},
+			},
+			expectedStatusCode: http.StatusCreated,
+		},
+		{
+			name:   "Shrink to the minimum",
+			method: http.MethodPatch,
+			body: generated.HcpOpenShiftClusterNodePoolResource{
+				Properties: &generated.NodePoolProperties{Spec: &generated.NodePoolSpec{Replicas: api.Ptr[int32](minReplicas)}},
+			},
+			expectedStatusCode: http.StatusOK,
+		},
+		{
+			name:   "Shrink below the minimum",
+			method: http.MethodPatch,
+			body: generated.HcpOpenShiftClusterNodePoolResource{
+				Properties: &generated.NodePoolProperties{Spec: &generated.NodePoolSpec{Replicas: api.Ptr[int32](1)}},
+			},
+			expectedStatusCode: http.StatusBadRequest,
+		},
+		{
+			name:   "Shrink below the minimum with override",
+			method: http.MethodPatch,
+			body: generated.HcpOpenShiftClusterNodePoolResource{
+				Properties: &generated.NodePoolProperties{Spec: &generated.NodePoolSpec{Replicas: api.Ptr[int32](1)}},
+			},
+			allowShrink:        true,
+			expectedStatusCode: http.StatusOK,
+		},
+		{
+			name:   "Grow while below the minimum",
+			method: http.MethodPatch,
+			body: generated.HcpOpenShiftClusterNodePoolResource{
+				Properties: &generated.NodePoolProperties{Spec: &generated.NodePoolSpec{Replicas: api.Ptr[int32](minReplicas)}},
+			},
+			expectedStatusCode: http.StatusOK,
+		},
+	}
+
+	// Subtests run in order, each updating the same node pool.
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			body, err := json.Marshal(test.body)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			req, err := http.NewRequest(test.method, requestURL, bytes.NewReader(body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set(arm.HeaderNameARMResourceSystemData, "{}")
+			if test.allowShrink {
+				req.Header.Set(HeaderNameAllowNodePoolShrink, "true")
+			}
+
+			rs, err := ts.Client().Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer rs.Body.Close()
+
+			if rs.StatusCode != test.expectedStatusCode {
+				t.Fatalf("expected status code %d, got %d", test.expectedStatusCode, rs.StatusCode)
+			}
+
+			if rs.StatusCode == http.StatusBadRequest {
+				var cloudError arm.CloudError
+				err = json.NewDecoder(rs.Body).Decode(&cloudError)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if cloudError.CloudErrorBody == nil || cloudError.Code != arm.CloudErrorCodeInvalidRequestContent {
+					t.Errorf("expected error code %s, got %+v", arm.CloudErrorCodeInvalidRequestContent, cloudError.CloudErrorBody)
+				}
+			}
+		})
+	}
+}
+
+func TestCreateNodePoolNameMismatch(t *testing.T) {
+	f, ts := newTestListServer(t)
+	cluster := addTestCluster(t, f, dummyClusterName, nil)
+
+	f.config.SynchronousOperations = true
+
+	tests := []struct {
+		name               string
+		pathName           string
+		bodyName           *string
+		expectedStatusCode int
+	}{
+		{
+			name:               "No body name",
+			pathName:           "nodepool-1",
+			expectedStatusCode: http.StatusCreated,
+		},
+		{
+			name:               "Matching body name",
+			pathName:           "nodepool-2",
+			bodyName:           api.Ptr("nodepool-2"),
+			expectedStatusCode: http.StatusCreated,
+		},
+		{
+			name:               "Mismatched body name",
+			pathName:           "nodepool-3",
+			bodyName:           api.Ptr("nodepool-4"),
+			expectedStatusCode: http.StatusBadRequest,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			body, err := json.Marshal(generated.HcpOpenShiftClusterNodePoolResource{
+				Name:       test.bodyName,
+				Location:   &dummyLocation,
+				Properties: &generated.NodePoolProperties{Spec: &generated.NodePoolSpec{Replicas: api.Ptr[int32](3), Platform: &generated.NodePoolPlatformProfile{VMSize: &dummyVMSize}, Version: &generated.VersionProfile{ID: &dummyVersionID, ChannelGroup: &dummyChannelGroup}}},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			requestURL := ts.URL + cluster.ResourceId.String() + "/" + api.NodePoolResourceTypeName + "/" + test.pathName + "?api-version=2024-06-10-preview"
+
+			req, err := http.NewRequest(http.MethodPut, requestURL, bytes.NewReader(body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set(arm.HeaderNameARMResourceSystemData, "{}")
+
+			rs, err := ts.Client().Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer rs.Body.Close()
+
+			if rs.StatusCode != test.expectedStatusCode {
+				t.Fatalf("expected status code %d, got %d", test.expectedStatusCode, rs.StatusCode)
+			}
+
+			if rs.StatusCode == http.StatusBadRequest {
+				var cloudError arm.CloudError
+				err = json.NewDecoder(rs.Body).Decode(&cloudError)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if cloudError.CloudErrorBody == nil || cloudError.Code != arm.CloudErrorCodeNameMismatch {
+					t.Errorf("expected error code %s, got %+v", arm.CloudErrorCodeNameMismatch, cloudError.CloudErrorBody)
+				}
+			}
+		})
+	}
+}
+
+func TestCreateNodePoolNameCollision(t *testing.T) {
+	f, ts := newTestListServer(t)
+	cluster := addTestCluster(t, f, dummyClusterName, nil)
+
+	f.config.SynchronousOperations = true
+
+	// Steps run in order against the same cluster.
+	tests := []struct {
+		name               string
+		pathName           string
+		expectedStatusCode int
+	}{
+		{
+			name:               "Create node pool",
+			pathName:           "pool1",
+			expectedStatusCode: http.StatusCreated,
+		},
+		{
+			name:               "Name differing only in case",
+			pathName:           "POOL1",
+			expectedStatusCode: http.StatusConflict,
+		},
+		{
+			name:               "Distinct name",
+			pathName:           "pool2",
+			expectedStatusCode: http.StatusCreated,
+		},
+		{
+			name:               "Same name updates",
+			pathName:           "pool1",
+			expectedStatusCode: http.StatusOK,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			body, err := json.Marshal(generated.HcpOpenShiftClusterNodePoolResource{
+				Location:   &dummyLocation,
+				Properties: &generated.NodePoolProperties{Spec: &generated.NodePoolSpec{Replicas: api.Ptr[int32](3), Platform: &generated.NodePoolPlatformProfile{VMSize: &dummyVMSize}, Version: &generated.VersionProfile{ID: &dummyVersionID, ChannelGroup: &dummyChannelGroup}}},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			requestURL := ts.URL + cluster.ResourceId.String() + "/" + api.NodePoolResourceTypeName + "/" + test.pathName + "?api-version=2024-06-10-preview"
+
+			req, err := http.NewRequest(http.MethodPut, requestURL, bytes.NewReader(body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set(arm.HeaderNameARMResourceSystemData, "{}")
+
+			rs, err := ts.Client().Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer rs.Body.Close()
+
+			if rs.StatusCode != test.expectedStatusCode {
+				t.Fatalf("expected status code %d, got %d", test.expectedStatusCode, rs.StatusCode)
+			}
+
+			if rs.StatusCode == http.StatusConflict {
+				var cloudError arm.CloudError
+				err = json.NewDecoder(rs.Body).Decode(&cloudError)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if cloudError.CloudErrorBody == nil || cloudError.Code != arm.CloudErrorCodeConflict {
+					t.Errorf("expected error code %s, got %+v", arm.CloudErrorCodeConflict, cloudError.CloudErrorBody)
+				}
+			}
+		})
+	}
+}
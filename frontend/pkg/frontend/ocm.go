@@ -183,7 +183,7 @@ func (f *Frontend) BuildCSCluster(resourceID *arm.ResourceID, requestHeader http
 			Flavour(cmv1.NewFlavour().
 				ID(csFlavourId)).
 			Region(cmv1.NewCloudRegion().
-				ID(f.location)).
+				ID(f.config.Location)).
 			CloudProvider(cmv1.NewCloudProvider().
 				ID(csCloudProvider)).
 			Product(cmv1.NewProduct().
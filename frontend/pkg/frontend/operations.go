@@ -5,18 +5,106 @@ package frontend
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"log/slog"
 	"net/http"
 	"net/url"
 	"path"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/Azure/ARO-HCP/internal/api"
 	"github.com/Azure/ARO-HCP/internal/api/arm"
 	"github.com/Azure/ARO-HCP/internal/database"
 )
 
+const (
+	// MaxOperationWait caps how long a client can ask an operation
+	// endpoint to wait for the operation to reach a terminal state,
+	// unless configured otherwise.
+	MaxOperationWait = 60 * time.Second
+
+	// DefaultMaxOperationWaiters is the number of operation result
+	// requests that may wait at once unless configured otherwise.
+	DefaultMaxOperationWaiters = 100
+)
+
+// operationPollInterval is how often a waiting request re-reads the
+// operation document. Tests shorten this.
+var operationPollInterval = time.Second
+
+// ParseOperationWait returns the duration requested by the optional "wait"
+// query parameter, in seconds, capped at maxWait. A missing parameter
+// returns zero, meaning do not wait.
+func ParseOperationWait(request *http.Request, maxWait time.Duration) (time.Duration, *arm.CloudError) {
+	value := request.URL.Query().Get(WaitKey)
+	if value == "" {
+		return 0, nil
+	}
+
+	seconds, err := strconv.Atoi(value)
+	if err != nil || seconds < 0 {
+		return 0, arm.NewCloudError(
+			http.StatusBadRequest,
+			arm.CloudErrorCodeInvalidParameter, "",
+			"The value '%s' of parameter '%s' must be a non-negative number of seconds.",
+			value, WaitKey)
+	}
+
+	return min(time.Duration(seconds)*time.Second, maxWait), nil
+}
+
+// acquireOperationWaiter reserves one of the limited slots for requests
+// waiting on an operation, returning false if all slots are taken. Call
+// releaseOperationWaiter after waiting if this returns true.
+func (f *Frontend) acquireOperationWaiter() bool {
+	if f.operationWaiters.Add(1) > int64(f.getMaxOperationWaiters()) {
+		f.operationWaiters.Add(-1)
+		return false
+	}
+	return true
+}
+
+// releaseOperationWaiter frees a slot reserved by acquireOperationWaiter.
+func (f *Frontend) releaseOperationWaiter() {
+	f.operationWaiters.Add(-1)
+}
+
+// WaitForOperation re-reads the operation document until it reaches a
+// terminal state, the wait duration elapses or the context is cancelled,
+// and then returns the most recently read operation document.
+func (f *Frontend) WaitForOperation(ctx context.Context, doc *database.OperationDocument, wait time.Duration) (*database.OperationDocument, error) {
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+
+	ticker := time.NewTicker(operationPollInterval)
+	defer ticker.Stop()
+
+	for !doc.Status.IsTerminal() {
+		select {
+		case <-ctx.Done():
+			return doc, nil
+		case <-timer.C:
+			return doc, nil
+		case <-ticker.C:
+			latest, err := f.dbClient.GetOperationDoc(ctx, doc.ID)
+			if err != nil {
+				// A cancelled request is not an error.
+				if ctx.Err() != nil {
+					return doc, nil
+				}
+				return nil, err
+			}
+			doc = latest
+		}
+	}
+
+	return doc, nil
+}
+
 // AddAsyncOperationHeader adds an "Azure-AsyncOperation" header to the ResponseWriter
 // with a URL of the operation status endpoint for the given OperationDocument.
 func (f *Frontend) AddAsyncOperationHeader(writer http.ResponseWriter, request *http.Request, doc *database.OperationDocument) {
@@ -83,6 +171,24 @@ func (f *Frontend) AddLocationHeader(writer http.ResponseWriter, request *http.R
 	writer.Header().Set("Location", u.String())
 }
 
+// AddOperationIDHeader adds an "X-Ms-Operation-Id" header to the ResponseWriter
+// with the ID of the latest operation for the given resource, so clients can
+// correlate the resource's current state with the operation that produced it.
+// The header is omitted if the resource has no operations.
+func (f *Frontend) AddOperationIDHeader(ctx context.Context, writer http.ResponseWriter, resourceID *arm.ResourceID) {
+	logger := LoggerFromContext(ctx)
+
+	doc, err := f.dbClient.GetLatestOperationForResource(ctx, resourceID.String())
+	if errors.Is(err, database.ErrNotFound) {
+		return
+	} else if err != nil {
+		logger.Error(err.Error())
+		return
+	}
+
+	writer.Header().Set(arm.HeaderNameOperationID, doc.ID)
+}
+
 // ExposeOperation fully initiates a new asynchronous operation by enriching
 // the operation database item and adding the necessary response headers.
 func (f *Frontend) ExposeOperation(writer http.ResponseWriter, request *http.Request, operationID string) error {
@@ -94,7 +200,7 @@ func (f *Frontend) ExposeOperation(writer http.ResponseWriter, request *http.Req
 		operationID, err := arm.ParseResourceID(path.Join("/",
 			"subscriptions", updateDoc.ExternalID.SubscriptionID,
 			"providers", api.ProviderNamespace,
-			"locations", f.location,
+			"locations", arm.NormalizeLocation(f.config.Location),
 			api.OperationStatusResourceTypeName, operationID))
 		if err != nil {
 			LoggerFromContext(ctx).Error(err.Error())
@@ -105,6 +211,7 @@ func (f *Frontend) ExposeOperation(writer http.ResponseWriter, request *http.Req
 		updateDoc.ClientID = request.Header.Get(arm.HeaderNameClientObjectID)
 		updateDoc.OperationID = operationID
 		updateDoc.NotificationURI = request.Header.Get(arm.HeaderNameAsyncNotificationURI)
+		updateDoc.APIVersion = request.URL.Query().Get(APIVersionKey)
 
 		// If ARM passed a notification URI, acknowledge it.
 		if updateDoc.NotificationURI != "" {
@@ -127,11 +234,118 @@ func (f *Frontend) ExposeOperation(writer http.ResponseWriter, request *http.Req
 		writer.Header().Del(arm.HeaderNameAsyncNotification)
 		writer.Header().Del(arm.HeaderNameAsyncOperation)
 		writer.Header().Del("Location")
+	} else {
+		writer.Header().Set(arm.HeaderNameOperationID, operationID)
 	}
 
 	return err
 }
 
+// OperationVersion returns the API version of the request that initiated
+// the operation, so the operation result is rendered with the same schema
+// regardless of the API version used to poll it. It falls back to the
+// given version if the operation did not record one or the recorded API
+// version is no longer registered.
+func OperationVersion(doc *database.OperationDocument, fallback api.Version) api.Version {
+	if doc.APIVersion != "" {
+		if version, ok := api.Lookup(doc.APIVersion); ok {
+			return version
+		}
+	}
+	return fallback
+}
+
+// CompleteOperation finishes an operation inline instead of leaving it
+// for the backend, updating the operation and resource documents as the
+// backend would and removing the asynchronous operation response headers.
+// It returns the updated resource document, or nil if the operation deleted
+// the resource. This is only used when synchronous operations are enabled.
+func (f *Frontend) CompleteOperation(ctx context.Context, writer http.ResponseWriter, operationDoc *database.OperationDocument) (*database.ResourceDocument, error) {
+	const opStatus arm.ProvisioningState = arm.ProvisioningStateSucceeded
+
+	writer.Header().Del(arm.HeaderNameAsyncNotification)
+	writer.Header().Del(arm.HeaderNameAsyncOperation)
+	writer.Header().Del("Location")
+
+	if operationDoc.Request == database.OperationRequestDelete {
+		// Collect child resources before deleting anything so the
+		// iterator is not disturbed. Cluster Service deletes child
+		// resources along with their parent.
+		var children []*database.ResourceDocument
+
+		iterator := f.dbClient.ListResourceDocs(ctx, operationDoc.ExternalID, -1, nil)
+		for item := range iterator.Items(ctx) {
+			var child database.ResourceDocument
+			err := json.Unmarshal(item, &child)
+			if err != nil {
+				return nil, err
+			}
+			children = append(children, &child)
+		}
+		err := iterator.GetError()
+		if err != nil {
+			return nil, err
+		}
+
+		for _, child := range children {
+			if child.ActiveOperationID != "" {
+				_, err = f.dbClient.UpdateOperationDoc(ctx, child.ActiveOperationID, func(updateDoc *database.OperationDocument) bool {
+					return updateDoc.UpdateStatus(opStatus, nil)
+				})
+				if err != nil && !errors.Is(err, database.ErrNotFound) {
+					return nil, err
+				}
+			}
+			err = f.deleteResourceDocs(ctx, child.ResourceId)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		err = f.deleteResourceDocs(ctx, operationDoc.ExternalID)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	_, err := f.dbClient.UpdateOperationDoc(ctx, operationDoc.ID, func(updateDoc *database.OperationDocument) bool {
+		return updateDoc.UpdateStatus(opStatus, nil)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if operationDoc.Request == database.OperationRequestDelete {
+		return nil, nil
+	}
+
+	_, err = f.dbClient.UpdateResourceDoc(ctx, operationDoc.ExternalID, func(updateDoc *database.ResourceDocument) bool {
+		if updateDoc.ActiveOperationID != operationDoc.ID {
+			return false
+		}
+		updateDoc.ProvisioningState = opStatus
+		updateDoc.ActiveOperationID = ""
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return f.dbClient.GetResourceDoc(ctx, operationDoc.ExternalID)
+}
+
+// deleteResourceDocs deletes a resource document along with any
+// documents associated with the resource.
+func (f *Frontend) deleteResourceDocs(ctx context.Context, resourceID *arm.ResourceID) error {
+	err := f.dbClient.DeleteResourceDoc(ctx, resourceID)
+	if err != nil {
+		return err
+	}
+
+	// Diagnostic settings do not outlive the resource they belong to.
+	return f.dbClient.DeleteDiagnosticSettingsDoc(ctx, resourceID)
+}
+
 // CancelActiveOperation marks the status of any active operation on the resource as canceled.
 func (f *Frontend) CancelActiveOperation(ctx context.Context, resourceDoc *database.ResourceDocument) error {
 	if resourceDoc.ActiveOperationID != "" {
@@ -150,6 +364,39 @@ func (f *Frontend) CancelActiveOperation(ctx context.Context, resourceDoc *datab
 	return nil
 }
 
+// getOperationDoc retrieves the operation document with the given ID for
+// a client. Operations which never existed and operations which have been
+// purged after expiring are told apart, since the document of an expired
+// operation lingers as a tombstone for some time.
+func (f *Frontend) getOperationDoc(ctx context.Context, resourceID *arm.ResourceID) (*database.OperationDocument, *arm.CloudError) {
+	doc, err := f.dbClient.GetOperationDoc(ctx, resourceID.Name)
+	if errors.Is(err, database.ErrNotFound) {
+		return nil, newOperationNotFoundError(resourceID)
+	} else if err != nil {
+		return nil, toCloudError(ctx, err, resourceID)
+	}
+	if doc.Expired(time.Now()) {
+		return nil, arm.NewCloudError(
+			http.StatusNotFound,
+			arm.CloudErrorCodeOperationExpired,
+			resourceID.String(),
+			"The operation '%s' has expired and its result is no longer available.",
+			resourceID.Name)
+	}
+	return doc, nil
+}
+
+// newOperationNotFoundError creates a CloudError for an operation that
+// does not exist or is not visible to the client.
+func newOperationNotFoundError(resourceID *arm.ResourceID) *arm.CloudError {
+	return arm.NewCloudError(
+		http.StatusNotFound,
+		arm.CloudErrorCodeOperationNotFound,
+		resourceID.String(),
+		"The operation '%s' was not found.",
+		resourceID.Name)
+}
+
 // OperationIsVisible returns true if the request is being called from the same
 // tenant and subscription that the operation originated in.
 func (f *Frontend) OperationIsVisible(request *http.Request, doc *database.OperationDocument) bool {
@@ -183,3 +430,49 @@ func (f *Frontend) OperationIsVisible(request *http.Request, doc *database.Opera
 
 	return visible
 }
+
+// ActiveOperations returns all operations that have not yet reached a terminal status.
+func (f *Frontend) ActiveOperations(ctx context.Context) ([]*database.OperationDocument, error) {
+	var activeOperations []*database.OperationDocument
+
+	iterator := f.dbClient.ListAllOperationDocs(ctx)
+
+	for item := range iterator.Items(ctx) {
+		var doc *database.OperationDocument
+
+		err := json.Unmarshal(item, &doc)
+		if err != nil {
+			return nil, err
+		}
+
+		if !doc.Status.IsTerminal() {
+			activeOperations = append(activeOperations, doc)
+		}
+	}
+
+	err := iterator.GetError()
+	if err != nil {
+		return nil, err
+	}
+
+	return activeOperations, nil
+}
+
+// logActiveOperations logs each operation that has not yet reached a terminal status.
+func (f *Frontend) logActiveOperations(ctx context.Context, logger *slog.Logger) {
+	activeOperations, err := f.ActiveOperations(ctx)
+	if err != nil {
+		logger.Error(fmt.Sprintf("Failed to list active operations: %v", err))
+		return
+	}
+
+	logger.Info(fmt.Sprintf("%d operations in progress", len(activeOperations)))
+
+	for _, doc := range activeOperations {
+		logger.Info(fmt.Sprintf("Operation '%s' in progress", doc.ID),
+			"operation", doc.Request,
+			"operation_id", doc.ID,
+			"resource_id", doc.ExternalID.String(),
+			"status", doc.Status)
+	}
+}
@@ -0,0 +1,300 @@
+package frontend
+
+// Copyright (c) Microsoft Corporation.
+// Licensed under the Apache License 2.0.
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/Azure/ARO-HCP/internal/api"
+	"github.com/Azure/ARO-HCP/internal/api/arm"
+	"github.com/Azure/ARO-HCP/internal/database"
+)
+
+// HeaderNameQuotaRemaining is the response header that tells clients how
+// many more clusters their subscription can create.
+const HeaderNameQuotaRemaining = "X-Aro-Quota-Remaining"
+
+// HeaderNameWarning is the standard response header for non-fatal
+// warnings about an otherwise successful request.
+const HeaderNameWarning = "Warning"
+
+// quotaWarningPercent is the percentage of a subscription's cluster
+// quota in use at which create responses start to carry a warning.
+const quotaWarningPercent = 80
+
+// clusterQuotaWarning returns a Warning header value if usedClusters
+// has reached the soft warning threshold of maxClusters, or an empty
+// string otherwise. The value uses the miscellaneous persistent warning
+// code 299 so that clients which understand the header surface it.
+func clusterQuotaWarning(usedClusters, maxClusters int) string {
+	if maxClusters <= 0 || usedClusters*100 < maxClusters*quotaWarningPercent {
+		return ""
+	}
+
+	return fmt.Sprintf("299 - %q", fmt.Sprintf(
+		"Subscription is using %d of %d clusters allowed by its quota.",
+		usedClusters, maxClusters))
+}
+
+// remainingClustersWarning returns a warning message if a deleted
+// subscription still owned clusters, which are deleted along with it,
+// or an empty string otherwise.
+func remainingClustersWarning(subscriptionID string, progress *ClusterDeletionProgress) string {
+	if progress == nil || progress.Total == 0 {
+		return ""
+	}
+
+	return fmt.Sprintf(
+		"Subscription '%s' still owned %d clusters, which are being deleted (%d deletions started by this request).",
+		subscriptionID, progress.Total, progress.Started)
+}
+
+// previewFeatures lists the preview features which gate functionality
+// in the resource provider.
+var previewFeatures = []string{
+	api.FeatureExternalAuth,
+}
+
+// isPreviewFeatureEnabled returns true if the named preview feature is
+// either enabled globally or registered by the subscription.
+func (f *Frontend) isPreviewFeatureEnabled(subscription *arm.Subscription, feature string) bool {
+	for _, globalFeature := range f.config.GlobalPreviewFeatures {
+		if strings.EqualFold(globalFeature, feature) {
+			return true
+		}
+	}
+	return subscription.IsFeatureRegistered(feature)
+}
+
+// SubscriptionFeatures lists the preview features enabled for a
+// subscription, so that clients such as the Azure portal can show
+// only what the subscription is able to use.
+type SubscriptionFeatures struct {
+	EnabledFeatures []string `json:"enabledFeatures"`
+}
+
+// EnabledFeaturesPath is the path segment, appended to the provider
+// path of a subscription, of the endpoint listing its enabled preview
+// features.
+const EnabledFeaturesPath = "enabledFeatures"
+
+// ArmSubscriptionFeaturesGet returns the preview features enabled for
+// the subscription in the request, whether registered by the subscription
+// or enabled globally.
+func (f *Frontend) ArmSubscriptionFeaturesGet(writer http.ResponseWriter, request *http.Request) {
+	ctx := request.Context()
+	logger := LoggerFromContext(ctx)
+
+	subscription, err := SubscriptionFromContext(ctx)
+	if err != nil {
+		logger.Error(err.Error())
+		arm.WriteInternalServerError(writer)
+		return
+	}
+
+	features := SubscriptionFeatures{EnabledFeatures: []string{}}
+	for _, feature := range previewFeatures {
+		if f.isPreviewFeatureEnabled(subscription, feature) {
+			features.EnabledFeatures = append(features.EnabledFeatures, feature)
+		}
+	}
+
+	_, err = arm.WriteJSONResponse(writer, http.StatusOK, features)
+	if err != nil {
+		logger.Error(err.Error())
+	}
+}
+
+// SubscriptionPolicy describes the effective limits and flags applied to
+// a subscription, after merging the service defaults with any overrides
+// for the subscription.
+type SubscriptionPolicy struct {
+	SubscriptionID  string                `json:"subscriptionId"`
+	State           arm.SubscriptionState `json:"state"`
+	MaxNodePools    int                   `json:"maxNodePools"`
+	MaxClusters     int                   `json:"maxClusters"`
+	DefaultPageSize int32                 `json:"defaultPageSize"`
+	MaxPageSize     int32                 `json:"maxPageSize"`
+
+	// PreviewFeatures maps each gating preview feature to whether
+	// it is enabled for the subscription, globally or by registration.
+	PreviewFeatures map[string]bool `json:"previewFeatures"`
+
+	// Overridden names the settings which differ from the service
+	// defaults because of a subscription-specific override.
+	Overridden []string `json:"overridden"`
+}
+
+// subscriptionPolicy computes the effective policy for a subscription.
+func (f *Frontend) subscriptionPolicy(doc *database.SubscriptionDocument) SubscriptionPolicy {
+	defaultPageSize, maxPageSize := f.pageSizes()
+
+	policy := SubscriptionPolicy{
+		SubscriptionID:  doc.ID,
+		MaxNodePools:    f.getMaxNodePools(),
+		MaxClusters:     f.getMaxClusters(),
+		DefaultPageSize: defaultPageSize,
+		MaxPageSize:     maxPageSize,
+		PreviewFeatures: make(map[string]bool, len(previewFeatures)),
+		Overridden:      []string{},
+	}
+
+	if doc.Subscription != nil {
+		policy.State = doc.Subscription.State
+	}
+
+	for _, feature := range previewFeatures {
+		policy.PreviewFeatures[feature] = f.isPreviewFeatureEnabled(doc.Subscription, feature)
+	}
+
+	if doc.Overrides != nil {
+		if doc.Overrides.MaxNodePools != nil {
+			policy.MaxNodePools = *doc.Overrides.MaxNodePools
+			policy.Overridden = append(policy.Overridden, "maxNodePools")
+		}
+		if doc.Overrides.MaxClusters != nil {
+			policy.MaxClusters = *doc.Overrides.MaxClusters
+			policy.Overridden = append(policy.Overridden, "maxClusters")
+		}
+	}
+
+	return policy
+}
+
+// getSubscriptionPolicy fetches the subscription document and computes
+// its effective policy.
+func (f *Frontend) getSubscriptionPolicy(ctx context.Context, subscriptionID string) (SubscriptionPolicy, error) {
+	doc, err := f.dbClient.GetSubscriptionDoc(ctx, subscriptionID)
+	if err != nil {
+		return SubscriptionPolicy{}, err
+	}
+	return f.subscriptionPolicy(doc), nil
+}
+
+// SubscriptionPolicyPath is the path segment, appended to the provider
+// path of a subscription, of the endpoint returning its effective policy.
+const SubscriptionPolicyPath = "policy"
+
+// subscriptionNotFoundError returns the error for a request naming a
+// subscription that has no document.
+func subscriptionNotFoundError(subscriptionID string) *arm.CloudError {
+	resourceID, err := arm.ParseResourceID("/subscriptions/" + subscriptionID)
+	if err != nil {
+		return arm.NewCloudError(http.StatusBadRequest,
+			arm.CloudErrorCodeInvalidSubscriptionID,
+			"/subscriptions/"+subscriptionID,
+			"The provided subscription identifier '%s' is malformed or invalid.",
+			subscriptionID)
+	}
+	return arm.NewResourceNotFoundError(resourceID)
+}
+
+// writeSubscriptionPolicy writes the effective policy for a subscription.
+func (f *Frontend) writeSubscriptionPolicy(writer http.ResponseWriter, request *http.Request) {
+	ctx := request.Context()
+	logger := LoggerFromContext(ctx)
+
+	subscriptionID := request.PathValue(PathSegmentSubscriptionID)
+
+	policy, err := f.getSubscriptionPolicy(ctx, subscriptionID)
+	if errors.Is(err, database.ErrNotFound) {
+		arm.WriteCloudError(writer, subscriptionNotFoundError(subscriptionID))
+		return
+	} else if err != nil {
+		logger.Error(err.Error())
+		arm.WriteInternalServerError(writer)
+		return
+	}
+
+	_, err = arm.WriteJSONResponse(writer, http.StatusOK, policy)
+	if err != nil {
+		logger.Error(err.Error())
+	}
+}
+
+// ArmSubscriptionPolicyGet returns the effective policy for the
+// subscription in the request, so that clients can see the limits
+// they are held to. The policy cannot be changed through this endpoint.
+func (f *Frontend) ArmSubscriptionPolicyGet(writer http.ResponseWriter, request *http.Request) {
+	f.writeSubscriptionPolicy(writer, request)
+}
+
+// AdminSubscriptionPolicyGet returns the effective policy for a subscription.
+func (f *Frontend) AdminSubscriptionPolicyGet(writer http.ResponseWriter, request *http.Request) {
+	f.writeSubscriptionPolicy(writer, request)
+}
+
+// AdminSubscriptionOverridesPut replaces the overrides of a subscription
+// and returns its resulting effective policy. Settings omitted from the
+// request revert to the service defaults.
+func (f *Frontend) AdminSubscriptionOverridesPut(writer http.ResponseWriter, request *http.Request) {
+	ctx := request.Context()
+	logger := LoggerFromContext(ctx)
+
+	subscriptionID := request.PathValue(PathSegmentSubscriptionID)
+
+	body, err := BodyFromContext(ctx)
+	if err != nil {
+		logger.Error(err.Error())
+		arm.WriteInternalServerError(writer)
+		return
+	}
+
+	var overrides database.SubscriptionOverrides
+	err = DecodeStrictJSON(body, &overrides)
+	if err != nil {
+		logger.Error(err.Error())
+		arm.WriteInvalidRequestContentError(writer, err)
+		return
+	}
+
+	cloudError := validateSubscriptionOverrides(&overrides)
+	if cloudError != nil {
+		arm.WriteCloudError(writer, cloudError)
+		return
+	}
+
+	_, err = f.dbClient.UpdateSubscriptionDoc(ctx, subscriptionID, func(doc *database.SubscriptionDocument) bool {
+		if overrides == (database.SubscriptionOverrides{}) {
+			doc.Overrides = nil
+		} else {
+			doc.Overrides = &overrides
+		}
+		return true
+	})
+	if errors.Is(err, database.ErrNotFound) {
+		arm.WriteCloudError(writer, subscriptionNotFoundError(subscriptionID))
+		return
+	} else if err != nil {
+		arm.WriteCloudError(writer, toCloudError(ctx, err, nil))
+		return
+	}
+	logger.Info(fmt.Sprintf("replaced policy overrides for subscription %s", subscriptionID))
+
+	f.writeSubscriptionPolicy(writer, request)
+}
+
+// validateSubscriptionOverrides checks that each override is in range.
+func validateSubscriptionOverrides(overrides *database.SubscriptionOverrides) *arm.CloudError {
+	limits := []struct {
+		name  string
+		value *int
+	}{
+		{"maxNodePools", overrides.MaxNodePools},
+		{"maxClusters", overrides.MaxClusters},
+	}
+
+	for _, limit := range limits {
+		if limit.value != nil && *limit.value < 0 {
+			return arm.NewCloudError(http.StatusBadRequest,
+				arm.CloudErrorCodeInvalidRequestContent, limit.name,
+				"The override '%s' must not be negative.", limit.name)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,417 @@
+package frontend
+
+// Copyright (c) Microsoft Corporation.
+// Licensed under the Apache License 2.0.
+
+import (
+	"context"
+	"encoding/json"
+	"maps"
+	"net/http"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Azure/ARO-HCP/internal/api"
+	"github.com/Azure/ARO-HCP/internal/api/arm"
+	"github.com/Azure/ARO-HCP/internal/database"
+)
+
+func TestAdminSubscriptionPolicyGet(t *testing.T) {
+	const (
+		overriddenSubscriptionID = "11111111-1111-1111-1111-111111111111"
+		missingSubscriptionID    = "22222222-2222-2222-2222-222222222222"
+		maxNodePools             = 10
+		maxNodePoolsOverride     = 25
+	)
+
+	f, ts := newTestListServer(t)
+
+	f.config.MaxNodePools = maxNodePools
+
+	doc := database.NewSubscriptionDocument(overriddenSubscriptionID, &arm.Subscription{
+		State:            arm.SubscriptionStateWarned,
+		RegistrationDate: api.Ptr(time.Now().String()),
+		Properties: &arm.SubscriptionProperties{
+			RegisteredFeatures: &[]arm.Feature{
+				{Name: api.Ptr(api.FeatureExternalAuth), State: api.Ptr(arm.FeatureStateRegistered)},
+			},
+		},
+	})
+	doc.Overrides = &database.SubscriptionOverrides{
+		MaxNodePools: api.Ptr(maxNodePoolsOverride),
+	}
+	err := f.dbClient.CreateSubscriptionDoc(context.Background(), doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name               string
+		subscriptionID     string
+		expectedStatusCode int
+		expectedPolicy     *SubscriptionPolicy
+	}{
+		{
+			name:               "Defaults",
+			subscriptionID:     dummySubscrtiptionId,
+			expectedStatusCode: http.StatusOK,
+			expectedPolicy: &SubscriptionPolicy{
+				SubscriptionID:  dummySubscrtiptionId,
+				State:           arm.SubscriptionStateRegistered,
+				MaxNodePools:    maxNodePools,
+				MaxClusters:     DefaultMaxClusters,
+				DefaultPageSize: DefaultPageSize,
+				MaxPageSize:     MaxPageSize,
+				PreviewFeatures: map[string]bool{api.FeatureExternalAuth: false},
+				Overridden:      []string{},
+			},
+		},
+		{
+			name:               "Overrides",
+			subscriptionID:     overriddenSubscriptionID,
+			expectedStatusCode: http.StatusOK,
+			expectedPolicy: &SubscriptionPolicy{
+				SubscriptionID:  overriddenSubscriptionID,
+				State:           arm.SubscriptionStateWarned,
+				MaxNodePools:    maxNodePoolsOverride,
+				MaxClusters:     DefaultMaxClusters,
+				DefaultPageSize: DefaultPageSize,
+				MaxPageSize:     MaxPageSize,
+				PreviewFeatures: map[string]bool{api.FeatureExternalAuth: true},
+				Overridden:      []string{"maxNodePools"},
+			},
+		},
+		{
+			name:               "Missing subscription",
+			subscriptionID:     missingSubscriptionID,
+			expectedStatusCode: http.StatusNotFound,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rs, err := ts.Client().Get(ts.URL + "/admin/subscriptions/" + test.subscriptionID + "/policy")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer rs.Body.Close()
+
+			if rs.StatusCode != test.expectedStatusCode {
+				t.Fatalf("expected status code %d, got %d", test.expectedStatusCode, rs.StatusCode)
+			}
+
+			if test.expectedPolicy == nil {
+				return
+			}
+
+			var policy SubscriptionPolicy
+			err = json.NewDecoder(rs.Body).Decode(&policy)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if policy.SubscriptionID != test.expectedPolicy.SubscriptionID ||
+				policy.State != test.expectedPolicy.State ||
+				policy.MaxNodePools != test.expectedPolicy.MaxNodePools ||
+				policy.MaxClusters != test.expectedPolicy.MaxClusters ||
+				policy.DefaultPageSize != test.expectedPolicy.DefaultPageSize ||
+				policy.MaxPageSize != test.expectedPolicy.MaxPageSize ||
+				!maps.Equal(policy.PreviewFeatures, test.expectedPolicy.PreviewFeatures) ||
+				!slices.Equal(policy.Overridden, test.expectedPolicy.Overridden) {
+				t.Errorf("expected policy %+v, got %+v", *test.expectedPolicy, policy)
+			}
+		})
+	}
+}
+
+func TestAdminSubscriptionOverridesPut(t *testing.T) {
+	const missingSubscriptionID = "22222222-2222-2222-2222-222222222222"
+
+	f, ts := newTestListServer(t)
+
+	put := func(subscriptionID, body string) *http.Response {
+		t.Helper()
+
+		req, err := http.NewRequest(http.MethodPut, ts.URL+"/admin/subscriptions/"+subscriptionID+"/policy/overrides", strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Content-Type", "application/json")
+
+		rs, err := ts.Client().Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { rs.Body.Close() })
+		return rs
+	}
+
+	tests := []struct {
+		name               string
+		subscriptionID     string
+		body               string
+		expectedStatusCode int
+		expectedOverridden []string
+	}{
+		{
+			name:               "Negative override",
+			subscriptionID:     dummySubscrtiptionId,
+			body:               `{"maxClusters": -1}`,
+			expectedStatusCode: http.StatusBadRequest,
+		},
+		{
+			name:               "Unknown override",
+			subscriptionID:     dummySubscrtiptionId,
+			body:               `{"maxWidgets": 1}`,
+			expectedStatusCode: http.StatusBadRequest,
+		},
+		{
+			name:               "Missing subscription",
+			subscriptionID:     missingSubscriptionID,
+			body:               `{"maxClusters": 5}`,
+			expectedStatusCode: http.StatusNotFound,
+		},
+		{
+			name:               "Override set",
+			subscriptionID:     dummySubscrtiptionId,
+			body:               `{"maxClusters": 5}`,
+			expectedStatusCode: http.StatusOK,
+			expectedOverridden: []string{"maxClusters"},
+		},
+		{
+			name:               "Overrides cleared",
+			subscriptionID:     dummySubscrtiptionId,
+			body:               `{}`,
+			expectedStatusCode: http.StatusOK,
+			expectedOverridden: []string{},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rs := put(test.subscriptionID, test.body)
+
+			if rs.StatusCode != test.expectedStatusCode {
+				t.Fatalf("expected status code %d, got %d", test.expectedStatusCode, rs.StatusCode)
+			}
+
+			if test.expectedOverridden == nil {
+				return
+			}
+
+			var policy SubscriptionPolicy
+			err := json.NewDecoder(rs.Body).Decode(&policy)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !slices.Equal(policy.Overridden, test.expectedOverridden) {
+				t.Errorf("expected overridden settings %v, got %v", test.expectedOverridden, policy.Overridden)
+			}
+		})
+	}
+
+	doc, err := f.dbClient.GetSubscriptionDoc(context.Background(), dummySubscrtiptionId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if doc.Overrides != nil {
+		t.Errorf("expected the overrides to be cleared, got %+v", doc.Overrides)
+	}
+}
+
+func TestArmSubscriptionPolicyGet(t *testing.T) {
+	const maxClustersOverride = 5
+
+	f, ts := newTestListServer(t)
+
+	_, err := f.dbClient.UpdateSubscriptionDoc(context.Background(), dummySubscrtiptionId, func(doc *database.SubscriptionDocument) bool {
+		doc.Overrides = &database.SubscriptionOverrides{MaxClusters: api.Ptr(maxClustersOverride)}
+		return true
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	policyURL := ts.URL + "/subscriptions/" + dummySubscrtiptionId +
+		"/providers/" + api.ProviderNamespace + "/" + SubscriptionPolicyPath + "?api-version=2024-06-10-preview"
+
+	rs, err := ts.Client().Get(policyURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rs.Body.Close()
+
+	if rs.StatusCode != http.StatusOK {
+		t.Fatalf("expected status code %d, got %d", http.StatusOK, rs.StatusCode)
+	}
+
+	var policy SubscriptionPolicy
+	err = json.NewDecoder(rs.Body).Decode(&policy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if policy.MaxClusters != maxClustersOverride || !slices.Equal(policy.Overridden, []string{"maxClusters"}) {
+		t.Errorf("expected the overridden cluster limit, got %+v", policy)
+	}
+
+	// The policy is read-only on the ARM surface.
+	req, err := http.NewRequest(http.MethodPut, policyURL, strings.NewReader(`{"maxClusters": 100}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	rs, err = ts.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rs.Body.Close()
+
+	if rs.StatusCode < http.StatusBadRequest {
+		t.Errorf("expected the policy not to be writable, got status code %d", rs.StatusCode)
+	}
+}
+
+func TestArmSubscriptionFeaturesGet(t *testing.T) {
+	const (
+		registeredSubscriptionID = "11111111-1111-1111-1111-111111111111"
+		pendingSubscriptionID    = "22222222-2222-2222-2222-222222222222"
+	)
+
+	f, ts := newTestListServer(t)
+
+	for subscriptionID, state := range map[string]string{
+		registeredSubscriptionID: arm.FeatureStateRegistered,
+		pendingSubscriptionID:    "Pending",
+	} {
+		err := f.dbClient.CreateSubscriptionDoc(context.Background(), database.NewSubscriptionDocument(
+			subscriptionID, &arm.Subscription{
+				State:            arm.SubscriptionStateRegistered,
+				RegistrationDate: api.Ptr(time.Now().String()),
+				Properties: &arm.SubscriptionProperties{
+					RegisteredFeatures: &[]arm.Feature{
+						{Name: api.Ptr(api.FeatureExternalAuth), State: api.Ptr(state)},
+					},
+				},
+			}))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name                  string
+		subscriptionID        string
+		globalPreviewFeatures []string
+		expectedFeatures      []string
+	}{
+		{
+			name:             "No registered features",
+			subscriptionID:   dummySubscrtiptionId,
+			expectedFeatures: []string{},
+		},
+		{
+			name:             "Registered feature",
+			subscriptionID:   registeredSubscriptionID,
+			expectedFeatures: []string{api.FeatureExternalAuth},
+		},
+		{
+			name:             "Pending feature registration",
+			subscriptionID:   pendingSubscriptionID,
+			expectedFeatures: []string{},
+		},
+		{
+			name:                  "Global feature",
+			subscriptionID:        dummySubscrtiptionId,
+			globalPreviewFeatures: []string{strings.ToLower(api.FeatureExternalAuth)},
+			expectedFeatures:      []string{api.FeatureExternalAuth},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			f.config.GlobalPreviewFeatures = test.globalPreviewFeatures
+
+			rs, err := ts.Client().Get(ts.URL + "/subscriptions/" + test.subscriptionID +
+				"/providers/" + api.ProviderNamespace + "/" + EnabledFeaturesPath + "?api-version=2024-06-10-preview")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer rs.Body.Close()
+
+			if rs.StatusCode != http.StatusOK {
+				t.Fatalf("expected status code %d, got %d", http.StatusOK, rs.StatusCode)
+			}
+
+			var features SubscriptionFeatures
+			err = json.NewDecoder(rs.Body).Decode(&features)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !slices.Equal(features.EnabledFeatures, test.expectedFeatures) {
+				t.Errorf("expected enabled features %v, got %v", test.expectedFeatures, features.EnabledFeatures)
+			}
+		})
+	}
+}
+
+func TestClusterQuotaWarning(t *testing.T) {
+	tests := []struct {
+		name            string
+		usedClusters    int
+		maxClusters     int
+		expectedWarning bool
+	}{
+		{
+			name:            "Well below threshold",
+			usedClusters:    1,
+			maxClusters:     10,
+			expectedWarning: false,
+		},
+		{
+			name:            "Just below threshold",
+			usedClusters:    79,
+			maxClusters:     100,
+			expectedWarning: false,
+		},
+		{
+			name:            "At threshold",
+			usedClusters:    80,
+			maxClusters:     100,
+			expectedWarning: true,
+		},
+		{
+			name:            "Above threshold",
+			usedClusters:    9,
+			maxClusters:     10,
+			expectedWarning: true,
+		},
+		{
+			name:            "At quota",
+			usedClusters:    5,
+			maxClusters:     5,
+			expectedWarning: true,
+		},
+		{
+			name:            "No quota",
+			usedClusters:    0,
+			maxClusters:     0,
+			expectedWarning: false,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			warning := clusterQuotaWarning(test.usedClusters, test.maxClusters)
+			if (warning != "") != test.expectedWarning {
+				t.Errorf("expected warning: %t, got %q", test.expectedWarning, warning)
+			}
+			if test.expectedWarning && !strings.HasPrefix(warning, "299 - ") {
+				t.Errorf("expected a 299 warning, got %q", warning)
+			}
+		})
+	}
+}
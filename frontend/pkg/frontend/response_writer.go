@@ -0,0 +1,54 @@
+package frontend
+
+// Copyright (c) Microsoft Corporation.
+// Licensed under the Apache License 2.0.
+
+import (
+	"net/http"
+)
+
+// trackingResponseWriter records whether the response header has been
+// written, so that error paths running after a partial response can avoid
+// writing a second status. Any WriteHeader call after the first is ignored
+// rather than passed on, where it would only log a "superfluous call" error.
+type trackingResponseWriter struct {
+	http.ResponseWriter
+	wroteHeader bool
+}
+
+func (w *trackingResponseWriter) WriteHeader(statusCode int) {
+	if w.wroteHeader {
+		return
+	}
+	w.wroteHeader = true
+	w.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (w *trackingResponseWriter) Write(b []byte) (int, error) {
+	// Writing a body implicitly writes a "200 OK" header.
+	w.wroteHeader = true
+	return w.ResponseWriter.Write(b)
+}
+
+// Unwrap returns the underlying ResponseWriter for http.ResponseController.
+func (w *trackingResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// ResponseStarted returns true if the response header has already been
+// written to w, meaning the status code can no longer be changed. It looks
+// through any wrapping ResponseWriters for a trackingResponseWriter and
+// returns false if there is none.
+func ResponseStarted(w http.ResponseWriter) bool {
+	for w != nil {
+		if tw, ok := w.(*trackingResponseWriter); ok {
+			return tw.wroteHeader
+		}
+		u, ok := w.(interface{ Unwrap() http.ResponseWriter })
+		if !ok {
+			break
+		}
+		w = u.Unwrap()
+	}
+	return false
+}
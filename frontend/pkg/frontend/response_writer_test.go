@@ -0,0 +1,179 @@
+package frontend
+
+// Copyright (c) Microsoft Corporation.
+// Licensed under the Apache License 2.0.
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// failingValue fails to encode, simulating an error partway through
+// writing a response body.
+type failingValue struct{}
+
+func (failingValue) MarshalJSON() ([]byte, error) {
+	return nil, errors.New("encoding failed")
+}
+
+// syncBuffer is a bytes.Buffer safe for use as a server error log.
+type syncBuffer struct {
+	mutex  sync.Mutex
+	buffer bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.buffer.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.buffer.String()
+}
+
+func TestTrackingResponseWriter(t *testing.T) {
+	tests := []struct {
+		name               string
+		write              func(w http.ResponseWriter)
+		expectedStarted    bool
+		expectedStatusCode int
+	}{
+		{
+			name:               "Nothing written",
+			write:              func(w http.ResponseWriter) {},
+			expectedStarted:    false,
+			expectedStatusCode: http.StatusOK,
+		},
+		{
+			name: "Header written",
+			write: func(w http.ResponseWriter) {
+				w.WriteHeader(http.StatusCreated)
+			},
+			expectedStarted:    true,
+			expectedStatusCode: http.StatusCreated,
+		},
+		{
+			name: "Body written",
+			write: func(w http.ResponseWriter) {
+				_, _ = w.Write([]byte("{"))
+			},
+			expectedStarted:    true,
+			expectedStatusCode: http.StatusOK,
+		},
+		{
+			name: "Second header ignored",
+			write: func(w http.ResponseWriter) {
+				w.WriteHeader(http.StatusOK)
+				w.WriteHeader(http.StatusInternalServerError)
+			},
+			expectedStarted:    true,
+			expectedStatusCode: http.StatusOK,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			recorder := httptest.NewRecorder()
+
+			// Wrap the tracking writer as other middleware would.
+			var w http.ResponseWriter = &trackingResponseWriter{ResponseWriter: recorder}
+			w = &LoggingResponseWriter{ResponseWriter: w}
+
+			test.write(w)
+
+			if started := ResponseStarted(w); started != test.expectedStarted {
+				t.Errorf("expected response started %t, got %t", test.expectedStarted, started)
+			}
+			if recorder.Code != test.expectedStatusCode {
+				t.Errorf("expected status code %d, got %d", test.expectedStatusCode, recorder.Code)
+			}
+		})
+	}
+
+	if ResponseStarted(httptest.NewRecorder()) {
+		t.Error("expected an untracked response to report not started")
+	}
+}
+
+func TestMiddlewarePanicAfterPartialResponse(t *testing.T) {
+	tests := []struct {
+		name               string
+		handler            http.HandlerFunc
+		expectedStatusCode int
+		expectTruncated    bool
+	}{
+		{
+			name: "Error before the response",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				panic("failed before writing")
+			},
+			expectedStatusCode: http.StatusInternalServerError,
+		},
+		{
+			name: "Error while encoding the response",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusOK)
+				_, _ = w.Write([]byte(`{"value":[`))
+				if err := json.NewEncoder(w).Encode(failingValue{}); err != nil {
+					panic(err)
+				}
+			},
+			expectedStatusCode: http.StatusOK,
+			expectTruncated:    true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var errorLog syncBuffer
+
+			ts := httptest.NewUnstartedServer(NewMiddlewareMux(MiddlewarePanic, MiddlewareLogging))
+			ts.Config.Handler.(*MiddlewareMux).HandleFunc("/", test.handler)
+			ts.Config.ErrorLog = log.New(&errorLog, "", 0)
+			ts.Config.BaseContext = func(net.Listener) context.Context {
+				return ContextWithLogger(context.Background(), testLogger)
+			}
+			ts.Start()
+			defer ts.Close()
+
+			// An aborted response fails either before the
+			// client sees the header or while reading the body.
+			rs, err := ts.Client().Get(ts.URL + "/")
+			if err == nil {
+				defer rs.Body.Close()
+
+				if rs.StatusCode != test.expectedStatusCode {
+					t.Errorf("expected status code %d, got %d", test.expectedStatusCode, rs.StatusCode)
+				}
+
+				var body []byte
+				body, err = io.ReadAll(rs.Body)
+				if test.expectTruncated && err == nil {
+					t.Errorf("expected the response to be aborted, got complete body %q", body)
+				}
+			}
+			if err != nil && !test.expectTruncated {
+				t.Fatal(err)
+			}
+
+			ts.Close()
+			if strings.Contains(errorLog.String(), "superfluous") {
+				t.Errorf("unexpected second header write: %s", errorLog.String())
+			}
+		})
+	}
+}
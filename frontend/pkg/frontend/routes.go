@@ -14,6 +14,7 @@ import (
 const (
 	WildcardActionName        = "{" + PathSegmentActionName + "}"
 	WildcardDeploymentName    = "{" + PathSegmentDeploymentName + "}"
+	WildcardDiagnosticSetting = "{" + PathSegmentDiagnosticSetting + "}"
 	WildcardLocation          = "{" + PathSegmentLocation + "}"
 	WildcardNodePoolName      = "{" + PathSegmentNodePoolName + "}"
 	WildcardOperationID       = "{" + PathSegmentOperationID + "}"
@@ -30,6 +31,10 @@ const (
 	PatternResourceGroups   = "resourcegroups/" + WildcardResourceGroupName
 	PatternOperationResults = api.OperationResultResourceTypeName + "/" + WildcardOperationID
 	PatternOperationsStatus = api.OperationStatusResourceTypeName + "/" + WildcardOperationID
+
+	// Diagnostic settings are a Microsoft.Insights extension resource.
+	PatternDiagnosticSettingsCollection = "providers/Microsoft.Insights/diagnosticSettings"
+	PatternDiagnosticSettings           = PatternDiagnosticSettingsCollection + "/" + WildcardDiagnosticSetting
 )
 
 // MuxPattern forms a URL pattern suitable for passing to http.ServeMux.
@@ -43,23 +48,36 @@ func (f *Frontend) routes() *MiddlewareMux {
 	// Setup metrics middleware
 	metricsMiddleware := MetricsMiddleware{dbClient: f.dbClient, Emitter: f.metrics}
 
+	// Requests under a subscription share its rate limit.
+	rateLimiter := newSubscriptionRateLimiter(f.getSubscriptionRateLimit(), f.getSubscriptionRateBurst())
+
+	// Requests back off together while the database keeps failing.
+	circuitBreaker := newCircuitBreaker(f.getDBCircuitBreaker())
+
 	mux := NewMiddlewareMux(
 		MiddlewarePanic,
 		MiddlewareLogging,
-		MiddlewareBody,
+		f.requests.Middleware,
+		MiddlewareURLLength(f.getMaxURLLength()),
+		MiddlewareHeaderSize(f.getMaxHeaderBytes()),
+		MiddlewareBody(f.getMaxBodyBytes(), f.getContentEncodings()...),
+		circuitBreaker.Middleware,
 		MiddlewareLowercase,
 		MiddlewareSystemData,
 		MiddlewareValidateStatic,
+		MiddlewareTracing(f.tracer()),
 		metricsMiddleware.Metrics(),
 	)
 
 	// Unauthenticated routes
 	mux.HandleFunc("/", f.NotFound)
 	mux.HandleFunc(MuxPattern(http.MethodGet, "healthz"), f.Healthz)
+	mux.HandleFunc(MuxPattern(http.MethodGet, "healthz", "live"), f.HealthzLive)
 
 	// List endpoints
 	postMuxMiddleware := NewMiddleware(
 		MiddlewareLoggingPostMux,
+		rateLimiter.Middleware,
 		MiddlewareValidateAPIVersion,
 		MiddlewareValidateSubscriptionState)
 	mux.Handle(
@@ -72,11 +90,27 @@ func (f *Frontend) routes() *MiddlewareMux {
 		MuxPattern(http.MethodGet, PatternSubscriptions, PatternResourceGroups, PatternProviders, PatternClusters, api.NodePoolResourceTypeName),
 		postMuxMiddleware.HandlerFunc(f.ArmResourceList))
 
+	// Resource group endpoints
+	postMuxMiddleware = NewMiddleware(
+		MiddlewareLoggingPostMux,
+		rateLimiter.Middleware,
+		MiddlewareValidateAPIVersion,
+		MiddlewareLockSubscription,
+		MiddlewareValidateSubscriptionState)
+	mux.Handle(
+		MuxPattern(http.MethodDelete, PatternSubscriptions, PatternResourceGroups, PatternProviders, api.ClusterResourceTypeName),
+		postMuxMiddleware.HandlerFunc(f.ArmResourceGroupClustersDelete))
+
+	// Cluster creates and updates carry managed identity credentials.
+	identityURLMiddleware := NewMiddleware(
+		MiddlewareValidateIdentityURL(f.getIdentityURLHostSuffixes()))
+
 	// Resource ID endpoints
 	// Request context holds an azcorearm.ResourceID
 	postMuxMiddleware = NewMiddleware(
 		MiddlewareResourceID,
 		MiddlewareLoggingPostMux,
+		rateLimiter.Middleware,
 		MiddlewareValidateAPIVersion,
 		MiddlewareLockSubscription,
 		MiddlewareValidateSubscriptionState)
@@ -85,10 +119,10 @@ func (f *Frontend) routes() *MiddlewareMux {
 		postMuxMiddleware.HandlerFunc(f.ArmResourceRead))
 	mux.Handle(
 		MuxPattern(http.MethodPut, PatternSubscriptions, PatternResourceGroups, PatternProviders, PatternClusters),
-		postMuxMiddleware.HandlerFunc(f.ArmResourceCreateOrUpdate))
+		postMuxMiddleware.Handler(identityURLMiddleware.HandlerFunc(f.ArmResourceCreateOrUpdate)))
 	mux.Handle(
 		MuxPattern(http.MethodPatch, PatternSubscriptions, PatternResourceGroups, PatternProviders, PatternClusters),
-		postMuxMiddleware.HandlerFunc(f.ArmResourceCreateOrUpdate))
+		postMuxMiddleware.Handler(identityURLMiddleware.HandlerFunc(f.ArmResourceCreateOrUpdate)))
 	mux.Handle(
 		MuxPattern(http.MethodDelete, PatternSubscriptions, PatternResourceGroups, PatternProviders, PatternClusters),
 		postMuxMiddleware.HandlerFunc(f.ArmResourceDelete))
@@ -112,7 +146,9 @@ func (f *Frontend) routes() *MiddlewareMux {
 	postMuxMiddleware = NewMiddleware(
 		MiddlewareResourceID,
 		MiddlewareLoggingPostMux,
+		rateLimiter.Middleware,
 		MiddlewareValidateAPIVersion,
+		MiddlewareValidateLocation(f.getSupportedLocations()...),
 		MiddlewareValidateSubscriptionState)
 	mux.Handle(
 		MuxPattern(http.MethodGet, PatternSubscriptions, PatternProviders, PatternLocations, PatternOperationResults),
@@ -121,12 +157,74 @@ func (f *Frontend) routes() *MiddlewareMux {
 		MuxPattern(http.MethodGet, PatternSubscriptions, PatternProviders, PatternLocations, PatternOperationsStatus),
 		postMuxMiddleware.HandlerFunc(f.OperationStatus))
 
+	// Subscription preview feature and policy endpoints
+	postMuxMiddleware = NewMiddleware(
+		MiddlewareLoggingPostMux,
+		rateLimiter.Middleware,
+		MiddlewareValidateAPIVersion,
+		MiddlewareValidateSubscriptionState)
+	mux.Handle(
+		MuxPattern(http.MethodGet, PatternSubscriptions, PatternProviders, EnabledFeaturesPath),
+		postMuxMiddleware.HandlerFunc(f.ArmSubscriptionFeaturesGet))
+	mux.Handle(
+		MuxPattern(http.MethodGet, PatternSubscriptions, PatternProviders, SubscriptionPolicyPath),
+		postMuxMiddleware.HandlerFunc(f.ArmSubscriptionPolicyGet))
+
+	// Provisioning state event endpoints
+	// These paths are not valid resource IDs.
+	postMuxMiddleware = NewMiddleware(
+		MiddlewareLoggingPostMux,
+		rateLimiter.Middleware,
+		MiddlewareValidateAPIVersion,
+		MiddlewareValidateSubscriptionState)
+	mux.Handle(
+		MuxPattern(http.MethodGet, PatternSubscriptions, PatternResourceGroups, PatternProviders, PatternClusters, ProvisioningStateEventsPath),
+		postMuxMiddleware.HandlerFunc(f.ArmResourceProvisioningStateEvents))
+	mux.Handle(
+		MuxPattern(http.MethodGet, PatternSubscriptions, PatternResourceGroups, PatternProviders, PatternClusters, PatternNodePools, ProvisioningStateEventsPath),
+		postMuxMiddleware.HandlerFunc(f.ArmResourceProvisioningStateEvents))
+
 	// Exclude ARO-HCP API version validation for the following endpoints defined by ARM.
 
+	// Diagnostic settings endpoints
+	// These use Microsoft.Insights API versions.
+	postMuxMiddleware = NewMiddleware(
+		MiddlewareLoggingPostMux,
+		rateLimiter.Middleware,
+		MiddlewareValidateSubscriptionState)
+	mux.Handle(
+		MuxPattern(http.MethodGet, PatternSubscriptions, PatternResourceGroups, PatternProviders, PatternClusters, PatternDiagnosticSettingsCollection),
+		postMuxMiddleware.HandlerFunc(f.ArmDiagnosticSettingsList))
+	postMuxMiddleware = NewMiddleware(
+		MiddlewareResourceID,
+		MiddlewareLoggingPostMux,
+		rateLimiter.Middleware,
+		MiddlewareLockSubscription,
+		MiddlewareValidateSubscriptionState)
+	mux.Handle(
+		MuxPattern(http.MethodGet, PatternSubscriptions, PatternResourceGroups, PatternProviders, PatternClusters, PatternDiagnosticSettings),
+		postMuxMiddleware.HandlerFunc(f.ArmDiagnosticSettingGet))
+	mux.Handle(
+		MuxPattern(http.MethodPut, PatternSubscriptions, PatternResourceGroups, PatternProviders, PatternClusters, PatternDiagnosticSettings),
+		postMuxMiddleware.HandlerFunc(f.ArmDiagnosticSettingCreateOrUpdate))
+	mux.Handle(
+		MuxPattern(http.MethodDelete, PatternSubscriptions, PatternResourceGroups, PatternProviders, PatternClusters, PatternDiagnosticSettings),
+		postMuxMiddleware.HandlerFunc(f.ArmDiagnosticSettingDelete))
+
+	// Provider metadata endpoint
+	postMuxMiddleware = NewMiddleware(
+		MiddlewareLoggingPostMux,
+		MiddlewareValidateContractAPIVersion(f.getContractAPIVersions()))
+	mux.Handle(
+		MuxPattern(http.MethodGet, PatternProviders),
+		postMuxMiddleware.HandlerFunc(f.ArmProviderGet))
+
 	// Subscription management endpoints
 	postMuxMiddleware = NewMiddleware(
 		MiddlewareResourceID,
 		MiddlewareLoggingPostMux,
+		rateLimiter.Middleware,
+		MiddlewareValidateContractAPIVersion(f.getContractAPIVersions()),
 		MiddlewareLockSubscription)
 	mux.Handle(
 		MuxPattern(http.MethodGet, PatternSubscriptions),
@@ -134,10 +232,53 @@ func (f *Frontend) routes() *MiddlewareMux {
 	mux.Handle(
 		MuxPattern(http.MethodPut, PatternSubscriptions),
 		postMuxMiddleware.HandlerFunc(f.ArmSubscriptionPut))
+	mux.Handle(
+		MuxPattern(http.MethodPatch, PatternSubscriptions),
+		postMuxMiddleware.HandlerFunc(f.ArmSubscriptionPatch))
+
+	// Admin endpoints
+	// These are internal and must not be reachable by tenants.
+	postMuxMiddleware = NewMiddleware(
+		MiddlewareLoggingPostMux,
+		RequireAdminAuth(f.config.AdminTokens...))
+	mux.Handle(
+		MuxPattern(http.MethodPost, "admin", "subscriptionstates"),
+		postMuxMiddleware.HandlerFunc(f.AdminSubscriptionStateBatch))
+	mux.Handle(
+		MuxPattern(http.MethodGet, "admin", "subscriptions"),
+		postMuxMiddleware.HandlerFunc(f.AdminSubscriptionList))
+	mux.Handle(
+		MuxPattern(http.MethodGet, "admin", PatternSubscriptions, "policy"),
+		postMuxMiddleware.HandlerFunc(f.AdminSubscriptionPolicyGet))
+	mux.Handle(
+		MuxPattern(http.MethodPut, "admin", PatternSubscriptions, "policy", "overrides"),
+		postMuxMiddleware.HandlerFunc(f.AdminSubscriptionOverridesPut))
+	mux.Handle(
+		MuxPattern(http.MethodGet, "admin", "operations"),
+		postMuxMiddleware.HandlerFunc(f.AdminOperationList))
+	mux.Handle(
+		MuxPattern(http.MethodGet, "admin", "operations", WildcardOperationID),
+		postMuxMiddleware.HandlerFunc(f.AdminOperationGet))
+	mux.Handle(
+		MuxPattern(http.MethodPost, "admin", PatternSubscriptions, PatternResourceGroups, PatternProviders, PatternClusters, "import"),
+		postMuxMiddleware.HandlerFunc(f.AdminClusterImport))
+	mux.Handle(
+		MuxPattern(http.MethodGet, "admin", PatternSubscriptions, PatternResourceGroups, PatternProviders, PatternClusters, "annotations"),
+		postMuxMiddleware.HandlerFunc(f.AdminResourceAnnotationsGet))
+	mux.Handle(
+		MuxPattern(http.MethodPut, "admin", PatternSubscriptions, PatternResourceGroups, PatternProviders, PatternClusters, "annotations"),
+		postMuxMiddleware.HandlerFunc(f.AdminResourceAnnotationsPut))
+	mux.Handle(
+		MuxPattern(http.MethodPut, "admin", PatternSubscriptions, PatternResourceGroups, PatternProviders, PatternClusters, "completionWebhook"),
+		postMuxMiddleware.HandlerFunc(f.AdminClusterCompletionWebhookPut))
+	mux.Handle(
+		MuxPattern(http.MethodDelete, "admin", PatternSubscriptions, PatternResourceGroups, PatternProviders, PatternClusters, "completionWebhook"),
+		postMuxMiddleware.HandlerFunc(f.AdminClusterCompletionWebhookDelete))
 
 	// Deployment preflight endpoint
 	postMuxMiddleware = NewMiddleware(
 		MiddlewareLoggingPostMux,
+		rateLimiter.Middleware,
 		MiddlewareValidateSubscriptionState)
 	mux.Handle(
 		MuxPattern(http.MethodPost, PatternSubscriptions, PatternResourceGroups, "providers", api.ProviderNamespace, PatternDeployments, "preflight"),
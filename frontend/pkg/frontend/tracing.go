@@ -0,0 +1,125 @@
+package frontend
+
+// Copyright (c) Microsoft Corporation.
+// Licensed under the Apache License 2.0.
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+
+	"github.com/Azure/ARO-HCP/internal/database"
+)
+
+// tracerName identifies the spans created by the frontend.
+const tracerName = "github.com/Azure/ARO-HCP/frontend"
+
+// subscriptionIDAttributeKey is the span attribute
+// naming the subscription a database call is for.
+const subscriptionIDAttributeKey = attribute.Key("aro.subscription_id")
+
+// SetTracerProvider enables tracing of requests and database calls with
+// spans from the given provider. Without a provider, tracing is a no-op.
+// Set the tracer provider before the frontend starts serving requests.
+func (f *Frontend) SetTracerProvider(provider trace.TracerProvider) {
+	f.tracerProvider = provider
+	f.dbClient = &tracingDBClient{
+		DBClient: f.dbClient,
+		tracer:   provider.Tracer(tracerName),
+	}
+}
+
+// tracer returns the tracer for frontend spans.
+func (f *Frontend) tracer() trace.Tracer {
+	if f.tracerProvider == nil {
+		return noop.NewTracerProvider().Tracer(tracerName)
+	}
+	return f.tracerProvider.Tracer(tracerName)
+}
+
+// MiddlewareTracing starts a server span for each request, continuing the
+// trace of an incoming "traceparent" header. Spans are named by the route
+// that matched, which the mux sets on the request it is given, so no later
+// middleware may replace the request.
+func MiddlewareTracing(tracer trace.Tracer) MiddlewareFunc {
+	propagator := propagation.TraceContext{}
+
+	return func(w http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
+		ctx := propagator.Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+		ctx, span := tracer.Start(ctx, r.Method,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(semconv.HTTPRequestMethodKey.String(r.Method)))
+		defer span.End()
+
+		lrw := &logResponseWriter{ResponseWriter: w, statusCode: http.StatusOK}
+		r = r.WithContext(ctx)
+
+		next(lrw, r)
+
+		// The mux sets the pattern that matched on the request.
+		route := routePattern(r)
+		span.SetName(r.Method + " " + route)
+		span.SetAttributes(
+			semconv.HTTPRoute(route),
+			semconv.HTTPResponseStatusCode(lrw.statusCode))
+		if lrw.statusCode >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, http.StatusText(lrw.statusCode))
+		}
+	}
+}
+
+var _ database.DBClient = &tracingDBClient{}
+
+// tracingDBClient records a span for each subscription document call.
+type tracingDBClient struct {
+	database.DBClient
+	tracer trace.Tracer
+}
+
+// startSpan starts a client span for the named database
+// operation on the documents of a subscription.
+func (c *tracingDBClient) startSpan(ctx context.Context, operation, subscriptionID string) (context.Context, trace.Span) {
+	return c.tracer.Start(ctx, operation,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			semconv.DBOperationName(operation),
+			subscriptionIDAttributeKey.String(subscriptionID)))
+}
+
+// endSpan ends a span, recording the error if the call failed.
+// A document not being found is an expected outcome, not a failure.
+func endSpan(span trace.Span, err error) {
+	if err != nil && !errors.Is(err, database.ErrNotFound) {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+func (c *tracingDBClient) GetSubscriptionDoc(ctx context.Context, subscriptionID string) (*database.SubscriptionDocument, error) {
+	ctx, span := c.startSpan(ctx, "GetSubscriptionDoc", subscriptionID)
+	doc, err := c.DBClient.GetSubscriptionDoc(ctx, subscriptionID)
+	endSpan(span, err)
+	return doc, err
+}
+
+func (c *tracingDBClient) CreateSubscriptionDoc(ctx context.Context, doc *database.SubscriptionDocument) error {
+	ctx, span := c.startSpan(ctx, "CreateSubscriptionDoc", doc.ID)
+	err := c.DBClient.CreateSubscriptionDoc(ctx, doc)
+	endSpan(span, err)
+	return err
+}
+
+func (c *tracingDBClient) UpdateSubscriptionDoc(ctx context.Context, subscriptionID string, callback func(*database.SubscriptionDocument) bool) (bool, error) {
+	ctx, span := c.startSpan(ctx, "UpdateSubscriptionDoc", subscriptionID)
+	updated, err := c.DBClient.UpdateSubscriptionDoc(ctx, subscriptionID, callback)
+	endSpan(span, err)
+	return updated, err
+}
@@ -0,0 +1,133 @@
+package frontend
+
+// Copyright (c) Microsoft Corporation.
+// Licensed under the Apache License 2.0.
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/Azure/ARO-HCP/internal/api"
+	"github.com/Azure/ARO-HCP/internal/api/arm"
+	"github.com/Azure/ARO-HCP/internal/database"
+)
+
+func TestSubscriptionPUTTracing(t *testing.T) {
+	const traceparent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+
+	recorder := tracetest.NewSpanRecorder()
+
+	f := &Frontend{
+		dbClient: database.NewCache(),
+		metrics:  NewPrometheusEmitter(prometheus.NewRegistry()),
+	}
+	f.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+
+	ts := httptest.NewUnstartedServer(f.routes())
+	ts.Config.BaseContext = func(net.Listener) context.Context {
+		ctx := context.Background()
+		ctx = ContextWithLogger(ctx, testLogger)
+		ctx = ContextWithDBClient(ctx, f.dbClient)
+		return ctx
+	}
+	ts.Start()
+	defer ts.Close()
+
+	body, err := json.Marshal(&arm.Subscription{
+		State:            arm.SubscriptionStateRegistered,
+		RegistrationDate: api.Ptr(time.Now().String()),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req, err := http.NewRequest(http.MethodPut, ts.URL+"/subscriptions/"+dummySubscrtiptionId+"?api-version=2.0", bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("traceparent", traceparent)
+
+	rs, err := ts.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rs.Body.Close()
+
+	if rs.StatusCode != http.StatusOK {
+		t.Fatalf("expected status code %d, got %d", http.StatusOK, rs.StatusCode)
+	}
+
+	// Closing the server waits for the handler to end its spans.
+	ts.Close()
+
+	var serverSpan sdktrace.ReadOnlySpan
+	var dbSpans []sdktrace.ReadOnlySpan
+	for _, span := range recorder.Ended() {
+		switch span.SpanKind() {
+		case trace.SpanKindServer:
+			serverSpan = span
+		case trace.SpanKindClient:
+			dbSpans = append(dbSpans, span)
+		}
+	}
+
+	if serverSpan == nil {
+		t.Fatal("expected a server span")
+	}
+	if serverSpan.Name() != "PUT /subscriptions/{subscriptionid}" {
+		t.Errorf("expected the server span to be named by route, got %q", serverSpan.Name())
+	}
+	if traceID := serverSpan.SpanContext().TraceID().String(); traceID != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Errorf("expected the server span to continue the incoming trace, got trace %s", traceID)
+	}
+	if parentID := serverSpan.Parent().SpanID().String(); parentID != "00f067aa0ba902b7" {
+		t.Errorf("expected the server span parent to be the incoming span, got %s", parentID)
+	}
+
+	var createSpan sdktrace.ReadOnlySpan
+	for _, span := range dbSpans {
+		if span.Name() == "CreateSubscriptionDoc" {
+			createSpan = span
+		}
+	}
+	if createSpan == nil {
+		t.Fatalf("expected a CreateSubscriptionDoc span, got %d database spans", len(dbSpans))
+	}
+	if createSpan.Parent().SpanID() != serverSpan.SpanContext().SpanID() {
+		t.Error("expected the database span to be a child of the server span")
+	}
+
+	expected := subscriptionIDAttributeKey.String(dummySubscrtiptionId)
+	var found bool
+	for _, attr := range createSpan.Attributes() {
+		if attr == expected {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("expected attribute %v, got %v", expected, createSpan.Attributes())
+	}
+}
+
+func TestTracingDisabledByDefault(t *testing.T) {
+	f := &Frontend{}
+
+	_, span := f.tracer().Start(context.Background(), "test")
+	defer span.End()
+
+	if span.IsRecording() {
+		t.Error("expected spans not to be recorded without a tracer provider")
+	}
+}
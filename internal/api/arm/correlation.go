@@ -27,12 +27,18 @@ type CorrelationData struct {
 }
 
 // NewCorrelationData allocates and initializes a new CorrelationData from
-// HTTP request headers
+// HTTP request headers. If the request has no correlation request ID, one
+// is generated so the request can still be traced across services.
 func NewCorrelationData(r *http.Request) *CorrelationData {
+	correlationRequestID := r.Header.Get(HeaderNameCorrelationRequestID)
+	if correlationRequestID == "" {
+		correlationRequestID = uuid.New().String()
+	}
+
 	return &CorrelationData{
 		RequestID:            uuid.New(),
 		ClientRequestID:      r.Header.Get(HeaderNameClientRequestID),
-		CorrelationRequestID: r.Header.Get(HeaderNameCorrelationRequestID),
+		CorrelationRequestID: correlationRequestID,
 		RequestTime:          time.Now(),
 	}
 }
@@ -50,3 +50,15 @@ func TestNewCorrelationData(t *testing.T) {
 		})
 	}
 }
+
+func TestNewCorrelationDataGeneratesCorrelationRequestID(t *testing.T) {
+	correlationData := NewCorrelationData(&http.Request{Header: http.Header{}})
+
+	if _, err := uuid.Parse(correlationData.CorrelationRequestID); err != nil {
+		t.Errorf("expected a generated UUID, got %q: %v", correlationData.CorrelationRequestID, err)
+	}
+
+	if correlationData.ClientRequestID != "" {
+		t.Errorf("expected empty client request ID, got %q", correlationData.ClientRequestID)
+	}
+}
@@ -0,0 +1,64 @@
+package arm
+
+// Copyright (c) Microsoft Corporation.
+// Licensed under the Apache License 2.0.
+
+import (
+	azcorearm "github.com/Azure/azure-sdk-for-go/sdk/azcore/arm"
+)
+
+// DiagnosticSettingsResourceType is the extension resource type
+// customers use to route resource logs and metrics to a destination.
+var DiagnosticSettingsResourceType = azcorearm.NewResourceType("Microsoft.Insights", "diagnosticSettings")
+
+// DiagnosticSetting represents a Microsoft.Insights/diagnosticSettings
+// extension resource associated with another resource.
+// See https://learn.microsoft.com/en-us/rest/api/monitor/diagnostic-settings
+type DiagnosticSetting struct {
+	Resource
+	Properties DiagnosticSettingProperties `json:"properties"`
+}
+
+// DiagnosticSettingProperties holds the destinations and categories
+// of a diagnostic setting.
+type DiagnosticSettingProperties struct {
+	StorageAccountID            *string          `json:"storageAccountId,omitempty"`
+	ServiceBusRuleID            *string          `json:"serviceBusRuleId,omitempty"`
+	EventHubAuthorizationRuleID *string          `json:"eventHubAuthorizationRuleId,omitempty"`
+	EventHubName                *string          `json:"eventHubName,omitempty"`
+	WorkspaceID                 *string          `json:"workspaceId,omitempty"`
+	MarketplacePartnerID        *string          `json:"marketplacePartnerId,omitempty"`
+	LogAnalyticsDestinationType *string          `json:"logAnalyticsDestinationType,omitempty"`
+	Logs                        []LogSettings    `json:"logs,omitempty"`
+	Metrics                     []MetricSettings `json:"metrics,omitempty"`
+}
+
+// HasDestination returns true if the diagnostic setting names
+// at least one destination for logs and metrics.
+func (p *DiagnosticSettingProperties) HasDestination() bool {
+	return p.StorageAccountID != nil ||
+		p.ServiceBusRuleID != nil ||
+		p.EventHubAuthorizationRuleID != nil ||
+		p.WorkspaceID != nil ||
+		p.MarketplacePartnerID != nil
+}
+
+// LogSettings enables or disables a category of resource logs.
+type LogSettings struct {
+	Category      *string `json:"category,omitempty"`
+	CategoryGroup *string `json:"categoryGroup,omitempty"`
+	Enabled       bool    `json:"enabled"`
+}
+
+// MetricSettings enables or disables a category of resource metrics.
+type MetricSettings struct {
+	Category  *string `json:"category,omitempty"`
+	TimeGrain *string `json:"timeGrain,omitempty"`
+	Enabled   bool    `json:"enabled"`
+}
+
+// DiagnosticSettingsList is the response format for listing the
+// diagnostic settings associated with a resource.
+type DiagnosticSettingsList struct {
+	Value []*DiagnosticSetting `json:"value"`
+}
@@ -15,20 +15,43 @@ import (
 const (
 	CloudErrorCodeInternalServerError      = "InternalServerError"
 	CloudErrorCodeInvalidParameter         = "InvalidParameter"
+	CloudErrorCodeInvalidAPIVersion        = "InvalidApiVersionParameter"
 	CloudErrorCodeInvalidRequestContent    = "InvalidRequestContent"
 	CloudErrorCodeInvalidResource          = "InvalidResource"
 	CloudErrorCodeInvalidResourceType      = "InvalidResourceType"
+	CloudErrorCodeInvalidResourceID        = "InvalidResourceId"
 	CloudErrorCodeMultipleErrorsOccurred   = "MultipleErrorsOccurred"
 	CloudErrorCodeUnsupportedMediaType     = "UnsupportedMediaType"
 	CloudErrorCodeConflict                 = "Conflict"
 	CloudErrorCodeNotFound                 = "NotFound"
 	CloudErrorCodeInvalidSubscriptionState = "InvalidSubscriptionState"
+	CloudErrorCodeMissingSubscriptionState = "MissingSubscriptionState"
 	CloudErrorCodeSubscriptionNotFound     = "SubscriptionNotFound"
 	CloudErrorCodeResourceNotFound         = "ResourceNotFound"
 	CloudErrorCodeResourceGroupNotFound    = "ResourceGroupNotFound"
 	CloudErrorCodeInvalidSubscriptionID    = "InvalidSubscriptionID"
 	CloudErrorCodeInvalidResourceName      = "InvalidResourceName"
 	CloudErrorCodeInvalidResourceGroupName = "InvalidResourceGroupName"
+	CloudErrorCodeNoRegisteredProvider     = "NoRegisteredProviderFound"
+	CloudErrorCodeFeatureNotRegistered     = "FeatureNotRegistered"
+	CloudErrorCodeNodePoolLimitExceeded    = "NodePoolLimitExceeded"
+	CloudErrorCodeClusterLimitExceeded     = "ClusterLimitExceeded"
+	CloudErrorCodeInvalidContinuationToken = "InvalidContinuationToken"
+	CloudErrorCodeNameMismatch             = "NameMismatch"
+	CloudErrorCodePreconditionFailed       = "PreconditionFailed"
+	CloudErrorCodeTooManyRequests          = "TooManyRequests"
+	CloudErrorCodeHeadersTooLarge          = "RequestHeaderFieldsTooLarge"
+	CloudErrorCodeURITooLong               = "RequestUriTooLong"
+	CloudErrorCodeRequestEntityTooLarge    = "RequestEntityTooLarge"
+	CloudErrorCodeServiceUnavailable       = "ServiceUnavailable"
+	CloudErrorCodeOperationNotFound        = "OperationNotFound"
+	CloudErrorCodeOperationExpired         = "OperationExpired"
+	CloudErrorCodeMissingIdentityURL       = "MissingIdentityUrl"
+	CloudErrorCodeAuthorizationFailed      = "AuthorizationFailed"
+
+	CloudErrorCodeLocationNotAvailableForResourceType = "LocationNotAvailableForResourceType"
+
+	CloudErrorCodeInvalidSubscriptionStateTransition = "InvalidSubscriptionStateTransition"
 )
 
 // CloudError represents a complete resource provider error.
@@ -64,6 +87,11 @@ type CloudErrorBody struct {
 
 	// A list of additional details about the error.
 	Details []CloudErrorBody `json:"details,omitempty"`
+
+	// The correlation ID of the request that caused the error, so support
+	// can trace the error even if response headers were not captured.
+	// This is only set on the top-level error.
+	CorrelationID string `json:"correlationId,omitempty"`
 }
 
 func (body *CloudErrorBody) String() string {
@@ -103,9 +131,19 @@ func WriteError(w http.ResponseWriter, statusCode int, code, target, format stri
 	WriteCloudError(w, NewCloudError(statusCode, code, target, format, a...))
 }
 
-// WriteCloudError writes a CloudError to the given ResponseWriter
+// WriteCloudError writes a CloudError to the given ResponseWriter. If the
+// response headers include a correlation request ID, it is copied into the
+// error body.
 func WriteCloudError(w http.ResponseWriter, err *CloudError) {
 	w.Header()[HeaderNameErrorCode] = []string{err.Code}
+
+	if correlationID := w.Header().Get(HeaderNameCorrelationRequestID); correlationID != "" && err.CloudErrorBody != nil {
+		// Copy the body to avoid modifying a possibly shared error.
+		body := *err.CloudErrorBody
+		body.CorrelationID = correlationID
+		err = &CloudError{StatusCode: err.StatusCode, CloudErrorBody: &body}
+	}
+
 	_, _ = WriteJSONResponse(w, err.StatusCode, err)
 }
 
@@ -1,6 +1,11 @@
 package arm
 
-import "testing"
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
 
 func TestCloudErrorBody_String(t *testing.T) {
 	tests := []struct {
@@ -58,3 +63,54 @@ func TestCloudErrorBody_String(t *testing.T) {
 		})
 	}
 }
+
+func TestWriteCloudErrorCorrelationID(t *testing.T) {
+	tests := []struct {
+		name          string
+		correlationID string
+	}{
+		{
+			name:          "With correlation request ID",
+			correlationID: "the_correlation_request_id",
+		},
+		{
+			name:          "Without correlation request ID",
+			correlationID: "",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cloudError := NewInternalServerError()
+
+			w := httptest.NewRecorder()
+			if test.correlationID != "" {
+				w.Header().Set(HeaderNameCorrelationRequestID, test.correlationID)
+			}
+			WriteCloudError(w, cloudError)
+
+			var response struct {
+				Error map[string]any `json:"error"`
+			}
+			err := json.Unmarshal(w.Body.Bytes(), &response)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			actual, ok := response.Error["correlationId"]
+			if test.correlationID == "" {
+				if ok {
+					t.Errorf("expected no correlationId, got %v", actual)
+				}
+			} else if actual != test.correlationID {
+				t.Errorf("expected correlationId %q, got %v", test.correlationID, actual)
+			}
+
+			if w.Code != http.StatusInternalServerError {
+				t.Errorf("expected status code %d, got %d", http.StatusInternalServerError, w.Code)
+			}
+			if cloudError.CorrelationID != "" {
+				t.Error("expected the original error to be left unmodified")
+			}
+		})
+	}
+}
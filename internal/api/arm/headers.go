@@ -19,4 +19,9 @@ const (
 	HeaderNameReturnClientRequestID = "X-Ms-Return-Client-Request-Id"
 	HeaderNameARMResourceSystemData = "X-Ms-Arm-Resource-System-Data"
 	HeaderNameIdentityURL           = "X-Ms-Identity-Url"
+	HeaderNameOperationID           = "X-Ms-Operation-Id"
+
+	// HeaderNameValidationOnly is an alternative to the "validateOnly"
+	// request parameter for clients that cannot add request parameters.
+	HeaderNameValidationOnly = "X-Ms-Validation-Only"
 )
@@ -7,14 +7,14 @@ package arm
 type Identity struct {
 	PrincipalID            string                           `json:"principalId,omitempty"`
 	TenantID               string                           `json:"tenantId,omitempty"`
-	Type                   ManagedServiceIdentityType       `json:"type"`
+	Type                   ManagedServiceIdentityType       `json:"type" validate:"omitempty,enum_managedserviceidentitytype"`
 	UserAssignedIdentities map[string]*UserAssignedIdentity `json:"userAssignedIdentities,omitempty"`
 }
 
 // UserAssignedIdentity - User assigned identity properties https://azure.github.io/typespec-azure/docs/libraries/azure-resource-manager/reference/data-types/#Azure.ResourceManager.CommonTypes.UserAssignedIdentity
 type UserAssignedIdentity struct {
-	ClientID    *string
-	PrincipalID *string
+	ClientID    *string `json:"clientId,omitempty"`
+	PrincipalID *string `json:"principalId,omitempty"`
 }
 
 type ManagedServiceIdentityType string
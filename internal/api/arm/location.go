@@ -0,0 +1,21 @@
+package arm
+
+// Copyright (c) Microsoft Corporation.
+// Licensed under the Apache License 2.0.
+
+import (
+	"strings"
+	"unicode"
+)
+
+// NormalizeLocation returns the canonical form of an Azure location,
+// which is lowercase without spaces. This maps display names such as
+// "East US 2" to the name ARM uses in URLs, "eastus2".
+func NormalizeLocation(location string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsSpace(r) {
+			return -1
+		}
+		return unicode.ToLower(r)
+	}, location)
+}
@@ -0,0 +1,25 @@
+package arm
+
+import "testing"
+
+func TestNormalizeLocation(t *testing.T) {
+	tests := []struct {
+		location string
+		expected string
+	}{
+		{location: "eastus", expected: "eastus"},
+		{location: "EastUS", expected: "eastus"},
+		{location: "East US", expected: "eastus"},
+		{location: "East US 2", expected: "eastus2"},
+		{location: " westeurope ", expected: "westeurope"},
+		{location: "", expected: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.location, func(t *testing.T) {
+			if got := NormalizeLocation(tt.location); got != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, got)
+			}
+		})
+	}
+}
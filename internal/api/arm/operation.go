@@ -10,13 +10,14 @@ import (
 
 // Operation is an ARM-defined resource returned by operation status endpoints.
 type Operation struct {
-	ID              *ResourceID       `json:"id,omitempty"`
-	Name            string            `json:"name,omitempty"`
-	Status          ProvisioningState `json:"status"`
-	StartTime       *time.Time        `json:"startTime,omitempty"`
-	EndTime         *time.Time        `json:"endTime,omitempty"`
-	PercentComplete float64           `json:"percentComplete,omitempty"`
-	Properties      json.RawMessage   `json:"peroperties,omitempty"`
-	Error           *CloudErrorBody   `json:"error,omitempty"`
-	Operations      []Operation       `json:"operations,omitempty"`
+	ID                      *ResourceID       `json:"id,omitempty"`
+	Name                    string            `json:"name,omitempty"`
+	Status                  ProvisioningState `json:"status"`
+	StartTime               *time.Time        `json:"startTime,omitempty"`
+	EndTime                 *time.Time        `json:"endTime,omitempty"`
+	PercentComplete         float64           `json:"percentComplete,omitempty"`
+	EstimatedCompletionTime *time.Time        `json:"estimatedCompletionTime,omitempty"`
+	Properties              json.RawMessage   `json:"peroperties,omitempty"`
+	Error                   *CloudErrorBody   `json:"error,omitempty"`
+	Operations              []Operation       `json:"operations,omitempty"`
 }
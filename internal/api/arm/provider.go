@@ -0,0 +1,19 @@
+package arm
+
+// Copyright (c) Microsoft Corporation.
+// Licensed under the Apache License 2.0.
+
+// Provider mirrors the resource provider metadata returned by ARM from
+// "GET /providers/{resourceProviderNamespace}".
+type Provider struct {
+	ID            string                 `json:"id"`
+	Namespace     string                 `json:"namespace"`
+	ResourceTypes []ProviderResourceType `json:"resourceTypes"`
+}
+
+// ProviderResourceType describes a resource type offered by a resource
+// provider. The resource type name excludes the provider namespace.
+type ProviderResourceType struct {
+	ResourceType string   `json:"resourceType"`
+	APIVersions  []string `json:"apiVersions"`
+}
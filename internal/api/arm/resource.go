@@ -5,6 +5,8 @@ package arm
 
 import (
 	"maps"
+	"slices"
+	"strings"
 	"time"
 
 	azcorearm "github.com/Azure/azure-sdk-for-go/sdk/azcore/arm"
@@ -76,6 +78,20 @@ type TrackedResource struct {
 	Tags     map[string]string `json:"tags,omitempty"`
 }
 
+// DuplicateTagKeys returns the first pair of tag keys, in sorted order,
+// that differ only by case. Azure tag keys are case-insensitive.
+func (r *TrackedResource) DuplicateTagKeys() (string, string, bool) {
+	seen := make(map[string]string, len(r.Tags))
+	for _, key := range slices.Sorted(maps.Keys(r.Tags)) {
+		folded := strings.ToLower(key)
+		if other, ok := seen[folded]; ok {
+			return other, key, true
+		}
+		seen[folded] = key
+	}
+	return "", "", false
+}
+
 func (src *TrackedResource) Copy(dst *TrackedResource) {
 	src.Resource.Copy(&dst.Resource)
 	dst.Location = src.Location
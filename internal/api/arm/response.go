@@ -4,9 +4,11 @@ package arm
 // Licensed under the Apache License 2.0.
 
 import (
+	"bytes"
 	"encoding/json"
 	"net/http"
 	"net/url"
+	"strconv"
 )
 
 const (
@@ -19,16 +21,70 @@ const (
 // Call this function instead of the marshal functions in "encoding/json" for
 // HTTP responses to ensure the formatting is consistent.
 //
+// Unlike the marshal functions in "encoding/json", HTML characters such as
+// '<', '>' and '&' are not escaped. API responses are never embedded in HTML
+// and escaping them only obscures resource names, tags and error messages.
+//
 // Note, there is nothing ARM-specific about this function other than all ARM
 // response bodies are JSON-formatted. But the "arm" package is currently the
 // lowest layer insofar as it has no dependencies on other ARO-HCP packages.
 func Marshal(v any) ([]byte, error) {
-	return json.MarshalIndent(v, prefix, indent)
+	var buffer bytes.Buffer
+
+	encoder := json.NewEncoder(&buffer)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent(prefix, indent)
+
+	err := encoder.Encode(v)
+	if err != nil {
+		return nil, err
+	}
+
+	// Types with their own MarshalJSON method, such as the generated
+	// API models, escape HTML characters regardless of the encoder.
+	data := unescapeHTML(buffer.Bytes())
+
+	// Encode terminates the value with a newline; Marshal does not.
+	return bytes.TrimSuffix(data, []byte("\n")), nil
+}
+
+// htmlEscapes maps the escape sequences "encoding/json" uses
+// for HTML characters back to the characters themselves.
+var htmlEscapes = map[string]byte{
+	`\u003c`: '<',
+	`\u003e`: '>',
+	`\u0026`: '&',
+}
+
+// unescapeHTML replaces the HTML escape sequences in a JSON encoding with
+// the characters they represent. A backslash that is itself escaped does
+// not start an escape sequence, so "\\u0026" is left as is.
+func unescapeHTML(data []byte) []byte {
+	output := make([]byte, 0, len(data))
+	for i := 0; i < len(data); i++ {
+		if data[i] == '\\' && i+1 < len(data) {
+			if i+6 <= len(data) {
+				if c, ok := htmlEscapes[string(data[i:i+6])]; ok {
+					output = append(output, c)
+					i += 5
+					continue
+				}
+			}
+			// Copy other escape sequences whole.
+			output = append(output, data[i], data[i+1])
+			i++
+			continue
+		}
+		output = append(output, data[i])
+	}
+	return output
 }
 
 // WriteJSONResponse writes a JSON response body to the http.ResponseWriter in
 // the proper sequence: first setting Content-Type to "application/json", then
 // setting the HTTP status code, and finally writing a JSON encoding of body.
+// Content-Length is set explicitly so that responses to HEAD requests, which
+// discard the body, carry the same headers as the equivalent GET response.
 //
 // The function accepts anything for the body argument that can be marshalled
 // to JSON. One special case, however, is a byte slice. A byte slice will be
@@ -52,6 +108,7 @@ func WriteJSONResponse(writer http.ResponseWriter, statusCode int, body any) (in
 	}
 
 	writer.Header().Set("Content-Type", "application/json")
+	writer.Header().Set("Content-Length", strconv.Itoa(len(data)))
 	writer.WriteHeader(statusCode)
 	return writer.Write(data)
 }
@@ -62,6 +119,17 @@ type PagedResponse struct {
 	NextLink string            `json:"nextLink,omitempty"`
 }
 
+// MarshalJSON implements json.Marshaler. An empty collection is always
+// encoded as an empty "value" array, never as null.
+func (r PagedResponse) MarshalJSON() ([]byte, error) {
+	// Alias the type to avoid infinite recursion.
+	type pagedResponse PagedResponse
+	if r.Value == nil {
+		r.Value = []json.RawMessage{}
+	}
+	return json.Marshal(pagedResponse(r))
+}
+
 // AddValue adds a JSON encoded value to a PagedResponse.
 func (r *PagedResponse) AddValue(value json.RawMessage) {
 	r.Value = append(r.Value, value)
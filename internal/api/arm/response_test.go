@@ -4,6 +4,7 @@ package arm
 // Licensed under the Apache License 2.0.
 
 import (
+	"encoding/json"
 	"io"
 	"net/http"
 	"net/http/httptest"
@@ -85,3 +86,94 @@ func TestWriteJSONResponse(t *testing.T) {
 		})
 	}
 }
+
+func TestPagedResponseMarshal(t *testing.T) {
+	tests := []struct {
+		name     string
+		response PagedResponse
+		expected string
+	}{
+		{
+			name:     "Empty collection",
+			response: PagedResponse{},
+			expected: `{"value":[]}`,
+		},
+		{
+			name: "Collection with next link",
+			response: PagedResponse{
+				Value:    []json.RawMessage{json.RawMessage(`{"name":"a"}`)},
+				NextLink: "https://example.com/?%24skipToken=abc",
+			},
+			expected: `{"value":[{"name":"a"}],"nextLink":"https://example.com/?%24skipToken=abc"}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := json.Marshal(tt.response)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(data) != tt.expected {
+				t.Errorf("expected %s, got %s", tt.expected, data)
+			}
+		})
+	}
+}
+
+// preEscaped marshals itself with "encoding/json",
+// which escapes HTML characters.
+type preEscaped struct {
+	Value string
+}
+
+func (p preEscaped) MarshalJSON() ([]byte, error) {
+	return json.Marshal(map[string]string{"value": p.Value})
+}
+
+func TestMarshalHTMLCharacters(t *testing.T) {
+	tests := []struct {
+		name     string
+		value    any
+		expected string
+	}{
+		{
+			name:     "HTML characters",
+			value:    "R&D <platform>",
+			expected: `"R&D <platform>"`,
+		},
+		{
+			name:     "HTML characters from a MarshalJSON method",
+			value:    preEscaped{Value: "a & b"},
+			expected: "{\n    \"value\": \"a & b\"\n}",
+		},
+		{
+			name:     "Literal escape sequence text",
+			value:    `\u0026`,
+			expected: `"\\u0026"`,
+		},
+		{
+			name:     "Other escape sequences",
+			value:    "line\n\"quoted\"",
+			expected: `"line\n\"quoted\""`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := Marshal(tt.value)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(data) != tt.expected {
+				t.Errorf("expected %s, got %s", tt.expected, data)
+			}
+
+			var roundTrip any
+			err = json.Unmarshal(data, &roundTrip)
+			if err != nil {
+				t.Errorf("expected valid JSON: %v", err)
+			}
+		})
+	}
+}
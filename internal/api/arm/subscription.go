@@ -3,6 +3,15 @@ package arm
 // Copyright (c) Microsoft Corporation.
 // Licensed under the Apache License 2.0.
 
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
 type Subscription struct {
 	// The resource provider contract gives an example RegistrationDate
 	// in RFC1123 format but does not explicitly state a required format
@@ -12,6 +21,72 @@ type Subscription struct {
 	Properties       *SubscriptionProperties `json:"properties"`
 }
 
+// MarshalJSON implements json.Marshaler. Missing properties are always
+// encoded as an empty "properties" object, never as null.
+func (s Subscription) MarshalJSON() ([]byte, error) {
+	// Alias the type to avoid infinite recursion.
+	type subscription Subscription
+	if s.Properties == nil {
+		s.Properties = &SubscriptionProperties{}
+	}
+	return json.Marshal(subscription(s))
+}
+
+// registrationDateLayouts lists the layouts ParseRegistrationDate accepts,
+// starting with the RFC1123 layout of the resource provider contract's
+// example.
+var registrationDateLayouts = []string{
+	time.RFC1123,
+	time.RFC1123Z,
+	time.RFC3339Nano,
+}
+
+// ParseRegistrationDate parses a subscription's RegistrationDate. Since
+// the resource provider contract does not state a required format, this
+// accepts RFC1123 as well as RFC3339 dates.
+func ParseRegistrationDate(value string) (time.Time, error) {
+	for _, layout := range registrationDateLayouts {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("unrecognized registration date '%s'", value)
+}
+
+// RegistrationAge returns how long before now the subscription was
+// registered. It returns false if the subscription has no registration
+// date or the date cannot be parsed.
+func (s *Subscription) RegistrationAge(now time.Time) (time.Duration, bool) {
+	if s == nil || s.RegistrationDate == nil {
+		return 0, false
+	}
+	registrationDate, err := ParseRegistrationDate(*s.RegistrationDate)
+	if err != nil {
+		return 0, false
+	}
+	return now.Sub(registrationDate), true
+}
+
+// FeatureStateRegistered is the Feature state of a registered preview feature.
+const FeatureStateRegistered = "Registered"
+
+// IsFeatureRegistered returns true if the subscription has the named
+// preview feature in its registered features. Feature names are compared
+// case-insensitively, as ARM does.
+func (s *Subscription) IsFeatureRegistered(name string) bool {
+	if s == nil || s.Properties == nil || s.Properties.RegisteredFeatures == nil {
+		return false
+	}
+	for _, feature := range *s.Properties.RegisteredFeatures {
+		if feature.Name != nil && feature.State != nil &&
+			strings.EqualFold(*feature.Name, name) &&
+			strings.EqualFold(*feature.State, FeatureStateRegistered) {
+			return true
+		}
+	}
+	return false
+}
+
 type SubscriptionProperties struct {
 	TenantId             *string              `json:"tenantId,omitempty"`
 	LocationPlacementId  *string              `json:"locationPlacementId,omitempty"`
@@ -31,7 +106,7 @@ type Feature struct {
 
 type AvailabilityZone struct {
 	Location     *string        `json:"location,omitempty"`
-	ZoneMappings *[]ZoneMapping `json:"zoneMppings,omitempty"`
+	ZoneMappings *[]ZoneMapping `json:"zoneMappings,omitempty"`
 }
 
 type ZoneMapping struct {
@@ -41,7 +116,26 @@ type ZoneMapping struct {
 
 type AccountOwner struct {
 	Puid  *string `json:"puid,omitempty"`
-	Email *string `json:"-,omitempty"` // we don't need to nor want to serialize this field
+	Email *string `json:"-"` // we don't need to nor want to serialize this field
+}
+
+// UnmarshalJSON implements json.Unmarshaler. ARM sends the account
+// owner's email address, so accept it even though it is never serialized.
+// A decoder's DisallowUnknownFields does not reach into an Unmarshaler,
+// so unknown fields are always rejected here.
+func (o *AccountOwner) UnmarshalJSON(data []byte) error {
+	var owner struct {
+		Puid  *string `json:"puid"`
+		Email *string `json:"email"`
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&owner); err != nil {
+		return err
+	}
+	o.Puid = owner.Puid
+	o.Email = owner.Email
+	return nil
 }
 
 type SubscriptionState string
@@ -53,3 +147,67 @@ const (
 	SubscriptionStateDeleted      SubscriptionState = "Deleted"
 	SubscriptionStateSuspended    SubscriptionState = "Suspended"
 )
+
+// subscriptionStates lists every known subscription state.
+var subscriptionStates = []SubscriptionState{
+	SubscriptionStateRegistered,
+	SubscriptionStateUnregistered,
+	SubscriptionStateWarned,
+	SubscriptionStateDeleted,
+	SubscriptionStateSuspended,
+}
+
+// SubscriptionStates returns every known subscription state.
+func SubscriptionStates() []SubscriptionState {
+	return slices.Clone(subscriptionStates)
+}
+
+// UnmarshalJSON maps a subscription state to its canonical casing, since
+// ARM does not guarantee the casing of the states it sends. Unknown states
+// are kept as-is so that validation rejects them.
+func (s *SubscriptionState) UnmarshalJSON(data []byte) error {
+	var value string
+	if err := json.Unmarshal(data, &value); err != nil {
+		return err
+	}
+	*s = SubscriptionState(value)
+	for _, state := range subscriptionStates {
+		if strings.EqualFold(value, string(state)) {
+			*s = state
+			break
+		}
+	}
+	return nil
+}
+
+// subscriptionStateTransitions lists the states each subscription state
+// may transition to, per the resource provider contract's subscription
+// lifecycle. A suspended subscription is either reinstated or deleted,
+// and Deleted is a terminal state.
+var subscriptionStateTransitions = map[SubscriptionState][]SubscriptionState{
+	SubscriptionStateRegistered: {
+		SubscriptionStateWarned,
+		SubscriptionStateSuspended,
+		SubscriptionStateDeleted,
+		SubscriptionStateUnregistered,
+	},
+	SubscriptionStateWarned: {
+		SubscriptionStateRegistered,
+		SubscriptionStateSuspended,
+		SubscriptionStateDeleted,
+	},
+	SubscriptionStateSuspended: {
+		SubscriptionStateRegistered,
+		SubscriptionStateDeleted,
+	},
+	SubscriptionStateUnregistered: {
+		SubscriptionStateRegistered,
+		SubscriptionStateDeleted,
+	},
+}
+
+// CanTransitionTo returns true if a subscription in this state may move to
+// the target state. Remaining in the same state is always allowed.
+func (s SubscriptionState) CanTransitionTo(target SubscriptionState) bool {
+	return s == target || slices.Contains(subscriptionStateTransitions[s], target)
+}
@@ -0,0 +1,358 @@
+package arm
+
+// Copyright (c) Microsoft Corporation.
+// Licensed under the Apache License 2.0.
+
+import (
+	"encoding/json"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestSubscriptionStateCanTransitionTo(t *testing.T) {
+	tests := []struct {
+		name     string
+		from     SubscriptionState
+		to       SubscriptionState
+		expected bool
+	}{
+		{
+			name:     "Registered to Warned",
+			from:     SubscriptionStateRegistered,
+			to:       SubscriptionStateWarned,
+			expected: true,
+		},
+		{
+			name:     "Suspended to Registered",
+			from:     SubscriptionStateSuspended,
+			to:       SubscriptionStateRegistered,
+			expected: true,
+		},
+		{
+			name:     "Unregistered to Suspended",
+			from:     SubscriptionStateUnregistered,
+			to:       SubscriptionStateSuspended,
+			expected: false,
+		},
+		{
+			name:     "Deleted to Registered",
+			from:     SubscriptionStateDeleted,
+			to:       SubscriptionStateRegistered,
+			expected: false,
+		},
+		{
+			name:     "Same state",
+			from:     SubscriptionStateDeleted,
+			to:       SubscriptionStateDeleted,
+			expected: true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			actual := test.from.CanTransitionTo(test.to)
+			if actual != test.expected {
+				t.Errorf("expected %t, got %t", test.expected, actual)
+			}
+		})
+	}
+}
+
+func TestSubscriptionStateTransitions(t *testing.T) {
+	states := []SubscriptionState{
+		SubscriptionStateRegistered,
+		SubscriptionStateUnregistered,
+		SubscriptionStateWarned,
+		SubscriptionStateSuspended,
+		SubscriptionStateDeleted,
+	}
+
+	// allowed lists the legal transitions out of each state,
+	// besides remaining in the same state.
+	allowed := map[SubscriptionState][]SubscriptionState{
+		SubscriptionStateRegistered:   {SubscriptionStateUnregistered, SubscriptionStateWarned, SubscriptionStateSuspended, SubscriptionStateDeleted},
+		SubscriptionStateUnregistered: {SubscriptionStateRegistered, SubscriptionStateDeleted},
+		SubscriptionStateWarned:       {SubscriptionStateRegistered, SubscriptionStateSuspended, SubscriptionStateDeleted},
+		SubscriptionStateSuspended:    {SubscriptionStateRegistered, SubscriptionStateDeleted},
+		SubscriptionStateDeleted:      {},
+	}
+
+	for _, from := range states {
+		for _, to := range states {
+			t.Run(string(from)+" to "+string(to), func(t *testing.T) {
+				expected := from == to || slices.Contains(allowed[from], to)
+				actual := from.CanTransitionTo(to)
+				if actual != expected {
+					t.Errorf("expected %t, got %t", expected, actual)
+				}
+			})
+		}
+	}
+}
+
+func TestSubscriptionIsFeatureRegistered(t *testing.T) {
+	const featureName = "Microsoft.RedHatOpenShift/Preview"
+
+	ptr := func(s string) *string { return &s }
+
+	tests := []struct {
+		name         string
+		subscription *Subscription
+		expected     bool
+	}{
+		{
+			name:         "Nil subscription",
+			subscription: nil,
+			expected:     false,
+		},
+		{
+			name:         "No properties",
+			subscription: &Subscription{},
+			expected:     false,
+		},
+		{
+			name: "Feature registered",
+			subscription: &Subscription{Properties: &SubscriptionProperties{
+				RegisteredFeatures: &[]Feature{{Name: ptr(featureName), State: ptr(FeatureStateRegistered)}},
+			}},
+			expected: true,
+		},
+		{
+			name: "Feature name differs in case",
+			subscription: &Subscription{Properties: &SubscriptionProperties{
+				RegisteredFeatures: &[]Feature{{Name: ptr("microsoft.redhatopenshift/preview"), State: ptr(FeatureStateRegistered)}},
+			}},
+			expected: true,
+		},
+		{
+			name: "Feature not yet registered",
+			subscription: &Subscription{Properties: &SubscriptionProperties{
+				RegisteredFeatures: &[]Feature{{Name: ptr(featureName), State: ptr("Registering")}},
+			}},
+			expected: false,
+		},
+		{
+			name: "Other feature registered",
+			subscription: &Subscription{Properties: &SubscriptionProperties{
+				RegisteredFeatures: &[]Feature{{Name: ptr("Microsoft.RedHatOpenShift/Other"), State: ptr(FeatureStateRegistered)}},
+			}},
+			expected: false,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			actual := test.subscription.IsFeatureRegistered(featureName)
+			if actual != test.expected {
+				t.Errorf("expected %t, got %t", test.expected, actual)
+			}
+		})
+	}
+}
+
+func TestSubscriptionStateUnmarshalJSON(t *testing.T) {
+	tests := []struct {
+		name     string
+		json     string
+		expected SubscriptionState
+	}{
+		{
+			name:     "Canonical casing",
+			json:     `"Registered"`,
+			expected: SubscriptionStateRegistered,
+		},
+		{
+			name:     "Lowercase",
+			json:     `"registered"`,
+			expected: SubscriptionStateRegistered,
+		},
+		{
+			name:     "Uppercase",
+			json:     `"REGISTERED"`,
+			expected: SubscriptionStateRegistered,
+		},
+		{
+			name:     "Unknown state is kept as-is",
+			json:     `"Bogus"`,
+			expected: SubscriptionState("Bogus"),
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var actual SubscriptionState
+			err := json.Unmarshal([]byte(test.json), &actual)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if actual != test.expected {
+				t.Errorf("expected %q, got %q", test.expected, actual)
+			}
+		})
+	}
+}
+
+func TestSubscriptionMarshalJSON(t *testing.T) {
+	ptr := func(s string) *string { return &s }
+
+	tests := []struct {
+		name         string
+		subscription *Subscription
+		expected     string
+	}{
+		{
+			name: "Nil properties",
+			subscription: &Subscription{
+				State:            SubscriptionStateRegistered,
+				RegistrationDate: ptr("Thu, 15 Oct 2026 00:00:00 GMT"),
+				Properties:       nil,
+			},
+			expected: `{"state":"Registered","registrationDate":"Thu, 15 Oct 2026 00:00:00 GMT","properties":{}}`,
+		},
+		{
+			name: "Empty properties",
+			subscription: &Subscription{
+				State:            SubscriptionStateRegistered,
+				RegistrationDate: ptr("Thu, 15 Oct 2026 00:00:00 GMT"),
+				Properties:       &SubscriptionProperties{},
+			},
+			expected: `{"state":"Registered","registrationDate":"Thu, 15 Oct 2026 00:00:00 GMT","properties":{}}`,
+		},
+		{
+			name: "Populated properties",
+			subscription: &Subscription{
+				State:            SubscriptionStateWarned,
+				RegistrationDate: ptr("Thu, 15 Oct 2026 00:00:00 GMT"),
+				Properties:       &SubscriptionProperties{TenantId: ptr("00000000-0000-0000-0000-000000000000")},
+			},
+			expected: `{"state":"Warned","registrationDate":"Thu, 15 Oct 2026 00:00:00 GMT","properties":{"tenantId":"00000000-0000-0000-0000-000000000000"}}`,
+		},
+		{
+			name:         "Zero value",
+			subscription: &Subscription{},
+			expected:     `{"state":"","registrationDate":null,"properties":{}}`,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			nilProperties := test.subscription.Properties == nil
+
+			// Marshal both the pointer and the value, since
+			// subscriptions are serialized both ways.
+			for _, v := range []any{test.subscription, *test.subscription} {
+				actual, err := json.Marshal(v)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if string(actual) != test.expected {
+					t.Errorf("expected %s, got %s", test.expected, actual)
+				}
+			}
+
+			if nilProperties != (test.subscription.Properties == nil) {
+				t.Error("MarshalJSON modified the subscription")
+			}
+		})
+	}
+}
+
+func TestSubscriptionMarshalJSONRoundTrip(t *testing.T) {
+	// A subscription received with null properties
+	// must serialize the same way every time.
+	data := []byte(`{"state":"Registered","registrationDate":"Thu, 15 Oct 2026 00:00:00 GMT","properties":null}`)
+	expected := `{"state":"Registered","registrationDate":"Thu, 15 Oct 2026 00:00:00 GMT","properties":{}}`
+
+	for i := 0; i < 2; i++ {
+		var subscription Subscription
+		if err := json.Unmarshal(data, &subscription); err != nil {
+			t.Fatal(err)
+		}
+		if subscription.IsFeatureRegistered("Microsoft.RedHatOpenShift/Preview") {
+			t.Error("expected no registered features")
+		}
+		actual, err := json.Marshal(&subscription)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(actual) != expected {
+			t.Errorf("pass %d: expected %s, got %s", i+1, expected, actual)
+		}
+		data = actual
+	}
+}
+
+func TestSubscriptionAccountOwnerEmail(t *testing.T) {
+	data := []byte(`{"state":"Registered","registrationDate":"Thu, 15 Oct 2026 00:00:00 GMT","properties":{"accountOwner":{"puid":"1000000000000000","email":"owner@example.com"}}}`)
+	expected := `{"state":"Registered","registrationDate":"Thu, 15 Oct 2026 00:00:00 GMT","properties":{"accountOwner":{"puid":"1000000000000000"}}}`
+
+	var subscription Subscription
+	if err := json.Unmarshal(data, &subscription); err != nil {
+		t.Fatal(err)
+	}
+	owner := subscription.Properties.AccountOwner
+	if owner == nil || owner.Email == nil || *owner.Email != "owner@example.com" {
+		t.Errorf("expected the account owner email to be decoded, got %+v", owner)
+	}
+
+	// The email address is never serialized.
+	actual, err := json.Marshal(&subscription)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(actual) != expected {
+		t.Errorf("expected %s, got %s", expected, actual)
+	}
+}
+
+func TestSubscriptionRegistrationAge(t *testing.T) {
+	ptr := func(s string) *string { return &s }
+
+	now := time.Date(2024, time.June, 10, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name         string
+		subscription *Subscription
+		expectedAge  time.Duration
+		expectedOK   bool
+	}{
+		{
+			name:         "Nil subscription",
+			subscription: nil,
+		},
+		{
+			name:         "No registration date",
+			subscription: &Subscription{},
+		},
+		{
+			name:         "RFC1123 registration date",
+			subscription: &Subscription{RegistrationDate: ptr("Mon, 03 Jun 2024 12:00:00 GMT")},
+			expectedAge:  7 * 24 * time.Hour,
+			expectedOK:   true,
+		},
+		{
+			name:         "RFC1123 registration date with numeric zone",
+			subscription: &Subscription{RegistrationDate: ptr("Mon, 10 Jun 2024 13:30:00 +0200")},
+			expectedAge:  30 * time.Minute,
+			expectedOK:   true,
+		},
+		{
+			name:         "RFC3339 registration date",
+			subscription: &Subscription{RegistrationDate: ptr("2024-06-10T11:59:30.5Z")},
+			expectedAge:  29*time.Second + 500*time.Millisecond,
+			expectedOK:   true,
+		},
+		{
+			name:         "Unrecognized registration date",
+			subscription: &Subscription{RegistrationDate: ptr("last Tuesday")},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			age, ok := test.subscription.RegistrationAge(now)
+			if ok != test.expectedOK {
+				t.Fatalf("expected ok %t, got %t", test.expectedOK, ok)
+			}
+			if age != test.expectedAge {
+				t.Errorf("expected age %s, got %s", test.expectedAge, age)
+			}
+		})
+	}
+}
@@ -4,6 +4,8 @@ package api
 // Licensed under the Apache License 2.0.
 
 import (
+	"fmt"
+
 	configv1 "github.com/openshift/api/config/v1"
 
 	"github.com/Azure/ARO-HCP/internal/api/arm"
@@ -113,6 +115,41 @@ type ExternalAuthConfigProfile struct {
 	ExternalAuths []*configv1.OIDCProvider `json:"externalAuths,omitempty" visibility:"read"`
 }
 
+// clusterStructTagMap holds the struct tags of the cluster fields,
+// including their visibility.
+var clusterStructTagMap = NewStructTagMap[HCPOpenShiftCluster]()
+
+// PreserveReadOnly copies the read-only fields of current, which are
+// managed by the service, into cluster.
+func (cluster *HCPOpenShiftCluster) PreserveReadOnly(current *HCPOpenShiftCluster) {
+	CopyReadOnly(cluster, current, clusterStructTagMap)
+}
+
+// ResourceReferences returns the Azure resource IDs referenced by the
+// cluster, keyed by the JSON path of the referencing field.
+func (cluster *HCPOpenShiftCluster) ResourceReferences() map[string]string {
+	platform := &cluster.Properties.Spec.Platform
+	identities := &platform.OperatorsAuthentication.UserAssignedIdentities
+
+	const platformPath = "properties.spec.platform"
+	const identitiesPath = platformPath + ".operatorsAuthentication.userAssignedIdentities"
+
+	references := map[string]string{
+		platformPath + ".subnetId":                 platform.SubnetID,
+		platformPath + ".networkSecurityGroupId":   platform.NetworkSecurityGroupID,
+		platformPath + ".etcdEncryptionSetId":      platform.EtcdEncryptionSetID,
+		identitiesPath + ".serviceManagedIdentity": identities.ServiceManagedIdentity,
+	}
+	for operator, identity := range identities.ControlPlaneOperators {
+		references[fmt.Sprintf("%s.controlPlaneOperators[%s]", identitiesPath, operator)] = identity
+	}
+	for operator, identity := range identities.DataPlaneOperators {
+		references[fmt.Sprintf("%s.dataPlaneOperators[%s]", identitiesPath, operator)] = identity
+	}
+
+	return references
+}
+
 // Creates an HCPOpenShiftCluster with any non-zero default values.
 func NewDefaultHCPOpenShiftCluster() *HCPOpenShiftCluster {
 	return &HCPOpenShiftCluster{
@@ -5,6 +5,7 @@ package api
 
 import (
 	"net/http"
+	"strings"
 	"testing"
 
 	"dario.cat/mergo"
@@ -241,6 +242,82 @@ func TestClusterValidateTags(t *testing.T) {
 				},
 			},
 		},
+		{
+			name: "Control character in free text",
+			tweaks: &HCPOpenShiftCluster{
+				Properties: HCPOpenShiftClusterProperties{
+					Spec: ClusterSpec{
+						Proxy: ProxyProfile{
+							NoProxy: "example.com\x00",
+						},
+					},
+				},
+			},
+			expectErrors: []arm.CloudErrorBody{
+				{
+					Message: "Invalid value for field 'noProxy' (must not contain control characters)",
+					Target:  "properties.spec.proxy.noProxy",
+				},
+			},
+		},
+		{
+			name: "Control character in tag value",
+			tweaks: &HCPOpenShiftCluster{
+				TrackedResource: arm.TrackedResource{
+					Tags: map[string]string{"clean": "value", "dirty": "bell\a"},
+				},
+			},
+			expectErrors: []arm.CloudErrorBody{
+				{
+					Message: "Invalid value for field 'tags[dirty]' (must not contain control characters)",
+					Target:  "tags[dirty]",
+				},
+			},
+		},
+		{
+			name: "Control character in tag key",
+			tweaks: &HCPOpenShiftCluster{
+				TrackedResource: arm.TrackedResource{
+					Tags: map[string]string{"escape\x1b": "value"},
+				},
+			},
+			expectErrors: []arm.CloudErrorBody{
+				{
+					Message: "Invalid value for field 'tags' (must not contain control characters)",
+					Target:  "tags",
+				},
+			},
+		},
+		{
+			name: "Tag keys differing only by case",
+			tweaks: &HCPOpenShiftCluster{
+				TrackedResource: arm.TrackedResource{
+					Tags: map[string]string{"Env": "prod", "env": "test", "team": "ARO HCP"},
+				},
+			},
+			expectErrors: []arm.CloudErrorBody{
+				{
+					Message: "Field 'tags' has keys 'Env' and 'env' that differ only by case",
+					Target:  "tags",
+				},
+			},
+		},
+		{
+			name: "Distinct tag keys are accepted",
+			tweaks: &HCPOpenShiftCluster{
+				TrackedResource: arm.TrackedResource{
+					Tags: map[string]string{"Env": "prod", "Environment": "prod", "ENV2": "test"},
+				},
+			},
+		},
+		{
+			name: "Clean tags and whitespace are accepted",
+			tweaks: &HCPOpenShiftCluster{
+				TrackedResource: arm.TrackedResource{
+					Tags: map[string]string{"team": "ARO HCP", "notes": "line one\nline two\ttabbed"},
+				},
+			},
+		},
 	}
 
 	validate := newTestValidator()
@@ -262,3 +339,214 @@ func TestClusterValidateTags(t *testing.T) {
 		})
 	}
 }
+
+func TestClusterValidateIdentity(t *testing.T) {
+	userAssignedIdentities := map[string]*arm.UserAssignedIdentity{
+		"/subscriptions/00000000-0000-0000-0000-000000000000/resourceGroups/myRG/providers/Microsoft.ManagedIdentity/userAssignedIdentities/myIdentity": {},
+	}
+
+	tests := []struct {
+		name         string
+		identity     arm.Identity
+		expectErrors []arm.CloudErrorBody
+	}{
+		{
+			name: "No identity",
+		},
+		{
+			name:     "None",
+			identity: arm.Identity{Type: arm.ManagedServiceIdentityTypeNone},
+		},
+		{
+			name:     "SystemAssigned",
+			identity: arm.Identity{Type: arm.ManagedServiceIdentityTypeSystemAssigned},
+		},
+		{
+			name: "UserAssigned",
+			identity: arm.Identity{
+				Type:                   arm.ManagedServiceIdentityTypeUserAssigned,
+				UserAssignedIdentities: userAssignedIdentities,
+			},
+		},
+		{
+			name: "SystemAssigned,UserAssigned",
+			identity: arm.Identity{
+				Type:                   arm.ManagedServiceIdentityTypeSystemAssignedUserAssigned,
+				UserAssignedIdentities: userAssignedIdentities,
+			},
+		},
+		{
+			name:     "SystemAssigned in lowercase",
+			identity: arm.Identity{Type: "systemassigned"},
+		},
+		{
+			name: "SystemAssigned,UserAssigned in lowercase",
+			identity: arm.Identity{
+				Type:                   "systemassigned,userassigned",
+				UserAssignedIdentities: userAssignedIdentities,
+			},
+		},
+		{
+			name:     "UserAssigned in lowercase without identities",
+			identity: arm.Identity{Type: "userassigned"},
+			expectErrors: []arm.CloudErrorBody{
+				{
+					Message: "Field 'userAssignedIdentities' must specify at least one identity when 'type' is 'userassigned'",
+					Target:  "identity.userAssignedIdentities",
+				},
+			},
+		},
+		{
+			name:     "UserAssigned without identities",
+			identity: arm.Identity{Type: arm.ManagedServiceIdentityTypeUserAssigned},
+			expectErrors: []arm.CloudErrorBody{
+				{
+					Message: "Field 'userAssignedIdentities' must specify at least one identity when 'type' is 'UserAssigned'",
+					Target:  "identity.userAssignedIdentities",
+				},
+			},
+		},
+		{
+			name:     "SystemAssigned,UserAssigned without identities",
+			identity: arm.Identity{Type: arm.ManagedServiceIdentityTypeSystemAssignedUserAssigned},
+			expectErrors: []arm.CloudErrorBody{
+				{
+					Message: "Field 'userAssignedIdentities' must specify at least one identity when 'type' is 'SystemAssigned,UserAssigned'",
+					Target:  "identity.userAssignedIdentities",
+				},
+			},
+		},
+		{
+			name:     "Unknown type",
+			identity: arm.Identity{Type: "UserAssigned,SystemAssigned"},
+			expectErrors: []arm.CloudErrorBody{
+				{
+					Message: "Invalid value 'UserAssigned,SystemAssigned' for field 'type' (must be one of: None SystemAssigned SystemAssigned,UserAssigned UserAssigned)",
+					Target:  "identity.type",
+				},
+			},
+		},
+	}
+
+	validate := newTestValidator()
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resource := minimumValidCluster()
+			resource.Identity = tt.identity
+
+			actualErrors := ValidateRequest(validate, http.MethodPut, resource)
+
+			diff := compareErrors(tt.expectErrors, actualErrors)
+			if diff != "" {
+				t.Fatalf("Expected error mismatch:\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestClusterValidateResourceReferences(t *testing.T) {
+	const (
+		clusterID = "/subscriptions/00000000-0000-0000-0000-000000000000/resourceGroups/myRG/providers/Microsoft.RedHatOpenShift/hcpOpenShiftClusters/myCluster"
+		subnetID  = "/subscriptions/00000000-0000-0000-0000-000000000000/resourceGroups/myRG/providers/Microsoft.Network/virtualNetworks/myVNet/subnets/mySubnet"
+		nsgID     = "/subscriptions/00000000-0000-0000-0000-000000000000/resourceGroups/myRG/providers/Microsoft.Network/networkSecurityGroups/myNSG"
+	)
+
+	resourceID, err := arm.ParseResourceID(clusterID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name         string
+		tweaks       *HCPOpenShiftCluster
+		expectErrors []arm.CloudErrorBody
+	}{
+		{
+			name: "Valid reference is accepted",
+			tweaks: &HCPOpenShiftCluster{
+				Properties: HCPOpenShiftClusterProperties{
+					Spec: ClusterSpec{
+						Platform: PlatformProfile{
+							SubnetID:               subnetID,
+							NetworkSecurityGroupID: nsgID,
+						},
+					},
+				},
+			},
+		},
+		{
+			name: "Self-reference is rejected",
+			tweaks: &HCPOpenShiftCluster{
+				Properties: HCPOpenShiftClusterProperties{
+					Spec: ClusterSpec{
+						Platform: PlatformProfile{
+							SubnetID: strings.ToUpper(clusterID),
+						},
+					},
+				},
+			},
+			expectErrors: []arm.CloudErrorBody{
+				{
+					Message: "Invalid value '" + strings.ToUpper(clusterID) + "' for field 'properties.spec.platform.subnetId' (must not reference the resource itself)",
+					Target:  "properties.spec.platform.subnetId",
+				},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resource := minimumValidCluster()
+			err := mergo.Merge(resource, tt.tweaks, mergo.WithOverride)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var actualErrors []arm.CloudErrorBody
+
+			cloudError := ValidateResourceReferences(resourceID, resource.ResourceReferences())
+			if cloudError != nil {
+				if cloudError.StatusCode != http.StatusBadRequest {
+					t.Fatalf("expected status code %d, got %d", http.StatusBadRequest, cloudError.StatusCode)
+				}
+				// A single error is promoted out of details.
+				actualErrors = []arm.CloudErrorBody{*cloudError.CloudErrorBody}
+			}
+
+			diff := compareErrors(tt.expectErrors, actualErrors)
+			if diff != "" {
+				t.Fatalf("Expected error mismatch:\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestClusterPreserveReadOnly(t *testing.T) {
+	current := minimumValidCluster()
+	current.Properties.ProvisioningState = arm.ProvisioningStateSucceeded
+	current.Properties.Spec.Version.AvailableUpgrades = []string{"openshift-v4.16.1"}
+	current.Properties.Spec.DNS.BaseDomain = "example.com"
+	current.Properties.Spec.DNS.BaseDomainPrefix = "current"
+	current.Properties.Spec.Console.URL = "https://console.example.com"
+	current.Properties.Spec.API.URL = "https://api.example.com"
+	current.Properties.Spec.IssuerURL = "https://issuer.example.com"
+
+	cluster := NewDefaultHCPOpenShiftCluster()
+	cluster.Properties.Spec.DNS.BaseDomainPrefix = "request"
+	cluster.Properties.Spec.Console.URL = "https://console.invalid"
+	cluster.PreserveReadOnly(current)
+
+	expected := NewDefaultHCPOpenShiftCluster()
+	expected.Properties.ProvisioningState = current.Properties.ProvisioningState
+	expected.Properties.Spec.Version.AvailableUpgrades = current.Properties.Spec.Version.AvailableUpgrades
+	expected.Properties.Spec.DNS.BaseDomain = current.Properties.Spec.DNS.BaseDomain
+	expected.Properties.Spec.DNS.BaseDomainPrefix = "request"
+	expected.Properties.Spec.Console.URL = current.Properties.Spec.Console.URL
+	expected.Properties.Spec.API.URL = current.Properties.Spec.API.URL
+	expected.Properties.Spec.IssuerURL = current.Properties.Spec.IssuerURL
+
+	if diff := cmp.Diff(expected, cluster); diff != "" {
+		t.Errorf("unexpected cluster (-want +got):\n%s", diff)
+	}
+}
@@ -58,6 +58,17 @@ type Taint struct {
 	Value  string `json:"value,omitempty"`
 }
 
+// ResourceReferences returns the Azure resource IDs referenced by the
+// node pool, keyed by the JSON path of the referencing field.
+func (nodePool *HCPOpenShiftClusterNodePool) ResourceReferences() map[string]string {
+	const platformPath = "properties.spec.platform"
+
+	return map[string]string{
+		platformPath + ".subnetId":            nodePool.Properties.Spec.Platform.SubnetID,
+		platformPath + ".diskEncryptionSetId": nodePool.Properties.Spec.Platform.DiskEncryptionSetID,
+	}
+}
+
 func NewDefaultHCPOpenShiftClusterNodePool() *HCPOpenShiftClusterNodePool {
 	return &HCPOpenShiftClusterNodePool{
 		Properties: HCPOpenShiftClusterNodePoolProperties{
@@ -5,6 +5,9 @@ package api
 
 import (
 	"fmt"
+	"maps"
+	"slices"
+	"strings"
 
 	azcorearm "github.com/Azure/azure-sdk-for-go/sdk/azcore/arm"
 
@@ -21,9 +24,17 @@ const (
 	ResourceTypeDisplay             = "Hosted Control Plane (HCP) OpenShift Clusters"
 )
 
+// Preview features a subscription must register through ARM before
+// the corresponding behavior is enabled.
+const (
+	FeatureExternalAuth = ProviderNamespace + "/ExternalAuth"
+)
+
 var (
-	ClusterResourceType  = azcorearm.NewResourceType(ProviderNamespace, ClusterResourceTypeName)
-	NodePoolResourceType = azcorearm.NewResourceType(ProviderNamespace, ClusterResourceTypeName+"/"+NodePoolResourceTypeName)
+	ClusterResourceType         = azcorearm.NewResourceType(ProviderNamespace, ClusterResourceTypeName)
+	NodePoolResourceType        = azcorearm.NewResourceType(ProviderNamespace, ClusterResourceTypeName+"/"+NodePoolResourceTypeName)
+	OperationResultResourceType = azcorearm.NewResourceType(ProviderNamespace, "locations/"+OperationResultResourceTypeName)
+	OperationStatusResourceType = azcorearm.NewResourceType(ProviderNamespace, "locations/"+OperationStatusResourceTypeName)
 )
 
 type VersionedHCPOpenShiftCluster interface {
@@ -45,14 +56,68 @@ type Version interface {
 	NewHCPOpenShiftClusterNodePool(*HCPOpenShiftClusterNodePool) VersionedHCPOpenShiftClusterNodePool
 }
 
+// contractVersions lists the API versions of the resource provider contract,
+// which ARM uses for subscription lifecycle and provider metadata requests
+// rather than any ARO-HCP API version.
+var contractVersions = []string{"2.0"}
+
+// ContractVersions returns the supported resource provider contract API versions.
+func ContractVersions() []string {
+	return slices.Clone(contractVersions)
+}
+
 // apiRegistry is the map of registered API versions
 var apiRegistry = map[string]Version{}
 
-func Register(version Version) {
+// apiResourceTypes is the map of resource types supported by registered API versions
+var apiResourceTypes = map[string][]azcorearm.ResourceType{}
+
+// Register adds an API version to the registry along with the
+// resource types that API version supports.
+func Register(version Version, resourceTypes ...azcorearm.ResourceType) {
 	apiRegistry[version.String()] = version
+	apiResourceTypes[version.String()] = resourceTypes
 }
 
 func Lookup(key string) (version Version, ok bool) {
 	version, ok = apiRegistry[key]
 	return
 }
+
+// SupportsResourceType returns true if the given API version is registered
+// and supports the given resource type. Resource types are compared case
+// insensitively.
+func SupportsResourceType(key string, resourceType azcorearm.ResourceType) bool {
+	return slices.ContainsFunc(apiResourceTypes[key], func(item azcorearm.ResourceType) bool {
+		return strings.EqualFold(item.String(), resourceType.String())
+	})
+}
+
+// ProviderMetadata describes the resource types supported by registered
+// API versions, in the form ARM uses for resource provider metadata.
+// Resource types and API versions are sorted for a stable response.
+func ProviderMetadata() *arm.Provider {
+	apiVersions := map[string][]string{}
+	for version, resourceTypes := range apiResourceTypes {
+		for _, resourceType := range resourceTypes {
+			apiVersions[resourceType.Type] = append(apiVersions[resourceType.Type], version)
+		}
+	}
+
+	provider := &arm.Provider{
+		ID:            "/providers/" + ProviderNamespace,
+		Namespace:     ProviderNamespace,
+		ResourceTypes: make([]arm.ProviderResourceType, 0, len(apiVersions)),
+	}
+
+	for _, resourceType := range slices.Sorted(maps.Keys(apiVersions)) {
+		versions := apiVersions[resourceType]
+		slices.Sort(versions)
+		provider.ResourceTypes = append(provider.ResourceTypes, arm.ProviderResourceType{
+			ResourceType: resourceType,
+			APIVersions:  versions,
+		})
+	}
+
+	return provider
+}
@@ -8,7 +8,10 @@ import (
 	"reflect"
 	"testing"
 
+	azcorearm "github.com/Azure/azure-sdk-for-go/sdk/azcore/arm"
 	validator "github.com/go-playground/validator/v10"
+
+	"github.com/Azure/ARO-HCP/internal/api/arm"
 )
 
 func TestGetJSONTagName(t *testing.T) {
@@ -223,3 +226,80 @@ func TestNewValidator(t *testing.T) {
 		})
 	}
 }
+
+func TestSupportsResourceType(t *testing.T) {
+	// Register resource types without implementing the interface.
+	apiResourceTypes["clusters-only-api-version"] = []azcorearm.ResourceType{ClusterResourceType}
+	t.Cleanup(func() { delete(apiResourceTypes, "clusters-only-api-version") })
+
+	tests := []struct {
+		name         string
+		apiVersion   string
+		resourceType azcorearm.ResourceType
+		expected     bool
+	}{
+		{
+			name:         "Supported resource type",
+			apiVersion:   "clusters-only-api-version",
+			resourceType: ClusterResourceType,
+			expected:     true,
+		},
+		{
+			name:         "Supported resource type with different casing",
+			apiVersion:   "clusters-only-api-version",
+			resourceType: azcorearm.NewResourceType("MICROSOFT.REDHATOPENSHIFT", "HCPOPENSHIFTCLUSTERS"),
+			expected:     true,
+		},
+		{
+			name:         "Unsupported resource type",
+			apiVersion:   "clusters-only-api-version",
+			resourceType: NodePoolResourceType,
+			expected:     false,
+		},
+		{
+			name:         "Unknown API version",
+			apiVersion:   "bogus-api-version",
+			resourceType: ClusterResourceType,
+			expected:     false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			actual := SupportsResourceType(tt.apiVersion, tt.resourceType)
+			if actual != tt.expected {
+				t.Errorf("Expected %t for '%s' in API version '%s', got %t", tt.expected, tt.resourceType, tt.apiVersion, actual)
+			}
+		})
+	}
+}
+
+func TestProviderMetadata(t *testing.T) {
+	// Swap in a known set of registered resource types.
+	savedResourceTypes := apiResourceTypes
+	t.Cleanup(func() { apiResourceTypes = savedResourceTypes })
+	apiResourceTypes = map[string][]azcorearm.ResourceType{
+		"2024-01-01": {ClusterResourceType},
+		"2023-01-01": {ClusterResourceType, NodePoolResourceType},
+	}
+
+	expected := &arm.Provider{
+		ID:        "/providers/Microsoft.RedHatOpenShift",
+		Namespace: "Microsoft.RedHatOpenShift",
+		ResourceTypes: []arm.ProviderResourceType{
+			{
+				ResourceType: "hcpOpenShiftClusters",
+				APIVersions:  []string{"2023-01-01", "2024-01-01"},
+			},
+			{
+				ResourceType: "hcpOpenShiftClusters/nodePools",
+				APIVersions:  []string{"2023-01-01"},
+			},
+		},
+	}
+
+	actual := ProviderMetadata()
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("Expected provider metadata %+v, got %+v", expected, actual)
+	}
+}
@@ -89,6 +89,29 @@ func newUserAssignedIdentitiesProfile(from *api.UserAssignedIdentitiesProfile) *
 	}
 }
 
+func newManagedServiceIdentity(from *arm.Identity) *generated.ManagedServiceIdentity {
+	// ARM omits the identity of a resource that has none,
+	// and omits principal and tenant IDs that are not set.
+	if from.Type == "" && from.PrincipalID == "" && from.TenantID == "" && len(from.UserAssignedIdentities) == 0 {
+		return nil
+	}
+
+	out := &generated.ManagedServiceIdentity{
+		//as UserAssignedIdentities is of a different type so using convertUserAssignedIdentities instead of StringMapToStringPtrMap
+		UserAssignedIdentities: convertUserAssignedIdentities(from.UserAssignedIdentities),
+	}
+	if from.Type != "" {
+		out.Type = api.Ptr(generated.ManagedServiceIdentityType(from.Type))
+	}
+	if from.PrincipalID != "" {
+		out.PrincipalID = api.Ptr(from.PrincipalID)
+	}
+	if from.TenantID != "" {
+		out.TenantID = api.Ptr(from.TenantID)
+	}
+	return out
+}
+
 func newExternalAuthProfile(from *configv1.OIDCProvider) *generated.ExternalAuthProfile {
 	out := &generated.ExternalAuthProfile{
 		Issuer: &generated.TokenIssuerProfile{
@@ -167,13 +190,7 @@ func (v version) NewHCPOpenShiftCluster(from *api.HCPOpenShiftCluster) api.Versi
 			Type:     api.Ptr(from.Resource.Type),
 			Location: api.Ptr(from.TrackedResource.Location),
 			Tags:     api.StringMapToStringPtrMap(from.TrackedResource.Tags),
-			Identity: &generated.ManagedServiceIdentity{
-				Type:        api.Ptr(generated.ManagedServiceIdentityType(from.Identity.Type)),
-				PrincipalID: api.Ptr(from.Identity.PrincipalID),
-				TenantID:    api.Ptr(from.Identity.TenantID),
-				//as UserAssignedIdentities is of a different type so using convertUserAssignedIdentities instead of StringMapToStringPtrMap
-				UserAssignedIdentities: convertUserAssignedIdentities(from.Identity.UserAssignedIdentities),
-			},
+			Identity: newManagedServiceIdentity(&from.Identity),
 			Properties: &generated.HcpOpenShiftClusterProperties{
 				ProvisioningState: api.Ptr(generated.ProvisioningState(from.Properties.ProvisioningState)),
 				Spec: &generated.ClusterSpec{
@@ -558,6 +575,9 @@ func normalizeIdentityUserAssignedIdentities(p map[string]*generated.UserAssigne
 	}
 }
 func convertUserAssignedIdentities(from map[string]*arm.UserAssignedIdentity) map[string]*generated.UserAssignedIdentity {
+	if len(from) == 0 {
+		return nil
+	}
 	converted := make(map[string]*generated.UserAssignedIdentity)
 	for key, value := range from {
 		if value != nil {
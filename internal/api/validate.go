@@ -6,8 +6,10 @@ package api
 import (
 	"crypto/x509"
 	"fmt"
+	"maps"
 	"net/http"
 	"reflect"
+	"slices"
 	"strings"
 	"unicode"
 
@@ -58,6 +60,31 @@ func NewValidator() *validator.Validate {
 		arm.SubscriptionStateDeleted,
 		arm.SubscriptionStateSuspended))
 
+	// Identity types cannot be an enum alias because one of them contains
+	// a comma, which the "oneof" parameter syntax cannot express.
+	err = validate.RegisterValidation("enum_managedserviceidentitytype", func(fl validator.FieldLevel) bool {
+		field := fl.Field()
+		if field.Kind() != reflect.String {
+			panic("String type required for enum_managedserviceidentitytype")
+		}
+		return isManagedServiceIdentityType(field.String(), managedServiceIdentityTypes...)
+	})
+	if err != nil {
+		panic(err)
+	}
+
+	// Identity types including user-assigned identities must list at least one.
+	validate.RegisterStructValidation(func(sl validator.StructLevel) {
+		identity := sl.Current().Interface().(arm.Identity)
+		userAssignedTypes := []arm.ManagedServiceIdentityType{
+			arm.ManagedServiceIdentityTypeUserAssigned,
+			arm.ManagedServiceIdentityTypeSystemAssignedUserAssigned,
+		}
+		if isManagedServiceIdentityType(string(identity.Type), userAssignedTypes...) && len(identity.UserAssignedIdentities) == 0 {
+			sl.ReportError(identity.UserAssignedIdentities, "userAssignedIdentities", "UserAssignedIdentities", "required_user_assigned_identities", string(identity.Type))
+		}
+	}, arm.Identity{})
+
 	// Use this for string fields specifying an ARO-HCP API version.
 	err = validate.RegisterValidation("api_version", func(fl validator.FieldLevel) bool {
 		field := fl.Field()
@@ -127,8 +154,24 @@ func ValidateRequest(validate *validator.Validate, method string, resource any)
 
 	err := validate.Struct(validateContext{Method: method, Resource: resource})
 
+	// Control characters are never valid in user-supplied strings,
+	// so check for them independently of any struct tags.
+	errorDetails = validateNoControlCharacters(reflect.ValueOf(resource), "", "")
+
+	// Azure tag keys are case-insensitive, so keys
+	// that differ only by case refer to the same tag.
+	if tracked, ok := resource.(interface{ DuplicateTagKeys() (string, string, bool) }); ok {
+		if key1, key2, found := tracked.DuplicateTagKeys(); found {
+			errorDetails = append(errorDetails, arm.CloudErrorBody{
+				Code:    arm.CloudErrorCodeInvalidRequestContent,
+				Message: fmt.Sprintf("Field 'tags' has keys '%s' and '%s' that differ only by case", key1, key2),
+				Target:  "tags",
+			})
+		}
+	}
+
 	if err == nil {
-		return nil
+		return errorDetails
 	}
 
 	// Convert validation errors to cloud error details.
@@ -139,10 +182,18 @@ func ValidateRequest(validate *validator.Validate, method string, resource any)
 			// Try to add a corrective suggestion to the message.
 			tag := fieldErr.Tag()
 			if strings.HasPrefix(tag, "enum_") {
-				if len(strings.Split(fieldErr.Param(), " ")) == 1 {
-					message += fmt.Sprintf(" (must be %s)", fieldErr.Param())
+				param := fieldErr.Param()
+				if tag == "enum_managedserviceidentitytype" { // custom tag
+					s := make([]string, len(managedServiceIdentityTypes))
+					for i, t := range managedServiceIdentityTypes {
+						s[i] = string(t)
+					}
+					param = strings.Join(s, " ")
+				}
+				if len(strings.Split(param, " ")) == 1 {
+					message += fmt.Sprintf(" (must be %s)", param)
 				} else {
-					message += fmt.Sprintf(" (must be one of: %s)", fieldErr.Param())
+					message += fmt.Sprintf(" (must be one of: %s)", param)
 				}
 			} else {
 				switch tag {
@@ -152,6 +203,8 @@ func ValidateRequest(validate *validator.Validate, method string, resource any)
 					message += " (must provide PEM encoded certificates)"
 				case "required", "required_for_put": // custom tag
 					message = fmt.Sprintf("Missing required field '%s'", fieldErr.Field())
+				case "required_user_assigned_identities": // custom tag
+					message = fmt.Sprintf("Field '%s' must specify at least one identity when 'type' is '%s'", fieldErr.Field(), fieldErr.Param())
 				case "cidrv4":
 					message += " (must be a v4 CIDR range)"
 				case "dns_rfc1035_label":
@@ -206,6 +259,102 @@ func ValidateRequest(validate *validator.Validate, method string, resource any)
 	return errorDetails
 }
 
+// managedServiceIdentityTypes lists the identity types ARM recognizes.
+var managedServiceIdentityTypes = []arm.ManagedServiceIdentityType{
+	arm.ManagedServiceIdentityTypeNone,
+	arm.ManagedServiceIdentityTypeSystemAssigned,
+	arm.ManagedServiceIdentityTypeSystemAssignedUserAssigned,
+	arm.ManagedServiceIdentityTypeUserAssigned,
+}
+
+// isManagedServiceIdentityType reports whether s matches one of types.
+// ARM compares identity types case-insensitively.
+func isManagedServiceIdentityType(s string, types ...arm.ManagedServiceIdentityType) bool {
+	return slices.ContainsFunc(types, func(t arm.ManagedServiceIdentityType) bool {
+		return strings.EqualFold(s, string(t))
+	})
+}
+
+// isControlCharacter reports whether r is a control character other
+// than the whitespace characters found in multi-line text like PEM.
+func isControlCharacter(r rune) bool {
+	switch r {
+	case '\t', '\n', '\r':
+		return false
+	}
+	return unicode.IsControl(r)
+}
+
+// validateNoControlCharacters walks v looking for strings, including map
+// keys, that contain control characters. target is the JSON path to v and
+// field is the JSON name of v for use in error messages.
+func validateNoControlCharacters(v reflect.Value, target, field string) []arm.CloudErrorBody {
+	var errorDetails []arm.CloudErrorBody
+
+	newErrorDetail := func(target, field string) arm.CloudErrorBody {
+		return arm.CloudErrorBody{
+			Code:    arm.CloudErrorCodeInvalidRequestContent,
+			Message: fmt.Sprintf("Invalid value for field '%s' (must not contain control characters)", field),
+			Target:  target,
+		}
+	}
+
+	joinTarget := func(name string) string {
+		if target == "" {
+			return name
+		}
+		return target + "." + name
+	}
+
+	switch v.Kind() {
+	case reflect.Pointer, reflect.Interface:
+		if !v.IsNil() {
+			errorDetails = validateNoControlCharacters(v.Elem(), target, field)
+		}
+	case reflect.Struct:
+		for i := range v.NumField() {
+			structField := v.Type().Field(i)
+			if !structField.IsExported() {
+				continue
+			}
+			// Embedded struct fields are flattened in JSON.
+			if structField.Anonymous {
+				errorDetails = append(errorDetails, validateNoControlCharacters(v.Field(i), target, field)...)
+				continue
+			}
+			name := GetJSONTagName(structField.Tag)
+			if name == "" {
+				continue
+			}
+			errorDetails = append(errorDetails, validateNoControlCharacters(v.Field(i), joinTarget(name), name)...)
+		}
+	case reflect.Slice, reflect.Array:
+		for i := range v.Len() {
+			errorDetails = append(errorDetails, validateNoControlCharacters(v.Index(i), fmt.Sprintf("%s[%d]", target, i), field)...)
+		}
+	case reflect.Map:
+		keys := v.MapKeys()
+		slices.SortFunc(keys, func(a, b reflect.Value) int {
+			return strings.Compare(fmt.Sprint(a), fmt.Sprint(b))
+		})
+		for _, key := range keys {
+			// Do not echo a key containing control characters in the target.
+			if key.Kind() == reflect.String && strings.IndexFunc(key.String(), isControlCharacter) >= 0 {
+				errorDetails = append(errorDetails, newErrorDetail(target, field))
+				continue
+			}
+			elemTarget := fmt.Sprintf("%s[%v]", target, key)
+			errorDetails = append(errorDetails, validateNoControlCharacters(v.MapIndex(key), elemTarget, fmt.Sprintf("%s[%v]", field, key))...)
+		}
+	case reflect.String:
+		if strings.IndexFunc(v.String(), isControlCharacter) >= 0 {
+			errorDetails = append(errorDetails, newErrorDetail(target, field))
+		}
+	}
+
+	return errorDetails
+}
+
 // ValidateSubscription validates a subscription request payload.
 func ValidateSubscription(subscription *arm.Subscription) *arm.CloudError {
 	cloudError := arm.NewCloudError(
@@ -215,8 +364,19 @@ func ValidateSubscription(subscription *arm.Subscription) *arm.CloudError {
 	cloudError.Details = make([]arm.CloudErrorBody, 0)
 
 	validate := NewValidator()
-	// There is no PATCH method for subscriptions, so assume PUT.
+	// A PATCH is validated once merged onto the stored subscription,
+	// which must then be complete, so always assume PUT.
 	errorDetails := ValidateRequest(validate, http.MethodPut, subscription)
+	for i := range errorDetails {
+		// ARM expects specific error codes for a bad subscription state.
+		if errorDetails[i].Target == "state" {
+			if subscription.State == "" {
+				errorDetails[i].Code = arm.CloudErrorCodeMissingSubscriptionState
+			} else {
+				errorDetails[i].Code = arm.CloudErrorCodeInvalidSubscriptionState
+			}
+		}
+	}
 	if errorDetails != nil {
 		cloudError.Details = append(cloudError.Details, errorDetails...)
 	}
@@ -231,3 +391,47 @@ func ValidateSubscription(subscription *arm.Subscription) *arm.CloudError {
 
 	return cloudError
 }
+
+// ValidateResourceReferences validates the Azure resources referenced by
+// a resource request payload. references maps the JSON path of each field
+// holding a resource ID to its value. Resource IDs are compared
+// case-insensitively.
+//
+// Only a reference to the resource itself is checked. Every reference
+// targets a resource outside this provider, none of which can reference
+// back, so no longer cycle is possible.
+func ValidateResourceReferences(resourceID *arm.ResourceID, references map[string]string) *arm.CloudError {
+	cloudError := arm.NewCloudError(
+		http.StatusBadRequest,
+		arm.CloudErrorCodeMultipleErrorsOccurred, "",
+		"Content validation failed on multiple fields")
+	cloudError.Details = make([]arm.CloudErrorBody, 0)
+
+	self := strings.ToLower(resourceID.String())
+
+	// Sort the JSON paths for stable error ordering.
+	for _, target := range slices.Sorted(maps.Keys(references)) {
+		reference := strings.ToLower(references[target])
+		if reference == "" {
+			continue
+		}
+
+		if reference == self {
+			cloudError.Details = append(cloudError.Details, arm.CloudErrorBody{
+				Code:    arm.CloudErrorCodeInvalidRequestContent,
+				Message: fmt.Sprintf("Invalid value '%s' for field '%s' (must not reference the resource itself)", references[target], target),
+				Target:  target,
+			})
+		}
+	}
+
+	switch len(cloudError.Details) {
+	case 0:
+		cloudError = nil
+	case 1:
+		// Promote a single validation error out of details.
+		cloudError.CloudErrorBody = &cloudError.Details[0]
+	}
+
+	return cloudError
+}
@@ -290,3 +290,56 @@ func (vv *validateVisibility) checkFlags(flags VisibilityFlags, namespace, field
 			})
 	}
 }
+
+// CopyReadOnly copies the values of read-only fields, as defined by
+// structTagMap, from src to dst. Both must be pointers to the same struct
+// type. Clients cannot set read-only fields, so this lets a replacement of
+// a resource keep the values the service manages.
+func CopyReadOnly(dst, src interface{}, structTagMap StructTagMap) {
+	dstVal := reflect.ValueOf(dst)
+	srcVal := reflect.ValueOf(src)
+
+	if dstVal.Type() != srcVal.Type() {
+		panic(fmt.Sprintf("value types differ (%s vs %s)", dstVal.Type(), srcVal.Type()))
+	}
+	if dstVal.Kind() != reflect.Pointer || dstVal.IsNil() || srcVal.IsNil() {
+		panic("values must be non-nil pointers")
+	}
+
+	copyReadOnly(dstVal.Elem(), srcVal.Elem(), structTagMap, "", VisibilityDefault)
+}
+
+func copyReadOnly(dst, src reflect.Value, structTagMap StructTagMap, mapKey string, implicitVisibility VisibilityFlags) {
+	flags, ok := GetVisibilityFlags(structTagMap[mapKey])
+	if !ok {
+		flags = implicitVisibility
+	}
+
+	if flags.ReadOnly() {
+		dst.Set(src)
+		return
+	}
+
+	// Only structs are descended into. Elements of slices and maps
+	// cannot be matched up between values, so are copied whole or
+	// not at all.
+	switch dst.Kind() {
+	case reflect.Pointer:
+		if src.IsNil() {
+			return
+		}
+		if dst.IsNil() {
+			dst.Set(reflect.New(dst.Type().Elem()))
+		}
+		copyReadOnly(dst.Elem(), src.Elem(), structTagMap, mapKey, flags)
+
+	case reflect.Struct:
+		for i := 0; i < dst.NumField(); i++ {
+			if !dst.Type().Field(i).IsExported() {
+				continue
+			}
+			mapKeyNext := join(mapKey, dst.Type().Field(i).Name)
+			copyReadOnly(dst.Field(i), src.Field(i), structTagMap, mapKeyNext, flags)
+		}
+	}
+}
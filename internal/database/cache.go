@@ -6,8 +6,17 @@ package database
 import (
 	"context"
 	"encoding/json"
+	"fmt"
+	"io"
 	"iter"
+	"maps"
+	"slices"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
 
 	"github.com/Azure/ARO-HCP/internal/api/arm"
 )
@@ -16,29 +25,57 @@ var _ DBClient = &Cache{}
 
 // Cache is a simple DBClient that allows us to perform simple tests without needing a real CosmosDB. For production,
 // use CosmosDBClient instead. Call NewCache() to initialize a Cache correctly.
+//
+// A Cache is safe for concurrent use. Update callbacks run with the Cache locked, so they must not call back into
+// the Cache. Documents returned by a Cache are the stored documents themselves, so callers must only modify them in
+// update callbacks.
 type Cache struct {
-	resource     map[string]*ResourceDocument
-	operation    map[string]*OperationDocument
-	subscription map[string]*SubscriptionDocument
+	// mu guards the document maps.
+	mu sync.RWMutex
+
+	resource           map[string]*ResourceDocument
+	operation          map[string]*OperationDocument
+	subscription       map[string]*SubscriptionDocument
+	diagnosticSettings map[string]*DiagnosticSettingsDocument
+
+	// etagCounter generates entity tags for subscription
+	// documents, mimicking Cosmos DB's "_etag" property.
+	etagCounter atomic.Uint64
+
+	// subscriptionWriteConflicts is how many subscription writes
+	// fail as if they had lost to a concurrent write.
+	subscriptionWriteConflicts atomic.Int64
 }
 
 type cacheIterator struct {
-	docs []any
-	err  error
+	items             [][]byte
+	continuationToken string
+	err               error
 }
 
-func (iter cacheIterator) Items(ctx context.Context) iter.Seq[[]byte] {
-	return func(yield func([]byte) bool) {
-		for _, doc := range iter.docs {
-			// Marshalling the document struct only to immediately unmarshal
-			// it back to a document struct is a little silly but this is to
-			// conform to the DBClientIterator interface.
-			item, err := json.Marshal(doc)
-			if err != nil {
-				iter.err = err
-				return
-			}
+// add appends a document to the iterator. Documents are marshalled as they
+// are added, while the Cache is locked, so that iterating over them later
+// does not race with updates to the same documents.
+func (iter *cacheIterator) add(doc any) {
+	if iter.err != nil {
+		return
+	}
+
+	// Marshalling the document struct only to immediately unmarshal
+	// it back to a document struct is a little silly but this is to
+	// conform to the DBClientIterator interface.
+	item, err := json.Marshal(doc)
+	if err != nil {
+		iter.err = err
+		return
+	}
 
+	iter.items = append(iter.items, item)
+}
+
+func (iter *cacheIterator) Items(ctx context.Context) iter.Seq[[]byte] {
+	return func(yield func([]byte) bool) {
+		for _, item := range iter.items {
 			if !yield(item) {
 				return
 			}
@@ -46,11 +83,11 @@ func (iter cacheIterator) Items(ctx context.Context) iter.Seq[[]byte] {
 	}
 }
 
-func (iter cacheIterator) GetContinuationToken() string {
-	return ""
+func (iter *cacheIterator) GetContinuationToken() string {
+	return iter.continuationToken
 }
 
-func (iter cacheIterator) GetError() error {
+func (iter *cacheIterator) GetError() error {
 	return iter.err
 }
 
@@ -58,9 +95,10 @@ func (iter cacheIterator) GetError() error {
 // NewCosmosDBConfig instead.
 func NewCache() DBClient {
 	return &Cache{
-		resource:     make(map[string]*ResourceDocument),
-		operation:    make(map[string]*OperationDocument),
-		subscription: make(map[string]*SubscriptionDocument),
+		resource:           make(map[string]*ResourceDocument),
+		operation:          make(map[string]*OperationDocument),
+		subscription:       make(map[string]*SubscriptionDocument),
+		diagnosticSettings: make(map[string]*DiagnosticSettingsDocument),
 	}
 }
 
@@ -73,6 +111,9 @@ func (c *Cache) GetLockClient() *LockClient {
 }
 
 func (c *Cache) GetResourceDoc(ctx context.Context, resourceID *arm.ResourceID) (*ResourceDocument, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
 	// Make sure lookup keys are lowercase.
 	key := strings.ToLower(resourceID.String())
 
@@ -84,25 +125,39 @@ func (c *Cache) GetResourceDoc(ctx context.Context, resourceID *arm.ResourceID)
 }
 
 func (c *Cache) CreateResourceDoc(ctx context.Context, doc *ResourceDocument) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
 	// Make sure lookup keys are lowercase.
 	key := strings.ToLower(doc.ResourceId.String())
 
+	doc.touch()
 	c.resource[key] = doc
 	return nil
 }
 
 func (c *Cache) UpdateResourceDoc(ctx context.Context, resourceID *arm.ResourceID, callback func(*ResourceDocument) bool) (bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
 	// Make sure lookup keys are lowercase.
 	key := strings.ToLower(resourceID.String())
 
 	if doc, ok := c.resource[key]; ok {
-		return callback(doc), nil
+		updated := callback(doc)
+		if updated {
+			doc.touch()
+		}
+		return updated, nil
 	}
 
 	return false, ErrNotFound
 }
 
 func (c *Cache) DeleteResourceDoc(ctx context.Context, resourceID *arm.ResourceID) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
 	// Make sure lookup keys are lowercase.
 	key := strings.ToLower(resourceID.String())
 
@@ -111,21 +166,79 @@ func (c *Cache) DeleteResourceDoc(ctx context.Context, resourceID *arm.ResourceI
 }
 
 func (c *Cache) ListResourceDocs(ctx context.Context, prefix *arm.ResourceID, maxItems int32, continuationToken *string) DBClientIterator {
+	return c.listResourceDocs(prefix, nil, maxItems, continuationToken)
+}
+
+func (c *Cache) ListChangedResourceDocs(ctx context.Context, prefix *arm.ResourceID, since time.Time, maxItems int32, continuationToken *string) DBClientIterator {
+	return c.listResourceDocs(prefix, &since, maxItems, continuationToken)
+}
+
+func (c *Cache) listResourceDocs(prefix *arm.ResourceID, since *time.Time, maxItems int32, continuationToken *string) DBClientIterator {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
 	var iterator cacheIterator
+	var keys []string
+	var lastKey string
 
 	// Make sure key prefix is lowercase.
 	prefixString := strings.ToLower(prefix.String() + "/")
 
+	if continuationToken != nil {
+		// An invalid continuation token starts from the beginning.
+		if key, err := DecodeContinuationToken(*continuationToken); err == nil {
+			lastKey = strings.ToLower(key)
+		}
+	}
+
 	for key, doc := range c.resource {
-		if strings.HasPrefix(key, prefixString) {
-			iterator.docs = append(iterator.docs, doc)
+		if strings.HasPrefix(key, prefixString) && key > lastKey {
+			if since != nil && !changedSince(doc, *since) {
+				continue
+			}
+			keys = append(keys, key)
+		}
+	}
+
+	// Sort keys so continuation tokens resume in a stable order.
+	slices.Sort(keys)
+
+	var last *ResourceDocument
+	for _, key := range keys {
+		if maxItems > 0 && len(iterator.items) == int(maxItems) {
+			iterator.continuationToken = EncodeContinuationToken(last.ResourceId.String())
+			break
+		}
+		last = c.resource[key]
+		iterator.add(last)
+	}
+
+	return &iterator
+}
+
+// changedSince returns true if the resource was last modified, or else
+// created, after the given time. Resources without any recorded system
+// data timestamps are assumed to have changed.
+func changedSince(doc *ResourceDocument, since time.Time) bool {
+	if doc.SystemData != nil {
+		if doc.SystemData.LastModifiedAt != nil {
+			return doc.SystemData.LastModifiedAt.After(since)
+		}
+		if doc.SystemData.CreatedAt != nil {
+			return doc.SystemData.CreatedAt.After(since)
 		}
 	}
+	return true
+}
 
-	return iterator
+func (c *Cache) DeleteResourceGroupResources(ctx context.Context, subscriptionID, resourceGroup string) (int, error) {
+	return deleteResourceGroupResources(ctx, c, subscriptionID, resourceGroup)
 }
 
 func (c *Cache) GetOperationDoc(ctx context.Context, operationID string) (*OperationDocument, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
 	// Make sure lookup keys are lowercase.
 	key := strings.ToLower(operationID)
 
@@ -137,25 +250,43 @@ func (c *Cache) GetOperationDoc(ctx context.Context, operationID string) (*Opera
 }
 
 func (c *Cache) CreateOperationDoc(ctx context.Context, doc *OperationDocument) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
 	// Make sure lookup keys are lowercase.
 	key := strings.ToLower(doc.ID)
 
+	doc.touch()
 	c.operation[key] = doc
 	return nil
 }
 
 func (c *Cache) UpdateOperationDoc(ctx context.Context, operationID string, callback func(*OperationDocument) bool) (bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
 	// Make sure lookup keys are lowercase.
 	key := strings.ToLower(operationID)
 
 	if doc, ok := c.operation[key]; ok {
-		return callback(doc), nil
+		updated := callback(doc)
+		if updated {
+			doc.touch()
+		}
+		return updated, nil
 	}
 
 	return false, ErrNotFound
 }
 
+func (c *Cache) ClaimOperation(ctx context.Context, operationID, workerID string, lease time.Duration) (bool, error) {
+	return c.UpdateOperationDoc(ctx, operationID, claimOperation(workerID, lease))
+}
+
 func (c *Cache) DeleteOperationDoc(ctx context.Context, operationID string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
 	// Make sure lookup keys are lowercase.
 	key := strings.ToLower(operationID)
 
@@ -164,14 +295,171 @@ func (c *Cache) DeleteOperationDoc(ctx context.Context, operationID string) erro
 }
 
 func (c *Cache) ListAllOperationDocs(ctx context.Context) DBClientIterator {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
 	var iterator cacheIterator
 	for _, doc := range c.operation {
-		iterator.docs = append(iterator.docs, doc)
+		iterator.add(doc)
+	}
+	return &iterator
+}
+
+func (c *Cache) ListOperationDocs(ctx context.Context, filter OperationFilter, maxItems int32, continuationToken *string) DBClientIterator {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	var iterator cacheIterator
+	var docs []*OperationDocument
+
+	// last stands in for the last operation seen.
+	var last *OperationDocument
+
+	if continuationToken != nil {
+		// An invalid continuation token starts from the beginning.
+		if key, err := DecodeContinuationToken(*continuationToken); err == nil {
+			if startTime, id, ok := parseOperationContinuationKey(key); ok {
+				last = &OperationDocument{BaseDocument: BaseDocument{ID: id}}
+				last.StartTime, _ = time.Parse(time.RFC3339Nano, startTime)
+			}
+		}
+	}
+
+	// Most recently started first, then by descending
+	// ID to break ties, as in CosmosDBClient.
+	compare := func(a, b *OperationDocument) int {
+		if n := b.StartTime.Compare(a.StartTime); n != 0 {
+			return n
+		}
+		return strings.Compare(b.ID, a.ID)
+	}
+
+	for _, doc := range c.operation {
+		if !filter.Matches(doc) {
+			continue
+		}
+		if last != nil && compare(doc, last) <= 0 {
+			continue
+		}
+		docs = append(docs, doc)
+	}
+
+	slices.SortFunc(docs, compare)
+
+	for i, doc := range docs {
+		if maxItems > 0 && i == int(maxItems) {
+			iterator.continuationToken = EncodeContinuationToken(
+				operationContinuationKey(docs[i-1].StartTime.Format(time.RFC3339Nano), docs[i-1].ID))
+			break
+		}
+		iterator.add(doc)
+	}
+
+	return &iterator
+}
+
+func (c *Cache) GetLatestOperationForResource(ctx context.Context, resourceID string) (*OperationDocument, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	var latest *OperationDocument
+
+	for _, doc := range c.operation {
+		if doc.ExternalID == nil || !strings.EqualFold(doc.ExternalID.String(), resourceID) {
+			continue
+		}
+		if latest == nil || doc.StartTime.After(latest.StartTime) {
+			latest = doc
+		}
+	}
+
+	if latest == nil {
+		return nil, ErrNotFound
+	}
+
+	return latest, nil
+}
+
+func (c *Cache) GetDiagnosticSettingsDoc(ctx context.Context, resourceID *arm.ResourceID) (*DiagnosticSettingsDocument, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	// Make sure lookup keys are lowercase.
+	key := strings.ToLower(resourceID.String())
+
+	if doc, ok := c.diagnosticSettings[key]; ok {
+		return doc, nil
+	}
+
+	return nil, ErrNotFound
+}
+
+func (c *Cache) CreateDiagnosticSettingsDoc(ctx context.Context, doc *DiagnosticSettingsDocument) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// Make sure lookup keys are lowercase.
+	key := strings.ToLower(doc.ResourceId.String())
+
+	doc.touch()
+	c.diagnosticSettings[key] = doc
+	return nil
+}
+
+func (c *Cache) UpdateDiagnosticSettingsDoc(ctx context.Context, resourceID *arm.ResourceID, callback func(*DiagnosticSettingsDocument) bool) (bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// Make sure lookup keys are lowercase.
+	key := strings.ToLower(resourceID.String())
+
+	if doc, ok := c.diagnosticSettings[key]; ok {
+		updated := callback(doc)
+		if updated {
+			doc.touch()
+		}
+		return updated, nil
+	}
+
+	return false, ErrNotFound
+}
+
+func (c *Cache) DeleteDiagnosticSettingsDoc(ctx context.Context, resourceID *arm.ResourceID) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// Make sure lookup keys are lowercase.
+	key := strings.ToLower(resourceID.String())
+
+	delete(c.diagnosticSettings, key)
+	return nil
+}
+
+// InjectSubscriptionWriteConflicts makes the next n subscription document
+// creates and updates fail with ErrConflict and ErrPreconditionFailed, as
+// they would in Cosmos DB after losing to a concurrent write. This lets
+// tests exercise retries of conflicting writes.
+func (c *Cache) InjectSubscriptionWriteConflicts(n int) {
+	c.subscriptionWriteConflicts.Store(int64(n))
+}
+
+// injectedSubscriptionWriteConflict consumes an injected conflict, if any.
+func (c *Cache) injectedSubscriptionWriteConflict() bool {
+	for {
+		n := c.subscriptionWriteConflicts.Load()
+		if n <= 0 {
+			return false
+		}
+		if c.subscriptionWriteConflicts.CompareAndSwap(n, n-1) {
+			return true
+		}
 	}
-	return iterator
 }
 
 func (c *Cache) GetSubscriptionDoc(ctx context.Context, subscriptionID string) (*SubscriptionDocument, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
 	// Make sure lookup keys are lowercase.
 	key := strings.ToLower(subscriptionID)
 
@@ -183,20 +471,183 @@ func (c *Cache) GetSubscriptionDoc(ctx context.Context, subscriptionID string) (
 }
 
 func (c *Cache) CreateSubscriptionDoc(ctx context.Context, doc *SubscriptionDocument) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
 	// Make sure lookup keys are lowercase.
 	key := strings.ToLower(doc.ID)
 
+	if c.injectedSubscriptionWriteConflict() {
+		return ErrConflict
+	}
+
+	doc.ETag = c.nextETag()
+	doc.touch()
 	c.subscription[key] = doc
 	return nil
 }
 
 func (c *Cache) UpdateSubscriptionDoc(ctx context.Context, subscriptionID string, callback func(*SubscriptionDocument) bool) (bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
 	// Make sure lookup keys are lowercase.
 	key := strings.ToLower(subscriptionID)
 
 	if doc, ok := c.subscription[key]; ok {
-		return callback(doc), nil
+		if c.injectedSubscriptionWriteConflict() {
+			return false, ErrPreconditionFailed
+		}
+		updated := callback(doc)
+		if updated {
+			doc.ETag = c.nextETag()
+			doc.touch()
+		}
+		return updated, nil
 	}
 
 	return false, ErrNotFound
 }
+
+func (c *Cache) SoftDeleteSubscriptionDoc(ctx context.Context, subscriptionID string) error {
+	_, err := c.UpdateSubscriptionDoc(ctx, subscriptionID, markSubscriptionDeleted)
+	return err
+}
+
+func (c *Cache) ReapDeletedSubscriptions(ctx context.Context, olderThan time.Duration) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	cutoff := time.Now().Add(-olderThan)
+
+	var reaped int
+	for key, doc := range c.subscription {
+		if doc.DeletedAt != nil && doc.DeletedAt.Before(cutoff) {
+			delete(c.subscription, key)
+			reaped++
+		}
+	}
+	return reaped, nil
+}
+
+func (c *Cache) ListSubscriptionDocs(ctx context.Context, continuationToken string, pageSize int) ([]*SubscriptionDocument, string, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	var lastKey string
+
+	if continuationToken != "" {
+		key, err := DecodeContinuationToken(continuationToken)
+		if err != nil {
+			return nil, "", fmt.Errorf("invalid continuation token: %w", err)
+		}
+		lastKey = strings.ToLower(key)
+	}
+
+	var docs []*SubscriptionDocument
+
+	// Sort keys so continuation tokens resume in a stable order.
+	for _, key := range slices.Sorted(maps.Keys(c.subscription)) {
+		if key <= lastKey {
+			continue
+		}
+		if pageSize > 0 && len(docs) == pageSize {
+			return docs, EncodeContinuationToken(docs[len(docs)-1].ID), nil
+		}
+		docs = append(docs, c.subscription[key])
+	}
+
+	return docs, "", nil
+}
+
+// nextETag returns an entity tag that differs from every entity tag
+// previously returned, so each document write changes the entity tag.
+func (c *Cache) nextETag() azcore.ETag {
+	return azcore.ETag(fmt.Sprintf("\"%08x\"", c.etagCounter.Add(1)))
+}
+
+// sortedCacheIterator returns an iterator over the documents in m,
+// ordered by key so that exports are reproducible.
+func sortedCacheIterator[T any](m map[string]*T) *cacheIterator {
+	var iterator cacheIterator
+	for _, key := range slices.Sorted(maps.Keys(m)) {
+		iterator.add(m[key])
+	}
+	return &iterator
+}
+
+func (c *Cache) ExportAll(ctx context.Context, w io.Writer) error {
+	encoder := json.NewEncoder(w)
+
+	c.mu.RLock()
+	containers := []struct {
+		name     string
+		iterator DBClientIterator
+	}{
+		{subscriptionsContainer, sortedCacheIterator(c.subscription)},
+		{resourcesContainer, sortedCacheIterator(c.resource)},
+		{operationsContainer, sortedCacheIterator(c.operation)},
+		{diagnosticSettingsContainer, sortedCacheIterator(c.diagnosticSettings)},
+	}
+	c.mu.RUnlock()
+
+	for _, container := range containers {
+		err := exportContainer(ctx, encoder, container.name, container.iterator)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ImportAll restores the ExportRecords read from r. Documents are stored
+// as they were exported, without touching them, so that like the Cosmos DB
+// upsert they keep their entity tag and last modified time.
+func (c *Cache) ImportAll(ctx context.Context, r io.Reader) error {
+	return importRecords(r, func(record ExportRecord) error {
+		switch record.Container {
+		case resourcesContainer:
+			doc, err := unmarshalExportRecord[ResourceDocument](record)
+			if err != nil {
+				return err
+			}
+			if doc.ResourceId == nil {
+				return fmt.Errorf("missing key in %s container item", record.Container)
+			}
+			c.mu.Lock()
+			c.resource[strings.ToLower(doc.ResourceId.String())] = doc
+			c.mu.Unlock()
+		case operationsContainer:
+			doc, err := unmarshalExportRecord[OperationDocument](record)
+			if err != nil {
+				return err
+			}
+			c.mu.Lock()
+			c.operation[strings.ToLower(doc.ID)] = doc
+			c.mu.Unlock()
+		case subscriptionsContainer:
+			doc, err := unmarshalExportRecord[SubscriptionDocument](record)
+			if err != nil {
+				return err
+			}
+			c.mu.Lock()
+			c.subscription[strings.ToLower(doc.ID)] = doc
+			c.mu.Unlock()
+		case diagnosticSettingsContainer:
+			doc, err := unmarshalExportRecord[DiagnosticSettingsDocument](record)
+			if err != nil {
+				return err
+			}
+			if doc.ResourceId == nil {
+				return fmt.Errorf("missing key in %s container item", record.Container)
+			}
+			c.mu.Lock()
+			c.diagnosticSettings[strings.ToLower(doc.ResourceId.String())] = doc
+			c.mu.Unlock()
+		default:
+			return fmt.Errorf("unknown container '%s' in export record", record.Container)
+		}
+		return nil
+	})
+}
@@ -0,0 +1,633 @@
+package database
+
+// Copyright (c) Microsoft Corporation.
+// Licensed under the Apache License 2.0.
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Azure/ARO-HCP/internal/api"
+	"github.com/Azure/ARO-HCP/internal/api/arm"
+	"github.com/Azure/ARO-HCP/internal/ocm"
+)
+
+const testSubscriptionPrefix = "/subscriptions/00000000-0000-0000-0000-000000000000/resourceGroups/myRG"
+
+// newTestCache returns a Cache populated with count cluster documents,
+// along with the resource group resource ID containing them.
+func newTestCache(t *testing.T, count int) (DBClient, *arm.ResourceID) {
+	t.Helper()
+
+	ctx := context.Background()
+	cache := NewCache()
+
+	for i := range count {
+		resourceID, err := arm.ParseResourceID(fmt.Sprintf(
+			"%s/providers/%s/%s/cluster%02d",
+			testSubscriptionPrefix, api.ProviderNamespace, api.ClusterResourceTypeName, i))
+		if err != nil {
+			t.Fatal(err)
+		}
+		doc := NewResourceDocument(resourceID)
+		doc.InternalID, err = ocm.NewInternalID(ocm.GenerateClusterHREF(resourceID.Name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = cache.CreateResourceDoc(ctx, doc)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	prefix, err := arm.ParseResourceID(testSubscriptionPrefix)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return cache, prefix
+}
+
+// listNames drains the iterator and returns the resource names it yielded.
+func listNames(t *testing.T, iterator DBClientIterator) []string {
+	t.Helper()
+
+	var names []string
+	for item := range iterator.Items(context.Background()) {
+		var doc ResourceDocument
+		err := json.Unmarshal(item, &doc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		names = append(names, doc.ResourceId.Name)
+	}
+	if err := iterator.GetError(); err != nil {
+		t.Fatal(err)
+	}
+	return names
+}
+
+func TestCacheListResourceDocsResumeAfterRestart(t *testing.T) {
+	ctx := context.Background()
+
+	cache, prefix := newTestCache(t, 5)
+
+	iterator := cache.ListResourceDocs(ctx, prefix, 3, nil)
+	firstPage := listNames(t, iterator)
+	token := iterator.GetContinuationToken()
+
+	if len(firstPage) != 3 {
+		t.Fatalf("expected 3 items on first page, got %v", firstPage)
+	}
+	if token == "" {
+		t.Fatal("expected a continuation token")
+	}
+
+	// Simulate a restart: the token is all that survives.
+	cache, prefix = newTestCache(t, 5)
+
+	iterator = cache.ListResourceDocs(ctx, prefix, 3, &token)
+	secondPage := listNames(t, iterator)
+
+	expected := []string{"cluster03", "cluster04"}
+	if fmt.Sprint(secondPage) != fmt.Sprint(expected) {
+		t.Errorf("expected second page %v, got %v", expected, secondPage)
+	}
+	if token = iterator.GetContinuationToken(); token != "" {
+		t.Errorf("expected no continuation token on last page, got %q", token)
+	}
+}
+
+func TestCacheListResourceDocsInvalidToken(t *testing.T) {
+	ctx := context.Background()
+
+	cache, prefix := newTestCache(t, 3)
+
+	token := "stale-session-token"
+	names := listNames(t, cache.ListResourceDocs(ctx, prefix, -1, &token))
+
+	expected := []string{"cluster00", "cluster01", "cluster02"}
+	if fmt.Sprint(names) != fmt.Sprint(expected) {
+		t.Errorf("expected list to restart from the beginning with %v, got %v", expected, names)
+	}
+}
+
+func TestCacheListChangedResourceDocs(t *testing.T) {
+	ctx := context.Background()
+
+	since := time.Date(2024, time.June, 1, 0, 0, 0, 0, time.UTC)
+	before := since.Add(-time.Hour)
+	after := since.Add(time.Hour)
+
+	cache, prefix := newTestCache(t, 6)
+
+	// Changes after the cutoff are spread out so that
+	// unchanged documents sit between them.
+	systemData := []*arm.SystemData{
+		{CreatedAt: &before},
+		{CreatedAt: &before, LastModifiedAt: &after},
+		{CreatedAt: &before, LastModifiedAt: &before},
+		{CreatedAt: &after},
+		{CreatedAt: &before},
+		nil,
+	}
+	for i, data := range systemData {
+		resourceID, err := arm.ParseResourceID(fmt.Sprintf(
+			"%s/providers/%s/%s/cluster%02d",
+			testSubscriptionPrefix, api.ProviderNamespace, api.ClusterResourceTypeName, i))
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = cache.UpdateResourceDoc(ctx, resourceID, func(doc *ResourceDocument) bool {
+			doc.SystemData = data
+			return true
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Every page is filled with changed documents, so paging
+	// through them takes no more requests than necessary.
+	var pages [][]string
+	var token *string
+	for {
+		iterator := cache.ListChangedResourceDocs(ctx, prefix, since, 2, token)
+		pages = append(pages, listNames(t, iterator))
+		if next := iterator.GetContinuationToken(); next != "" {
+			token = &next
+		} else {
+			break
+		}
+	}
+
+	expected := [][]string{{"cluster01", "cluster03"}, {"cluster05"}}
+	if fmt.Sprint(pages) != fmt.Sprint(expected) {
+		t.Errorf("expected pages %v, got %v", expected, pages)
+	}
+}
+
+func TestCacheGetLatestOperationForResource(t *testing.T) {
+	ctx := context.Background()
+	cache := NewCache()
+
+	clusterID, err := arm.ParseResourceID(fmt.Sprintf(
+		"%s/providers/%s/%s/cluster", testSubscriptionPrefix, api.ProviderNamespace, api.ClusterResourceTypeName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherClusterID, err := arm.ParseResourceID(fmt.Sprintf(
+		"%s/providers/%s/%s/other", testSubscriptionPrefix, api.ProviderNamespace, api.ClusterResourceTypeName))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Date(2024, time.June, 1, 0, 0, 0, 0, time.UTC)
+
+	// Seed operations out of order so insertion order cannot be relied upon.
+	var latestID string
+	for i, offset := range []int{2, 0, 3, 1} {
+		doc := NewOperationDocument(OperationRequestUpdate, clusterID, ocm.InternalID{})
+		doc.StartTime = start.Add(time.Duration(offset) * time.Hour)
+		if offset == 3 {
+			latestID = doc.ID
+		}
+		err = cache.CreateOperationDoc(ctx, doc)
+		if err != nil {
+			t.Fatalf("operation %d: %v", i, err)
+		}
+	}
+
+	// A newer operation for a different resource must be ignored.
+	otherDoc := NewOperationDocument(OperationRequestCreate, otherClusterID, ocm.InternalID{})
+	otherDoc.StartTime = start.Add(24 * time.Hour)
+	err = cache.CreateOperationDoc(ctx, otherDoc)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name        string
+		resourceID  string
+		expectedID  string
+		expectedErr error
+	}{
+		{
+			name:       "Latest operation is returned",
+			resourceID: clusterID.String(),
+			expectedID: latestID,
+		},
+		{
+			name:       "Resource ID is case-insensitive",
+			resourceID: strings.ToUpper(clusterID.String()),
+			expectedID: latestID,
+		},
+		{
+			name:        "Resource without operations",
+			resourceID:  testSubscriptionPrefix + "/providers/" + api.ProviderNamespace + "/" + api.ClusterResourceTypeName + "/missing",
+			expectedErr: ErrNotFound,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			doc, err := cache.GetLatestOperationForResource(ctx, test.resourceID)
+			if !errors.Is(err, test.expectedErr) {
+				t.Fatalf("expected error %v, got %v", test.expectedErr, err)
+			}
+			if test.expectedErr == nil && doc.ID != test.expectedID {
+				t.Errorf("expected operation %s, got %s", test.expectedID, doc.ID)
+			}
+		})
+	}
+}
+
+func TestCacheListOperationDocsSameStartTime(t *testing.T) {
+	ctx := context.Background()
+	cache := NewCache()
+
+	clusterID, err := arm.ParseResourceID(fmt.Sprintf(
+		"%s/providers/%s/%s/cluster", testSubscriptionPrefix, api.ProviderNamespace, api.ClusterResourceTypeName))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Operations that start at the same time must
+	// not be skipped or repeated across pages.
+	start := time.Date(2024, time.June, 1, 0, 0, 0, 0, time.UTC)
+	for i := range 5 {
+		doc := NewOperationDocument(OperationRequestUpdate, clusterID, ocm.InternalID{})
+		doc.ID = fmt.Sprintf("op-%d", i)
+		doc.StartTime = start
+		err = cache.CreateOperationDoc(ctx, doc)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var ids []string
+	var continuationToken *string
+	for {
+		iterator := cache.ListOperationDocs(ctx, OperationFilter{}, 2, continuationToken)
+		for item := range iterator.Items(ctx) {
+			var doc OperationDocument
+			if err := json.Unmarshal(item, &doc); err != nil {
+				t.Fatal(err)
+			}
+			ids = append(ids, doc.ID)
+		}
+		if err := iterator.GetError(); err != nil {
+			t.Fatal(err)
+		}
+		token := iterator.GetContinuationToken()
+		if token == "" {
+			break
+		}
+		continuationToken = &token
+	}
+
+	expected := []string{"op-4", "op-3", "op-2", "op-1", "op-0"}
+	if !slices.Equal(ids, expected) {
+		t.Errorf("expected operations %v, got %v", expected, ids)
+	}
+}
+
+func TestCacheDeleteResourceGroupResources(t *testing.T) {
+	// Span several pages to exercise the internal pagination.
+	const count = resourceGroupDeletionPageSize*2 + 5
+
+	ctx := context.Background()
+
+	cache, prefix := newTestCache(t, count)
+
+	// Node pools and diagnostic settings in the resource group go too.
+	nodePoolID, err := arm.ParseResourceID(fmt.Sprintf(
+		"%s/providers/%s/%s/cluster00/%s/nodepool",
+		testSubscriptionPrefix, api.ProviderNamespace, api.ClusterResourceTypeName, api.NodePoolResourceTypeName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = cache.CreateResourceDoc(ctx, NewResourceDocument(nodePoolID))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = cache.CreateDiagnosticSettingsDoc(ctx, NewDiagnosticSettingsDocument(nodePoolID))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Clusters in another resource group of the same subscription remain.
+	otherPrefix, err := arm.ParseResourceID(strings.Replace(testSubscriptionPrefix, "myRG", "otherRG", 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var otherIDs []*arm.ResourceID
+	for i := range 3 {
+		resourceID, err := arm.ParseResourceID(fmt.Sprintf(
+			"%s/providers/%s/%s/cluster%02d",
+			otherPrefix, api.ProviderNamespace, api.ClusterResourceTypeName, i))
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = cache.CreateResourceDoc(ctx, NewResourceDocument(resourceID))
+		if err != nil {
+			t.Fatal(err)
+		}
+		otherIDs = append(otherIDs, resourceID)
+	}
+
+	deleted, err := cache.DeleteResourceGroupResources(ctx, prefix.SubscriptionID, prefix.ResourceGroupName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if deleted != count+1 {
+		t.Errorf("expected %d documents deleted, got %d", count+1, deleted)
+	}
+
+	if names := listNames(t, cache.ListResourceDocs(ctx, prefix, -1, nil)); len(names) != 0 {
+		t.Errorf("expected no documents left in the resource group, got %v", names)
+	}
+	_, err = cache.GetDiagnosticSettingsDoc(ctx, nodePoolID)
+	if !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected diagnostic settings to be deleted, got %v", err)
+	}
+
+	for _, resourceID := range otherIDs {
+		_, err = cache.GetResourceDoc(ctx, resourceID)
+		if err != nil {
+			t.Errorf("expected %s to remain, got %v", resourceID, err)
+		}
+	}
+}
+
+func TestCacheReapDeletedSubscriptions(t *testing.T) {
+	const retention = time.Hour
+
+	ctx := context.Background()
+	cache := NewCache()
+
+	now := time.Now()
+	subscriptions := []struct {
+		id        string
+		deletedAt *time.Time
+		reaped    bool
+	}{
+		{id: "00000000-0000-0000-0000-000000000001", deletedAt: api.Ptr(now.Add(-2 * retention)), reaped: true},
+		{id: "00000000-0000-0000-0000-000000000002", deletedAt: api.Ptr(now.Add(-retention / 2))},
+		{id: "00000000-0000-0000-0000-000000000003"},
+	}
+
+	for _, subscription := range subscriptions {
+		doc := NewSubscriptionDocument(subscription.id, &arm.Subscription{State: arm.SubscriptionStateRegistered})
+		doc.DeletedAt = subscription.deletedAt
+		err := cache.CreateSubscriptionDoc(ctx, doc)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	reaped, err := cache.ReapDeletedSubscriptions(ctx, retention)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reaped != 1 {
+		t.Errorf("expected 1 subscription reaped, got %d", reaped)
+	}
+
+	for _, subscription := range subscriptions {
+		_, err := cache.GetSubscriptionDoc(ctx, subscription.id)
+		if subscription.reaped && !errors.Is(err, ErrNotFound) {
+			t.Errorf("expected subscription %s to be reaped, got %v", subscription.id, err)
+		} else if !subscription.reaped && err != nil {
+			t.Errorf("expected subscription %s to be retained, got %v", subscription.id, err)
+		}
+	}
+}
+
+func TestCacheListSubscriptionDocs(t *testing.T) {
+	const count = 7
+
+	ctx := context.Background()
+	cache := NewCache()
+
+	for i := range count {
+		subscriptionID := fmt.Sprintf("00000000-0000-0000-0000-%012d", i)
+		err := cache.CreateSubscriptionDoc(ctx, NewSubscriptionDocument(subscriptionID, &arm.Subscription{State: arm.SubscriptionStateRegistered}))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, pageSize := range []int{1, 3, count, count + 1} {
+		t.Run(fmt.Sprintf("page size %d", pageSize), func(t *testing.T) {
+			seen := make(map[string]int)
+			var continuationToken string
+			var pages int
+
+			for {
+				docs, token, err := cache.ListSubscriptionDocs(ctx, continuationToken, pageSize)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if len(docs) > pageSize {
+					t.Fatalf("expected at most %d documents in a page, got %d", pageSize, len(docs))
+				}
+				for _, doc := range docs {
+					seen[doc.ID]++
+				}
+				pages++
+				if token == "" {
+					break
+				}
+				if pages > count {
+					t.Fatal("continuation tokens did not terminate")
+				}
+				continuationToken = token
+			}
+
+			if len(seen) != count {
+				t.Errorf("expected %d subscriptions, got %d", count, len(seen))
+			}
+			for subscriptionID, n := range seen {
+				if n != 1 {
+					t.Errorf("expected subscription %s once, got it %d times", subscriptionID, n)
+				}
+			}
+		})
+	}
+
+	t.Run("invalid continuation token", func(t *testing.T) {
+		_, _, err := cache.ListSubscriptionDocs(ctx, "bogus", 1)
+		if err == nil {
+			t.Error("expected an error for an invalid continuation token")
+		}
+	})
+}
+
+// TestCacheConcurrentAccess exercises the Cache from many goroutines at
+// once. It relies on the race detector to catch unguarded map access.
+func TestCacheConcurrentAccess(t *testing.T) {
+	const (
+		workers    = 16
+		iterations = 100
+	)
+
+	ctx := context.Background()
+	cache, prefix := newTestCache(t, 4)
+
+	var wg sync.WaitGroup
+	for worker := range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			subscriptionID := fmt.Sprintf("00000000-0000-0000-0000-%012d", worker%4)
+			resourceID, err := arm.ParseResourceID(fmt.Sprintf(
+				"%s/providers/%s/%s/cluster%02d",
+				testSubscriptionPrefix, api.ProviderNamespace, api.ClusterResourceTypeName, worker%4))
+			if err != nil {
+				t.Error(err)
+				return
+			}
+
+			for i := range iterations {
+				switch i % 7 {
+				case 0:
+					err = cache.CreateSubscriptionDoc(ctx, NewSubscriptionDocument(subscriptionID, &arm.Subscription{State: arm.SubscriptionStateRegistered}))
+				case 1:
+					_, err = cache.GetSubscriptionDoc(ctx, subscriptionID)
+				case 2:
+					_, err = cache.UpdateSubscriptionDoc(ctx, subscriptionID, func(doc *SubscriptionDocument) bool {
+						doc.Subscription.State = arm.SubscriptionStateWarned
+						return true
+					})
+				case 3:
+					_, _, err = cache.ListSubscriptionDocs(ctx, "", 2)
+				case 4:
+					iterator := cache.ListResourceDocs(ctx, prefix, -1, nil)
+					for range iterator.Items(ctx) {
+					}
+					err = iterator.GetError()
+				case 5:
+					_, err = cache.UpdateResourceDoc(ctx, resourceID, func(doc *ResourceDocument) bool {
+						doc.ProvisioningState = arm.ProvisioningStateUpdating
+						return true
+					})
+				case 6:
+					_, err = cache.ReapDeletedSubscriptions(ctx, time.Hour)
+				}
+
+				// Reads and updates may precede the first create.
+				if err != nil && !errors.Is(err, ErrNotFound) {
+					t.Error(err)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestCacheSoftDeleteSubscriptionDoc(t *testing.T) {
+	const subscriptionID = "00000000-0000-0000-0000-000000000000"
+
+	ctx := context.Background()
+	cache := NewCache()
+
+	err := cache.SoftDeleteSubscriptionDoc(ctx, subscriptionID)
+	if !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound for a missing subscription, got %v", err)
+	}
+
+	err = cache.CreateSubscriptionDoc(ctx, NewSubscriptionDocument(subscriptionID, &arm.Subscription{State: arm.SubscriptionStateDeleted}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = cache.SoftDeleteSubscriptionDoc(ctx, subscriptionID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc, err := cache.GetSubscriptionDoc(ctx, subscriptionID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if doc.DeletedAt == nil {
+		t.Fatal("expected DeletedAt to be set")
+	}
+	deletedAt := *doc.DeletedAt
+
+	// Marking the subscription again keeps the original time.
+	err = cache.SoftDeleteSubscriptionDoc(ctx, subscriptionID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !doc.DeletedAt.Equal(deletedAt) {
+		t.Errorf("expected DeletedAt to stay %v, got %v", deletedAt, doc.DeletedAt)
+	}
+}
+
+func TestCacheClaimOperation(t *testing.T) {
+	const lease = time.Minute
+
+	ctx := context.Background()
+	cache := NewCache()
+
+	clusterID, err := arm.ParseResourceID(fmt.Sprintf(
+		"%s/providers/%s/%s/cluster", testSubscriptionPrefix, api.ProviderNamespace, api.ClusterResourceTypeName))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	doc := NewOperationDocument(OperationRequestCreate, clusterID, ocm.InternalID{})
+	err = cache.CreateOperationDoc(ctx, doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	claim := func(workerID string, expected bool) {
+		t.Helper()
+		claimed, err := cache.ClaimOperation(ctx, doc.ID, workerID, lease)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if claimed != expected {
+			t.Errorf("expected %s claimed: %t, got %t", workerID, expected, claimed)
+		}
+	}
+
+	claim("worker-1", true)
+	claim("worker-2", false)
+
+	// The lease holder may renew its lease.
+	claim("worker-1", true)
+	claim("worker-2", false)
+
+	// Simulate worker-1 crashing and its lease running out.
+	_, err = cache.UpdateOperationDoc(ctx, doc.ID, func(doc *OperationDocument) bool {
+		expired := time.Now().Add(-time.Second)
+		doc.LeaseExpiry = &expired
+		return true
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	claim("worker-2", true)
+	claim("worker-1", false)
+
+	if doc.LeaseHolder != "worker-2" {
+		t.Errorf("expected lease holder worker-2, got %q", doc.LeaseHolder)
+	}
+
+	_, err = cache.ClaimOperation(ctx, "missing", "worker-1", lease)
+	if !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound for a missing operation, got %v", err)
+	}
+}
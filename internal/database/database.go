@@ -8,9 +8,11 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"iter"
 	"net/http"
 	"strings"
+	"time"
 
 	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
 	"github.com/Azure/azure-sdk-for-go/sdk/data/azcosmos"
@@ -19,11 +21,13 @@ import (
 )
 
 const (
-	billingContainer       = "Billing"
-	locksContainer         = "Locks"
-	operationsContainer    = "Operations"
-	resourcesContainer     = "Resources"
-	subscriptionsContainer = "Subscriptions"
+	billingContainer            = "Billing"
+	diagnosticSettingsContainer = "DiagnosticSettings"
+	locksContainer              = "Locks"
+	operationsContainer         = "Operations"
+	resourcesContainer          = "Resources"
+	subscriptionIndexContainer  = "SubscriptionIndex"
+	subscriptionsContainer      = "Subscriptions"
 
 	// XXX The azcosmos SDK currently only supports single-partition queries,
 	//     so there's no way to list all items in a container unless you know
@@ -39,9 +43,38 @@ const (
 	//
 	//     [1] https://github.com/Azure/azure-sdk-for-go/issues/18578
 	operationsPartitionKey = "workaround"
+
+	// XXX For the same reason, the Subscriptions container, which is
+	//     partitioned by subscription ID, cannot be listed. So alongside
+	//     each subscription document we keep an entry in the single
+	//     "subscriptions" partition of the SubscriptionIndex container.
+	//     Subscriptions last written before the index existed are listed
+	//     once ARM next updates them.
+	subscriptionIndexPartitionKey = "subscriptions"
 )
 
-var ErrNotFound = errors.New("not found")
+// subscriptionIndexEntry is a SubscriptionIndex container item. Its ID
+// is the ID of the subscription document it indexes, and DeletedAt mirrors
+// the document's so deleted subscriptions can be found without reading
+// every document.
+type subscriptionIndexEntry struct {
+	BaseDocument
+
+	PartitionKey string     `json:"partitionKey"`
+	DeletedAt    *time.Time `json:"deletedAt,omitempty"`
+}
+
+var (
+	ErrNotFound = errors.New("not found")
+
+	// ErrConflict, ErrPreconditionFailed and ErrThrottled are for DBClient
+	// implementations without Cosmos DB response errors to signal the same
+	// conditions: a write conflicting with an existing item, a conditional
+	// write losing to a concurrent one, and a request rate limit.
+	ErrConflict           = errors.New("conflict")
+	ErrPreconditionFailed = errors.New("precondition failed")
+	ErrThrottled          = errors.New("throttled")
+)
 
 func isResponseError(err error, statusCode int) bool {
 	var responseError *azcore.ResponseError
@@ -72,29 +105,79 @@ type DBClient interface {
 	// of a Microsoft.RedHatOpenShift/HcpOpenShiftClusters resource or NodePools child resource.
 	DeleteResourceDoc(ctx context.Context, resourceID *arm.ResourceID) error
 	ListResourceDocs(ctx context.Context, prefix *arm.ResourceID, maxItems int32, continuationToken *string) DBClientIterator
+	// ListChangedResourceDocs behaves like ListResourceDocs but only matches resource documents
+	// whose system data records a change after the given time. Documents without system data
+	// timestamps always match, so incremental syncs never miss them.
+	ListChangedResourceDocs(ctx context.Context, prefix *arm.ResourceID, since time.Time, maxItems int32, continuationToken *string) DBClientIterator
+	// DeleteResourceGroupResources deletes every ResourceDocument in the given resource group,
+	// along with any associated DiagnosticSettingsDocument, and returns the number of resource
+	// documents deleted. Documents are listed a page at a time so a resource group of any size
+	// can be deleted in bounded memory.
+	DeleteResourceGroupResources(ctx context.Context, subscriptionID, resourceGroup string) (int, error)
 
 	GetOperationDoc(ctx context.Context, operationID string) (*OperationDocument, error)
 	CreateOperationDoc(ctx context.Context, doc *OperationDocument) error
 	UpdateOperationDoc(ctx context.Context, operationID string, callback func(*OperationDocument) bool) (bool, error)
 	DeleteOperationDoc(ctx context.Context, operationID string) error
+	// ClaimOperation grants a worker a lease on an OperationDocument so that no other
+	// worker processes the operation until the lease expires, and reports whether the
+	// lease was granted. A worker renews its lease by claiming the operation again.
+	// ErrNotFound is returned if the OperationDocument cannot be found.
+	ClaimOperation(ctx context.Context, operationID, workerID string, lease time.Duration) (bool, error)
 	ListAllOperationDocs(ctx context.Context) DBClientIterator
+	// ListOperationDocs searches for operation documents across all subscriptions that
+	// match the given filter, most recently started first. maxItems and continuationToken
+	// behave as they do for ListResourceDocs.
+	ListOperationDocs(ctx context.Context, filter OperationFilter, maxItems int32, continuationToken *string) DBClientIterator
+	// GetLatestOperationForResource retrieves the most recently started OperationDocument
+	// for the given resource ID. ErrNotFound is returned if the resource has no operations.
+	GetLatestOperationForResource(ctx context.Context, resourceID string) (*OperationDocument, error)
+
+	// GetDiagnosticSettingsDoc retrieves the DiagnosticSettingsDocument for the given resourceID.
+	// ErrNotFound is returned if the resource has no associated DiagnosticSettingsDocument.
+	GetDiagnosticSettingsDoc(ctx context.Context, resourceID *arm.ResourceID) (*DiagnosticSettingsDocument, error)
+	CreateDiagnosticSettingsDoc(ctx context.Context, doc *DiagnosticSettingsDocument) error
+	UpdateDiagnosticSettingsDoc(ctx context.Context, resourceID *arm.ResourceID, callback func(*DiagnosticSettingsDocument) bool) (bool, error)
+	DeleteDiagnosticSettingsDoc(ctx context.Context, resourceID *arm.ResourceID) error
 
 	// GetSubscriptionDoc retrieves a SubscriptionDocument from the database given the subscriptionID.
 	// ErrNotFound is returned if an associated SubscriptionDocument cannot be found.
 	GetSubscriptionDoc(ctx context.Context, subscriptionID string) (*SubscriptionDocument, error)
 	CreateSubscriptionDoc(ctx context.Context, doc *SubscriptionDocument) error
 	UpdateSubscriptionDoc(ctx context.Context, subscriptionID string, callback func(*SubscriptionDocument) bool) (bool, error)
+	// SoftDeleteSubscriptionDoc marks a SubscriptionDocument as deleted without removing it,
+	// so it remains readable until reaped. Marking a document again keeps the original time.
+	// ErrNotFound is returned if an associated SubscriptionDocument cannot be found.
+	SoftDeleteSubscriptionDoc(ctx context.Context, subscriptionID string) error
+	// ReapDeletedSubscriptions removes the SubscriptionDocuments that were marked as deleted
+	// longer ago than olderThan, and returns the number of documents removed.
+	ReapDeletedSubscriptions(ctx context.Context, olderThan time.Duration) (int, error)
+	// ListSubscriptionDocs returns up to pageSize SubscriptionDocuments, ordered by
+	// subscription ID, along with a continuation token for the next page. The token
+	// is empty once every document has been returned. An empty continuationToken
+	// starts from the first document.
+	ListSubscriptionDocs(ctx context.Context, continuationToken string, pageSize int) ([]*SubscriptionDocument, string, error)
+
+	// ExportAll writes every document in the database to w as newline-delimited
+	// ExportRecords, for backup or migration.
+	ExportAll(ctx context.Context, w io.Writer) error
+	// ImportAll restores the ExportRecords read from r, replacing any existing
+	// documents with the same identity. Importing the same export repeatedly
+	// yields the same result.
+	ImportAll(ctx context.Context, r io.Reader) error
 }
 
 var _ DBClient = &CosmosDBClient{}
 
 // CosmosDBClient defines the needed values to perform CRUD operations against the async DB
 type CosmosDBClient struct {
-	database      *azcosmos.DatabaseClient
-	resources     *azcosmos.ContainerClient
-	operations    *azcosmos.ContainerClient
-	subscriptions *azcosmos.ContainerClient
-	lockClient    *LockClient
+	database           *azcosmos.DatabaseClient
+	resources          *azcosmos.ContainerClient
+	operations         *azcosmos.ContainerClient
+	subscriptions      *azcosmos.ContainerClient
+	subscriptionIndex  *azcosmos.ContainerClient
+	diagnosticSettings *azcosmos.ContainerClient
+	lockClient         *LockClient
 }
 
 // NewCosmosDBClient instantiates a Cosmos DatabaseClient targeting Frontends async DB
@@ -104,6 +187,8 @@ func NewCosmosDBClient(ctx context.Context, database *azcosmos.DatabaseClient) (
 	resources, _ := database.NewContainer(resourcesContainer)
 	operations, _ := database.NewContainer(operationsContainer)
 	subscriptions, _ := database.NewContainer(subscriptionsContainer)
+	subscriptionIndex, _ := database.NewContainer(subscriptionIndexContainer)
+	diagnosticSettings, _ := database.NewContainer(diagnosticSettingsContainer)
 	locks, _ := database.NewContainer(locksContainer)
 
 	lockClient, err := NewLockClient(ctx, locks)
@@ -112,11 +197,13 @@ func NewCosmosDBClient(ctx context.Context, database *azcosmos.DatabaseClient) (
 	}
 
 	return &CosmosDBClient{
-		database:      database,
-		resources:     resources,
-		operations:    operations,
-		subscriptions: subscriptions,
-		lockClient:    lockClient,
+		database:           database,
+		resources:          resources,
+		operations:         operations,
+		subscriptions:      subscriptions,
+		subscriptionIndex:  subscriptionIndex,
+		diagnosticSettings: diagnosticSettings,
+		lockClient:         lockClient,
 	}, nil
 }
 
@@ -186,6 +273,8 @@ func (d *CosmosDBClient) CreateResourceDoc(ctx context.Context, doc *ResourceDoc
 	// Make sure partition key is lowercase.
 	doc.PartitionKey = strings.ToLower(doc.PartitionKey)
 
+	doc.touch()
+
 	data, err := json.Marshal(doc)
 	if err != nil {
 		return fmt.Errorf("failed to marshal Resources container item for '%s': %w", doc.ResourceId, err)
@@ -228,6 +317,8 @@ func (d *CosmosDBClient) UpdateResourceDoc(ctx context.Context, resourceID *arm.
 			return false, nil
 		}
 
+		doc.touch()
+
 		data, err = json.Marshal(doc)
 		if err != nil {
 			return false, fmt.Errorf("failed to marshal Resources container item for '%s': %w", resourceID, err)
@@ -272,8 +363,20 @@ func (d *CosmosDBClient) DeleteResourceDoc(ctx context.Context, resourceID *arm.
 // ListResourceDocs searches for resource documents that match the given resource ID prefix.
 // maxItems can limit the number of items returned at once. A negative value will cause the
 // returned iterator to yield all matching items. A positive value will cause the returned
-// iterator to include a continuation token if additional items are available.
+// iterator to include a continuation token if additional items are available. An invalid
+// continuation token is disregarded, causing the search to start from the beginning.
 func (d *CosmosDBClient) ListResourceDocs(ctx context.Context, prefix *arm.ResourceID, maxItems int32, continuationToken *string) DBClientIterator {
+	return d.listResourceDocs(ctx, prefix, nil, maxItems, continuationToken)
+}
+
+// ListChangedResourceDocs searches for resource documents that match the given resource ID
+// prefix and were changed after the given time. The time is filtered in the query, so pages
+// hold only matching documents.
+func (d *CosmosDBClient) ListChangedResourceDocs(ctx context.Context, prefix *arm.ResourceID, since time.Time, maxItems int32, continuationToken *string) DBClientIterator {
+	return d.listResourceDocs(ctx, prefix, &since, maxItems, continuationToken)
+}
+
+func (d *CosmosDBClient) listResourceDocs(ctx context.Context, prefix *arm.ResourceID, since *time.Time, maxItems int32, continuationToken *string) DBClientIterator {
 	// Make sure partition key is lowercase.
 	pk := azcosmos.NewPartitionKeyString(strings.ToLower(prefix.SubscriptionID))
 
@@ -285,8 +388,7 @@ func (d *CosmosDBClient) ListResourceDocs(ctx context.Context, prefix *arm.Resou
 
 	query := "SELECT * FROM c WHERE STARTSWITH(c.key, @prefix, true)"
 	opt := azcosmos.QueryOptions{
-		PageSizeHint:      maxItems,
-		ContinuationToken: continuationToken,
+		PageSizeHint: maxItems,
 		QueryParameters: []azcosmos.QueryParameter{
 			{
 				Name:  "@prefix",
@@ -295,6 +397,33 @@ func (d *CosmosDBClient) ListResourceDocs(ctx context.Context, prefix *arm.Resou
 		},
 	}
 
+	// System data timestamps may have any number of fractional digits,
+	// so compare them as timestamps rather than as strings.
+	if since != nil {
+		query += " AND (IS_DEFINED(c.systemData.lastModifiedAt)" +
+			" ? DateTimeToTimestamp(c.systemData.lastModifiedAt) > @since" +
+			" : (IS_DEFINED(c.systemData.createdAt) ? DateTimeToTimestamp(c.systemData.createdAt) > @since : true))"
+		opt.QueryParameters = append(opt.QueryParameters, azcosmos.QueryParameter{
+			Name:  "@since",
+			Value: since.UnixMilli(),
+		})
+	}
+
+	// Resume after the last key seen rather than passing a Cosmos DB
+	// continuation token, which may not survive a client restart.
+	if continuationToken != nil {
+		lastKey, err := DecodeContinuationToken(*continuationToken)
+		if err == nil {
+			query += " AND c.key > @lastKey"
+			opt.QueryParameters = append(opt.QueryParameters, azcosmos.QueryParameter{
+				Name:  "@lastKey",
+				Value: lastKey,
+			})
+		}
+	}
+
+	query += " ORDER BY c.key"
+
 	pager := d.resources.NewQueryItemsPager(query, pk, &opt)
 
 	if maxItems > 0 {
@@ -304,6 +433,12 @@ func (d *CosmosDBClient) ListResourceDocs(ctx context.Context, prefix *arm.Resou
 	}
 }
 
+// DeleteResourceGroupResources deletes the resource documents and diagnostic
+// settings documents in the given resource group.
+func (d *CosmosDBClient) DeleteResourceGroupResources(ctx context.Context, subscriptionID, resourceGroup string) (int, error) {
+	return deleteResourceGroupResources(ctx, d, subscriptionID, resourceGroup)
+}
+
 // GetOperationDoc retrieves the asynchronous operation document for the given
 // operation ID from the "operations" container
 func (d *CosmosDBClient) GetOperationDoc(ctx context.Context, operationID string) (*OperationDocument, error) {
@@ -334,6 +469,8 @@ func (d *CosmosDBClient) GetOperationDoc(ctx context.Context, operationID string
 func (d *CosmosDBClient) CreateOperationDoc(ctx context.Context, doc *OperationDocument) error {
 	pk := azcosmos.NewPartitionKeyString(operationsPartitionKey)
 
+	doc.touch()
+
 	data, err := json.Marshal(doc)
 	if err != nil {
 		return fmt.Errorf("failed to marshal Operations container item for '%s': %w", doc.ID, err)
@@ -375,6 +512,8 @@ func (d *CosmosDBClient) UpdateOperationDoc(ctx context.Context, operationID str
 			return false, nil
 		}
 
+		doc.touch()
+
 		data, err = json.Marshal(doc)
 		if err != nil {
 			return false, fmt.Errorf("failed to marshal Operations container item for '%s': %w", operationID, err)
@@ -396,6 +535,13 @@ func (d *CosmosDBClient) UpdateOperationDoc(ctx context.Context, operationID str
 	return false, err
 }
 
+// ClaimOperation grants a worker a lease on an operation document. The
+// entity tag precondition of UpdateOperationDoc ensures that only one of
+// several workers racing to claim the operation succeeds.
+func (d *CosmosDBClient) ClaimOperation(ctx context.Context, operationID, workerID string, lease time.Duration) (bool, error) {
+	return d.UpdateOperationDoc(ctx, operationID, claimOperation(workerID, lease))
+}
+
 // DeleteOperationDoc deletes the asynchronous operation document for the given
 // operation ID from the "operations" container
 func (d *CosmosDBClient) DeleteOperationDoc(ctx context.Context, operationID string) error {
@@ -417,6 +563,238 @@ func (d *CosmosDBClient) ListAllOperationDocs(ctx context.Context) DBClientItera
 	return NewQueryItemsIterator(d.operations.NewQueryItemsPager("SELECT * FROM c", pk, nil))
 }
 
+// ListOperationDocs searches the "operations" container for operation documents
+// matching the given filter. All operations share a partition, so this is not a
+// cross-partition query.
+func (d *CosmosDBClient) ListOperationDocs(ctx context.Context, filter OperationFilter, maxItems int32, continuationToken *string) DBClientIterator {
+	pk := azcosmos.NewPartitionKeyString(operationsPartitionKey)
+
+	// See the comment in ListResourceDocs.
+	maxItems = max(maxItems, -1)
+
+	query := "SELECT * FROM c WHERE IS_DEFINED(c.startTime)"
+	opt := azcosmos.QueryOptions{
+		PageSizeHint: maxItems,
+	}
+
+	addCondition := func(condition, name string, value any) {
+		query += " AND " + condition
+		opt.QueryParameters = append(opt.QueryParameters, azcosmos.QueryParameter{
+			Name:  name,
+			Value: value,
+		})
+	}
+
+	if filter.Status != "" {
+		addCondition("STRINGEQUALS(c.status, @status, true)", "@status", string(filter.Status))
+	}
+	if filter.Request != "" {
+		addCondition("STRINGEQUALS(c.request, @request, true)", "@request", string(filter.Request))
+	}
+	if !filter.StartedAfter.IsZero() {
+		addCondition("c.startTime >= @startedAfter", "@startedAfter", filter.StartedAfter.UTC())
+	}
+	if !filter.StartedBefore.IsZero() {
+		addCondition("c.startTime < @startedBefore", "@startedBefore", filter.StartedBefore.UTC())
+	}
+
+	// Resume after the last operation seen, in the sort order below.
+	if continuationToken != nil {
+		lastKey, err := DecodeContinuationToken(*continuationToken)
+		if err == nil {
+			if lastStartTime, lastID, ok := parseOperationContinuationKey(lastKey); ok {
+				addCondition("(c.startTime < @lastStartTime OR (c.startTime = @lastStartTime AND c.id < @lastID))",
+					"@lastStartTime", lastStartTime)
+				opt.QueryParameters = append(opt.QueryParameters, azcosmos.QueryParameter{
+					Name:  "@lastID",
+					Value: lastID,
+				})
+			}
+		}
+	}
+
+	// Sorting by more than one property requires
+	// a composite index on the Operations container.
+	query += " ORDER BY c.startTime DESC, c.id DESC"
+
+	pager := d.operations.NewQueryItemsPager(query, pk, &opt)
+
+	if maxItems > 0 {
+		return newSinglePageIterator(pager, func(item map[string]any) string {
+			startTime, _ := item["startTime"].(string)
+			id, _ := item["id"].(string)
+			return operationContinuationKey(startTime, id)
+		})
+	} else {
+		return NewQueryItemsIterator(pager)
+	}
+}
+
+// GetLatestOperationForResource queries the "operations" container for the
+// operation with the latest start time for the given resource ID
+func (d *CosmosDBClient) GetLatestOperationForResource(ctx context.Context, resourceID string) (*OperationDocument, error) {
+	pk := azcosmos.NewPartitionKeyString(operationsPartitionKey)
+
+	// Resource IDs are case-insensitive, but a case-insensitive
+	// STRINGEQUALS cannot be served from the index, so this scans
+	// every operation in the partition. Operations expire after
+	// their retention period, which keeps the scan bounded.
+	query := "SELECT TOP 1 * FROM c WHERE STRINGEQUALS(c.externalId, @resourceID, true) ORDER BY c.startTime DESC"
+	opt := azcosmos.QueryOptions{
+		QueryParameters: []azcosmos.QueryParameter{
+			{
+				Name:  "@resourceID",
+				Value: resourceID,
+			},
+		},
+	}
+
+	iterator := NewQueryItemsIterator(d.operations.NewQueryItemsPager(query, pk, &opt))
+
+	for item := range iterator.Items(ctx) {
+		var doc *OperationDocument
+		err := json.Unmarshal(item, &doc)
+		if err != nil {
+			return nil, fmt.Errorf("failed to unmarshal Operations container item for '%s': %w", resourceID, err)
+		}
+		return doc, nil
+	}
+
+	err := iterator.GetError()
+	if err != nil {
+		return nil, fmt.Errorf("failed to query Operations container for '%s': %w", resourceID, err)
+	}
+
+	return nil, ErrNotFound
+}
+
+// GetDiagnosticSettingsDoc retrieves a diagnostic settings document from the
+// "diagnosticSettings" DB using the resource ID the settings are associated with
+func (d *CosmosDBClient) GetDiagnosticSettingsDoc(ctx context.Context, resourceID *arm.ResourceID) (*DiagnosticSettingsDocument, error) {
+	// Make sure partition key is lowercase.
+	pk := azcosmos.NewPartitionKeyString(strings.ToLower(resourceID.SubscriptionID))
+
+	query := "SELECT * FROM c WHERE STRINGEQUALS(c.key, @key, true)"
+	opt := azcosmos.QueryOptions{
+		PageSizeHint:    1,
+		QueryParameters: []azcosmos.QueryParameter{{Name: "@key", Value: resourceID.String()}},
+	}
+
+	queryPager := d.diagnosticSettings.NewQueryItemsPager(query, pk, &opt)
+
+	var doc *DiagnosticSettingsDocument
+	for queryPager.More() {
+		queryResponse, err := queryPager.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to advance page while querying DiagnosticSettings container for '%s': %w", resourceID, err)
+		}
+
+		for _, item := range queryResponse.Items {
+			err = json.Unmarshal(item, &doc)
+			if err != nil {
+				return nil, fmt.Errorf("failed to unmarshal DiagnosticSettings container item for '%s': %w", resourceID, err)
+			}
+		}
+	}
+	if doc != nil {
+		return doc, nil
+	}
+	return nil, ErrNotFound
+}
+
+// CreateDiagnosticSettingsDoc creates a diagnostic settings document in the "diagnosticSettings" DB
+func (d *CosmosDBClient) CreateDiagnosticSettingsDoc(ctx context.Context, doc *DiagnosticSettingsDocument) error {
+	// Make sure partition key is lowercase.
+	doc.PartitionKey = strings.ToLower(doc.PartitionKey)
+
+	doc.touch()
+
+	data, err := json.Marshal(doc)
+	if err != nil {
+		return fmt.Errorf("failed to marshal DiagnosticSettings container item for '%s': %w", doc.ResourceId, err)
+	}
+
+	_, err = d.diagnosticSettings.CreateItem(ctx, azcosmos.NewPartitionKeyString(doc.PartitionKey), data, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create DiagnosticSettings container item for '%s': %w", doc.ResourceId, err)
+	}
+
+	return nil
+}
+
+// UpdateDiagnosticSettingsDoc updates a diagnostic settings document by first fetching the document
+// and passing it to the provided callback for modifications to be applied. It then attempts to replace
+// the existing document with the modified document and an "etag" precondition. Upon a precondition
+// failure the function repeats for a limited number of times before giving up.
+//
+// The callback function should return true if modifications were applied, signaling to proceed
+// with the document replacement. The boolean return value reflects this: returning true if the
+// document was sucessfully replaced, or false with or without an error to indicate no change.
+func (d *CosmosDBClient) UpdateDiagnosticSettingsDoc(ctx context.Context, resourceID *arm.ResourceID, callback func(*DiagnosticSettingsDocument) bool) (bool, error) {
+	var err error
+
+	// Make sure partition key is lowercase.
+	pk := azcosmos.NewPartitionKeyString(strings.ToLower(resourceID.SubscriptionID))
+
+	options := &azcosmos.ItemOptions{}
+
+	for try := 0; try < 5; try++ {
+		var doc *DiagnosticSettingsDocument
+		var data []byte
+
+		doc, err = d.GetDiagnosticSettingsDoc(ctx, resourceID)
+		if err != nil {
+			return false, err
+		}
+
+		if !callback(doc) {
+			return false, nil
+		}
+
+		doc.touch()
+
+		data, err = json.Marshal(doc)
+		if err != nil {
+			return false, fmt.Errorf("failed to marshal DiagnosticSettings container item for '%s': %w", resourceID, err)
+		}
+
+		options.IfMatchEtag = &doc.ETag
+		_, err = d.diagnosticSettings.ReplaceItem(ctx, pk, doc.ID, data, options)
+		if err == nil {
+			return true, nil
+		}
+
+		var responseError *azcore.ResponseError
+		err = fmt.Errorf("failed to replace DiagnosticSettings container item for '%s': %w", resourceID, err)
+		if !errors.As(err, &responseError) || responseError.StatusCode != http.StatusPreconditionFailed {
+			return false, err
+		}
+	}
+
+	return false, err
+}
+
+// DeleteDiagnosticSettingsDoc removes a diagnostic settings document from the
+// "diagnosticSettings" DB using the resource ID the settings are associated with
+func (d *CosmosDBClient) DeleteDiagnosticSettingsDoc(ctx context.Context, resourceID *arm.ResourceID) error {
+	// Make sure partition key is lowercase.
+	pk := azcosmos.NewPartitionKeyString(strings.ToLower(resourceID.SubscriptionID))
+
+	doc, err := d.GetDiagnosticSettingsDoc(ctx, resourceID)
+	if err != nil {
+		if errors.Is(err, ErrNotFound) {
+			return nil
+		}
+		return err
+	}
+
+	_, err = d.diagnosticSettings.DeleteItem(ctx, pk, doc.ID, nil)
+	if err != nil {
+		return fmt.Errorf("failed to delete DiagnosticSettings container item for '%s': %w", resourceID, err)
+	}
+	return nil
+}
+
 // GetSubscriptionDoc retreives a subscription document from async DB using the subscription ID
 func (d *CosmosDBClient) GetSubscriptionDoc(ctx context.Context, subscriptionID string) (*SubscriptionDocument, error) {
 	// Make sure lookup keys are lowercase.
@@ -448,6 +826,8 @@ func (d *CosmosDBClient) CreateSubscriptionDoc(ctx context.Context, doc *Subscri
 
 	pk := azcosmos.NewPartitionKeyString(doc.ID)
 
+	doc.touch()
+
 	data, err := json.Marshal(doc)
 	if err != nil {
 		return fmt.Errorf("failed to marshal Subscriptions container item for '%s': %w", doc.ID, err)
@@ -458,7 +838,7 @@ func (d *CosmosDBClient) CreateSubscriptionDoc(ctx context.Context, doc *Subscri
 		return fmt.Errorf("failed to create Subscriptions container item for '%s': %w", doc.ID, err)
 	}
 
-	return nil
+	return d.indexSubscription(ctx, doc)
 }
 
 // UpdateSubscriptionDoc updates a subscription document by first fetching the document and
@@ -490,6 +870,8 @@ func (d *CosmosDBClient) UpdateSubscriptionDoc(ctx context.Context, subscription
 			return false, nil
 		}
 
+		doc.touch()
+
 		data, err = json.Marshal(doc)
 		if err != nil {
 			return false, fmt.Errorf("failed to marshal Subscriptions container item for '%s': %w", subscriptionID, err)
@@ -498,7 +880,7 @@ func (d *CosmosDBClient) UpdateSubscriptionDoc(ctx context.Context, subscription
 		options.IfMatchEtag = &doc.ETag
 		_, err = d.subscriptions.ReplaceItem(ctx, pk, doc.ID, data, options)
 		if err == nil {
-			return true, nil
+			return true, d.indexSubscription(ctx, doc)
 		}
 
 		var responseError *azcore.ResponseError
@@ -510,3 +892,273 @@ func (d *CosmosDBClient) UpdateSubscriptionDoc(ctx context.Context, subscription
 
 	return false, err
 }
+
+// SoftDeleteSubscriptionDoc marks a subscription document as deleted.
+func (d *CosmosDBClient) SoftDeleteSubscriptionDoc(ctx context.Context, subscriptionID string) error {
+	_, err := d.UpdateSubscriptionDoc(ctx, subscriptionID, markSubscriptionDeleted)
+	return err
+}
+
+// indexSubscription adds or updates the SubscriptionIndex container
+// item for a subscription document that was just written.
+func (d *CosmosDBClient) indexSubscription(ctx context.Context, doc *SubscriptionDocument) error {
+	pk := azcosmos.NewPartitionKeyString(subscriptionIndexPartitionKey)
+
+	entry := subscriptionIndexEntry{
+		BaseDocument: BaseDocument{ID: strings.ToLower(doc.ID)},
+		PartitionKey: subscriptionIndexPartitionKey,
+		DeletedAt:    doc.DeletedAt,
+	}
+	entry.touch()
+
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("failed to marshal SubscriptionIndex container item for '%s': %w", entry.ID, err)
+	}
+
+	_, err = d.subscriptionIndex.UpsertItem(ctx, pk, data, nil)
+	if err != nil {
+		return fmt.Errorf("failed to upsert SubscriptionIndex container item for '%s': %w", entry.ID, err)
+	}
+
+	return nil
+}
+
+// queryIndexedSubscriptionIDs returns the IDs of the SubscriptionIndex
+// container items matching the given query.
+func (d *CosmosDBClient) queryIndexedSubscriptionIDs(ctx context.Context, query string, parameters ...azcosmos.QueryParameter) ([]string, error) {
+	pk := azcosmos.NewPartitionKeyString(subscriptionIndexPartitionKey)
+
+	opt := azcosmos.QueryOptions{
+		QueryParameters: parameters,
+	}
+
+	iterator := NewQueryItemsIterator(d.subscriptionIndex.NewQueryItemsPager(query, pk, &opt))
+
+	var subscriptionIDs []string
+	for item := range iterator.Items(ctx) {
+		var entry subscriptionIndexEntry
+		err := json.Unmarshal(item, &entry)
+		if err != nil {
+			return nil, fmt.Errorf("failed to unmarshal SubscriptionIndex container item: %w", err)
+		}
+		subscriptionIDs = append(subscriptionIDs, entry.ID)
+	}
+
+	err := iterator.GetError()
+	if err != nil {
+		return nil, fmt.Errorf("failed to query SubscriptionIndex container: %w", err)
+	}
+
+	return subscriptionIDs, nil
+}
+
+// ReapDeletedSubscriptions queries the SubscriptionIndex container for the
+// subscriptions marked as deleted before the cutoff, and removes both their
+// subscription documents and their index entries.
+func (d *CosmosDBClient) ReapDeletedSubscriptions(ctx context.Context, olderThan time.Duration) (int, error) {
+	pk := azcosmos.NewPartitionKeyString(subscriptionIndexPartitionKey)
+
+	// Collect the IDs first so that deletions do not
+	// disturb the paging of the query results.
+	subscriptionIDs, err := d.queryIndexedSubscriptionIDs(ctx,
+		"SELECT c.id FROM c WHERE IS_DEFINED(c.deletedAt) AND c.deletedAt < @cutoff",
+		azcosmos.QueryParameter{Name: "@cutoff", Value: time.Now().UTC().Add(-olderThan)})
+	if err != nil {
+		return 0, err
+	}
+
+	var reaped int
+	for _, subscriptionID := range subscriptionIDs {
+		_, err = d.subscriptions.DeleteItem(ctx, azcosmos.NewPartitionKeyString(subscriptionID), subscriptionID, nil)
+		if err == nil {
+			reaped++
+		} else if !isResponseError(err, http.StatusNotFound) {
+			return reaped, fmt.Errorf("failed to delete Subscriptions container item for '%s': %w", subscriptionID, err)
+		}
+
+		_, err = d.subscriptionIndex.DeleteItem(ctx, pk, subscriptionID, nil)
+		if err != nil && !isResponseError(err, http.StatusNotFound) {
+			return reaped, fmt.Errorf("failed to delete SubscriptionIndex container item for '%s': %w", subscriptionID, err)
+		}
+	}
+
+	return reaped, nil
+}
+
+// ListSubscriptionDocs pages through the SubscriptionIndex container and
+// reads the subscription document for each entry. An entry whose document
+// has since been removed is skipped.
+func (d *CosmosDBClient) ListSubscriptionDocs(ctx context.Context, continuationToken string, pageSize int) ([]*SubscriptionDocument, string, error) {
+	pk := azcosmos.NewPartitionKeyString(subscriptionIndexPartitionKey)
+
+	query := "SELECT c.id FROM c"
+	opt := azcosmos.QueryOptions{
+		PageSizeHint: -1,
+	}
+
+	if pageSize > 0 {
+		opt.PageSizeHint = int32(pageSize)
+	}
+
+	if continuationToken != "" {
+		lastKey, err := DecodeContinuationToken(continuationToken)
+		if err != nil {
+			return nil, "", fmt.Errorf("invalid continuation token: %w", err)
+		}
+		query += " WHERE c.id > @lastKey"
+		opt.QueryParameters = []azcosmos.QueryParameter{
+			{
+				Name:  "@lastKey",
+				Value: strings.ToLower(lastKey),
+			},
+		}
+	}
+
+	query += " ORDER BY c.id"
+
+	pager := d.subscriptionIndex.NewQueryItemsPager(query, pk, &opt)
+
+	var docs []*SubscriptionDocument
+	var lastKey string
+
+	for pager.More() {
+		response, err := pager.NextPage(ctx)
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to advance page while querying SubscriptionIndex container: %w", err)
+		}
+
+		for _, item := range response.Items {
+			var entry subscriptionIndexEntry
+			err = json.Unmarshal(item, &entry)
+			if err != nil {
+				return nil, "", fmt.Errorf("failed to unmarshal SubscriptionIndex container item: %w", err)
+			}
+			lastKey = entry.ID
+
+			doc, err := d.GetSubscriptionDoc(ctx, entry.ID)
+			if errors.Is(err, ErrNotFound) {
+				continue
+			} else if err != nil {
+				return nil, "", err
+			}
+			docs = append(docs, doc)
+		}
+
+		// Return a single page when the page size is limited.
+		if pageSize > 0 {
+			if pager.More() && lastKey != "" {
+				return docs, EncodeContinuationToken(lastKey), nil
+			}
+			break
+		}
+	}
+
+	return docs, "", nil
+}
+
+// ExportAll writes the documents of every container, in the same order as
+// the Cache does. Every container except Operations is partitioned by
+// subscription ID, so the subscriptions are taken from the SubscriptionIndex
+// container and each of their partitions is exported in turn.
+func (d *CosmosDBClient) ExportAll(ctx context.Context, w io.Writer) error {
+	encoder := json.NewEncoder(w)
+
+	subscriptionIDs, err := d.queryIndexedSubscriptionIDs(ctx, "SELECT c.id FROM c ORDER BY c.id")
+	if err != nil {
+		return err
+	}
+
+	for _, subscriptionID := range subscriptionIDs {
+		response, err := d.subscriptions.ReadItem(ctx, azcosmos.NewPartitionKeyString(subscriptionID), subscriptionID, nil)
+		if isResponseError(err, http.StatusNotFound) {
+			continue
+		} else if err != nil {
+			return fmt.Errorf("failed to read Subscriptions container item for '%s': %w", subscriptionID, err)
+		}
+
+		err = encoder.Encode(ExportRecord{Container: subscriptionsContainer, Document: response.Value})
+		if err != nil {
+			return fmt.Errorf("failed to export %s container item: %w", subscriptionsContainer, err)
+		}
+	}
+
+	exportPartition := func(name string, container *azcosmos.ContainerClient, partitionKey string) error {
+		pk := azcosmos.NewPartitionKeyString(partitionKey)
+		iterator := NewQueryItemsIterator(container.NewQueryItemsPager("SELECT * FROM c", pk, nil))
+		return exportContainer(ctx, encoder, name, iterator)
+	}
+
+	for _, subscriptionID := range subscriptionIDs {
+		err = exportPartition(resourcesContainer, d.resources, subscriptionID)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = exportPartition(operationsContainer, d.operations, operationsPartitionKey)
+	if err != nil {
+		return err
+	}
+
+	for _, subscriptionID := range subscriptionIDs {
+		err = exportPartition(diagnosticSettingsContainer, d.diagnosticSettings, subscriptionID)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ImportAll restores the ExportRecords read from r, upserting each document
+// into its container.
+func (d *CosmosDBClient) ImportAll(ctx context.Context, r io.Reader) error {
+	return importRecords(r, func(record ExportRecord) error {
+		var container *azcosmos.ContainerClient
+		var partitionKey string
+
+		switch record.Container {
+		case resourcesContainer:
+			doc, err := unmarshalExportRecord[ResourceDocument](record)
+			if err != nil {
+				return err
+			}
+			container = d.resources
+			partitionKey = doc.PartitionKey
+		case operationsContainer:
+			container = d.operations
+			partitionKey = operationsPartitionKey
+		case subscriptionsContainer:
+			doc, err := unmarshalExportRecord[SubscriptionDocument](record)
+			if err != nil {
+				return err
+			}
+			err = d.indexSubscription(ctx, doc)
+			if err != nil {
+				return err
+			}
+			container = d.subscriptions
+			partitionKey = doc.ID
+		case diagnosticSettingsContainer:
+			doc, err := unmarshalExportRecord[DiagnosticSettingsDocument](record)
+			if err != nil {
+				return err
+			}
+			container = d.diagnosticSettings
+			partitionKey = doc.PartitionKey
+		default:
+			return fmt.Errorf("unknown container '%s' in export record", record.Container)
+		}
+
+		// Make sure partition key is lowercase.
+		pk := azcosmos.NewPartitionKeyString(strings.ToLower(partitionKey))
+
+		_, err := container.UpsertItem(ctx, pk, record.Document, nil)
+		if err != nil {
+			return fmt.Errorf("failed to upsert %s container item: %w", record.Container, err)
+		}
+
+		return nil
+	})
+}
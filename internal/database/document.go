@@ -4,6 +4,12 @@ package database
 // Licensed under the Apache License 2.0.
 
 import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math"
 	"strings"
 	"time"
 
@@ -24,6 +30,11 @@ type BaseDocument struct {
 	ETag        azcore.ETag `json:"_etag,omitempty"`
 	Attachments string      `json:"_attachments,omitempty"`
 	Timestamp   int         `json:"_ts,omitempty"`
+
+	// LastModified is when the document was last written. Unlike the
+	// Cosmos timestamp it is set by the DBClient, so it is available
+	// from any DBClient implementation.
+	LastModified time.Time `json:"lastModified"`
 }
 
 // newBaseDocument returns a BaseDocument with a unique ID.
@@ -31,6 +42,11 @@ func newBaseDocument() BaseDocument {
 	return BaseDocument{ID: uuid.New().String()}
 }
 
+// touch records that the document is about to be written.
+func (d *BaseDocument) touch() {
+	d.LastModified = time.Now().UTC()
+}
+
 // ResourceDocument captures the mapping of an Azure resource ID
 // to an internal resource ID (the OCM API path), as well as any
 // ARM-specific metadata for the resource.
@@ -45,6 +61,36 @@ type ResourceDocument struct {
 	ProvisioningState arm.ProvisioningState `json:"provisioningState,omitempty"`
 	SystemData        *arm.SystemData       `json:"systemData,omitempty"`
 	Tags              map[string]string     `json:"tags,omitempty"`
+
+	// Identity is the managed service identity configuration from ARM.
+	Identity *arm.Identity `json:"identity,omitempty"`
+
+	// Annotations hold internal metadata about the resource. Unlike
+	// tags they are never included in responses to ARM.
+	Annotations map[string]string `json:"annotations,omitempty"`
+
+	// CompletionWebhook, if set, is called by the backend whenever an
+	// operation on the resource reaches a terminal state.
+	CompletionWebhook *CompletionWebhook `json:"completionWebhook,omitempty"`
+}
+
+// CompletionWebhook is an endpoint to notify when an operation on a
+// resource reaches a terminal state. If KeyID is set, requests to the
+// endpoint are signed so the receiver can verify their origin. The secret
+// they are signed with is derived from KeyID by CompletionWebhookSecret
+// and is never stored.
+type CompletionWebhook struct {
+	URL   string `json:"url"`
+	KeyID string `json:"keyId,omitempty"`
+}
+
+// CompletionWebhookSecret derives the secret that signs the requests to a
+// completion webhook from the service's signing key, which is kept outside
+// the database, and the key ID stored with the webhook.
+func CompletionWebhookSecret(signingKey []byte, keyID string) string {
+	mac := hmac.New(sha256.New, signingKey)
+	mac.Write([]byte(keyID))
+	return hex.EncodeToString(mac.Sum(nil))
 }
 
 func NewResourceDocument(resourceID *arm.ResourceID) *ResourceDocument {
@@ -84,6 +130,9 @@ type OperationDocument struct {
 	// NotificationURI is provided by the Azure-AsyncNotificationUri header if the
 	// Async Operation Callbacks ARM feature is enabled
 	NotificationURI string `json:"notificationUri,omitempty"`
+	// APIVersion is the api-version of the request that initiated the operation,
+	// which determines the schema of the operation result
+	APIVersion string `json:"apiVersion,omitempty"`
 
 	// StartTime marks the start of the operation
 	StartTime time.Time `json:"startTime,omitempty"`
@@ -94,6 +143,100 @@ type OperationDocument struct {
 	Status arm.ProvisioningState `json:"status,omitempty"`
 	// Error is an OData error, present when Status is "Failed" or "Canceled"
 	Error *arm.CloudErrorBody `json:"error,omitempty"`
+	// History records each status the operation has held, oldest first
+	History []OperationEvent `json:"history,omitempty"`
+	// EstimatedCompletionTime is when the operation is expected to finish,
+	// based on the typical duration of its type, cleared once it finishes
+	EstimatedCompletionTime *time.Time `json:"estimatedCompletionTime,omitempty"`
+	// FailedAttempts counts the transient failures encountered while
+	// tracking the operation, which are retried up to a limit
+	FailedAttempts int `json:"failedAttempts,omitempty"`
+	// LeaseHolder is the ID of the worker processing the operation,
+	// which holds a lease on it until LeaseExpiry
+	LeaseHolder string     `json:"leaseHolder,omitempty"`
+	LeaseExpiry *time.Time `json:"leaseExpiry,omitempty"`
+	// TTL is the Cosmos DB time-to-live of the document in seconds, set by
+	// SetRetention once the operation reaches a terminal state. Zero leaves
+	// the default time-to-live of the Operations container in effect.
+	TTL int32 `json:"ttl,omitempty"`
+}
+
+// claimOperation returns an UpdateOperationDoc callback that grants the
+// worker a lease on the operation, unless another worker holds a lease
+// that has yet to expire. A worker may renew its own lease.
+func claimOperation(workerID string, lease time.Duration) func(*OperationDocument) bool {
+	return func(doc *OperationDocument) bool {
+		now := time.Now().UTC()
+		if doc.LeaseHolder != "" && doc.LeaseHolder != workerID &&
+			doc.LeaseExpiry != nil && now.Before(*doc.LeaseExpiry) {
+			return false
+		}
+		expiry := now.Add(lease)
+		doc.LeaseHolder = workerID
+		doc.LeaseExpiry = &expiry
+		return true
+	}
+}
+
+// OperationRetention is how long an operation remains available after
+// reaching a terminal state.
+const OperationRetention = 7 * 24 * time.Hour
+
+// OperationTombstoneRetention is how long an expired operation document is
+// kept past OperationRetention so that requests for it can be told it has
+// expired rather than never existed. Their sum matches the default
+// time-to-live of the Operations container, which Cosmos DB measures from
+// the last update.
+const OperationTombstoneRetention = 7 * 24 * time.Hour
+
+// OperationRetentionPolicy gives how long operations remain available after
+// reaching each terminal status, such as to keep failed operations around
+// longer for debugging. Statuses missing from the policy use
+// OperationRetention.
+type OperationRetentionPolicy map[arm.ProvisioningState]time.Duration
+
+// Retention returns how long an operation remains available after
+// reaching the given terminal status.
+func (policy OperationRetentionPolicy) Retention(status arm.ProvisioningState) time.Duration {
+	if retention, ok := policy[status]; ok {
+		return retention
+	}
+	return OperationRetention
+}
+
+// Validate returns an error if the policy has a non-terminal status or
+// a retention that is not positive.
+func (policy OperationRetentionPolicy) Validate() error {
+	var errs []error
+	for status, retention := range policy {
+		if !status.IsTerminal() {
+			errs = append(errs, fmt.Errorf("operation retention given for non-terminal status '%s'", status))
+		}
+		if retention <= 0 {
+			errs = append(errs, fmt.Errorf("operation retention for status '%s' must be positive", status))
+		} else if retention+OperationTombstoneRetention > math.MaxInt32*time.Second {
+			errs = append(errs, fmt.Errorf("operation retention for status '%s' is too long", status))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// typicalOperationDurations are rough durations of each type of operation,
+// from which an in-progress operation estimates its completion time.
+var typicalOperationDurations = map[OperationRequest]time.Duration{
+	OperationRequestCreate: 15 * time.Minute,
+	OperationRequestUpdate: 10 * time.Minute,
+	OperationRequestDelete: 10 * time.Minute,
+}
+
+// OperationEvent records an operation entering a status.
+type OperationEvent struct {
+	// Time marks when the operation entered the status
+	Time time.Time `json:"time"`
+	// Status is the status the operation entered
+	Status arm.ProvisioningState `json:"status"`
+	// Error is the OData error recorded with the status, if any
+	Error *arm.CloudErrorBody `json:"error,omitempty"`
 }
 
 func NewOperationDocument(request OperationRequest, externalID *arm.ResourceID, internalID ocm.InternalID) *OperationDocument {
@@ -116,9 +259,76 @@ func NewOperationDocument(request OperationRequest, externalID *arm.ResourceID,
 		doc.Status = arm.ProvisioningStateDeleting
 	}
 
+	doc.History = []OperationEvent{{Time: now, Status: doc.Status}}
+
+	if duration, ok := typicalOperationDurations[request]; ok {
+		estimate := now.Add(duration)
+		doc.EstimatedCompletionTime = &estimate
+	}
+
 	return doc
 }
 
+// Expired returns true if the operation has been in a terminal state for
+// longer than its retention as of now, which is OperationRetention unless
+// set otherwise by SetRetention. Cosmos DB keeps such documents as
+// tombstones for OperationTombstoneRetention before removing them, and
+// other DBClient implementations may not remove them at all.
+func (doc *OperationDocument) Expired(now time.Time) bool {
+	return doc.Status.IsTerminal() && now.Sub(doc.LastTransitionTime) > doc.retention()
+}
+
+// retention returns how long the operation remains available after
+// reaching a terminal state, as recorded by SetRetention.
+func (doc *OperationDocument) retention() time.Duration {
+	if doc.TTL > 0 {
+		return time.Duration(doc.TTL)*time.Second - OperationTombstoneRetention
+	}
+	return OperationRetention
+}
+
+// SetRetention sets the TTL of a document in a terminal state so that it
+// is kept for as long as the policy retains operations in that state,
+// followed by OperationTombstoneRetention. Since Cosmos DB measures the
+// time-to-live from the last update, this is intended to be called along
+// with UpdateStatus, in the same DBClient.UpdateOperationDoc callback.
+func (doc *OperationDocument) SetRetention(policy OperationRetentionPolicy) {
+	if doc.Status.IsTerminal() {
+		ttl := policy.Retention(doc.Status) + OperationTombstoneRetention
+		doc.TTL = int32(ttl / time.Second)
+	}
+}
+
+// OperationFilter selects operation documents in DBClient.ListOperationDocs.
+// Zero-valued fields match every operation.
+type OperationFilter struct {
+	// Status matches operations currently in the given status
+	Status arm.ProvisioningState
+	// Request matches operations of the given type
+	Request OperationRequest
+	// StartedAfter matches operations started at or after the given time
+	StartedAfter time.Time
+	// StartedBefore matches operations started before the given time
+	StartedBefore time.Time
+}
+
+// Matches returns true if the operation document satisfies the filter.
+func (filter OperationFilter) Matches(doc *OperationDocument) bool {
+	if filter.Status != "" && !strings.EqualFold(string(doc.Status), string(filter.Status)) {
+		return false
+	}
+	if filter.Request != "" && !strings.EqualFold(string(doc.Request), string(filter.Request)) {
+		return false
+	}
+	if !filter.StartedAfter.IsZero() && doc.StartTime.Before(filter.StartedAfter) {
+		return false
+	}
+	if !filter.StartedBefore.IsZero() && !doc.StartTime.Before(filter.StartedBefore) {
+		return false
+	}
+	return true
+}
+
 // ToStatus converts an OperationDocument to the ARM operation status format.
 func (doc *OperationDocument) ToStatus() *arm.Operation {
 	operation := &arm.Operation{
@@ -131,6 +341,8 @@ func (doc *OperationDocument) ToStatus() *arm.Operation {
 
 	if doc.Status.IsTerminal() {
 		operation.EndTime = &doc.LastTransitionTime
+	} else {
+		operation.EstimatedCompletionTime = doc.EstimatedCompletionTime
 	}
 
 	return operation
@@ -138,13 +350,23 @@ func (doc *OperationDocument) ToStatus() *arm.Operation {
 
 // UpdateStatus conditionally updates the document if the status given differs
 // from the status already present. If so, it sets the Status and Error fields
-// to the values given, updates the LastTransitionTime, and returns true. This
-// is intended to be used with DBClient.UpdateOperationDoc.
+// to the values given, updates the LastTransitionTime, appends the transition
+// to the History, clears the EstimatedCompletionTime if the new status is
+// terminal, and returns true. This is intended to be used with
+// DBClient.UpdateOperationDoc.
 func (doc *OperationDocument) UpdateStatus(status arm.ProvisioningState, err *arm.CloudErrorBody) bool {
 	if doc.Status != status {
-		doc.LastTransitionTime = time.Now()
+		doc.LastTransitionTime = time.Now().UTC()
 		doc.Status = status
 		doc.Error = err
+		doc.History = append(doc.History, OperationEvent{
+			Time:   doc.LastTransitionTime,
+			Status: status,
+			Error:  err,
+		})
+		if status.IsTerminal() {
+			doc.EstimatedCompletionTime = nil
+		}
 		return true
 	}
 	return false
@@ -155,6 +377,22 @@ type SubscriptionDocument struct {
 	BaseDocument
 
 	Subscription *arm.Subscription `json:"subscription,omitempty"`
+
+	// Overrides are subscription-specific adjustments to the service
+	// defaults. They are not part of the ARM subscription lifecycle and
+	// are preserved when ARM updates the subscription.
+	Overrides *SubscriptionOverrides `json:"overrides,omitempty"`
+
+	// DeletedAt is when the subscription entered the Deleted state. The
+	// document is retained for auditing until it is reaped some time later.
+	DeletedAt *time.Time `json:"deletedAt,omitempty"`
+}
+
+// SubscriptionOverrides holds subscription-specific settings which, when
+// set, take precedence over the service defaults.
+type SubscriptionOverrides struct {
+	MaxNodePools *int `json:"maxNodePools,omitempty"`
+	MaxClusters  *int `json:"maxClusters,omitempty"`
 }
 
 func NewSubscriptionDocument(subscriptionID string, subscription *arm.Subscription) *SubscriptionDocument {
@@ -165,3 +403,34 @@ func NewSubscriptionDocument(subscriptionID string, subscription *arm.Subscripti
 		Subscription: subscription,
 	}
 }
+
+// markSubscriptionDeleted is an UpdateSubscriptionDoc callback that
+// records when a subscription was deleted, unless already recorded.
+func markSubscriptionDeleted(doc *SubscriptionDocument) bool {
+	if doc.DeletedAt != nil {
+		return false
+	}
+	now := time.Now().UTC()
+	doc.DeletedAt = &now
+	return true
+}
+
+// DiagnosticSettingsDocument holds the Microsoft.Insights/diagnosticSettings
+// extension resources associated with a resource, keyed by the resource ID.
+type DiagnosticSettingsDocument struct {
+	BaseDocument
+
+	ResourceId   *arm.ResourceID `json:"key,omitempty"`
+	PartitionKey string          `json:"partitionKey,omitempty"`
+	// Settings maps lowercase diagnostic setting names to diagnostic settings
+	Settings map[string]*arm.DiagnosticSetting `json:"settings,omitempty"`
+}
+
+func NewDiagnosticSettingsDocument(resourceID *arm.ResourceID) *DiagnosticSettingsDocument {
+	return &DiagnosticSettingsDocument{
+		BaseDocument: newBaseDocument(),
+		ResourceId:   resourceID,
+		PartitionKey: strings.ToLower(resourceID.SubscriptionID),
+		Settings:     make(map[string]*arm.DiagnosticSetting),
+	}
+}
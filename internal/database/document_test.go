@@ -0,0 +1,262 @@
+package database
+
+// Copyright (c) Microsoft Corporation.
+// Licensed under the Apache License 2.0.
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/Azure/ARO-HCP/internal/api/arm"
+	"github.com/Azure/ARO-HCP/internal/ocm"
+)
+
+func TestOperationDocumentHistory(t *testing.T) {
+	failure := &arm.CloudErrorBody{Code: arm.CloudErrorCodeInternalServerError}
+
+	tests := []struct {
+		name             string
+		request          OperationRequest
+		transitions      []arm.ProvisioningState
+		expectedStatuses []arm.ProvisioningState
+	}{
+		{
+			name:    "Create succeeds",
+			request: OperationRequestCreate,
+			transitions: []arm.ProvisioningState{
+				arm.ProvisioningStateProvisioning,
+				arm.ProvisioningStateProvisioning,
+				arm.ProvisioningStateSucceeded,
+			},
+			expectedStatuses: []arm.ProvisioningState{
+				arm.ProvisioningStateAccepted,
+				arm.ProvisioningStateProvisioning,
+				arm.ProvisioningStateSucceeded,
+			},
+		},
+		{
+			name:    "Delete fails",
+			request: OperationRequestDelete,
+			transitions: []arm.ProvisioningState{
+				arm.ProvisioningStateFailed,
+			},
+			expectedStatuses: []arm.ProvisioningState{
+				arm.ProvisioningStateDeleting,
+				arm.ProvisioningStateFailed,
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			doc := NewOperationDocument(test.request, nil, ocm.InternalID{})
+
+			for _, status := range test.transitions {
+				var err *arm.CloudErrorBody
+				if status == arm.ProvisioningStateFailed {
+					err = failure
+				}
+				doc.UpdateStatus(status, err)
+			}
+
+			var statuses []arm.ProvisioningState
+			for i, event := range doc.History {
+				statuses = append(statuses, event.Status)
+				if i > 0 && event.Time.Before(doc.History[i-1].Time) {
+					t.Errorf("event %d is earlier than the event before it", i)
+				}
+				if (event.Error != nil) != (event.Status == arm.ProvisioningStateFailed) {
+					t.Errorf("unexpected error %v for event %d with status %s", event.Error, i, event.Status)
+				}
+			}
+
+			if !slices.Equal(statuses, test.expectedStatuses) {
+				t.Errorf("expected history %v, got %v", test.expectedStatuses, statuses)
+			}
+
+			if last := doc.History[len(doc.History)-1]; !last.Time.Equal(doc.LastTransitionTime) {
+				t.Errorf("expected the last event time %s to match the last transition time %s", last.Time, doc.LastTransitionTime)
+			}
+		})
+	}
+}
+
+func TestOperationDocumentEstimatedCompletionTime(t *testing.T) {
+	operationID, err := arm.ParseResourceID("/subscriptions/00000000-0000-0000-0000-000000000000/providers/Microsoft.RedHatOpenShift/locations/eastus/hcpOperationsStatus/operation")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name             string
+		request          OperationRequest
+		status           arm.ProvisioningState
+		expectedEstimate bool
+	}{
+		{
+			name:             "Create accepted",
+			request:          OperationRequestCreate,
+			status:           arm.ProvisioningStateAccepted,
+			expectedEstimate: true,
+		},
+		{
+			name:             "Create provisioning",
+			request:          OperationRequestCreate,
+			status:           arm.ProvisioningStateProvisioning,
+			expectedEstimate: true,
+		},
+		{
+			name:             "Create succeeded",
+			request:          OperationRequestCreate,
+			status:           arm.ProvisioningStateSucceeded,
+			expectedEstimate: false,
+		},
+		{
+			name:             "Update canceled",
+			request:          OperationRequestUpdate,
+			status:           arm.ProvisioningStateCanceled,
+			expectedEstimate: false,
+		},
+		{
+			name:             "Delete deleting",
+			request:          OperationRequestDelete,
+			status:           arm.ProvisioningStateDeleting,
+			expectedEstimate: true,
+		},
+		{
+			name:             "Delete failed",
+			request:          OperationRequestDelete,
+			status:           arm.ProvisioningStateFailed,
+			expectedEstimate: false,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			doc := NewOperationDocument(test.request, nil, ocm.InternalID{})
+			doc.OperationID = operationID
+			doc.UpdateStatus(test.status, nil)
+
+			status := doc.ToStatus()
+			if test.expectedEstimate {
+				if status.EstimatedCompletionTime == nil {
+					t.Fatal("expected an estimated completion time")
+				}
+				expected := doc.StartTime.Add(typicalOperationDurations[test.request])
+				if !status.EstimatedCompletionTime.Equal(expected) {
+					t.Errorf("expected estimated completion time %s, got %s", expected, status.EstimatedCompletionTime)
+				}
+			} else {
+				if status.EstimatedCompletionTime != nil {
+					t.Errorf("expected no estimated completion time, got %s", status.EstimatedCompletionTime)
+				}
+				if doc.EstimatedCompletionTime != nil {
+					t.Errorf("expected the estimate to be cleared from the document, got %s", doc.EstimatedCompletionTime)
+				}
+			}
+		})
+	}
+}
+
+func TestOperationDocumentRetention(t *testing.T) {
+	policy := OperationRetentionPolicy{
+		arm.ProvisioningStateSucceeded: 24 * time.Hour,
+		arm.ProvisioningStateFailed:    30 * 24 * time.Hour,
+	}
+
+	tests := []struct {
+		name              string
+		status            arm.ProvisioningState
+		expectedRetention time.Duration
+	}{
+		{
+			name:              "Succeeded",
+			status:            arm.ProvisioningStateSucceeded,
+			expectedRetention: 24 * time.Hour,
+		},
+		{
+			name:              "Failed",
+			status:            arm.ProvisioningStateFailed,
+			expectedRetention: 30 * 24 * time.Hour,
+		},
+		{
+			name:              "Canceled uses the default",
+			status:            arm.ProvisioningStateCanceled,
+			expectedRetention: OperationRetention,
+		},
+		{
+			name:              "In progress keeps the container default",
+			status:            arm.ProvisioningStateProvisioning,
+			expectedRetention: OperationRetention,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			doc := NewOperationDocument(OperationRequestCreate, nil, ocm.InternalID{})
+			doc.UpdateStatus(test.status, nil)
+			doc.SetRetention(policy)
+
+			if !test.status.IsTerminal() {
+				if doc.TTL != 0 {
+					t.Errorf("expected no TTL, got %d", doc.TTL)
+				}
+			} else if expectedTTL := int32((test.expectedRetention + OperationTombstoneRetention) / time.Second); doc.TTL != expectedTTL {
+				t.Errorf("expected TTL %d, got %d", expectedTTL, doc.TTL)
+			}
+
+			if doc.Expired(doc.LastTransitionTime.Add(test.expectedRetention - time.Minute)) {
+				t.Error("expected the operation to be retained")
+			}
+			if test.status.IsTerminal() && !doc.Expired(doc.LastTransitionTime.Add(test.expectedRetention+time.Minute)) {
+				t.Error("expected the operation to have expired")
+			}
+		})
+	}
+}
+
+func TestOperationRetentionPolicyValidate(t *testing.T) {
+	tests := []struct {
+		name        string
+		policy      OperationRetentionPolicy
+		expectError bool
+	}{
+		{
+			name:        "Nil policy",
+			policy:      nil,
+			expectError: false,
+		},
+		{
+			name:        "Terminal statuses",
+			policy:      OperationRetentionPolicy{arm.ProvisioningStateSucceeded: time.Hour, arm.ProvisioningStateFailed: 2 * time.Hour},
+			expectError: false,
+		},
+		{
+			name:        "Non-terminal status",
+			policy:      OperationRetentionPolicy{arm.ProvisioningStateProvisioning: time.Hour},
+			expectError: true,
+		},
+		{
+			name:        "Zero retention",
+			policy:      OperationRetentionPolicy{arm.ProvisioningStateFailed: 0},
+			expectError: true,
+		},
+		{
+			name:        "Retention too long for a TTL",
+			policy:      OperationRetentionPolicy{arm.ProvisioningStateFailed: 100 * 365 * 24 * time.Hour},
+			expectError: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := test.policy.Validate()
+			if test.expectError && err == nil {
+				t.Error("expected an error, got nil")
+			} else if !test.expectError && err != nil {
+				t.Errorf("expected no error, got %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,76 @@
+package database
+
+// Copyright (c) Microsoft Corporation.
+// Licensed under the Apache License 2.0.
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// ExportRecord is a single line of a database export, written as
+// newline-delimited JSON. Container names the container the document
+// belongs to and Document holds the document as it was stored.
+type ExportRecord struct {
+	Container string          `json:"container"`
+	Document  json.RawMessage `json:"document"`
+}
+
+// exportContainer writes an ExportRecord for each item yielded by the
+// iterator. Items are written as they are yielded so that the export
+// does not hold an entire container in memory.
+func exportContainer(ctx context.Context, encoder *json.Encoder, container string, iterator DBClientIterator) error {
+	for item := range iterator.Items(ctx) {
+		err := encoder.Encode(ExportRecord{Container: container, Document: item})
+		if err != nil {
+			return fmt.Errorf("failed to export %s container item: %w", container, err)
+		}
+	}
+
+	err := iterator.GetError()
+	if err != nil {
+		return fmt.Errorf("failed to export %s container: %w", container, err)
+	}
+
+	return nil
+}
+
+// importRecords decodes the ExportRecords in r one at a time and passes
+// each to the callback, stopping at the first error.
+func importRecords(r io.Reader, callback func(ExportRecord) error) error {
+	decoder := json.NewDecoder(r)
+
+	for decoder.More() {
+		var record ExportRecord
+
+		err := decoder.Decode(&record)
+		if err != nil {
+			return fmt.Errorf("failed to decode export record: %w", err)
+		}
+
+		err = callback(record)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// unmarshalExportRecord unmarshals the document of an ExportRecord,
+// returning an error that names the container if the document is invalid.
+func unmarshalExportRecord[T any](record ExportRecord) (*T, error) {
+	var doc *T
+
+	err := json.Unmarshal(record.Document, &doc)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal %s container item: %w", record.Container, err)
+	}
+	if doc == nil {
+		return nil, fmt.Errorf("missing %s container item", record.Container)
+	}
+
+	return doc, nil
+}
@@ -0,0 +1,116 @@
+package database
+
+// Copyright (c) Microsoft Corporation.
+// Licensed under the Apache License 2.0.
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Azure/ARO-HCP/internal/api"
+	"github.com/Azure/ARO-HCP/internal/api/arm"
+)
+
+func TestCacheExportImportAll(t *testing.T) {
+	ctx := context.Background()
+
+	source, prefix := newTestCache(t, 3)
+
+	err := source.CreateSubscriptionDoc(ctx, NewSubscriptionDocument(prefix.SubscriptionID, &arm.Subscription{
+		State:            arm.SubscriptionStateRegistered,
+		RegistrationDate: api.Ptr(time.Now().String()),
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	iterator := source.ListResourceDocs(ctx, prefix, -1, nil)
+	for item := range iterator.Items(ctx) {
+		doc, err := unmarshalExportRecord[ResourceDocument](ExportRecord{Container: resourcesContainer, Document: item})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = source.CreateOperationDoc(ctx, NewOperationDocument(OperationRequestCreate, doc.ResourceId, doc.InternalID))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		settingsDoc := NewDiagnosticSettingsDocument(doc.ResourceId)
+		settingsDoc.Settings = map[string]*arm.DiagnosticSetting{"setting": {Resource: arm.Resource{Name: "setting"}}}
+		err = source.CreateDiagnosticSettingsDoc(ctx, settingsDoc)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := iterator.GetError(); err != nil {
+		t.Fatal(err)
+	}
+
+	var exported bytes.Buffer
+	err = source.ExportAll(ctx, &exported)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 1 subscription + 3 clusters with 1 operation and 1 diagnostic settings each.
+	if lines := strings.Count(exported.String(), "\n"); lines != 10 {
+		t.Errorf("expected 10 export records, got %d", lines)
+	}
+
+	target := NewCache()
+
+	// Importing twice must yield the same result as importing once.
+	for range 2 {
+		err = target.ImportAll(ctx, bytes.NewReader(exported.Bytes()))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var reexported bytes.Buffer
+	err = target.ExportAll(ctx, &reexported)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if reexported.String() != exported.String() {
+		t.Errorf("re-exported documents differ from the original export\noriginal:\n%s\nre-exported:\n%s", exported.String(), reexported.String())
+	}
+}
+
+func TestCacheImportAllErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+	}{
+		{
+			name:  "Malformed record",
+			input: `{"container":`,
+		},
+		{
+			name:  "Unknown container",
+			input: `{"container":"Bogus","document":{}}`,
+		},
+		{
+			name:  "Missing document",
+			input: `{"container":"Resources","document":null}`,
+		},
+		{
+			name:  "Missing resource key",
+			input: `{"container":"Resources","document":{"id":"00000000-0000-0000-0000-000000000000"}}`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := NewCache().ImportAll(context.Background(), strings.NewReader(test.input))
+			if err == nil {
+				t.Error("expected an error, got nil")
+			}
+		})
+	}
+}
@@ -144,6 +144,22 @@ func (c *LockClient) TryAcquireLock(ctx context.Context, id string) (*azcosmos.I
 	return &response, nil
 }
 
+// lockRenewalTime returns the UTC time at which a lock should be renewed,
+// which is one second before its TTL expires. The lock document timestamp
+// is in Unix seconds, so the result is independent of the host time zone.
+func lockRenewalTime(doc *lockDocument) time.Time {
+	timeToRenew := time.Unix(int64(doc.Timestamp), 0).UTC()
+	if doc.TTL > 0 {
+		timeToRenew = timeToRenew.Add(time.Duration(doc.TTL-1) * time.Second)
+	}
+	return timeToRenew
+}
+
+// lockRenewalDelay returns how long to wait from now before renewing a lock.
+func lockRenewalDelay(doc *lockDocument, now time.Time) time.Duration {
+	return lockRenewalTime(doc).Sub(now.UTC())
+}
+
 type StopHoldLock func() *azcosmos.ItemResponse
 
 // HoldLock tries to hold an acquired lock by renewing it periodically from a
@@ -172,14 +188,8 @@ func (c *LockClient) HoldLock(ctx context.Context, item *azcosmos.ItemResponse)
 				return
 			}
 
-			// Aim to renew one second before TTL expires.
-			timeToRenew := time.Unix(int64(doc.Timestamp), 0)
-			if doc.TTL > 0 {
-				timeToRenew = timeToRenew.Add(time.Duration(doc.TTL-1) * time.Second)
-			}
-
 			select {
-			case <-time.After(time.Until(timeToRenew)):
+			case <-time.After(lockRenewalDelay(doc, time.Now())):
 				item, err = c.RenewLock(cancelCtx, item)
 				if err != nil {
 					cancelCause(fmt.Errorf("Failed to renew lock: %w", err))
@@ -0,0 +1,78 @@
+package database
+
+// Copyright (c) Microsoft Corporation.
+// Licensed under the Apache License 2.0.
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLockRenewalDelay(t *testing.T) {
+	// Lock acquired at 2024-06-10 23:30:00 UTC, which falls
+	// on a different calendar day in many time zones.
+	acquired := time.Date(2024, time.June, 10, 23, 30, 0, 0, time.UTC)
+
+	tests := []struct {
+		name          string
+		ttl           int32
+		elapsed       time.Duration
+		expectedDelay time.Duration
+	}{
+		{
+			name:          "Freshly acquired lock",
+			ttl:           10,
+			elapsed:       0,
+			expectedDelay: 9 * time.Second,
+		},
+		{
+			name:          "Lock nearing expiry",
+			ttl:           10,
+			elapsed:       8 * time.Second,
+			expectedDelay: time.Second,
+		},
+		{
+			name:          "Lock past renewal time",
+			ttl:           10,
+			elapsed:       12 * time.Second,
+			expectedDelay: -3 * time.Second,
+		},
+		{
+			name:          "Lock without TTL",
+			ttl:           0,
+			elapsed:       0,
+			expectedDelay: 0,
+		},
+	}
+
+	zones := []*time.Location{
+		time.UTC,
+		time.FixedZone("UTC-12", -12*60*60),
+		time.FixedZone("UTC+5:30", 5*60*60+30*60),
+		time.FixedZone("UTC+14", 14*60*60),
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			doc := &lockDocument{
+				BaseDocument: BaseDocument{Timestamp: int(acquired.Unix())},
+				TTL:          test.ttl,
+			}
+
+			for _, zone := range zones {
+				// Simulate a clock reading in the host time zone.
+				now := acquired.Add(test.elapsed).In(zone)
+
+				delay := lockRenewalDelay(doc, now)
+				if delay != test.expectedDelay {
+					t.Errorf("%s: expected delay %s, got %s", zone, test.expectedDelay, delay)
+				}
+
+				renewal := lockRenewalTime(doc)
+				if renewal.Location() != time.UTC {
+					t.Errorf("%s: expected renewal time in UTC, got %s", zone, renewal.Location())
+				}
+			}
+		})
+	}
+}
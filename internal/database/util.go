@@ -5,34 +5,108 @@ package database
 
 import (
 	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
 	"iter"
+	"path"
+	"strings"
 
 	"github.com/Azure/azure-sdk-for-go/sdk/azcore/runtime"
 	"github.com/Azure/azure-sdk-for-go/sdk/data/azcosmos"
+
+	"github.com/Azure/ARO-HCP/internal/api/arm"
 )
 
+// resourceGroupDeletionPageSize is the number of resource documents
+// deleteResourceGroupResources reads from the database at once.
+const resourceGroupDeletionPageSize = 100
+
+// continuationToken is the decoded form of a continuation token returned
+// from a resource list. It records the last key seen, rather than relying
+// on opaque Cosmos DB session state, so a list can be resumed by any client
+// instance, even one started after the token was issued.
+type continuationToken struct {
+	LastKey string `json:"lastKey"`
+}
+
+// EncodeContinuationToken returns an opaque continuation token that resumes
+// a resource list immediately after the given resource key.
+func EncodeContinuationToken(lastKey string) string {
+	// Marshalling a struct with a single string field cannot fail.
+	data, _ := json.Marshal(continuationToken{LastKey: lastKey})
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// DecodeContinuationToken returns the last-seen resource key encoded in a
+// continuation token, or an error if the token is malformed.
+func DecodeContinuationToken(token string) (string, error) {
+	var decoded continuationToken
+
+	data, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return "", err
+	}
+
+	err = json.Unmarshal(data, &decoded)
+	if err != nil {
+		return "", err
+	}
+
+	if decoded.LastKey == "" {
+		return "", errors.New("continuation token is missing last key")
+	}
+
+	return decoded.LastKey, nil
+}
+
+// operationContinuationKey returns the key that a list of operations, most
+// recently started first, resumes after. Operations that started at the same
+// time are told apart by ID.
+func operationContinuationKey(startTime, operationID string) string {
+	return startTime + " " + operationID
+}
+
+// parseOperationContinuationKey splits a key returned by
+// operationContinuationKey into its start time and operation ID.
+func parseOperationContinuationKey(key string) (string, string, bool) {
+	return strings.Cut(key, " ")
+}
+
 type QueryItemsIterator struct {
 	pager             *runtime.Pager[azcosmos.QueryItemsResponse]
 	singlePage        bool
+	continuationKey   func(item map[string]any) string
 	continuationToken string
 	err               error
 }
 
 // NewQueryItemsIterator is a failable push iterator for a paged query response.
-func NewQueryItemsIterator(pager *runtime.Pager[azcosmos.QueryItemsResponse]) QueryItemsIterator {
-	return QueryItemsIterator{pager: pager}
+func NewQueryItemsIterator(pager *runtime.Pager[azcosmos.QueryItemsResponse]) *QueryItemsIterator {
+	return &QueryItemsIterator{pager: pager}
 }
 
 // NewQueryItemsSinglePageIterator is a failable push iterator for a paged
 // query response that stops at the end of the first page and includes a
-// continuation token if additional items are available.
-func NewQueryItemsSinglePageIterator(pager *runtime.Pager[azcosmos.QueryItemsResponse]) QueryItemsIterator {
-	return QueryItemsIterator{pager: pager, singlePage: true}
+// continuation token if additional items are available. The query items
+// must be Resources container items, sorted by key.
+func NewQueryItemsSinglePageIterator(pager *runtime.Pager[azcosmos.QueryItemsResponse]) *QueryItemsIterator {
+	return newSinglePageIterator(pager, func(item map[string]any) string {
+		key, _ := item["key"].(string)
+		return key
+	})
+}
+
+// newSinglePageIterator is like NewQueryItemsSinglePageIterator but builds
+// the continuation token from the key that continuationKey returns for the
+// last query item, which must identify the item's place in the sort order.
+func newSinglePageIterator(pager *runtime.Pager[azcosmos.QueryItemsResponse], continuationKey func(item map[string]any) string) *QueryItemsIterator {
+	return &QueryItemsIterator{pager: pager, singlePage: true, continuationKey: continuationKey}
 }
 
 // Items returns a push iterator that can be used directly in for/range loops.
 // If an error occurs during paging, iteration stops and the error is recorded.
-func (iter QueryItemsIterator) Items(ctx context.Context) iter.Seq[[]byte] {
+func (iter *QueryItemsIterator) Items(ctx context.Context) iter.Seq[[]byte] {
 	return func(yield func([]byte) bool) {
 		for iter.pager.More() {
 			response, err := iter.pager.NextPage(ctx)
@@ -40,10 +114,16 @@ func (iter QueryItemsIterator) Items(ctx context.Context) iter.Seq[[]byte] {
 				iter.err = err
 				return
 			}
-			if iter.singlePage && response.ContinuationToken != nil {
-				iter.continuationToken = *response.ContinuationToken
-			}
 			for _, item := range response.Items {
+				if iter.singlePage && response.ContinuationToken != nil {
+					var doc map[string]any
+					err = json.Unmarshal(item, &doc)
+					if err != nil {
+						iter.err = err
+						return
+					}
+					iter.continuationToken = EncodeContinuationToken(iter.continuationKey(doc))
+				}
 				if !yield(item) {
 					return
 				}
@@ -58,12 +138,63 @@ func (iter QueryItemsIterator) Items(ctx context.Context) iter.Seq[[]byte] {
 // GetContinuationToken returns a continuation token that can be used to obtain
 // the next page of results. This is only set when the iterator was created with
 // NewQueryItemsSinglePageIterator and additional items are available.
-func (iter QueryItemsIterator) GetContinuationToken() string {
+func (iter *QueryItemsIterator) GetContinuationToken() string {
 	return iter.continuationToken
 }
 
 // GetError returns any error that occurred during iteration. Call this after the
 // for/range loop that calls Items() to check if iteration completed successfully.
-func (iter QueryItemsIterator) GetError() error {
+func (iter *QueryItemsIterator) GetError() error {
 	return iter.err
 }
+
+// deleteResourceGroupResources implements DBClient.DeleteResourceGroupResources
+// in terms of other DBClient methods. Each page of resource documents is read
+// in full before any are deleted so that deletions do not disturb the query.
+func deleteResourceGroupResources(ctx context.Context, client DBClient, subscriptionID, resourceGroup string) (int, error) {
+	prefix, err := arm.ParseResourceID(path.Join("/",
+		"subscriptions", subscriptionID,
+		"resourceGroups", resourceGroup))
+	if err != nil {
+		return 0, err
+	}
+
+	var deleted int
+	var continuationToken *string
+
+	for {
+		var resourceIDs []*arm.ResourceID
+
+		iterator := client.ListResourceDocs(ctx, prefix, resourceGroupDeletionPageSize, continuationToken)
+		for item := range iterator.Items(ctx) {
+			var doc ResourceDocument
+			err = json.Unmarshal(item, &doc)
+			if err != nil {
+				return deleted, err
+			}
+			resourceIDs = append(resourceIDs, doc.ResourceId)
+		}
+		err = iterator.GetError()
+		if err != nil {
+			return deleted, err
+		}
+
+		for _, resourceID := range resourceIDs {
+			err = client.DeleteResourceDoc(ctx, resourceID)
+			if err != nil {
+				return deleted, err
+			}
+			err = client.DeleteDiagnosticSettingsDoc(ctx, resourceID)
+			if err != nil {
+				return deleted, err
+			}
+			deleted++
+		}
+
+		token := iterator.GetContinuationToken()
+		if token == "" {
+			return deleted, nil
+		}
+		continuationToken = &token
+	}
+}
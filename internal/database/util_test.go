@@ -0,0 +1,59 @@
+package database
+
+// Copyright (c) Microsoft Corporation.
+// Licensed under the Apache License 2.0.
+
+import (
+	"encoding/base64"
+	"testing"
+)
+
+func TestContinuationToken(t *testing.T) {
+	const lastKey = "/subscriptions/00000000-0000-0000-0000-000000000000/resourceGroups/myRG/providers/Microsoft.RedHatOpenShift/hcpOpenShiftClusters/myCluster"
+
+	key, err := DecodeContinuationToken(EncodeContinuationToken(lastKey))
+	if err != nil {
+		t.Fatalf("unexpected error decoding token: %v", err)
+	}
+	if key != lastKey {
+		t.Errorf("expected last key %q, got %q", lastKey, key)
+	}
+}
+
+func TestDecodeContinuationTokenInvalid(t *testing.T) {
+	tests := []struct {
+		name  string
+		token string
+	}{
+		{
+			name:  "empty",
+			token: "",
+		},
+		{
+			name:  "not base64",
+			token: "not a token!",
+		},
+		{
+			name:  "not JSON",
+			token: base64.RawURLEncoding.EncodeToString([]byte("garbage")),
+		},
+		{
+			name:  "missing last key",
+			token: base64.RawURLEncoding.EncodeToString([]byte(`{"lastKey":""}`)),
+		},
+		{
+			// Opaque Cosmos DB session tokens look nothing like ours.
+			name:  "cosmos session token",
+			token: `{"token":"+RID:~abc#RT:1#TRC:20#ISV:2#IEO:65567","range":{"min":"","max":"FF"}}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := DecodeContinuationToken(tt.token)
+			if err == nil {
+				t.Errorf("expected error decoding token %q", tt.token)
+			}
+		})
+	}
+}
@@ -6,6 +6,8 @@ package ocm
 import (
 	"context"
 	"fmt"
+	"net/http"
+	"strings"
 
 	sdk "github.com/openshift-online/ocm-sdk-go"
 	cmv1 "github.com/openshift-online/ocm-sdk-go/clustersmgmt/v1"
@@ -25,6 +27,7 @@ func mockNotFoundError(internalID InternalID) error {
 	// ErrorBuilder.Build() never returns an error.
 	body, _ := errors.NewError().
 		ID("404").
+		Status(http.StatusNotFound).
 		Reason(reason).
 		Build()
 	return body
@@ -57,13 +60,13 @@ func (mcsc *MockClusterServiceClient) GetCSCluster(ctx context.Context, internal
 
 func (mcsc *MockClusterServiceClient) PostCSCluster(ctx context.Context, cluster *cmv1.Cluster) (*cmv1.Cluster, error) {
 	href := GenerateClusterHREF(cluster.Name())
-	// Adding the HREF to correspond with what the full client does when crating the body
-	clusterBuilder := cmv1.NewCluster()
-	enrichedCluster, err := clusterBuilder.Copy(cluster).HREF(href).Build()
+	internalID, err := NewInternalID(href)
 	if err != nil {
 		return nil, err
 	}
-	internalID, err := NewInternalID(href)
+	// Adding the ID and HREF to correspond with what the full client does when crating the body
+	clusterBuilder := cmv1.NewCluster()
+	enrichedCluster, err := clusterBuilder.Copy(cluster).ID(internalID.ID()).HREF(href).Build()
 	if err != nil {
 		return nil, err
 	}
@@ -91,8 +94,13 @@ func (mcsc *MockClusterServiceClient) DeleteCSCluster(ctx context.Context, inter
 	return nil
 }
 
+// ListCSClusters ignores the search expression and returns all clusters.
 func (mcsc *MockClusterServiceClient) ListCSClusters(searchExpression string) ClusterListIterator {
-	return ClusterListIterator{err: fmt.Errorf("ListCSClusters not implemented")}
+	var iterator ClusterListIterator
+	for _, cluster := range mcsc.clusters {
+		iterator.items = append(iterator.items, cluster)
+	}
+	return iterator
 }
 
 func (mcsc *MockClusterServiceClient) GetCSNodePool(ctx context.Context, internalID InternalID) (*cmv1.NodePool, error) {
@@ -138,6 +146,15 @@ func (mcsc *MockClusterServiceClient) DeleteCSNodePool(ctx context.Context, inte
 	return nil
 }
 
+// ListCSNodePools ignores the search expression and returns all node pools
+// belonging to the given cluster.
 func (mcsc *MockClusterServiceClient) ListCSNodePools(clusterInternalID InternalID, searchExpression string) NodePoolListIterator {
-	return NodePoolListIterator{err: fmt.Errorf("ListCSClusters not implemented")}
+	var iterator NodePoolListIterator
+	prefix := GenerateNodePoolHREF(clusterInternalID.path, "")
+	for internalID, nodePool := range mcsc.nodePools {
+		if strings.HasPrefix(internalID.path, prefix) {
+			iterator.items = append(iterator.items, nodePool)
+		}
+	}
+	return iterator
 }